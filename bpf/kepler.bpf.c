@@ -12,21 +12,65 @@ int kepler_sched_switch_trace(u64 *ctx)
 	next_task = (struct task_struct *)ctx[2];
 
 	return do_kepler_sched_switch_trace(
-		prev_task->pid, next_task->pid, prev_task->tgid, next_task->tgid);
+		prev_task->pid, next_task->pid, prev_task->tgid, next_task->tgid,
+		prev_task->flags);
+}
+
+SEC("tp_btf/sched_process_fork")
+int kepler_sched_process_fork(u64 *ctx)
+{
+	struct task_struct *child;
+
+	child = (struct task_struct *)ctx[1];
+
+	do_kepler_process_fork(child->pid, child->tgid);
+	return 0;
+}
+
+SEC("tp_btf/sched_process_exit")
+int kepler_sched_process_exit(u64 *ctx)
+{
+	struct task_struct *task;
+
+	task = (struct task_struct *)ctx[0];
+
+	do_kepler_process_exit(task->pid, task->tgid);
+	return 0;
 }
 
 SEC("tp_btf/softirq_entry")
 int kepler_irq_trace(u64 *ctx)
 {
 	u32 curr_tgid;
-	struct process_metrics_t *process_metrics;
 	unsigned int vec;
 
 	curr_tgid = bpf_get_current_pid_tgid() >> 32;
 	vec = (unsigned int)ctx[0];
-	process_metrics = bpf_map_lookup_elem(&processes, &curr_tgid);
-	if (process_metrics != 0 && vec < 10)
-		process_metrics->vec_nr[vec] += 1;
+	do_softirq_entry();
+	do_irq_increment(curr_tgid, vec);
+	return 0;
+}
+
+SEC("tp_btf/softirq_exit")
+int kepler_softirq_exit(u64 *ctx)
+{
+	do_softirq_exit((unsigned int)ctx[0]);
+	return 0;
+}
+
+// the hardirqs of the devices, the interrupts of the local timers and the
+// inter-processor interrupts are not traced
+SEC("tp_btf/irq_handler_entry")
+int kepler_hardirq_entry(u64 *ctx)
+{
+	do_hardirq_entry();
+	return 0;
+}
+
+SEC("tp_btf/irq_handler_exit")
+int kepler_hardirq_exit(u64 *ctx)
+{
+	do_hardirq_exit();
 	return 0;
 }
 
@@ -52,4 +96,85 @@ int kepler_write_page_trace(void *ctx)
 	return 0;
 }
 
+// count the bytes sent by the sockets of the process, the tracepoint is hit in
+// the context of the sending task
+SEC("tp_btf/sock_send_length")
+int kepler_sock_send_trace(u64 *ctx)
+{
+	int ret;
+	u32 curr_tgid;
+	u64 cgroup_id;
+
+	ret = (int)ctx[1];
+	curr_tgid = bpf_get_current_pid_tgid() >> 32;
+	cgroup_id = bpf_get_current_cgroup_id();
+	set_sock_owner(ctx[0], curr_tgid, cgroup_id);
+	if (ret > 0)
+		do_net_increment(curr_tgid, cgroup_id, 1, ret, 0);
+	return 0;
+}
+
+// count the bytes received by the sockets of the process, peeking does not
+// consume the data and is not counted
+SEC("tp_btf/sock_recv_length")
+int kepler_sock_recv_trace(u64 *ctx)
+{
+	int ret, flags;
+	u32 curr_tgid;
+	u64 cgroup_id;
+
+	ret = (int)ctx[1];
+	flags = (int)ctx[2];
+	curr_tgid = bpf_get_current_pid_tgid() >> 32;
+	cgroup_id = bpf_get_current_cgroup_id();
+	set_sock_owner(ctx[0], curr_tgid, cgroup_id);
+	if (ret > 0 && !(flags & MSG_PEEK))
+		do_net_increment(curr_tgid, cgroup_id, 0, ret, 0);
+	return 0;
+}
+
+// count the packets transmitted by the sockets to their owner. The packets are
+// sent once from the local IP output, in the network namespace of the socket,
+// and forwarded without it by the virtual devices. The retransmissions and
+// acknowledgments sent from the softirq are counted to the owner too.
+SEC("fentry/__ip_local_out")
+int kepler_ip_local_out(u64 *ctx)
+{
+	count_sock_packets(ctx[1], skb_packets((struct sk_buff *)ctx[2]));
+	return 0;
+}
+
+SEC("fentry/ip6_local_out")
+int kepler_ip6_local_out(u64 *ctx)
+{
+	count_sock_packets(ctx[1], skb_packets((struct sk_buff *)ctx[2]));
+	return 0;
+}
+
+// count the packets received when they are copied to the receiving task, the
+// softirq handling the packets runs in the context of any task
+SEC("tp_btf/skb_copy_datagram_iovec")
+int kepler_net_recv_trace(u64 *ctx)
+{
+	do_net_increment(
+		bpf_get_current_pid_tgid() >> 32, bpf_get_current_cgroup_id(), 0, 0,
+		1);
+	return 0;
+}
+
+// count the block I/O completed for each cgroup, a request can complete in
+// several parts
+SEC("tp_btf/block_rq_complete")
+int kepler_block_rq_complete(u64 *ctx)
+{
+	struct request *rq;
+	unsigned int nr_bytes;
+
+	rq = (struct request *)ctx[0];
+	nr_bytes = (unsigned int)ctx[2];
+
+	do_block_io_increment(rq, nr_bytes);
+	return 0;
+}
+
 char __license[] SEC("license") = "Dual BSD/GPL";
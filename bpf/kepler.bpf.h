@@ -35,6 +35,19 @@ typedef struct pid_time_t {
 # define MAP_SIZE 32768
 #endif
 
+#ifndef MAX_SOCKETS
+# define MAX_SOCKETS 4
+#endif
+
+#ifndef MAX_HW_COUNTERS
+# define MAX_HW_COUNTERS 8
+#endif
+
+// softirq vectors, per the softirq_entry tracepoint
+#define NUM_SOFTIRQS 10
+// index of the hardirqs in the irq_times map, after the softirq vectors
+#define HARDIRQ NUM_SOFTIRQS
+
 #include <bpf/bpf_helpers.h>
 #include <bpf/bpf_core_read.h>
 
@@ -90,18 +103,50 @@ struct bpf_perf_event_value {
 	__u64 running;
 };
 
+// CPU time and hardware counters of a process on the CPUs of one socket, or
+// of the task switched out of a CPU since it was switched in
+typedef struct run_metrics_t {
+	u64 process_run_time;
+	u64 hw_counters[MAX_HW_COUNTERS];
+} run_metrics_t;
+
 typedef struct process_metrics_t {
 	u64 cgroup_id;
 	u64 pid; // pid is the kernel space view of the thread id
 	u64 process_run_time;
-	u64 cpu_cycles;
-	u64 cpu_instr;
-	u64 cache_miss;
+	// the hardware counters, in the order they are configured in user space
+	u64 hw_counters[MAX_HW_COUNTERS];
 	u64 page_cache_hit;
-	u16 vec_nr[10];
+	// bytes and packets sent and received by the process
+	u64 net_tx_bytes;
+	u64 net_rx_bytes;
+	u64 net_tx_packets;
+	u64 net_rx_packets;
+	u16 vec_nr[NUM_SOFTIRQS];
 	char comm[16];
 } process_metrics_t;
 
+// key of the CPU time and counters of a process or cgroup on the CPUs of a
+// socket
+typedef struct socket_key_t {
+	u64 id; // tgid of the process or id of the cgroup
+	u64 socket;
+} socket_key_t;
+
+// process and cgroup the packets transmitted from a socket are counted to
+typedef struct sock_owner_t {
+	u64 tgid;
+	u64 cgroup_id;
+} sock_owner_t;
+
+// block I/O of a cgroup
+typedef struct block_io_metrics_t {
+	u64 read_bytes;
+	u64 write_bytes;
+	u64 read_ops;
+	u64 write_ops;
+} block_io_metrics_t;
+
 struct {
 	__uint(type, BPF_MAP_TYPE_LRU_HASH);
 	__type(key, u32);
@@ -109,6 +154,15 @@ struct {
 	__uint(max_entries, MAP_SIZE);
 } processes SEC(".maps");
 
+// counters of the processes that exited since the last read, aggregated per
+// cgroup so that short-lived processes are still attributed to their container
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__type(key, u64);
+	__type(value, process_metrics_t);
+	__uint(max_entries, MAP_SIZE);
+} exited_cgroups SEC(".maps");
+
 struct {
 	__uint(type, BPF_MAP_TYPE_LRU_HASH);
 	__type(key, u32);
@@ -116,47 +170,157 @@ struct {
 	__uint(max_entries, MAP_SIZE);
 } pid_time_map SEC(".maps");
 
+// counters of the cgroups since the last read, when they are aggregated in the
+// kernel. Unlike the processes map, it is not an LRU: the counters of a busy
+// cgroup are never evicted by the processes of other cgroups.
 struct {
-	__uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
-	__type(key, int);
-	__type(value, u32);
-	__uint(max_entries, NUM_CPUS);
-} cpu_cycles_event_reader SEC(".maps");
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__type(key, u64);
+	__type(value, process_metrics_t);
+	__uint(max_entries, MAP_SIZE);
+} cgroups SEC(".maps");
 
+// block I/O completed since the last read, per cgroup the I/O was issued for.
+// The writeback is issued by kernel threads, so the I/O cannot be attributed
+// to the task running when it is issued or completed.
 struct {
-	__uint(type, BPF_MAP_TYPE_ARRAY);
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__type(key, u64);
+	__type(value, block_io_metrics_t);
+	__uint(max_entries, MAP_SIZE);
+} cgroup_block_io SEC(".maps");
+
+// the CPU time and counters of the processes, the cgroups and the processes
+// exited from the cgroups, split by the socket of the CPU they ran on. They are
+// kept apart from the processes and cgroups maps so that the entries of the
+// nodes with a single socket, which are not split, stay small. The processes
+// and cgroups only have entries for the sockets they ran on.
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__type(key, socket_key_t);
+	__type(value, run_metrics_t);
+	__uint(max_entries, MAP_SIZE);
+} process_sockets SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__type(key, socket_key_t);
+	__type(value, run_metrics_t);
+	__uint(max_entries, MAP_SIZE);
+} cgroup_sockets SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__type(key, socket_key_t);
+	__type(value, run_metrics_t);
+	__uint(max_entries, MAP_SIZE);
+} exited_cgroup_sockets SEC(".maps");
+
+// owner of the sockets, keyed by the address of the socket. The packets are
+// transmitted from the softirq as well as from the sending process, so they
+// are counted to the last process that sent or received on their socket. An
+// address reused by a new socket keeps the owner of the closed socket until a
+// process sends or receives on it.
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__type(key, u64);
+	__type(value, sock_owner_t);
+	__uint(max_entries, MAP_SIZE);
+} sock_owners SEC(".maps");
+
+// events losing counters of the maps, read by the user space to report the
+// loss. The evictions of the processes map are derived from its inserts and
+// deletes, the entries not deleted nor read by the user space were evicted.
+enum map_stat {
+	PROCESSES_INSERTS = 0,
+	PROCESSES_DELETES,
+	PROCESSES_INSERT_ERRORS,
+	// tasks switched out without a start time, their CPU time is lost
+	PID_TIME_MISSES,
+	PID_TIME_INSERT_ERRORS,
+	CGROUPS_INSERT_ERRORS,
+	EXITED_CGROUPS_INSERT_ERRORS,
+	CGROUP_BLOCK_IO_INSERT_ERRORS,
+	PROCESS_SOCKETS_INSERT_ERRORS,
+	CGROUP_SOCKETS_INSERT_ERRORS,
+	EXITED_CGROUP_SOCKETS_INSERT_ERRORS,
+	NUM_MAP_STATS,
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
 	__type(key, u32);
 	__type(value, u64);
-	__uint(max_entries, NUM_CPUS);
-} cpu_cycles SEC(".maps");
+	__uint(max_entries, NUM_MAP_STATS);
+} map_stats SEC(".maps");
+
+// time in ns spent handling the interrupts on a CPU and their number, per
+// softirq vector and for the hardirqs
+typedef struct irq_metrics_t {
+	u64 time;
+	u64 count;
+} irq_metrics_t;
 
 struct {
-	__uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
-	__type(key, int);
-	__type(value, u32);
-	__uint(max_entries, NUM_CPUS);
-} cpu_instructions_event_reader SEC(".maps");
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__type(key, u32);
+	__type(value, irq_metrics_t);
+	__uint(max_entries, NUM_SOFTIRQS + 1);
+} irq_times SEC(".maps");
+
+// interrupts being handled on a CPU. A softirq does not interrupt another
+// softirq, and a hardirq does not interrupt another hardirq.
+typedef struct irq_state_t {
+	// entry time of the softirq and of the hardirq being handled, or 0
+	u64 softirq_start;
+	u64 hardirq_start;
+	// time spent handling the interrupts since the task on the CPU was
+	// switched in
+	u64 task_irq_time;
+} irq_state_t;
 
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__type(key, u32);
+	__type(value, irq_state_t);
+	__uint(max_entries, 1);
+} irq_state SEC(".maps");
+
+// socket of each CPU, filled by the user space on the nodes with several
+// sockets. The CPUs of a socket id out of MAX_SOCKETS are not accounted per
+// socket.
 struct {
 	__uint(type, BPF_MAP_TYPE_ARRAY);
 	__type(key, u32);
-	__type(value, u64);
+	__type(value, u32);
 	__uint(max_entries, NUM_CPUS);
-} cpu_instructions SEC(".maps");
+} cpu_sockets SEC(".maps");
 
-struct {
+// perf events of one hardware counter, indexed by CPU
+struct hw_counter_event_reader {
 	__uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
 	__type(key, int);
 	__type(value, u32);
 	__uint(max_entries, NUM_CPUS);
-} cache_miss_event_reader SEC(".maps");
+};
 
+// perf events of the hardware counters, indexed by counter. A perf event array
+// cannot have more entries than CPUs, so each counter has its own.
+struct {
+	__uint(type, BPF_MAP_TYPE_ARRAY_OF_MAPS);
+	__type(key, u32);
+	__uint(max_entries, MAX_HW_COUNTERS);
+	__array(values, struct hw_counter_event_reader);
+} hw_counters_event_reader SEC(".maps");
+
+// last value read of the hardware counters, the value of the counter i on a
+// CPU is at cpu * MAX_HW_COUNTERS + i
 struct {
 	__uint(type, BPF_MAP_TYPE_ARRAY);
 	__type(key, u32);
 	__type(value, u64);
-	__uint(max_entries, NUM_CPUS);
-} cache_miss SEC(".maps");
+	__uint(max_entries, NUM_CPUS * MAX_HW_COUNTERS);
+} hw_counters SEC(".maps");
 
 // Test mode skips unsupported helpers
 SEC(".rodata.config")
@@ -167,6 +331,36 @@ SEC(".rodata.config")
 __attribute__((btf_decl_tag(
 	"Hardware Events Enabled"))) static volatile const int HW = 1;
 
+// Number of hardware counters configured in user space
+SEC(".rodata.config")
+__attribute__((btf_decl_tag(
+	"Hardware Counters"))) static volatile const int NUM_HW_COUNTERS = 0;
+
+// Number of sockets of the node, the counters are only split per socket if
+// there are several
+SEC(".rodata.config")
+__attribute__((
+	btf_decl_tag("Sockets"))) static volatile const int NUM_SOCKETS = 0;
+
+// Aggregate the counters of the tasks per cgroup in the cgroups map
+SEC(".rodata.config")
+__attribute__((btf_decl_tag(
+	"Cgroup Aggregation"))) static volatile const int CGROUP_AGGREGATION = 0;
+
+// Keep the counters per process in the processes map, which is not needed when
+// only the cgroups are accounted
+SEC(".rodata.config")
+__attribute__((btf_decl_tag(
+	"Process Metrics"))) static volatile const int PROCESS_METRICS = 1;
+
+// Charge the interrupts to the task they interrupted. Otherwise their time is
+// not counted as running time of the task and the user space attributes it to
+// the kernel or to the owners of the sockets and requests.
+#define IRQ_ATTRIBUTION_TASK 0
+SEC(".rodata.config")
+__attribute__((btf_decl_tag(
+	"IRQ Attribution"))) static volatile const int IRQ_ATTRIBUTION = 0;
+
 // The sampling rate should be disabled by default because its impact on the
 // measurements is unknown.
 SEC(".rodata.config")
@@ -175,11 +369,95 @@ __attribute__((
 
 int counter_sched_switch = 0;
 
+// initial value of the map entries, the metrics are too large for the stack
+static const process_metrics_t empty_metrics = {};
+static const run_metrics_t empty_run_metrics = {};
+
 struct task_struct {
 	int pid;
 	unsigned int tgid;
+	unsigned int flags;
+} __attribute__((preserve_access_index));
+
+#define PF_EXITING 0x00000004
+
+struct kernfs_node {
+	u64 id;
 } __attribute__((preserve_access_index));
 
+struct cgroup {
+	struct kernfs_node *kn;
+} __attribute__((preserve_access_index));
+
+struct cgroup_subsys_state {
+	struct cgroup *cgroup;
+} __attribute__((preserve_access_index));
+
+struct blkcg {
+	struct cgroup_subsys_state css;
+} __attribute__((preserve_access_index));
+
+struct blkcg_gq {
+	struct blkcg *blkcg;
+} __attribute__((preserve_access_index));
+
+struct bio {
+	struct blkcg_gq *bi_blkg;
+} __attribute__((preserve_access_index));
+
+struct request {
+	unsigned int cmd_flags;
+	struct bio *bio;
+} __attribute__((preserve_access_index));
+
+struct sk_buff {
+	unsigned char *head;
+	// an offset from head on the 64-bit architectures
+	unsigned int end;
+} __attribute__((preserve_access_index));
+
+struct skb_shared_info {
+	unsigned short gso_segs;
+} __attribute__((preserve_access_index));
+
+#define REQ_OP_MASK 0xff
+#define REQ_OP_READ 0
+#define REQ_OP_WRITE 1
+
+// cgroup id of the root cgroup, which the I/O not issued for a cgroup is
+// accounted to
+#define ROOT_CGROUP_ID 1
+
+#define MSG_PEEK 2
+
+#define EEXIST 17
+
+static __always_inline void *
+bpf_map_lookup_or_try_init(void *map, const void *key, const void *init)
+{
+	void *val;
+	int err;
+
+	val = bpf_map_lookup_elem(map, key);
+	if (val)
+		return val;
+
+	err = bpf_map_update_elem(map, key, init, BPF_NOEXIST);
+	if (err && err != -EEXIST)
+		return 0;
+
+	return bpf_map_lookup_elem(map, key);
+}
+
+static inline void count_map_stat(u32 stat)
+{
+	u64 *count;
+
+	count = bpf_map_lookup_elem(&map_stats, &stat);
+	if (count)
+		*count += 1;
+}
+
 static inline u64 calc_delta(u64 *prev_val, u64 val)
 {
 	u64 delta = 0;
@@ -191,7 +469,11 @@ static inline u64 calc_delta(u64 *prev_val, u64 val)
 	return delta;
 }
 
-static inline u64 get_on_cpu_elapsed_time_us(u32 prev_pid, u64 curr_ts)
+// get_on_cpu_elapsed_time_us returns the time the task ran since it was
+// switched in. A missing start time is counted if it is unexpected, i.e. it was
+// evicted or could not be inserted.
+static inline u64
+get_on_cpu_elapsed_time_us(u32 prev_pid, u64 curr_ts, int count_miss)
 {
 	u64 cpu_time = 0;
 	u64 *prev_ts;
@@ -200,120 +482,406 @@ static inline u64 get_on_cpu_elapsed_time_us(u32 prev_pid, u64 curr_ts)
 	if (prev_ts) {
 		cpu_time = calc_delta(prev_ts, curr_ts) / 1000;
 		bpf_map_delete_elem(&pid_time_map, &prev_pid);
+	} else if (count_miss) {
+		count_map_stat(PID_TIME_MISSES);
 	}
 
 	return cpu_time;
 }
 
-static inline u64 get_on_cpu_cycles(u32 *cpu_id)
+static inline void set_on_cpu_start_time(u32 next_pid, u64 curr_ts)
 {
-	u64 delta, val, *prev_val;
-	long error;
-	struct bpf_perf_event_value c = {};
-
-	error = bpf_perf_event_read_value(
-		&cpu_cycles_event_reader, *cpu_id, &c, sizeof(c));
-	if (error)
-		return 0;
-
-	val = c.counter;
-	prev_val = bpf_map_lookup_elem(&cpu_cycles, cpu_id);
-	delta = calc_delta(prev_val, val);
-	bpf_map_update_elem(&cpu_cycles, cpu_id, &val, BPF_ANY);
-
-	return delta;
+	if (bpf_map_update_elem(&pid_time_map, &next_pid, &curr_ts, BPF_ANY))
+		count_map_stat(PID_TIME_INSERT_ERRORS);
 }
 
-static inline u64 get_on_cpu_instr(u32 *cpu_id)
+static inline u64 get_on_cpu_hw_counter(u32 cpu_id, u32 counter)
 {
 	u64 delta, val, *prev_val;
 	long error;
+	u32 idx = cpu_id * MAX_HW_COUNTERS + counter;
 	struct bpf_perf_event_value c = {};
+	void *event_reader;
 
-	error = bpf_perf_event_read_value(
-		&cpu_instructions_event_reader, *cpu_id, &c, sizeof(c));
+	event_reader = bpf_map_lookup_elem(&hw_counters_event_reader, &counter);
+	if (!event_reader)
+		return 0;
+	error = bpf_perf_event_read_value(event_reader, cpu_id, &c, sizeof(c));
 	if (error)
 		return 0;
 
 	val = c.counter;
-	prev_val = bpf_map_lookup_elem(&cpu_instructions, cpu_id);
+	prev_val = bpf_map_lookup_elem(&hw_counters, &idx);
 	delta = calc_delta(prev_val, val);
-	bpf_map_update_elem(&cpu_instructions, cpu_id, &val, BPF_ANY);
+	bpf_map_update_elem(&hw_counters, &idx, &val, BPF_ANY);
 
 	return delta;
 }
 
-static inline u64 get_on_cpu_cache_miss(u32 *cpu_id)
+// insert_process inserts the empty entry of a process, it returns 0 if the
+// entry was not inserted
+static inline int insert_process(u32 tgid)
 {
-	u64 delta, val, *prev_val;
-	long error;
-	struct bpf_perf_event_value c = {};
+	long err;
 
-	error = bpf_perf_event_read_value(
-		&cache_miss_event_reader, *cpu_id, &c, sizeof(c));
-	if (error)
+	err = bpf_map_update_elem(
+		&processes, &tgid, &empty_metrics, BPF_NOEXIST);
+	if (err) {
+		// the entry of the process was inserted concurrently
+		if (err != -EEXIST)
+			count_map_stat(PROCESSES_INSERT_ERRORS);
 		return 0;
-	val = c.counter;
-	prev_val = bpf_map_lookup_elem(&cache_miss, cpu_id);
-	delta = calc_delta(prev_val, val);
-	bpf_map_update_elem(&cache_miss, cpu_id, &val, BPF_ANY);
-
-	return delta;
+	}
+	count_map_stat(PROCESSES_INSERTS);
+	return 1;
 }
 
 static inline void register_new_process_if_not_exist(u32 tgid)
 {
-	u64 cgroup_id;
 	struct process_metrics_t *curr_tgid_metrics;
 
+	if (!PROCESS_METRICS)
+		return;
+
 	// create new process metrics
 	curr_tgid_metrics = bpf_map_lookup_elem(&processes, &tgid);
-	if (!curr_tgid_metrics) {
-		cgroup_id = bpf_get_current_cgroup_id();
-		// the Kernel tgid is the user-space PID, and the Kernel pid is the
-		// user-space TID
-		process_metrics_t new_process = {
-			.pid = tgid,
-			.cgroup_id = cgroup_id,
-		};
-
-		if (!TEST)
-			bpf_get_current_comm(
-				&new_process.comm, sizeof(new_process.comm));
-
-		bpf_map_update_elem(&processes, &tgid, &new_process, BPF_NOEXIST);
+	if (curr_tgid_metrics)
+		return;
+	if (!insert_process(tgid))
+		return;
+	curr_tgid_metrics = bpf_map_lookup_elem(&processes, &tgid);
+	if (!curr_tgid_metrics)
+		return;
+	// the Kernel tgid is the user-space PID, and the Kernel pid is the
+	// user-space TID
+	curr_tgid_metrics->pid = tgid;
+	curr_tgid_metrics->cgroup_id = bpf_get_current_cgroup_id();
+	if (!TEST)
+		bpf_get_current_comm(
+			&curr_tgid_metrics->comm,
+			sizeof(curr_tgid_metrics->comm));
+}
+
+// lookup_cgroup_metrics_of returns the counters of the cgroup, or 0 if the
+// counters are not aggregated per cgroup
+static inline struct process_metrics_t *lookup_cgroup_metrics_of(u64 cgroup_id)
+{
+	struct process_metrics_t *cgroup_metrics;
+
+	if (!CGROUP_AGGREGATION)
+		return 0;
+
+	cgroup_metrics = bpf_map_lookup_or_try_init(
+		&cgroups, &cgroup_id, &empty_metrics);
+	if (!cgroup_metrics) {
+		count_map_stat(CGROUPS_INSERT_ERRORS);
+		return 0;
 	}
+	cgroup_metrics->cgroup_id = cgroup_id;
+	return cgroup_metrics;
+}
+
+// lookup_cgroup_metrics returns the counters of the cgroup of the current task,
+// or 0 if the counters are not aggregated per cgroup
+static inline struct process_metrics_t *lookup_cgroup_metrics(void)
+{
+	if (!CGROUP_AGGREGATION)
+		return 0;
+	return lookup_cgroup_metrics_of(bpf_get_current_cgroup_id());
+}
+
+// take_task_irq_time returns the time in us spent handling the interrupts since
+// the task on the CPU was switched in, and resets it for the next task
+static inline u64 take_task_irq_time(void)
+{
+	u32 key = 0;
+	u64 irq_time;
+	struct irq_state_t *state;
+
+	state = bpf_map_lookup_elem(&irq_state, &key);
+	if (!state)
+		return 0;
+	irq_time = state->task_irq_time;
+	state->task_irq_time = 0;
+	return irq_time / 1000;
 }
 
 static inline void collect_metrics_and_reset_counters(
-	struct process_metrics_t *buf, u32 prev_pid, u64 curr_ts, u32 cpu_id)
+	struct run_metrics_t *buf, u32 prev_pid, u64 curr_ts, u32 cpu_id,
+	int count_miss)
 {
+	int i;
+	u64 irq_time;
+
 	if (HW) {
-		buf->cpu_cycles = get_on_cpu_cycles(&cpu_id);
-		buf->cpu_instr = get_on_cpu_instr(&cpu_id);
-		buf->cache_miss = get_on_cpu_cache_miss(&cpu_id);
+		for (i = 0; i < MAX_HW_COUNTERS && i < NUM_HW_COUNTERS; i++)
+			buf->hw_counters[i] = get_on_cpu_hw_counter(cpu_id, i);
 	}
 	// Get current time to calculate the previous task on-CPU time
-	buf->process_run_time = get_on_cpu_elapsed_time_us(prev_pid, curr_ts);
+	buf->process_run_time =
+		get_on_cpu_elapsed_time_us(prev_pid, curr_ts, count_miss);
+
+	// the interrupts are not charged to the task they interrupted
+	irq_time = take_task_irq_time();
+	if (IRQ_ATTRIBUTION == IRQ_ATTRIBUTION_TASK)
+		return;
+	if (buf->process_run_time > irq_time)
+		buf->process_run_time -= irq_time;
+	else
+		buf->process_run_time = 0;
+}
+
+// lookup_socket_metrics returns the counters of the process or cgroup id on
+// the socket of the CPU in the map, or 0 if the CPU is not accounted per socket
+static inline struct run_metrics_t *
+lookup_socket_metrics(void *map, u64 id, u32 cpu_id, u32 insert_error_stat)
+{
+	u32 *socket;
+	struct socket_key_t key = {};
+	struct run_metrics_t *socket_metrics;
+
+	if (NUM_SOCKETS < 2)
+		return 0;
+	socket = bpf_map_lookup_elem(&cpu_sockets, &cpu_id);
+	if (!socket || *socket >= MAX_SOCKETS)
+		return 0;
+	key.id = id;
+	key.socket = *socket;
+	socket_metrics =
+		bpf_map_lookup_or_try_init(map, &key, &empty_run_metrics);
+	if (!socket_metrics)
+		count_map_stat(insert_error_stat);
+	return socket_metrics;
+}
+
+static inline void add_metrics(
+	struct process_metrics_t *process_metrics, u32 tgid,
+	struct run_metrics_t *buf, u32 cpu_id)
+{
+	struct run_metrics_t *socket_metrics;
+	int i;
+
+	process_metrics->process_run_time += buf->process_run_time;
+	for (i = 0; i < MAX_HW_COUNTERS; i++)
+		process_metrics->hw_counters[i] += buf->hw_counters[i];
+
+	socket_metrics = lookup_socket_metrics(
+		&process_sockets, tgid, cpu_id, PROCESS_SOCKETS_INSERT_ERRORS);
+	if (!socket_metrics)
+		return;
+	socket_metrics->process_run_time += buf->process_run_time;
+	for (i = 0; i < MAX_HW_COUNTERS; i++)
+		socket_metrics->hw_counters[i] += buf->hw_counters[i];
+}
+
+// add_run_metrics adds the counters to the ones of a cgroup, whose tasks run
+// concurrently on other CPUs
+static inline void
+add_run_metrics(struct run_metrics_t *metrics, struct run_metrics_t *buf)
+{
+	int i;
+
+	__sync_fetch_and_add(&metrics->process_run_time, buf->process_run_time);
+	for (i = 0; i < MAX_HW_COUNTERS; i++)
+		__sync_fetch_and_add(&metrics->hw_counters[i], buf->hw_counters[i]);
+}
+
+// add_cgroup_metrics is add_metrics for a cgroup
+static inline void add_cgroup_metrics(
+	struct process_metrics_t *cgroup_metrics, struct run_metrics_t *buf,
+	u32 cpu_id)
+{
+	struct run_metrics_t *socket_metrics;
+	int i;
+
+	__sync_fetch_and_add(
+		&cgroup_metrics->process_run_time, buf->process_run_time);
+	for (i = 0; i < MAX_HW_COUNTERS; i++)
+		__sync_fetch_and_add(
+			&cgroup_metrics->hw_counters[i], buf->hw_counters[i]);
+
+	socket_metrics = lookup_socket_metrics(
+		&cgroup_sockets, cgroup_metrics->cgroup_id, cpu_id,
+		CGROUP_SOCKETS_INSERT_ERRORS);
+	if (socket_metrics)
+		add_run_metrics(socket_metrics, buf);
 }
 
 static inline void do_page_cache_hit_increment(u32 curr_pid)
 {
-	struct process_metrics_t *process_metrics;
+	struct process_metrics_t *process_metrics, *cgroup_metrics;
 
 	process_metrics = bpf_map_lookup_elem(&processes, &curr_pid);
 	if (process_metrics)
 		process_metrics->page_cache_hit++;
+
+	cgroup_metrics = lookup_cgroup_metrics();
+	if (cgroup_metrics)
+		__sync_fetch_and_add(&cgroup_metrics->page_cache_hit, 1);
+}
+
+// do_net_increment counts the network traffic of a process of the cgroup
+static inline void
+do_net_increment(u32 tgid, u64 cgroup_id, int tx, u64 bytes, u64 packets)
+{
+	struct process_metrics_t *process_metrics, *cgroup_metrics;
+
+	process_metrics = bpf_map_lookup_elem(&processes, &tgid);
+	if (process_metrics) {
+		if (tx) {
+			process_metrics->net_tx_bytes += bytes;
+			process_metrics->net_tx_packets += packets;
+		} else {
+			process_metrics->net_rx_bytes += bytes;
+			process_metrics->net_rx_packets += packets;
+		}
+	}
+
+	cgroup_metrics = lookup_cgroup_metrics_of(cgroup_id);
+	if (!cgroup_metrics)
+		return;
+	if (tx) {
+		__sync_fetch_and_add(&cgroup_metrics->net_tx_bytes, bytes);
+		__sync_fetch_and_add(&cgroup_metrics->net_tx_packets, packets);
+	} else {
+		__sync_fetch_and_add(&cgroup_metrics->net_rx_bytes, bytes);
+		__sync_fetch_and_add(&cgroup_metrics->net_rx_packets, packets);
+	}
+}
+
+// set_sock_owner records the process and cgroup owning a socket, when the
+// process sends or receives on it
+static inline void set_sock_owner(u64 sk, u32 tgid, u64 cgroup_id)
+{
+	struct sock_owner_t *owner, new_owner = {};
+
+	owner = bpf_map_lookup_elem(&sock_owners, &sk);
+	if (owner && owner->tgid == tgid && owner->cgroup_id == cgroup_id)
+		return;
+	new_owner.tgid = tgid;
+	new_owner.cgroup_id = cgroup_id;
+	bpf_map_update_elem(&sock_owners, &sk, &new_owner, BPF_ANY);
+}
+
+// count_sock_packets counts the packets transmitted from a socket to its
+// owner. The packets of the sockets no process sent or received on, such as
+// the control sockets of the kernel, are not counted.
+static inline void count_sock_packets(u64 sk, u64 packets)
+{
+	struct sock_owner_t *owner;
+
+	owner = bpf_map_lookup_elem(&sock_owners, &sk);
+	if (owner)
+		do_net_increment(owner->tgid, owner->cgroup_id, 1, 0, packets);
+}
+
+// skb_packets returns the number of packets of a socket buffer, which is split
+// in several packets by the segmentation offload
+static inline u64 skb_packets(struct sk_buff *skb)
+{
+	struct skb_shared_info *shinfo;
+	u16 gso_segs;
+
+	// the shared info is at the end of the data, whose offset is end on the
+	// 64-bit architectures
+	shinfo = (struct skb_shared_info *)(BPF_CORE_READ(skb, head) +
+					    BPF_CORE_READ(skb, end));
+	gso_segs = BPF_CORE_READ(shinfo, gso_segs);
+	return gso_segs ? gso_segs : 1;
+}
+
+// do_irq_increment counts a softirq of the vector to the current task
+static inline void do_irq_increment(u32 curr_tgid, unsigned int vec)
+{
+	struct process_metrics_t *process_metrics, *cgroup_metrics;
+
+	if (vec >= NUM_SOFTIRQS || IRQ_ATTRIBUTION != IRQ_ATTRIBUTION_TASK)
+		return;
+
+	process_metrics = bpf_map_lookup_elem(&processes, &curr_tgid);
+	if (process_metrics)
+		process_metrics->vec_nr[vec] += 1;
+
+	cgroup_metrics = lookup_cgroup_metrics();
+	if (cgroup_metrics)
+		cgroup_metrics->vec_nr[vec] += 1;
+}
+
+static inline void add_irq_time(u32 irq, u64 time)
+{
+	struct irq_metrics_t *irq_metrics;
+
+	irq_metrics = bpf_map_lookup_elem(&irq_times, &irq);
+	if (!irq_metrics)
+		return;
+	irq_metrics->time += time;
+	irq_metrics->count += 1;
+}
+
+static inline void do_softirq_entry(void)
+{
+	u32 key = 0;
+	struct irq_state_t *state;
+
+	state = bpf_map_lookup_elem(&irq_state, &key);
+	if (state)
+		state->softirq_start = bpf_ktime_get_ns();
+}
+
+static inline void do_softirq_exit(unsigned int vec)
+{
+	u32 key = 0;
+	u64 time;
+	struct irq_state_t *state;
+
+	state = bpf_map_lookup_elem(&irq_state, &key);
+	if (!state || !state->softirq_start)
+		return;
+	time = calc_delta(&state->softirq_start, bpf_ktime_get_ns());
+	state->softirq_start = 0;
+	state->task_irq_time += time;
+	if (vec < NUM_SOFTIRQS)
+		add_irq_time(vec, time);
+}
+
+static inline void do_hardirq_entry(void)
+{
+	u32 key = 0;
+	struct irq_state_t *state;
+
+	state = bpf_map_lookup_elem(&irq_state, &key);
+	if (state)
+		state->hardirq_start = bpf_ktime_get_ns();
+}
+
+static inline void do_hardirq_exit(void)
+{
+	u32 key = 0;
+	u64 time;
+	struct irq_state_t *state;
+
+	state = bpf_map_lookup_elem(&irq_state, &key);
+	if (!state || !state->hardirq_start)
+		return;
+	time = calc_delta(&state->hardirq_start, bpf_ktime_get_ns());
+	state->hardirq_start = 0;
+	state->task_irq_time += time;
+	// the time of a hardirq interrupting a softirq is not softirq time
+	if (state->softirq_start)
+		state->softirq_start += time;
+	add_irq_time(HARDIRQ, time);
 }
 
 static inline int do_kepler_sched_switch_trace(
-	u32 prev_pid, u32 next_pid, u32 prev_tgid, u32 next_tgid)
+	u32 prev_pid, u32 next_pid, u32 prev_tgid, u32 next_tgid, u32 prev_flags)
 {
 	u32 cpu_id;
 	u64 curr_ts = bpf_ktime_get_ns();
 
-	struct process_metrics_t *curr_tgid_metrics, *prev_tgid_metrics;
-	struct process_metrics_t buf = {};
+	struct process_metrics_t *prev_tgid_metrics, *cgroup_metrics;
+	// the process metrics are too large for the stack, only the counters
+	// accounted at a switch are collected
+	struct run_metrics_t buf = {};
 
 	cpu_id = bpf_get_smp_processor_id();
 
@@ -323,13 +891,14 @@ static inline int do_kepler_sched_switch_trace(
 			// update hardware counters to be used when sample is taken
 			if (counter_sched_switch == 1) {
 				collect_metrics_and_reset_counters(
-					&buf, prev_pid, curr_ts, cpu_id);
+					&buf, prev_pid, curr_ts, cpu_id, 0);
 				// Add task on-cpu running start time
-				bpf_map_update_elem(
-					&pid_time_map, &next_pid, &curr_ts,
-					BPF_ANY);
+				set_on_cpu_start_time(next_pid, curr_ts);
 				// create new process metrics
 				register_new_process_if_not_exist(next_tgid);
+			} else {
+				// drop the interrupts of the task not sampled
+				take_task_irq_time();
 			}
 			counter_sched_switch--;
 			return 0;
@@ -337,7 +906,12 @@ static inline int do_kepler_sched_switch_trace(
 		counter_sched_switch = SAMPLE_RATE;
 	}
 
-	collect_metrics_and_reset_counters(&buf, prev_pid, curr_ts, cpu_id);
+	// Without sampling, the start time is only expected to be missing for
+	// the idle tasks, whose pid 0 is shared by all the CPUs, and the exiting
+	// tasks, whose running time was accounted at exit.
+	collect_metrics_and_reset_counters(
+		&buf, prev_pid, curr_ts, cpu_id,
+		!SAMPLE_RATE && prev_pid && !(prev_flags & PF_EXITING));
 
 	// The process_run_time is 0 if we do not have the previous timestamp of
 	// the task or due to a clock issue. In either case, we skip collecting
@@ -346,36 +920,206 @@ static inline int do_kepler_sched_switch_trace(
 	if (buf.process_run_time > 0) {
 		prev_tgid_metrics = bpf_map_lookup_elem(&processes, &prev_tgid);
 		if (prev_tgid_metrics) {
-			prev_tgid_metrics->process_run_time += buf.process_run_time;
-			prev_tgid_metrics->cpu_cycles += buf.cpu_cycles;
-			prev_tgid_metrics->cpu_instr += buf.cpu_instr;
-			prev_tgid_metrics->cache_miss += buf.cache_miss;
+			add_metrics(prev_tgid_metrics, prev_tgid, &buf, cpu_id);
+			// processes registered at fork get their comm once they run
+			if (!TEST && !prev_tgid_metrics->comm[0])
+				bpf_get_current_comm(
+					&prev_tgid_metrics->comm,
+					sizeof(prev_tgid_metrics->comm));
 		}
+		// the previous task is still the current task in sched_switch
+		cgroup_metrics = lookup_cgroup_metrics();
+		if (cgroup_metrics)
+			add_cgroup_metrics(cgroup_metrics, &buf, cpu_id);
 	}
 
-	// create new process metrics
-	register_new_process_if_not_exist(prev_tgid);
+	// create new process metrics, unless the process exited and its counters
+	// were already moved to the exited_cgroups map
+	if (!(prev_flags & PF_EXITING && prev_pid == prev_tgid))
+		register_new_process_if_not_exist(prev_tgid);
 
 	// Add task on-cpu running start time
 	curr_ts = bpf_ktime_get_ns();
-	bpf_map_update_elem(&pid_time_map, &next_pid, &curr_ts, BPF_ANY);
+	set_on_cpu_start_time(next_pid, curr_ts);
 
 	return 0;
 }
 
-static __always_inline void *
-bpf_map_lookup_or_try_init(void *map, const void *key, const void *init)
+// cgroup the block I/O request was issued for, per the blkcg of its bio
+static inline u64 get_block_io_cgroup_id(struct request *rq)
 {
-	void *val;
-	int err;
+	struct bio *bio;
+	struct blkcg_gq *blkg;
 
-	val = bpf_map_lookup_elem(map, key);
-	if (val)
-		return val;
+	// the kernels built without CONFIG_BLK_CGROUP do not track the cgroup
+	if (!bpf_core_field_exists(bio->bi_blkg))
+		return ROOT_CGROUP_ID;
+	bio = rq->bio;
+	if (!bio)
+		return ROOT_CGROUP_ID;
+	blkg = bio->bi_blkg;
+	if (!blkg)
+		return ROOT_CGROUP_ID;
+	return blkg->blkcg->css.cgroup->kn->id;
+}
 
-	err = bpf_map_update_elem(map, key, init, BPF_NOEXIST);
-	if (err && err != -17)
-		return 0;
+// add_block_io counts the bytes of a read or write request completed for the
+// cgroup
+static inline void add_block_io(u64 cgroup_id, u32 op, u32 nr_bytes)
+{
+	struct block_io_metrics_t *block_io;
+	struct block_io_metrics_t new_block_io = {};
 
-	return bpf_map_lookup_elem(map, key);
+	block_io = bpf_map_lookup_or_try_init(
+		&cgroup_block_io, &cgroup_id, &new_block_io);
+	if (!block_io) {
+		count_map_stat(CGROUP_BLOCK_IO_INSERT_ERRORS);
+		return;
+	}
+	// requests of the same cgroup complete concurrently on other CPUs
+	if (op == REQ_OP_READ) {
+		__sync_fetch_and_add(&block_io->read_bytes, nr_bytes);
+		__sync_fetch_and_add(&block_io->read_ops, 1);
+	} else {
+		__sync_fetch_and_add(&block_io->write_bytes, nr_bytes);
+		__sync_fetch_and_add(&block_io->write_ops, 1);
+	}
+}
+
+static inline void do_block_io_increment(struct request *rq, u32 nr_bytes)
+{
+	u32 op;
+
+	op = rq->cmd_flags & REQ_OP_MASK;
+	if (!nr_bytes || (op != REQ_OP_READ && op != REQ_OP_WRITE))
+		return;
+
+	add_block_io(get_block_io_cgroup_id(rq), op, nr_bytes);
+}
+
+static inline void do_kepler_process_fork(u32 child_pid, u32 child_tgid)
+{
+	struct process_metrics_t *child_metrics;
+
+	// threads are accounted to the process that created them
+	if (!PROCESS_METRICS || child_pid != child_tgid)
+		return;
+
+	// register the child before it runs, so that it is accounted even if it
+	// exits before being switched out. It runs in the cgroup of its parent and
+	// its comm is set the first time it is switched out, after it could exec.
+	if (!insert_process(child_tgid))
+		return;
+	child_metrics = bpf_map_lookup_elem(&processes, &child_tgid);
+	if (!child_metrics)
+		return;
+	child_metrics->pid = child_tgid;
+	child_metrics->cgroup_id = bpf_get_current_cgroup_id();
+}
+
+// move_to_exited_cgroup_sockets moves the counters of an exited process per
+// socket to the accumulator of its cgroup
+static inline void move_to_exited_cgroup_sockets(u32 tgid, u64 cgroup_id)
+{
+	int i;
+	struct socket_key_t key = {};
+	struct run_metrics_t *process_socket, *cgroup_socket;
+
+	if (NUM_SOCKETS < 2)
+		return;
+	for (i = 0; i < MAX_SOCKETS; i++) {
+		key.id = tgid;
+		key.socket = i;
+		process_socket = bpf_map_lookup_elem(&process_sockets, &key);
+		if (!process_socket)
+			continue;
+		key.id = cgroup_id;
+		cgroup_socket = bpf_map_lookup_or_try_init(
+			&exited_cgroup_sockets, &key, &empty_run_metrics);
+		if (cgroup_socket)
+			add_run_metrics(cgroup_socket, process_socket);
+		else
+			count_map_stat(EXITED_CGROUP_SOCKETS_INSERT_ERRORS);
+		key.id = tgid;
+		bpf_map_delete_elem(&process_sockets, &key);
+	}
+}
+
+// move_to_exited_cgroup moves the counters of an exited process not read yet to
+// the accumulator of its cgroup, the processes map only keeps the entries of
+// the running processes
+static inline void
+move_to_exited_cgroup(struct process_metrics_t *process_metrics, u32 tgid)
+{
+	int i;
+	struct process_metrics_t *cgroup_metrics;
+
+	cgroup_metrics = bpf_map_lookup_or_try_init(
+		&exited_cgroups, &process_metrics->cgroup_id, &empty_metrics);
+	if (!cgroup_metrics) {
+		count_map_stat(EXITED_CGROUPS_INSERT_ERRORS);
+		return;
+	}
+	cgroup_metrics->cgroup_id = process_metrics->cgroup_id;
+	// processes of the same cgroup can exit concurrently on other CPUs
+	__sync_fetch_and_add(
+		&cgroup_metrics->process_run_time,
+		process_metrics->process_run_time);
+	for (i = 0; i < MAX_HW_COUNTERS; i++)
+		__sync_fetch_and_add(
+			&cgroup_metrics->hw_counters[i],
+			process_metrics->hw_counters[i]);
+	__sync_fetch_and_add(
+		&cgroup_metrics->page_cache_hit,
+		process_metrics->page_cache_hit);
+	__sync_fetch_and_add(
+		&cgroup_metrics->net_tx_bytes, process_metrics->net_tx_bytes);
+	__sync_fetch_and_add(
+		&cgroup_metrics->net_rx_bytes, process_metrics->net_rx_bytes);
+	__sync_fetch_and_add(
+		&cgroup_metrics->net_tx_packets,
+		process_metrics->net_tx_packets);
+	__sync_fetch_and_add(
+		&cgroup_metrics->net_rx_packets,
+		process_metrics->net_rx_packets);
+	for (i = 0; i < NUM_SOFTIRQS; i++)
+		cgroup_metrics->vec_nr[i] += process_metrics->vec_nr[i];
+	move_to_exited_cgroup_sockets(tgid, process_metrics->cgroup_id);
+}
+
+static inline void do_kepler_process_exit(u32 pid, u32 tgid)
+{
+	u32 cpu_id;
+	u64 curr_ts = bpf_ktime_get_ns();
+
+	struct process_metrics_t *process_metrics, *cgroup_metrics;
+	struct run_metrics_t buf = {};
+
+	process_metrics = bpf_map_lookup_elem(&processes, &tgid);
+	if (!process_metrics && !CGROUP_AGGREGATION)
+		return;
+
+	// The exiting task is still on the CPU: account its last running time
+	// here, the sched_switch that follows will not find its start time.
+	cpu_id = bpf_get_smp_processor_id();
+	collect_metrics_and_reset_counters(&buf, pid, curr_ts, cpu_id, 0);
+	if (buf.process_run_time > 0) {
+		if (process_metrics)
+			add_metrics(process_metrics, tgid, &buf, cpu_id);
+		cgroup_metrics = lookup_cgroup_metrics();
+		if (cgroup_metrics)
+			add_cgroup_metrics(cgroup_metrics, &buf, cpu_id);
+	}
+
+	// the process lives on until its thread group leader exits
+	if (!process_metrics || pid != tgid)
+		return;
+
+	// the counters aggregated per cgroup already include the exited
+	// processes
+	if (!CGROUP_AGGREGATION)
+		move_to_exited_cgroup(process_metrics, tgid);
+
+	if (!bpf_map_delete_elem(&processes, &tgid))
+		count_map_stat(PROCESSES_DELETES);
 }
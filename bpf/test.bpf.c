@@ -20,9 +20,48 @@ int test_register_new_process_if_not_exist(void *ctx)
 SEC("raw_tp/sched_switch")
 int test_kepler_sched_switch_trace(u64 *ctx)
 {
-	do_kepler_sched_switch_trace(42, 43, 42, 43);
+	do_kepler_sched_switch_trace(42, 43, 42, 43, 0);
 
 	return 0;
 }
 
+SEC("raw_tp")
+int test_kepler_process_exit(void *ctx)
+{
+	do_kepler_process_exit(42, 42);
+	return 0;
+}
+
+SEC("raw_tp")
+int test_kepler_net_trace(void *ctx)
+{
+	do_net_increment(42, 7, 1, 1500, 0);
+	do_net_increment(42, 7, 0, 3000, 2);
+	// the socket at 0x1000 of TGID 42 transmits 3 packets, the socket at
+	// 0x2000 no process sent or received on transmits 1
+	set_sock_owner(0x1000, 42, 7);
+	count_sock_packets(0x1000, 3);
+	count_sock_packets(0x2000, 1);
+	return 0;
+}
+
+SEC("raw_tp")
+int test_kepler_block_rq_complete(void *ctx)
+{
+	add_block_io(7, REQ_OP_READ, 4096);
+	add_block_io(7, REQ_OP_WRITE, 8192);
+	return 0;
+}
+
+// a hardirq interrupting a softirq of vector 3
+SEC("raw_tp")
+int test_kepler_irq_trace(void *ctx)
+{
+	do_softirq_entry();
+	do_hardirq_entry();
+	do_hardirq_exit();
+	do_softirq_exit(3);
+	return 0;
+}
+
 char __license[] SEC("license") = "Dual BSD/GPL";
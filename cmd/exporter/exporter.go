@@ -32,12 +32,15 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/bpf"
 	"github.com/sustainable-computing-io/kepler/pkg/build"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/health"
 	"github.com/sustainable-computing-io/kepler/pkg/manager"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
+	"github.com/sustainable-computing-io/kepler/pkg/remotewrite"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
-	"gopkg.in/yaml.v3"
+	"github.com/sustainable-computing-io/kepler/pkg/web"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -52,18 +55,10 @@ const (
 	startedMsg   = "Started Kepler in %s"
 )
 
-type TLSConfig struct {
-	CertFile string `yaml:"cert_file"`
-	KeyFile  string `yaml:"key_file"`
-}
-
-type TLSServerConfig struct {
-	TLSConfig TLSConfig `yaml:"tls_server_config"`
-}
-
 // AppConfig holds the configuration info for the application.
 type AppConfig struct {
 	BaseDir                      string
+	ConfigFile                   string
 	Address                      string
 	MetricsPath                  string
 	EnableGPU                    bool
@@ -77,12 +72,14 @@ type AppConfig struct {
 	MachineSpecFilePath          string
 	DisablePowerMeter            bool
 	TLSFilePath                  string
+	ConfigReloadInterval         time.Duration
 }
 
 func newAppConfig() *AppConfig {
 	// Initialize flags
 	cfg := &AppConfig{}
 	flag.StringVar(&cfg.BaseDir, "config-dir", config.BaseDir, "path to config base directory")
+	flag.StringVar(&cfg.ConfigFile, "config-file", "", "path to the YAML config file, defaults to kepler.yaml in the config base directory")
 	flag.StringVar(&cfg.Address, "address", "0.0.0.0:8888", "bind address")
 	flag.StringVar(&cfg.MetricsPath, "metrics-path", "/metrics", "metrics path")
 	flag.BoolVar(&cfg.EnableGPU, "enable-gpu", false, "whether enable gpu (need to have libnvidia-ml installed)")
@@ -95,7 +92,8 @@ func newAppConfig() *AppConfig {
 	flag.BoolVar(&cfg.ExposeEstimatedIdlePower, "expose-estimated-idle-power", false, "Whether to expose the estimated idle power as a metric")
 	flag.StringVar(&cfg.MachineSpecFilePath, "machine-spec", "", "path to the machine spec file in json format")
 	flag.BoolVar(&cfg.DisablePowerMeter, "disable-power-meter", false, "whether manually disable power meter read and forcefully apply the estimator for node powers")
-	flag.StringVar(&cfg.TLSFilePath, "web.config.file", "", "path to TLS web config file")
+	flag.StringVar(&cfg.TLSFilePath, "web.config.file", "", "path to the web config file enabling TLS, mutual TLS and basic authentication")
+	flag.DurationVar(&cfg.ConfigReloadInterval, "config-reload-interval", 10*time.Second, "interval to check the config sources for changes, 0 disables the reload on change (SIGHUP still reloads)")
 
 	return cfg
 }
@@ -109,11 +107,30 @@ func healthProbe(w http.ResponseWriter, req *http.Request) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "measure" {
+		os.Exit(runMeasure(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "unpin" {
+		os.Exit(runUnpin(os.Args[2:]))
+	}
+
 	start := time.Now()
 	klog.InitFlags(nil)
 	appConfig := newAppConfig() // Initialize appConfig and define flags
 	flag.Parse()                // Parse command-line flags
 
+	// flags given on the command line take precedence over every other config source
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	override := func(flagName, configKey string) bool {
+		if setFlags[flagName] {
+			config.SetFlagSource(configKey)
+			return true
+		}
+		return !config.IsSet(configKey)
+	}
+
+	config.ConfigFile = appConfig.ConfigFile
 	if _, err := config.Initialize(appConfig.BaseDir); err != nil {
 		klog.Fatalf("Failed to initialize config: %v", err)
 	}
@@ -139,17 +156,33 @@ func main() {
 	platform.SetIsSystemCollectionSupported(!appConfig.DisablePowerMeter)
 	components.SetIsSystemCollectionSupported(!appConfig.DisablePowerMeter)
 
+	if setFlags["enable-cgroup-id"] {
+		config.SetFlagSource("ENABLE_EBPF_CGROUPID")
+	}
 	config.SetEnabledEBPFCgroupID(appConfig.EnableEBPFCgroupID)
-	config.SetEnabledHardwareCounterMetrics(appConfig.ExposeHardwareCounterMetrics)
-	config.SetEnabledGPU(appConfig.EnableGPU)
-	config.SetEnabledMSR(appConfig.EnableMSR)
-	config.SetEnabledIdlePower(appConfig.ExposeEstimatedIdlePower)
+	if override("expose-hardware-counter-metrics", "EXPOSE_HW_COUNTER_METRICS") {
+		config.SetEnabledHardwareCounterMetrics(appConfig.ExposeHardwareCounterMetrics)
+	}
+	if override("enable-gpu", "ENABLE_GPU") {
+		config.SetEnabledGPU(appConfig.EnableGPU)
+	}
+	if override("enable-msr", "ENABLE_MSR") {
+		config.SetEnabledMSR(appConfig.EnableMSR)
+	}
+	if override("expose-estimated-idle-power", "EXPOSE_ESTIMATED_IDLE_POWER_METRICS") {
+		config.SetEnabledIdlePower(appConfig.ExposeEstimatedIdlePower)
+	}
 
-	config.SetKubeConfig(appConfig.Kubeconfig)
-	config.SetEnableAPIServer(appConfig.ApiserverEnabled)
+	if override("kubeconfig", "KUBE_CONFIG") {
+		config.SetKubeConfig(appConfig.Kubeconfig)
+	}
+	if override("apiserver", "ENABLE_API_SERVER") {
+		config.SetEnableAPIServer(appConfig.ApiserverEnabled)
+	}
 
 	// set redfish credential file path
 	if appConfig.RedfishCredFilePath != "" {
+		config.SetFlagSource("REDFISH_CRED_FILE_PATH")
 		config.SetRedfishCredFilePath(appConfig.RedfishCredFilePath)
 	}
 
@@ -160,9 +193,7 @@ func main() {
 	config.LogConfigs()
 
 	components.InitPowerImpl()
-	defer components.StopPower()
 	platform.InitPowerImpl()
-	defer platform.StopPower()
 
 	if config.IsGPUEnabled() {
 		r := accelerator.GetRegistry()
@@ -171,56 +202,110 @@ func main() {
 		} else {
 			klog.Errorf("failed to init GPU accelerators: %v", err)
 		}
-		defer accelerator.Shutdown()
 	}
 
 	bpfExporter, err := bpf.NewExporter()
 	if err != nil {
-		klog.Fatalf("failed to create eBPF exporter: %v", err)
+		if !config.IsProcfsFallbackEnabled() {
+			klog.Fatalf("failed to create eBPF exporter: %v", err)
+		}
+		klog.Errorf("failed to create eBPF exporter: %v. Kepler falls back to reading the CPU time of the processes from procfs, the power attribution is less accurate.", err)
+		bpfExporter = bpf.NewProcfsExporter()
 	}
-	defer bpfExporter.Detach()
+	pipeline.SetProcessUsageSource(bpfExporter.SupportedMetrics().Source)
 
 	m := manager.New(bpfExporter)
 	if m == nil {
 		klog.Fatal("could not create a collector manager")
 	}
-	defer m.Stop()
-
-	// starting a CollectorManager instance to collect data and report metrics
-	if startErr := m.Start(); startErr != nil {
-		klog.Infof("%s", fmt.Sprintf("failed to start : %v", startErr))
+	// the power meters and the eBPF programs are released after the last collection
+	m.Register(manager.Component{
+		Name: "power-meters",
+		Stop: func(context.Context) error {
+			components.StopPower()
+			platform.StopPower()
+			return nil
+		},
+	})
+	if config.IsGPUEnabled() {
+		m.Register(manager.Component{
+			Name: "accelerators",
+			Stop: func(context.Context) error {
+				accelerator.Shutdown()
+				return nil
+			},
+		})
 	}
-	metricPathConfig := config.GetMetricPath(appConfig.MetricsPath)
-	bindAddressConfig := config.GetBindAddress(appConfig.Address)
-
-	var certFile, keyFile string
-	tlsConfigured := false
-
-	// Retrieve the TLS config
-	if appConfig.TLSFilePath != "" {
-		configPath := appConfig.TLSFilePath
+	m.Register(manager.Component{
+		Name: "bpf",
+		Stop: func(context.Context) error {
+			bpfExporter.Detach()
+			return nil
+		},
+	})
 
-		configFile, err := os.Open(configPath)
-		if err != nil {
-			klog.Errorf("Error opening config file: %v\n", err)
+	reg := m.PrometheusCollector.RegisterMetrics()
+	if config.IsRemoteWriteEnabled() {
+		rwConfig := config.GetRemoteWriteConfig()
+		writer, rwErr := remotewrite.NewWriter(&rwConfig, reg)
+		if rwErr != nil {
+			klog.Fatalf("failed to create the remote-write writer: %v", rwErr)
 		}
-		defer configFile.Close()
+		// stopped after the collection loop, so the last collection is pushed
+		rwDone := make(chan struct{})
+		var rwCancel context.CancelFunc
+		m.Register(manager.Component{
+			Name: "remote-write",
+			Start: func(ctx context.Context) error {
+				ctx, rwCancel = context.WithCancel(ctx)
+				go func() {
+					defer close(rwDone)
+					writer.Run(ctx)
+				}()
+				return nil
+			},
+			Stop: func(context.Context) error {
+				rwCancel()
+				<-rwDone
+				return nil
+			},
+		})
+	}
+	if appConfig.ConfigReloadInterval > 0 {
+		m.EnableConfigWatcher(appConfig.ConfigReloadInterval)
+	}
 
-		var tlsServerConfig TLSServerConfig
-		decoder := yaml.NewDecoder(configFile)
-		if err := decoder.Decode(&tlsServerConfig); err != nil {
-			klog.Errorf("Error parsing config file: %v\n", err)
+	// starting a CollectorManager instance to collect data and report metrics
+	if startErr := m.Start(context.Background()); startErr != nil {
+		klog.Infof("%s", fmt.Sprintf("failed to start : %v", startErr))
+	}
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	go func() {
+		for range reloadChan {
+			klog.Infof("Received SIGHUP, reloading config")
+			if err := m.Reload(); err != nil {
+				klog.Errorf("failed to reload config: %v", err)
+			}
 		}
+	}()
+	metricPathConfig := appConfig.MetricsPath
+	if !setFlags["metrics-path"] {
+		metricPathConfig = config.GetMetricPath(appConfig.MetricsPath)
+	}
+	bindAddressConfig := appConfig.Address
+	if !setFlags["address"] {
+		bindAddressConfig = config.GetBindAddress(appConfig.Address)
+	}
 
-		if tlsServerConfig.TLSConfig.CertFile != "" && tlsServerConfig.TLSConfig.KeyFile != "" {
-			certFile = tlsServerConfig.TLSConfig.CertFile
-			keyFile = tlsServerConfig.TLSConfig.KeyFile
-			tlsConfigured = true
+	webConfig := &web.Config{}
+	if appConfig.TLSFilePath != "" {
+		if webConfig, err = web.LoadConfig(appConfig.TLSFilePath); err != nil {
+			klog.Fatalf("%v", err)
 		}
 	}
 
 	handler := http.ServeMux{}
-	reg := m.PrometheusCollector.RegisterMetrics()
 	handler.Handle(metricPathConfig, promhttp.HandlerFor(
 		reg,
 		promhttp.HandlerOpts{
@@ -228,11 +313,20 @@ func main() {
 		},
 	))
 	handler.HandleFunc("/healthz", healthProbe)
+	handler.HandleFunc("/readyz", health.GetRegistry().ReadyHandler)
+	handler.HandleFunc("/debug/config", m.EffectiveConfigHandler)
+	handler.Handle(manager.APIPrefix, m.APIHandler())
 	handler.HandleFunc("/", rootHandler(metricPathConfig))
 	handler.HandleFunc("/debug/pprof/", http.DefaultServeMux.ServeHTTP)
+	// the kubelet probes do not send credentials
 	srv := &http.Server{
 		Addr:    bindAddressConfig,
-		Handler: &handler,
+		Handler: webConfig.Handler(&handler, "/healthz", "/readyz"),
+	}
+	if webConfig.TLSEnabled() {
+		if srv.TLSConfig, err = webConfig.NewTLSConfig(); err != nil {
+			klog.Fatalf("%v", err)
+		}
 	}
 
 	klog.Infof("starting to listen on %s", bindAddressConfig)
@@ -245,10 +339,10 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if tlsConfigured {
-			// Run server in TLS mode
+		if srv.TLSConfig != nil {
+			// Run server in TLS mode, the certificate is served by srv.TLSConfig
 			klog.Infof("Starting server with TLS")
-			err = srv.ListenAndServeTLS(certFile, keyFile)
+			err = srv.ListenAndServeTLS("", "")
 		} else {
 			// Fall back to non-TLS mode
 			klog.Infof("Starting server without TLS")
@@ -277,6 +371,12 @@ func main() {
 		}
 	}
 	wg.Wait()
+	// the collection is stopped once the server no longer serves the metrics, with a last collection for the push exporters
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := m.Stop(stopCtx); err != nil {
+		klog.Errorf("failed to stop the collector manager: %v", err)
+	}
+	stopCancel()
 	klog.Infoln(finishingMsg)
 	klog.FlushAndExit(klog.ExitFlushTimeout, 0)
 }
@@ -0,0 +1,126 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/measure"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
+
+	"k8s.io/klog/v2"
+)
+
+const measureUsage = `Usage: kepler measure [flags] -- command [args...]
+
+Runs the command in its own cgroup and reports the energy attributed to its process tree,
+together with the node energy over the same period. The report is written to stderr unless
+-output-file is set, and kepler exits with the exit code of the command. If the eBPF programs
+cannot be loaded, the CPU time of the processes is read from procfs unless ENABLE_PROCFS_FALLBACK
+is false.
+
+Flags:
+`
+
+// runMeasure implements the measure subcommand and returns the process exit code.
+func runMeasure(args []string) int {
+	fs := flag.NewFlagSet("measure", flag.ExitOnError)
+	klog.InitFlags(fs)
+	baseDir := fs.String("config-dir", config.BaseDir, "path to config base directory")
+	configFile := fs.String("config-file", "", "path to the YAML config file, defaults to kepler.yaml in the config base directory")
+	enableGPU := fs.Bool("enable-gpu", false, "whether enable gpu (need to have libnvidia-ml installed)")
+	output := fs.String("output", "text", "report format, text or json")
+	outputFile := fs.String("output-file", "", "path to write the report to instead of stderr")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), measureUsage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 || (*output != "text" && *output != "json") {
+		fs.Usage()
+		return 2
+	}
+
+	config.ConfigFile = *configFile
+	if _, err := config.Initialize(*baseDir); err != nil {
+		klog.Errorf("Failed to initialize config: %v", err)
+		return 1
+	}
+	if *enableGPU {
+		config.SetEnabledGPU(true)
+	}
+	// the programs and maps pinned by the exporter running on the node are not shared with the measured command
+	config.SetBPFPinPath("")
+
+	components.InitPowerImpl()
+	defer components.StopPower()
+	platform.InitPowerImpl()
+	defer platform.StopPower()
+	if config.IsGPUEnabled() {
+		if a, err := accelerator.New(config.GPU, true); err == nil {
+			accelerator.GetRegistry().MustRegister(a)
+		} else {
+			klog.Errorf("failed to init GPU accelerators: %v", err)
+		}
+		defer accelerator.Shutdown()
+	}
+
+	bpfExporter, err := bpf.NewExporter()
+	if err != nil {
+		if !config.IsProcfsFallbackEnabled() {
+			klog.Errorf("failed to create eBPF exporter: %v", err)
+			return 1
+		}
+		klog.Errorf("failed to create eBPF exporter: %v. Kepler falls back to reading the CPU time of the processes from procfs, the power attribution is less accurate.", err)
+		bpfExporter = bpf.NewProcfsExporter()
+	}
+	defer bpfExporter.Detach()
+
+	report, err := measure.Run(bpfExporter, fs.Args())
+	if err != nil {
+		klog.Errorf("%v", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stderr
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			klog.Errorf("failed to create the report file: %v", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if *output == "json" {
+		err = report.WriteJSON(w)
+	} else {
+		err = report.WriteText(w)
+	}
+	if err != nil {
+		klog.Errorf("failed to write the report: %v", err)
+		return 1
+	}
+	return report.ExitCode
+}
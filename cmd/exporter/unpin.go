@@ -0,0 +1,64 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+
+	"k8s.io/klog/v2"
+)
+
+const unpinUsage = `Usage: kepler unpin [flags]
+
+Removes the eBPF programs and maps pinned in BPF_PIN_PATH, which detaches the programs once no
+exporter uses them. Run it on each node when Kepler is uninstalled.
+
+Flags:
+`
+
+// runUnpin implements the unpin subcommand and returns the process exit code.
+func runUnpin(args []string) int {
+	fs := flag.NewFlagSet("unpin", flag.ExitOnError)
+	klog.InitFlags(fs)
+	baseDir := fs.String("config-dir", config.BaseDir, "path to config base directory")
+	configFile := fs.String("config-file", "", "path to the YAML config file, defaults to kepler.yaml in the config base directory")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), unpinUsage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	config.ConfigFile = *configFile
+	if _, err := config.Initialize(*baseDir); err != nil {
+		klog.Errorf("Failed to initialize config: %v", err)
+		return 1
+	}
+	if err := bpf.Unpin(); err != nil {
+		klog.Errorf("%v", err)
+		return 1
+	}
+	klog.Infof("Unpinned the eBPF objects in %s", config.GetBPFPinPath())
+	return 0
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 	"unsafe"
 
@@ -32,41 +33,91 @@ import (
 	"github.com/cilium/ebpf/rlimit"
 	"github.com/jaypipes/ghw"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/health"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"golang.org/x/sys/unix"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
+// socketMaps are the maps of the counters split per socket, by the map of the processes or cgroups they split
+var socketMaps = map[string]string{
+	"process_sockets":       "processes",
+	"cgroup_sockets":        "cgroups",
+	"exited_cgroup_sockets": "exited_cgroups",
+}
+
 type exporter struct {
 	bpfObjects keplerObjects
 
 	schedSwitchLink link.Link
 	irqLink         link.Link
+	irqExitLink     link.Link
+	hardirqLinks    []link.Link
 	pageWriteLink   link.Link
 	pageReadLink    link.Link
+	forkLink        link.Link
+	exitLink        link.Link
+	netLinks        []link.Link
+	blockIOLink     link.Link
 
 	perfEvents *hardwarePerfEvents
 
 	enabledHardwareCounters sets.Set[string]
 	enabledSoftwareCounters sets.Set[string]
+	// cgroupAggregation is true if the eBPF programs aggregate the counters per cgroup
+	cgroupAggregation bool
+	// splitPerSocket is true if the eBPF programs split the CPU time and hardware counters per socket
+	splitPerSocket bool
+	// mapLoss tracks the entries lost by the eBPF maps
+	mapLoss mapLossTracker
 }
 
 func NewExporter() (Exporter, error) {
 	e := &exporter{
-		enabledHardwareCounters: sets.New[string](config.BPFHwCounters()...),
+		enabledHardwareCounters: sets.New[string](),
 		enabledSoftwareCounters: sets.New[string](config.BPFSwCounters()...),
 	}
 	err := e.attach()
 	if err != nil {
 		e.Detach()
+		return e, err
+	}
+	health.GetRegistry().Register("bpf", e.linksHealthCheck)
+	health.GetRegistry().RegisterOptional("perf-events", e.perfEventsHealthCheck)
+	return e, nil
+}
+
+// linksHealthCheck fails if a required eBPF program is not attached
+func (e *exporter) linksHealthCheck() error {
+	var missing []string
+	if e.schedSwitchLink == nil {
+		missing = append(missing, "sched_switch")
+	}
+	if config.ExposeIRQCounterMetrics() && e.irqLink == nil {
+		missing = append(missing, "softirq_entry")
 	}
-	return e, err
+	if len(missing) > 0 {
+		return fmt.Errorf("eBPF programs not attached: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// perfEventsHealthCheck fails if the hardware counters are enabled but the perf events could not be opened, e.g. in
+// a VM without a PMU, where the processes are only accounted by their CPU time
+func (e *exporter) perfEventsHealthCheck() error {
+	if config.ExposeHardwareCounterMetrics() && e.perfEvents == nil {
+		return fmt.Errorf("hardware perf events are not opened")
+	}
+	return nil
 }
 
 func (e *exporter) SupportedMetrics() SupportedMetrics {
 	return SupportedMetrics{
-		HardwareCounters: e.enabledHardwareCounters.Clone(),
-		SoftwareCounters: e.enabledSoftwareCounters.Clone(),
+		HardwareCounters:  e.enabledHardwareCounters.Clone(),
+		SoftwareCounters:  e.enabledSoftwareCounters.Clone(),
+		Source:            SourceEBPF,
+		CgroupAggregation: e.cgroupAggregation,
 	}
 }
 
@@ -81,47 +132,125 @@ func (e *exporter) attach() error {
 	if err != nil {
 		return fmt.Errorf("error loading eBPF specs: %v", err)
 	}
+	if err := specs.Assign(&keplerSpecs{}); err != nil {
+		return fmt.Errorf("the eBPF objects do not match their bindings, they must be regenerated with make generate: %v", err)
+	}
+
+	// When the counters are aggregated per cgroup, the processes are only tracked for the metrics of the processes
+	// and of the virtual machines, which are resolved from the pid
+	e.cgroupAggregation = config.IsCgroupAggregationEnabled()
+	processMetrics := !e.cgroupAggregation || config.IsExposeProcessStatsEnabled() || config.IsExposeVMStatsEnabled()
+
+	// The CPU time and hardware counters are only split per socket on the nodes with several sockets
+	cpuSockets, numSockets, err := readCPUSockets()
+	if err != nil {
+		klog.Warningf("failed to map the CPUs to their socket: %v. Kepler will not split the resource usage per socket.", err)
+	}
+	e.splitPerSocket = numSockets > 1
 
 	// Adjust map sizes to the number of available CPUs
 	numCPU := getCPUCores()
 	klog.Infof("Number of CPUs: %d", numCPU)
-	for _, m := range specs.Maps {
+	for name, m := range specs.Maps {
+		switch {
+		// The hardware counters have MAX_HW_COUNTERS values per CPU and an event reader per counter
+		case name == "hw_counters":
+			m.MaxEntries = uint32(numCPU * config.MaxHWCounters)
+		case name == "hw_counters_event_reader":
+			m.InnerMap.MaxEntries = uint32(numCPU)
+		// The maps not used with the configured aggregation only need one entry
+		case name == "cgroups" && !e.cgroupAggregation,
+			name == "exited_cgroups" && e.cgroupAggregation,
+			name == "processes" && !processMetrics:
+			m.MaxEntries = 1
 		// Only resize maps that have a MaxEntries of NUM_CPUS constant
-		if m.MaxEntries == 128 {
+		case m.MaxEntries == 128:
 			m.MaxEntries = uint32(numCPU)
+		// Resize the maps of the processes and cgroups that have a MaxEntries of MAP_SIZE constant
+		case m.MaxEntries == config.DefaultBPFMapSize:
+			m.MaxEntries = uint32(config.GetBPFMapSize())
+		}
+	}
+	// The maps of the counters split per socket have an entry per socket a process or cgroup ran on
+	for name, parent := range socketMaps {
+		specs.Maps[name].MaxEntries = 1
+		if e.splitPerSocket {
+			specs.Maps[name].MaxEntries = specs.Maps[parent].MaxEntries * uint32(numSockets)
 		}
 	}
 
+	hwCounters := config.HWCounters()
+	if !config.ExposeHardwareCounterMetrics() {
+		hwCounters = nil
+	}
+
 	// Set program global variables
-	err = specs.RewriteConstants(map[string]interface{}{
-		"SAMPLE_RATE": int32(config.GetBPFSampleRate()),
-	})
+	constants := map[string]interface{}{
+		"SAMPLE_RATE":        int32(config.GetBPFSampleRate()),
+		"NUM_HW_COUNTERS":    int32(len(hwCounters)),
+		"NUM_SOCKETS":        int32(numSockets),
+		"CGROUP_AGGREGATION": boolToInt32(e.cgroupAggregation),
+		"PROCESS_METRICS":    boolToInt32(processMetrics),
+		"IRQ_ATTRIBUTION":    irqAttribution(config.GetIRQAttribution()),
+	}
+	err = specs.RewriteConstants(constants)
 	if err != nil {
 		return fmt.Errorf("error rewriting program constants: %v", err)
 	}
 
+	// Adopt the links and maps pinned by a previous exporter loading the same objects, so the programs keep
+	// counting while Kepler restarts
+	pinner, err := newPinner(config.GetBPFPinPath(), pinVersion(_KeplerBytes, specs, constants))
+	if err != nil {
+		return fmt.Errorf("error pinning eBPF objects: %v", err)
+	}
+	if pinner != nil {
+		e.mapLoss.adopted = pinner.adoptedMaps
+	}
+
 	// Load the eBPF program(s)
-	if err := specs.LoadAndAssign(&e.bpfObjects, nil); err != nil {
+	if err := specs.LoadAndAssign(&e.bpfObjects, pinner.collectionOptions(specs)); err != nil {
 		return fmt.Errorf("error loading eBPF objects: %v", err)
 	}
 
+	// Map the CPUs to their socket to account the processes per socket
+	if e.splitPerSocket {
+		if err := updateCPUSockets(e.bpfObjects.CpuSockets, cpuSockets); err != nil {
+			klog.Warningf("failed to map the CPUs to their socket: %v. Kepler will account all the processes to the first socket.", err)
+		}
+	}
+
 	// Attach the eBPF program(s)
-	e.schedSwitchLink, err = link.AttachTracing(link.TracingOptions{
-		Program:    e.bpfObjects.KeplerSchedSwitchTrace,
-		AttachType: ebpf.AttachTraceRawTp,
+	e.schedSwitchLink, err = pinner.attach("sched_switch", func() (link.Link, error) {
+		return link.AttachTracing(link.TracingOptions{
+			Program:    e.bpfObjects.KeplerSchedSwitchTrace,
+			AttachType: ebpf.AttachTraceRawTp,
+		})
 	})
 	if err != nil {
 		return fmt.Errorf("error attaching sched_switch tracepoint: %v", err)
 	}
 
 	if config.ExposeIRQCounterMetrics() {
-		e.irqLink, err = link.AttachTracing(link.TracingOptions{
-			Program:    e.bpfObjects.KeplerIrqTrace,
-			AttachType: ebpf.AttachTraceRawTp,
+		e.irqLink, err = pinner.attach("softirq_entry", func() (link.Link, error) {
+			return link.AttachTracing(link.TracingOptions{
+				Program:    e.bpfObjects.KeplerIrqTrace,
+				AttachType: ebpf.AttachTraceRawTp,
+			})
 		})
 		if err != nil {
 			return fmt.Errorf("could not attach irq/softirq_entry: %w", err)
 		}
+		e.irqExitLink, err = pinner.attach("softirq_exit", func() (link.Link, error) {
+			return link.AttachTracing(link.TracingOptions{
+				Program:    e.bpfObjects.KeplerSoftirqExit,
+				AttachType: ebpf.AttachTraceRawTp,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("could not attach irq/softirq_exit: %w", err)
+		}
+		e.attachHardirqTraces(pinner)
 	}
 
 	group := "writeback"
@@ -129,40 +258,148 @@ func (e *exporter) attach() error {
 	if _, err := os.Stat("/sys/kernel/debug/tracing/events/writeback/writeback_dirty_folio"); err == nil {
 		name = "writeback_dirty_folio"
 	}
-	e.pageWriteLink, err = link.Tracepoint(group, name, e.bpfObjects.KeplerWritePageTrace, nil)
+	e.pageWriteLink, err = pinner.attach(name, func() (link.Link, error) {
+		return link.Tracepoint(group, name, e.bpfObjects.KeplerWritePageTrace, nil)
+	})
 	if err != nil {
 		klog.Warningf("failed to attach tp/%s/%s: %v. Kepler will not collect page cache write events. This will affect the DRAM power model estimation on VMs.", group, name, err)
 	} else {
 		e.enabledSoftwareCounters[config.PageCacheHit] = struct{}{}
 	}
 
-	e.pageReadLink, err = link.AttachTracing(link.TracingOptions{
-		Program:    e.bpfObjects.KeplerReadPageTrace,
-		AttachType: ebpf.AttachTraceFEntry,
+	e.pageReadLink, err = pinner.attach("mark_page_accessed", func() (link.Link, error) {
+		return link.AttachTracing(link.TracingOptions{
+			Program:    e.bpfObjects.KeplerReadPageTrace,
+			AttachType: ebpf.AttachTraceFEntry,
+		})
 	})
 	if err != nil {
 		klog.Warningf("failed to attach fentry/mark_page_accessed: %v. Kepler will not collect page cache read events. This will affect the DRAM power model estimation on VMs.", err)
 	}
 
+	e.forkLink, err = pinner.attach("sched_process_fork", func() (link.Link, error) {
+		return link.AttachTracing(link.TracingOptions{
+			Program:    e.bpfObjects.KeplerSchedProcessFork,
+			AttachType: ebpf.AttachTraceRawTp,
+		})
+	})
+	if err != nil {
+		klog.Warningf("failed to attach sched_process_fork tracepoint: %v. Kepler will not attribute the processes exiting before being scheduled out.", err)
+	}
+
+	e.exitLink, err = pinner.attach("sched_process_exit", func() (link.Link, error) {
+		return link.AttachTracing(link.TracingOptions{
+			Program:    e.bpfObjects.KeplerSchedProcessExit,
+			AttachType: ebpf.AttachTraceRawTp,
+		})
+	})
+	if err != nil {
+		klog.Warningf("failed to attach sched_process_exit tracepoint: %v. Kepler will only attribute the processes still running at each collection.", err)
+	}
+
+	e.attachNetworkTraces(pinner)
+
+	e.blockIOLink, err = pinner.attach("block_rq_complete", func() (link.Link, error) {
+		return link.AttachTracing(link.TracingOptions{
+			Program:    e.bpfObjects.KeplerBlockRqComplete,
+			AttachType: ebpf.AttachTraceRawTp,
+		})
+	})
+	if err != nil {
+		klog.Warningf("failed to attach block_rq_complete tracepoint: %v. Kepler will not collect the block I/O of the cgroups.", err)
+		e.enabledSoftwareCounters.Delete(config.BlockReadBytes, config.BlockWriteBytes, config.BlockReadOps, config.BlockWriteOps)
+	}
+
+	pinner.removeStale()
+
 	// Return early if hardware counters are not enabled
 	if !config.ExposeHardwareCounterMetrics() {
 		klog.Infof("Hardware counter metrics are disabled")
 		return nil
 	}
 
-	e.perfEvents, err = createHardwarePerfEvents(
-		e.bpfObjects.CpuInstructionsEventReader,
-		e.bpfObjects.CpuCyclesEventReader,
-		e.bpfObjects.CacheMissEventReader,
-		numCPU,
-	)
+	e.perfEvents, err = createHardwarePerfEvents(e.bpfObjects.HwCountersEventReader, specs.Maps["hw_counters_event_reader"].InnerMap, hwCounters, numCPU)
 	if err != nil {
 		return nil
 	}
+	for i, name := range config.BPFHwCounters() {
+		if e.perfEvents.fds[i] != nil {
+			e.enabledHardwareCounters.Insert(name)
+		}
+	}
 
 	return nil
 }
 
+// attachNetworkTraces attaches the programs counting the bytes and packets sent and received by the processes.
+// A counter whose programs are not attached, e.g. because the kernel lacks their tracepoint, is not supported.
+func (e *exporter) attachNetworkTraces(pinner *pinner) {
+	traces := []struct {
+		program    *ebpf.Program
+		tracepoint string
+		attachType ebpf.AttachType
+		counter    string
+	}{
+		{e.bpfObjects.KeplerSockSendTrace, "sock_send_length", ebpf.AttachTraceRawTp, config.NetTXBytes},
+		{e.bpfObjects.KeplerSockRecvTrace, "sock_recv_length", ebpf.AttachTraceRawTp, config.NetRXBytes},
+		{e.bpfObjects.KeplerIpLocalOut, "__ip_local_out", ebpf.AttachTraceFEntry, config.NetTXPackets},
+		{e.bpfObjects.KeplerIp6LocalOut, "ip6_local_out", ebpf.AttachTraceFEntry, config.NetTXPackets},
+		{e.bpfObjects.KeplerNetRecvTrace, "skb_copy_datagram_iovec", ebpf.AttachTraceRawTp, config.NetRXPackets},
+	}
+	attached := map[string]bool{}
+	for _, t := range traces {
+		t := t
+		l, err := pinner.attach(t.tracepoint, func() (link.Link, error) {
+			return link.AttachTracing(link.TracingOptions{
+				Program:    t.program,
+				AttachType: t.attachType,
+			})
+		})
+		if err != nil {
+			klog.Warningf("failed to attach %s: %v. Kepler will not collect %s from it.", t.tracepoint, err, t.counter)
+			continue
+		}
+		attached[t.tracepoint] = true
+		attached[t.counter] = true
+		e.netLinks = append(e.netLinks, l)
+	}
+	// the packets are transmitted to the owner of their socket, which is known once it sent or received
+	if !attached["sock_send_length"] && !attached["sock_recv_length"] {
+		attached[config.NetTXPackets] = false
+	}
+	for _, counter := range []string{config.NetTXBytes, config.NetRXBytes, config.NetTXPackets, config.NetRXPackets} {
+		if !attached[counter] {
+			e.enabledSoftwareCounters.Delete(counter)
+		}
+	}
+}
+
+// attachHardirqTraces attaches the programs measuring the time spent in the hardirqs, which is not measured if
+// either program cannot be attached
+func (e *exporter) attachHardirqTraces(pinner *pinner) {
+	traces := []struct {
+		program    *ebpf.Program
+		tracepoint string
+	}{
+		{e.bpfObjects.KeplerHardirqEntry, "irq_handler_entry"},
+		{e.bpfObjects.KeplerHardirqExit, "irq_handler_exit"},
+	}
+	for _, t := range traces {
+		program := t.program
+		l, err := pinner.attach(t.tracepoint, func() (link.Link, error) {
+			return link.AttachTracing(link.TracingOptions{
+				Program:    program,
+				AttachType: ebpf.AttachTraceRawTp,
+			})
+		})
+		if err != nil {
+			klog.Warningf("failed to attach %s tracepoint: %v. Kepler will not measure the time spent in the hardirqs.", t.tracepoint, err)
+			return
+		}
+		e.hardirqLinks = append(e.hardirqLinks, l)
+	}
+}
+
 func (e *exporter) Detach() {
 	// Links
 	if e.schedSwitchLink != nil {
@@ -175,6 +412,16 @@ func (e *exporter) Detach() {
 		e.irqLink = nil
 	}
 
+	if e.irqExitLink != nil {
+		e.irqExitLink.Close()
+		e.irqExitLink = nil
+	}
+
+	for _, l := range e.hardirqLinks {
+		l.Close()
+	}
+	e.hardirqLinks = nil
+
 	if e.pageWriteLink != nil {
 		e.pageWriteLink.Close()
 		e.pageWriteLink = nil
@@ -185,6 +432,26 @@ func (e *exporter) Detach() {
 		e.pageReadLink = nil
 	}
 
+	if e.forkLink != nil {
+		e.forkLink.Close()
+		e.forkLink = nil
+	}
+
+	if e.exitLink != nil {
+		e.exitLink.Close()
+		e.exitLink = nil
+	}
+
+	if e.blockIOLink != nil {
+		e.blockIOLink.Close()
+		e.blockIOLink = nil
+	}
+
+	for _, l := range e.netLinks {
+		l.Close()
+	}
+	e.netLinks = nil
+
 	// Perf events
 	e.perfEvents.close()
 	e.perfEvents = nil
@@ -195,11 +462,13 @@ func (e *exporter) Detach() {
 
 func (e *exporter) CollectProcesses() ([]ProcessMetrics, error) {
 	start := time.Now()
+	// Read the map stats before draining the map, see mapLossTracker.update
+	mapStats, mapStatsErr := e.readMapStats()
 	// Get the max number of entries in the map
 	maxEntries := e.bpfObjects.Processes.MaxEntries()
 	total := 0
 	deleteKeys := make([]uint32, maxEntries)
-	deleteValues := make([]ProcessMetrics, maxEntries)
+	deleteValues := make([]ProcessCounters, maxEntries)
 	var cursor ebpf.MapBatchCursor
 	for {
 		count, err := e.bpfObjects.Processes.BatchLookupAndDelete(
@@ -216,24 +485,158 @@ func (e *exporter) CollectProcesses() ([]ProcessMetrics, error) {
 			return nil, fmt.Errorf("failed to batch lookup and delete: %v", err)
 		}
 	}
+	pipeline.BPFProcessSamples.Set(float64(total))
+	pipeline.BPFProcessesMapFillRatio.Set(float64(total) / float64(maxEntries))
+	pipeline.BPFMapFillRatio.WithLabelValues("processes").Set(float64(total) / float64(maxEntries))
+	if mapStatsErr != nil {
+		klog.V(5).Infof("failed to read the eBPF map stats: %v", mapStatsErr)
+	} else {
+		e.mapLoss.record(mapStats, total)
+	}
 	klog.V(5).Infof("collected %d process samples in %v", total, time.Since(start))
-	return deleteValues[:total], nil
+	return e.withSockets(deleteValues[:total], e.bpfObjects.ProcessSockets, "process_sockets", func(c *ProcessCounters) uint64 {
+		return c.Pid
+	})
+}
+
+// readMapStats sums the map_stats counters of all the CPUs
+func (e *exporter) readMapStats() ([numMapStats]uint64, error) {
+	var stats [numMapStats]uint64
+	var perCPU []uint64
+	for i := range stats {
+		if err := e.bpfObjects.MapStats.Lookup(uint32(i), &perCPU); err != nil {
+			return stats, err
+		}
+		for _, count := range perCPU {
+			stats[i] += count
+		}
+	}
+	return stats, nil
+}
+
+// CollectIRQs sums the time spent handling the interrupts on all the CPUs
+func (e *exporter) CollectIRQs() ([]IRQMetrics, error) {
+	if e.irqExitLink == nil {
+		return nil, nil
+	}
+	irqs := make([]IRQMetrics, NumIRQs)
+	var perCPU []IRQMetrics
+	for i := range irqs {
+		if err := e.bpfObjects.IrqTimes.Lookup(uint32(i), &perCPU); err != nil {
+			return nil, fmt.Errorf("failed to read the time spent handling the interrupts: %w", err)
+		}
+		for _, irq := range perCPU {
+			irqs[i].Time += irq.Time
+			irqs[i].Count += irq.Count
+		}
+	}
+	return irqs, nil
+}
+
+func (e *exporter) CollectExitedProcesses() ([]ProcessMetrics, error) {
+	maxEntries := e.bpfObjects.ExitedCgroups.MaxEntries()
+	total := 0
+	deleteKeys := make([]uint64, maxEntries)
+	deleteValues := make([]ProcessCounters, maxEntries)
+	var cursor ebpf.MapBatchCursor
+	for {
+		count, err := e.bpfObjects.ExitedCgroups.BatchLookupAndDelete(
+			&cursor,
+			deleteKeys,
+			deleteValues,
+			&ebpf.BatchOptions{},
+		)
+		total += count
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to batch lookup and delete: %v", err)
+		}
+	}
+	pipeline.BPFMapFillRatio.WithLabelValues("exited_cgroups").Set(float64(total) / float64(maxEntries))
+	return e.withSockets(deleteValues[:total], e.bpfObjects.ExitedCgroupSockets, "exited_cgroup_sockets", func(c *ProcessCounters) uint64 {
+		return c.CgroupId
+	})
+}
+
+func (e *exporter) CollectCgroupBlockIO() (map[uint64]BlockIOMetrics, error) {
+	maxEntries := e.bpfObjects.CgroupBlockIo.MaxEntries()
+	total := 0
+	deleteKeys := make([]uint64, maxEntries)
+	deleteValues := make([]BlockIOMetrics, maxEntries)
+	var cursor ebpf.MapBatchCursor
+	for {
+		count, err := e.bpfObjects.CgroupBlockIo.BatchLookupAndDelete(
+			&cursor,
+			deleteKeys,
+			deleteValues,
+			&ebpf.BatchOptions{},
+		)
+		total += count
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to batch lookup and delete: %v", err)
+		}
+	}
+	pipeline.BPFMapFillRatio.WithLabelValues("cgroup_block_io").Set(float64(total) / float64(maxEntries))
+	blockIO := make(map[uint64]BlockIOMetrics, total)
+	for i := 0; i < total; i++ {
+		blockIO[deleteKeys[i]] = deleteValues[i]
+	}
+	return blockIO, nil
+}
+
+func (e *exporter) CollectCgroups() ([]ProcessMetrics, error) {
+	if !e.cgroupAggregation {
+		return []ProcessMetrics{}, nil
+	}
+	maxEntries := e.bpfObjects.Cgroups.MaxEntries()
+	total := 0
+	deleteKeys := make([]uint64, maxEntries)
+	deleteValues := make([]ProcessCounters, maxEntries)
+	var cursor ebpf.MapBatchCursor
+	for {
+		count, err := e.bpfObjects.Cgroups.BatchLookupAndDelete(
+			&cursor,
+			deleteKeys,
+			deleteValues,
+			&ebpf.BatchOptions{},
+		)
+		total += count
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to batch lookup and delete: %v", err)
+		}
+	}
+	pipeline.BPFMapFillRatio.WithLabelValues("cgroups").Set(float64(total) / float64(maxEntries))
+	klog.V(5).Infof("collected %d cgroup samples", total)
+	return e.withSockets(deleteValues[:total], e.bpfObjects.CgroupSockets, "cgroup_sockets", func(c *ProcessCounters) uint64 {
+		return c.CgroupId
+	})
 }
 
 ///////////////////////////////////////////////////////////////////////////
 // utility functions
 
-func unixOpenPerfEvent(typ, conf, cpuCores int) ([]int, error) {
+func unixOpenPerfEvent(event perfEvent, cpuCores int) ([]int, error) {
 	sysAttr := &unix.PerfEventAttr{
-		Type:   uint32(typ),
+		Type:   event.Type,
 		Size:   uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
-		Config: uint64(conf),
+		Config: event.Config,
+		Ext1:   event.Config1,
+		Ext2:   event.Config2,
 	}
 	fds := []int{}
 	for i := 0; i < cpuCores; i++ {
 		cloexecFlags := unix.PERF_FLAG_FD_CLOEXEC
 		fd, err := unix.PerfEventOpen(sysAttr, -1, i, -1, cloexecFlags)
 		if fd < 0 {
+			unixClosePerfEvents(fds)
 			return nil, fmt.Errorf("failed to open bpf perf event on cpu %d: %w", i, err)
 		}
 		fds = append(fds, fd)
@@ -241,6 +644,29 @@ func unixOpenPerfEvent(typ, conf, cpuCores int) ([]int, error) {
 	return fds, nil
 }
 
+// unixOpenCgroupPerfEvent opens the perf event counting the tasks of the cgroup, whose directory is opened as
+// cgroupFd, on each CPU. The time the events are enabled and running is read with the count.
+func unixOpenCgroupPerfEvent(event perfEvent, cgroupFd, cpuCores int) ([]int, error) {
+	sysAttr := &unix.PerfEventAttr{
+		Type:        event.Type,
+		Size:        uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+		Config:      event.Config,
+		Ext1:        event.Config1,
+		Ext2:        event.Config2,
+		Read_format: unix.PERF_FORMAT_TOTAL_TIME_ENABLED | unix.PERF_FORMAT_TOTAL_TIME_RUNNING,
+	}
+	fds := []int{}
+	for i := 0; i < cpuCores; i++ {
+		fd, err := unix.PerfEventOpen(sysAttr, cgroupFd, i, -1, unix.PERF_FLAG_FD_CLOEXEC|unix.PERF_FLAG_PID_CGROUP)
+		if fd < 0 {
+			unixClosePerfEvents(fds)
+			return nil, fmt.Errorf("failed to open cgroup perf event on cpu %d: %w", i, err)
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
 func unixClosePerfEvents(fds []int) {
 	for _, fd := range fds {
 		_ = unix.SetNonblock(fd, true)
@@ -258,71 +684,182 @@ func getCPUCores() int {
 	return cores
 }
 
-type hardwarePerfEvents struct {
-	cpuCyclesPerfEvents       []int
-	cpuInstructionsPerfEvents []int
-	cacheMissPerfEvents       []int
+// readCPUSockets returns the socket of each CPU and the number of sockets. It fails if a socket id is out of the
+// sockets accounted by the eBPF programs.
+func readCPUSockets() (map[uint32]uint32, int, error) {
+	cpu, err := ghw.CPU()
+	if err != nil {
+		return nil, 0, err
+	}
+	sockets := map[uint32]uint32{}
+	for _, processor := range cpu.Processors {
+		if processor.ID >= MaxSockets {
+			return nil, 0, fmt.Errorf("a socket id is greater than %d", MaxSockets-1)
+		}
+		for _, core := range processor.Cores {
+			for _, logicalProcessor := range core.LogicalProcessors {
+				sockets[uint32(logicalProcessor)] = uint32(processor.ID)
+			}
+		}
+	}
+	return sockets, len(cpu.Processors), nil
 }
 
-func (h *hardwarePerfEvents) close() {
-	unixClosePerfEvents(h.cpuCyclesPerfEvents)
-	unixClosePerfEvents(h.cpuInstructionsPerfEvents)
-	unixClosePerfEvents(h.cacheMissPerfEvents)
+// updateCPUSockets sets the socket of each CPU in the cpu_sockets map
+func updateCPUSockets(cpuSocketsMap *ebpf.Map, sockets map[uint32]uint32) error {
+	for cpuID, socket := range sockets {
+		if err := cpuSocketsMap.Update(cpuID, socket, ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("failed to update cpu_sockets map: %w", err)
+		}
+	}
+	return nil
 }
 
-// CreateHardwarePerfEvents creates perf events for CPU cycles, CPU instructions, and cache misses
-// and updates the corresponding eBPF maps.
-func createHardwarePerfEvents(cpuInstructionsMap, cpuCyclesMap, cacheMissMap *ebpf.Map, numCPU int) (*hardwarePerfEvents, error) {
-	var err error
-	events := &hardwarePerfEvents{
-		cpuCyclesPerfEvents:       []int{},
-		cpuInstructionsPerfEvents: []int{},
-		cacheMissPerfEvents:       []int{},
+// withSockets returns the metrics of the processes or cgroups read from their map, with their CPU time and hardware
+// counters per socket drained from the socket map, keyed by the id of the process or cgroup
+func (e *exporter) withSockets(counters []ProcessCounters, socketMap *ebpf.Map, mapName string, id func(*ProcessCounters) uint64) ([]ProcessMetrics, error) {
+	metrics := make([]ProcessMetrics, len(counters))
+	for i := range counters {
+		metrics[i].ProcessCounters = counters[i]
+	}
+	if !e.splitPerSocket {
+		return metrics, nil
 	}
-	defer func() {
+	maxEntries := socketMap.MaxEntries()
+	total := 0
+	deleteKeys := make([]keplerSocketKeyT, maxEntries)
+	deleteValues := make([]SocketMetrics, maxEntries)
+	var cursor ebpf.MapBatchCursor
+	for {
+		count, err := socketMap.BatchLookupAndDelete(
+			&cursor,
+			deleteKeys,
+			deleteValues,
+			&ebpf.BatchOptions{},
+		)
+		total += count
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			break
+		}
 		if err != nil {
-			unixClosePerfEvents(events.cpuCyclesPerfEvents)
-			unixClosePerfEvents(events.cpuInstructionsPerfEvents)
-			unixClosePerfEvents(events.cacheMissPerfEvents)
+			return nil, fmt.Errorf("failed to batch lookup and delete: %v", err)
 		}
-	}()
+	}
+	pipeline.BPFMapFillRatio.WithLabelValues(mapName).Set(float64(total) / float64(maxEntries))
+	sockets := map[uint64][]SocketMetrics{}
+	for i := 0; i < total; i++ {
+		if deleteKeys[i].Socket >= MaxSockets {
+			continue
+		}
+		if sockets[deleteKeys[i].Id] == nil {
+			sockets[deleteKeys[i].Id] = make([]SocketMetrics, MaxSockets)
+		}
+		sockets[deleteKeys[i].Id][deleteKeys[i].Socket] = deleteValues[i]
+	}
+	for i := range metrics {
+		metrics[i].Sockets = sockets[id(&counters[i])]
+	}
+	return metrics, nil
+}
 
-	// Create perf events and update each eBPF map
-	events.cpuCyclesPerfEvents, err = unixOpenPerfEvent(unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_CPU_CYCLES, numCPU)
-	if err != nil {
-		klog.Warning("Failed to open perf event for CPU cycles: ", err)
-		return nil, err
+type hardwarePerfEvents struct {
+	// fds holds the perf events of each CPU for each hardware counter, in the configuration order.
+	// The events of a counter that could not be opened are nil.
+	fds [][]int
+	// readers holds the perf event array of each hardware counter inserted in the hw_counters_event_reader map.
+	// The kernel removes the perf events of an array when the file descriptor they were inserted with is closed.
+	readers []*ebpf.Map
+}
+
+func (h *hardwarePerfEvents) close() {
+	if h == nil {
+		return
+	}
+	for _, fds := range h.fds {
+		unixClosePerfEvents(fds)
+	}
+	for _, reader := range h.readers {
+		if reader != nil {
+			reader.Close()
+		}
 	}
+}
 
-	events.cpuInstructionsPerfEvents, err = unixOpenPerfEvent(unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_INSTRUCTIONS, numCPU)
-	if err != nil {
-		klog.Warning("Failed to open perf event for CPU instructions: ", err)
-		return nil, err
+// createHardwarePerfEvents opens the perf events of the hardware counters on each CPU, in a perf event array per
+// counter created from readerSpec, and inserts the arrays in the hw_counters_event_reader eBPF map. A counter whose
+// event cannot be opened is skipped.
+func createHardwarePerfEvents(eventReaderMap *ebpf.Map, readerSpec *ebpf.MapSpec, events []string, numCPU int) (*hardwarePerfEvents, error) {
+	perfEvents := &hardwarePerfEvents{fds: make([][]int, len(events)), readers: make([]*ebpf.Map, len(events))}
+	opened := 0
+	for i, event := range events {
+		attr, err := parsePerfEvent(event)
+		if err != nil {
+			klog.Warningf("Failed to resolve perf event %q: %v", event, err)
+			continue
+		}
+		fds, err := unixOpenPerfEvent(attr, numCPU)
+		if err != nil {
+			klog.Warningf("Failed to open perf event %q: %v", event, err)
+			continue
+		}
+		reader, err := insertHardwareCounterReader(eventReaderMap, readerSpec, i, fds)
+		if err != nil {
+			klog.Warningf("Failed to update hw_counters_event_reader map for perf event %q: %v", event, err)
+			unixClosePerfEvents(fds)
+			continue
+		}
+		perfEvents.fds[i] = fds
+		perfEvents.readers[i] = reader
+		opened++
+	}
+	// The maps pinned by a previous exporter may still hold the perf events of counters no longer configured
+	for i := 0; i < config.MaxHWCounters; i++ {
+		if i >= len(events) || perfEvents.fds[i] == nil {
+			if err := eventReaderMap.Delete(uint32(i)); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+				klog.Warningf("Failed to delete the hardware counter %d from hw_counters_event_reader map: %v", i, err)
+			}
+		}
 	}
+	if opened == 0 && len(events) > 0 {
+		return nil, fmt.Errorf("no hardware perf event could be opened")
+	}
+	return perfEvents, nil
+}
 
-	events.cacheMissPerfEvents, err = unixOpenPerfEvent(unix.PERF_TYPE_HW_CACHE, unix.PERF_COUNT_HW_CACHE_MISSES, numCPU)
+// insertHardwareCounterReader creates the perf event array of a hardware counter, holding its perf event on each CPU,
+// and inserts it in the hw_counters_event_reader eBPF map
+func insertHardwareCounterReader(eventReaderMap *ebpf.Map, readerSpec *ebpf.MapSpec, counter int, fds []int) (*ebpf.Map, error) {
+	reader, err := ebpf.NewMap(readerSpec)
 	if err != nil {
-		klog.Warning("Failed to open perf event for cache misses: ", err)
 		return nil, err
 	}
-
-	for i, fd := range events.cpuCyclesPerfEvents {
-		if err = cpuCyclesMap.Update(uint32(i), uint32(fd), ebpf.UpdateAny); err != nil {
-			klog.Warningf("Failed to update cpu_cycles_event_reader map: %v", err)
-			return nil, err
+	for cpu, fd := range fds {
+		if err = reader.Update(uint32(cpu), uint32(fd), ebpf.UpdateAny); err != nil {
+			break
 		}
 	}
-	for i, fd := range events.cpuInstructionsPerfEvents {
-		if err = cpuInstructionsMap.Update(uint32(i), uint32(fd), ebpf.UpdateAny); err != nil {
-			klog.Warningf("Failed to update cpu_instructions_event_reader map: %v", err)
-			return nil, err
-		}
+	if err == nil {
+		err = eventReaderMap.Update(uint32(counter), reader, ebpf.UpdateAny)
 	}
-	for i, fd := range events.cacheMissPerfEvents {
-		if err = cacheMissMap.Update(uint32(i), uint32(fd), ebpf.UpdateAny); err != nil {
-			klog.Warningf("Failed to update cache_miss_event_reader map: %v", err)
-			return nil, err
-		}
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// irqAttribution is the IRQ_ATTRIBUTION constant of the policy, the eBPF programs only distinguish the interrupts
+// charged to the task they interrupted
+func irqAttribution(policy string) int32 {
+	if policy == config.IRQAttributionTask {
+		return 0
+	}
+	return 1
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
 	}
-	return events, nil
+	return 0
 }
@@ -12,19 +12,54 @@ import (
 	"github.com/cilium/ebpf"
 )
 
+type keplerBlockIoMetricsT struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadOps    uint64
+	WriteOps   uint64
+}
+
+type keplerIrqMetricsT struct {
+	Time  uint64
+	Count uint64
+}
+
+type keplerIrqStateT struct {
+	SoftirqStart uint64
+	HardirqStart uint64
+	TaskIrqTime  uint64
+}
+
 type keplerProcessMetricsT struct {
 	CgroupId       uint64
 	Pid            uint64
 	ProcessRunTime uint64
-	CpuCycles      uint64
-	CpuInstr       uint64
-	CacheMiss      uint64
+	HwCounters     [8]uint64
 	PageCacheHit   uint64
+	NetTxBytes     uint64
+	NetRxBytes     uint64
+	NetTxPackets   uint64
+	NetRxPackets   uint64
 	VecNr          [10]uint16
 	Comm           [16]int8
 	_              [4]byte
 }
 
+type keplerRunMetricsT struct {
+	ProcessRunTime uint64
+	HwCounters     [8]uint64
+}
+
+type keplerSockOwnerT struct {
+	Tgid     uint64
+	CgroupId uint64
+}
+
+type keplerSocketKeyT struct {
+	Id     uint64
+	Socket uint64
+}
+
 // loadKepler returns the embedded CollectionSpec for kepler.
 func loadKepler() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_KeplerBytes)
@@ -66,9 +101,20 @@ type keplerSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type keplerProgramSpecs struct {
+	KeplerBlockRqComplete  *ebpf.ProgramSpec `ebpf:"kepler_block_rq_complete"`
+	KeplerHardirqEntry     *ebpf.ProgramSpec `ebpf:"kepler_hardirq_entry"`
+	KeplerHardirqExit      *ebpf.ProgramSpec `ebpf:"kepler_hardirq_exit"`
+	KeplerIp6LocalOut      *ebpf.ProgramSpec `ebpf:"kepler_ip6_local_out"`
+	KeplerIpLocalOut       *ebpf.ProgramSpec `ebpf:"kepler_ip_local_out"`
 	KeplerIrqTrace         *ebpf.ProgramSpec `ebpf:"kepler_irq_trace"`
+	KeplerNetRecvTrace     *ebpf.ProgramSpec `ebpf:"kepler_net_recv_trace"`
 	KeplerReadPageTrace    *ebpf.ProgramSpec `ebpf:"kepler_read_page_trace"`
+	KeplerSchedProcessExit *ebpf.ProgramSpec `ebpf:"kepler_sched_process_exit"`
+	KeplerSchedProcessFork *ebpf.ProgramSpec `ebpf:"kepler_sched_process_fork"`
 	KeplerSchedSwitchTrace *ebpf.ProgramSpec `ebpf:"kepler_sched_switch_trace"`
+	KeplerSockRecvTrace    *ebpf.ProgramSpec `ebpf:"kepler_sock_recv_trace"`
+	KeplerSockSendTrace    *ebpf.ProgramSpec `ebpf:"kepler_sock_send_trace"`
+	KeplerSoftirqExit      *ebpf.ProgramSpec `ebpf:"kepler_softirq_exit"`
 	KeplerWritePageTrace   *ebpf.ProgramSpec `ebpf:"kepler_write_page_trace"`
 }
 
@@ -76,14 +122,21 @@ type keplerProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type keplerMapSpecs struct {
-	CacheMiss                  *ebpf.MapSpec `ebpf:"cache_miss"`
-	CacheMissEventReader       *ebpf.MapSpec `ebpf:"cache_miss_event_reader"`
-	CpuCycles                  *ebpf.MapSpec `ebpf:"cpu_cycles"`
-	CpuCyclesEventReader       *ebpf.MapSpec `ebpf:"cpu_cycles_event_reader"`
-	CpuInstructions            *ebpf.MapSpec `ebpf:"cpu_instructions"`
-	CpuInstructionsEventReader *ebpf.MapSpec `ebpf:"cpu_instructions_event_reader"`
-	PidTimeMap                 *ebpf.MapSpec `ebpf:"pid_time_map"`
-	Processes                  *ebpf.MapSpec `ebpf:"processes"`
+	CgroupBlockIo         *ebpf.MapSpec `ebpf:"cgroup_block_io"`
+	CgroupSockets         *ebpf.MapSpec `ebpf:"cgroup_sockets"`
+	Cgroups               *ebpf.MapSpec `ebpf:"cgroups"`
+	CpuSockets            *ebpf.MapSpec `ebpf:"cpu_sockets"`
+	ExitedCgroupSockets   *ebpf.MapSpec `ebpf:"exited_cgroup_sockets"`
+	ExitedCgroups         *ebpf.MapSpec `ebpf:"exited_cgroups"`
+	HwCounters            *ebpf.MapSpec `ebpf:"hw_counters"`
+	HwCountersEventReader *ebpf.MapSpec `ebpf:"hw_counters_event_reader"`
+	IrqState              *ebpf.MapSpec `ebpf:"irq_state"`
+	IrqTimes              *ebpf.MapSpec `ebpf:"irq_times"`
+	MapStats              *ebpf.MapSpec `ebpf:"map_stats"`
+	PidTimeMap            *ebpf.MapSpec `ebpf:"pid_time_map"`
+	ProcessSockets        *ebpf.MapSpec `ebpf:"process_sockets"`
+	Processes             *ebpf.MapSpec `ebpf:"processes"`
+	SockOwners            *ebpf.MapSpec `ebpf:"sock_owners"`
 }
 
 // keplerObjects contains all objects after they have been loaded into the kernel.
@@ -105,26 +158,40 @@ func (o *keplerObjects) Close() error {
 //
 // It can be passed to loadKeplerObjects or ebpf.CollectionSpec.LoadAndAssign.
 type keplerMaps struct {
-	CacheMiss                  *ebpf.Map `ebpf:"cache_miss"`
-	CacheMissEventReader       *ebpf.Map `ebpf:"cache_miss_event_reader"`
-	CpuCycles                  *ebpf.Map `ebpf:"cpu_cycles"`
-	CpuCyclesEventReader       *ebpf.Map `ebpf:"cpu_cycles_event_reader"`
-	CpuInstructions            *ebpf.Map `ebpf:"cpu_instructions"`
-	CpuInstructionsEventReader *ebpf.Map `ebpf:"cpu_instructions_event_reader"`
-	PidTimeMap                 *ebpf.Map `ebpf:"pid_time_map"`
-	Processes                  *ebpf.Map `ebpf:"processes"`
+	CgroupBlockIo         *ebpf.Map `ebpf:"cgroup_block_io"`
+	CgroupSockets         *ebpf.Map `ebpf:"cgroup_sockets"`
+	Cgroups               *ebpf.Map `ebpf:"cgroups"`
+	CpuSockets            *ebpf.Map `ebpf:"cpu_sockets"`
+	ExitedCgroupSockets   *ebpf.Map `ebpf:"exited_cgroup_sockets"`
+	ExitedCgroups         *ebpf.Map `ebpf:"exited_cgroups"`
+	HwCounters            *ebpf.Map `ebpf:"hw_counters"`
+	HwCountersEventReader *ebpf.Map `ebpf:"hw_counters_event_reader"`
+	IrqState              *ebpf.Map `ebpf:"irq_state"`
+	IrqTimes              *ebpf.Map `ebpf:"irq_times"`
+	MapStats              *ebpf.Map `ebpf:"map_stats"`
+	PidTimeMap            *ebpf.Map `ebpf:"pid_time_map"`
+	ProcessSockets        *ebpf.Map `ebpf:"process_sockets"`
+	Processes             *ebpf.Map `ebpf:"processes"`
+	SockOwners            *ebpf.Map `ebpf:"sock_owners"`
 }
 
 func (m *keplerMaps) Close() error {
 	return _KeplerClose(
-		m.CacheMiss,
-		m.CacheMissEventReader,
-		m.CpuCycles,
-		m.CpuCyclesEventReader,
-		m.CpuInstructions,
-		m.CpuInstructionsEventReader,
+		m.CgroupBlockIo,
+		m.CgroupSockets,
+		m.Cgroups,
+		m.CpuSockets,
+		m.ExitedCgroupSockets,
+		m.ExitedCgroups,
+		m.HwCounters,
+		m.HwCountersEventReader,
+		m.IrqState,
+		m.IrqTimes,
+		m.MapStats,
 		m.PidTimeMap,
+		m.ProcessSockets,
 		m.Processes,
+		m.SockOwners,
 	)
 }
 
@@ -132,17 +199,39 @@ func (m *keplerMaps) Close() error {
 //
 // It can be passed to loadKeplerObjects or ebpf.CollectionSpec.LoadAndAssign.
 type keplerPrograms struct {
+	KeplerBlockRqComplete  *ebpf.Program `ebpf:"kepler_block_rq_complete"`
+	KeplerHardirqEntry     *ebpf.Program `ebpf:"kepler_hardirq_entry"`
+	KeplerHardirqExit      *ebpf.Program `ebpf:"kepler_hardirq_exit"`
+	KeplerIp6LocalOut      *ebpf.Program `ebpf:"kepler_ip6_local_out"`
+	KeplerIpLocalOut       *ebpf.Program `ebpf:"kepler_ip_local_out"`
 	KeplerIrqTrace         *ebpf.Program `ebpf:"kepler_irq_trace"`
+	KeplerNetRecvTrace     *ebpf.Program `ebpf:"kepler_net_recv_trace"`
 	KeplerReadPageTrace    *ebpf.Program `ebpf:"kepler_read_page_trace"`
+	KeplerSchedProcessExit *ebpf.Program `ebpf:"kepler_sched_process_exit"`
+	KeplerSchedProcessFork *ebpf.Program `ebpf:"kepler_sched_process_fork"`
 	KeplerSchedSwitchTrace *ebpf.Program `ebpf:"kepler_sched_switch_trace"`
+	KeplerSockRecvTrace    *ebpf.Program `ebpf:"kepler_sock_recv_trace"`
+	KeplerSockSendTrace    *ebpf.Program `ebpf:"kepler_sock_send_trace"`
+	KeplerSoftirqExit      *ebpf.Program `ebpf:"kepler_softirq_exit"`
 	KeplerWritePageTrace   *ebpf.Program `ebpf:"kepler_write_page_trace"`
 }
 
 func (p *keplerPrograms) Close() error {
 	return _KeplerClose(
+		p.KeplerBlockRqComplete,
+		p.KeplerHardirqEntry,
+		p.KeplerHardirqExit,
+		p.KeplerIp6LocalOut,
+		p.KeplerIpLocalOut,
 		p.KeplerIrqTrace,
+		p.KeplerNetRecvTrace,
 		p.KeplerReadPageTrace,
+		p.KeplerSchedProcessExit,
+		p.KeplerSchedProcessFork,
 		p.KeplerSchedSwitchTrace,
+		p.KeplerSockRecvTrace,
+		p.KeplerSockSendTrace,
+		p.KeplerSoftirqExit,
 		p.KeplerWritePageTrace,
 	)
 }
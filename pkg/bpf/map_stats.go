@@ -0,0 +1,116 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bpf
+
+import (
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
+	"k8s.io/klog/v2"
+)
+
+// Indices of the map_stats map, per enum map_stat in kepler.bpf.h
+const (
+	mapStatProcessesInserts = iota
+	mapStatProcessesDeletes
+	mapStatProcessesInsertErrors
+	mapStatPidTimeMisses
+	mapStatPidTimeInsertErrors
+	mapStatCgroupsInsertErrors
+	mapStatExitedCgroupsInsertErrors
+	mapStatCgroupBlockIOInsertErrors
+	mapStatProcessSocketsInsertErrors
+	mapStatCgroupSocketsInsertErrors
+	mapStatExitedCgroupSocketsInsertErrors
+	numMapStats
+)
+
+// insertErrorStats are the map_stats counting the failed inserts, by map
+var insertErrorStats = []struct {
+	stat    int
+	mapName string
+}{
+	{mapStatProcessesInsertErrors, "processes"},
+	{mapStatPidTimeInsertErrors, "pid_time_map"},
+	{mapStatCgroupsInsertErrors, "cgroups"},
+	{mapStatExitedCgroupsInsertErrors, "exited_cgroups"},
+	{mapStatCgroupBlockIOInsertErrors, "cgroup_block_io"},
+	{mapStatProcessSocketsInsertErrors, "process_sockets"},
+	{mapStatCgroupSocketsInsertErrors, "cgroup_sockets"},
+	{mapStatExitedCgroupSocketsInsertErrors, "exited_cgroup_sockets"},
+}
+
+// mapLoss is the number of entries of an eBPF map lost for a reason since the last collection
+type mapLoss struct {
+	mapName string
+	reason  string
+	count   uint64
+}
+
+// mapLossTracker derives the entries lost by the eBPF maps from the cumulative map_stats counters
+type mapLossTracker struct {
+	last      [numMapStats]uint64
+	collected uint64
+	evicted   uint64
+	started   bool
+	// adopted is true if the maps were pinned by a previous exporter, whose counters include the entries it collected
+	// and the losses it reported
+	adopted bool
+}
+
+// update returns the entries lost since the last update, from the map_stats counters read before the processes map
+// was drained and the number of entries then collected from it.
+// The evictions of the processes map are the entries inserted but neither deleted at exit nor collected. The entries
+// inserted after the counters were read are collected first and counted as inserted at the next update, which delays
+// the evictions but does not report evictions that did not happen.
+// The start times missing at the first update are the ones of the tasks that were running when the eBPF programs
+// were attached, they are not a loss. The first update of adopted maps only reads the counters.
+func (t *mapLossTracker) update(stats [numMapStats]uint64, collected uint64) []mapLoss {
+	var losses []mapLoss
+	add := func(mapName, reason string, count uint64) {
+		if count > 0 {
+			losses = append(losses, mapLoss{mapName: mapName, reason: reason, count: count})
+		}
+	}
+
+	t.collected += collected
+	removed := stats[mapStatProcessesDeletes] + t.collected
+	if inserted := stats[mapStatProcessesInserts]; inserted > removed+t.evicted {
+		add("processes", pipeline.MapLossEvicted, inserted-removed-t.evicted)
+		t.evicted = inserted - removed
+	}
+	for _, s := range insertErrorStats {
+		add(s.mapName, pipeline.MapLossInsertFailed, stats[s.stat]-t.last[s.stat])
+	}
+	if t.started {
+		add("pid_time_map", pipeline.MapLossMissingStartTime, stats[mapStatPidTimeMisses]-t.last[mapStatPidTimeMisses])
+	}
+
+	if t.adopted && !t.started {
+		losses = nil
+	}
+	t.last = stats
+	t.started = true
+	return losses
+}
+
+// record reports the entries of the eBPF maps lost since the last collection
+func (t *mapLossTracker) record(stats [numMapStats]uint64, collected int) {
+	for _, loss := range t.update(stats, uint64(collected)) {
+		pipeline.BPFMapLostEntries.WithLabelValues(loss.mapName, loss.reason).Add(float64(loss.count))
+		klog.Warningf("eBPF map %s lost %d entries (%s) since the last collection, the reported resource usage and energy are incomplete. Consider increasing BPF_MAP_SIZE.",
+			loss.mapName, loss.count, loss.reason)
+	}
+}
@@ -0,0 +1,59 @@
+package bpf
+
+import (
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Map loss tracker", func() {
+	var t *mapLossTracker
+
+	stats := func(inserts, deletes, misses, cgroupErrors uint64) [numMapStats]uint64 {
+		var s [numMapStats]uint64
+		s[mapStatProcessesInserts] = inserts
+		s[mapStatProcessesDeletes] = deletes
+		s[mapStatPidTimeMisses] = misses
+		s[mapStatCgroupsInsertErrors] = cgroupErrors
+		return s
+	}
+
+	BeforeEach(func() {
+		t = &mapLossTracker{}
+	})
+
+	It("reports no loss when the inserted processes are deleted or collected", func() {
+		Expect(t.update(stats(10, 3, 0, 0), 7)).To(BeEmpty())
+		Expect(t.update(stats(25, 5, 0, 0), 13)).To(BeEmpty())
+	})
+
+	It("reports the processes neither deleted nor collected as evicted", func() {
+		Expect(t.update(stats(100, 10, 0, 0), 60)).To(ConsistOf(mapLoss{"processes", pipeline.MapLossEvicted, 30}))
+		// the evictions are only reported once
+		Expect(t.update(stats(150, 10, 0, 0), 50)).To(BeEmpty())
+		Expect(t.update(stats(200, 20, 0, 0), 35)).To(ConsistOf(mapLoss{"processes", pipeline.MapLossEvicted, 5}))
+	})
+
+	It("does not report the processes collected before their insert was counted as evicted", func() {
+		// 5 processes were inserted after the counters were read, they are counted at the next update
+		Expect(t.update(stats(10, 0, 0, 0), 15)).To(BeEmpty())
+		Expect(t.update(stats(20, 0, 0, 0), 5)).To(BeEmpty())
+	})
+
+	It("reports the failed inserts and the missing start times since the last update", func() {
+		// the start times missing at the first update are the ones of the tasks running at startup
+		Expect(t.update(stats(0, 0, 40, 1), 0)).To(ConsistOf(mapLoss{"cgroups", pipeline.MapLossInsertFailed, 1}))
+		Expect(t.update(stats(0, 0, 42, 1), 0)).To(ConsistOf(mapLoss{"pid_time_map", pipeline.MapLossMissingStartTime, 2}))
+	})
+
+	It("only reads the counters of the adopted maps at the first update", func() {
+		t.adopted = true
+		// the previous exporter collected 80 processes and reported the failed inserts
+		Expect(t.update(stats(100, 10, 40, 3), 10)).To(BeEmpty())
+		Expect(t.update(stats(120, 10, 41, 3), 15)).To(ConsistOf(
+			mapLoss{"processes", pipeline.MapLossEvicted, 5},
+			mapLoss{"pid_time_map", pipeline.MapLossMissingStartTime, 1},
+		))
+	})
+})
@@ -0,0 +1,21 @@
+package bpf
+
+import (
+	"encoding/binary"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("eBPF objects", func() {
+	It("contain the programs and maps of the bindings", func() {
+		specs, err := loadKepler()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(specs.Assign(&keplerSpecs{})).To(Succeed())
+
+		processMetricsSize := uint32(binary.Size(keplerProcessMetricsT{}))
+		Expect(specs.Maps["processes"].ValueSize).To(Equal(processMetricsSize))
+		Expect(specs.Maps["cgroups"].ValueSize).To(Equal(processMetricsSize))
+		Expect(specs.Maps["exited_cgroups"].ValueSize).To(Equal(processMetricsSize))
+	})
+})
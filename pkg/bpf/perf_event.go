@@ -0,0 +1,233 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Per include/uapi/linux/perf_event.h
+const (
+	perfTypeHardware = 0
+	perfTypeHWCache  = 3
+
+	perfCacheOpRead       = 0
+	perfCacheOpWrite      = 1
+	perfCacheOpPrefetch   = 2
+	perfCacheResultAccess = 0
+	perfCacheResultMiss   = 1
+)
+
+var (
+	// eventSourcePath is the sysfs directory of the PMUs, it is overridden in tests
+	eventSourcePath = "/sys/bus/event_source/devices"
+	// onlineCPUsPath is the sysfs list of the online CPUs, it is overridden in tests
+	onlineCPUsPath = "/sys/devices/system/cpu/online"
+)
+
+// perfEvent holds the perf_event_attr fields selecting the event to count
+type perfEvent struct {
+	Type    uint32
+	Config  uint64
+	Config1 uint64
+	Config2 uint64
+}
+
+// hardwareEvents are the generic hardware events, named as in perf list
+var hardwareEvents = map[string]uint64{
+	"cpu-cycles":              0,
+	"cycles":                  0,
+	"instructions":            1,
+	"cache-references":        2,
+	"cache-misses":            3,
+	"branch-instructions":     4,
+	"branches":                4,
+	"branch-misses":           5,
+	"bus-cycles":              6,
+	"stalled-cycles-frontend": 7,
+	"stalled-cycles-backend":  8,
+	"ref-cycles":              9,
+}
+
+// hardwareCaches are the caches of the generic cache events, named as in perf list
+var hardwareCaches = map[string]uint64{
+	"l1-dcache": 0,
+	"l1-icache": 1,
+	"llc":       2,
+	"dtlb":      3,
+	"itlb":      4,
+	"branch":    5,
+	"node":      6,
+}
+
+// hardwareCacheOps are the operations of the generic cache events, with the plural used for the accesses
+var hardwareCacheOps = map[string]uint64{
+	"load":       perfCacheOpRead,
+	"loads":      perfCacheOpRead,
+	"store":      perfCacheOpWrite,
+	"stores":     perfCacheOpWrite,
+	"prefetch":   perfCacheOpPrefetch,
+	"prefetches": perfCacheOpPrefetch,
+}
+
+// parsePerfEvent resolves a perf event written as in perf: a generic hardware event (e.g. instructions),
+// a generic cache event (e.g. LLC-load-misses) or a PMU event from sysfs, either by name (e.g. cpu/mem-loads/)
+// or by its terms (e.g. cpu/event=0xd0,umask=0x81/).
+func parsePerfEvent(event string) (perfEvent, error) {
+	name := strings.ToLower(event)
+	if config, found := hardwareEvents[name]; found {
+		return perfEvent{Type: perfTypeHardware, Config: config}, nil
+	}
+	if pmu, terms, found := strings.Cut(strings.TrimSuffix(event, "/"), "/"); found {
+		return parsePMUEvent(pmu, terms)
+	}
+	if config, ok := parseHardwareCacheEvent(name); ok {
+		return perfEvent{Type: perfTypeHWCache, Config: config}, nil
+	}
+	return perfEvent{}, fmt.Errorf("unknown perf event %q", event)
+}
+
+// parseHardwareCacheEvent resolves the cache events written cache-op or cache-op-misses, e.g. LLC-loads or dTLB-load-misses
+func parseHardwareCacheEvent(name string) (uint64, bool) {
+	for cacheName, cache := range hardwareCaches {
+		opName, found := strings.CutPrefix(name, cacheName+"-")
+		if !found {
+			continue
+		}
+		result := uint64(perfCacheResultAccess)
+		if op, found := strings.CutSuffix(opName, "-misses"); found {
+			opName, result = op, perfCacheResultMiss
+		} else if !strings.HasSuffix(opName, "s") {
+			return 0, false
+		}
+		op, found := hardwareCacheOps[opName]
+		if !found {
+			return 0, false
+		}
+		return cache | op<<8 | result<<16, true
+	}
+	return 0, false
+}
+
+// parsePMUEvent resolves the event of a PMU from its sysfs type, events and format
+func parsePMUEvent(pmu, terms string) (perfEvent, error) {
+	pmuPath := filepath.Join(eventSourcePath, pmu)
+	typ, err := readSysfsUint(filepath.Join(pmuPath, "type"))
+	if err != nil {
+		return perfEvent{}, fmt.Errorf("unknown PMU %q: %w", pmu, err)
+	}
+	if err := checkPMUCPUs(pmu, pmuPath); err != nil {
+		return perfEvent{}, err
+	}
+	if !strings.Contains(terms, "=") {
+		// a named event is an alias of its terms
+		alias, err := os.ReadFile(filepath.Join(pmuPath, "events", terms))
+		if err != nil {
+			return perfEvent{}, fmt.Errorf("unknown event %q of PMU %q: %w", terms, pmu, err)
+		}
+		terms = strings.TrimSpace(string(alias))
+	}
+	event := perfEvent{Type: uint32(typ)}
+	for _, term := range strings.Split(terms, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(term), "=")
+		val := uint64(1)
+		if found {
+			if val, err = strconv.ParseUint(value, 0, 64); err != nil {
+				return perfEvent{}, fmt.Errorf("invalid value of term %q of PMU %q: %w", key, pmu, err)
+			}
+		}
+		format, err := os.ReadFile(filepath.Join(pmuPath, "format", key))
+		if err != nil {
+			return perfEvent{}, fmt.Errorf("unknown term %q of PMU %q: %w", key, pmu, err)
+		}
+		if err := event.setTerm(strings.TrimSpace(string(format)), val); err != nil {
+			return perfEvent{}, fmt.Errorf("invalid format of term %q of PMU %q: %w", key, pmu, err)
+		}
+	}
+	return event, nil
+}
+
+// checkPMUCPUs rejects the PMUs that only count on some CPUs, per their sysfs cpumask, such as the uncore PMUs
+// counting the events of a whole socket: their counters cannot be attributed to the task running on each CPU.
+func checkPMUCPUs(pmu, pmuPath string) error {
+	cpumask, err := os.ReadFile(filepath.Join(pmuPath, "cpumask"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the CPUs of PMU %q: %w", pmu, err)
+	}
+	online, err := os.ReadFile(onlineCPUsPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the online CPUs: %w", err)
+	}
+	if cpus := strings.TrimSpace(string(cpumask)); cpus != strings.TrimSpace(string(online)) {
+		return fmt.Errorf("PMU %q only counts on CPUs %s, its events cannot be attributed to the processes", pmu, cpus)
+	}
+	return nil
+}
+
+// setTerm sets the value of a term in the config bits given by its sysfs format, e.g. config:0-7,32-35
+func (e *perfEvent) setTerm(format string, val uint64) error {
+	field, bits, found := strings.Cut(format, ":")
+	if !found {
+		return fmt.Errorf("%q", format)
+	}
+	var config *uint64
+	switch field {
+	case "config":
+		config = &e.Config
+	case "config1":
+		config = &e.Config1
+	case "config2":
+		config = &e.Config2
+	default:
+		return fmt.Errorf("unknown field %q", field)
+	}
+	for _, bitRange := range strings.Split(bits, ",") {
+		first, last, isRange := strings.Cut(bitRange, "-")
+		if !isRange {
+			last = first
+		}
+		lo, err := strconv.ParseUint(first, 10, 6)
+		if err != nil {
+			return err
+		}
+		hi, err := strconv.ParseUint(last, 10, 6)
+		if err != nil {
+			return err
+		}
+		for bit := lo; bit <= hi; bit++ {
+			*config |= (val & 1) << bit
+			val >>= 1
+		}
+	}
+	return nil
+}
+
+func readSysfsUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 32)
+}
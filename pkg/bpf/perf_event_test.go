@@ -0,0 +1,73 @@
+package bpf
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Perf events", func() {
+	BeforeEach(func() {
+		devices := GinkgoT().TempDir()
+		eventSourcePath = devices
+		onlineCPUsPath = filepath.Join(GinkgoT().TempDir(), "online")
+		DeferCleanup(func() {
+			eventSourcePath = "/sys/bus/event_source/devices"
+			onlineCPUsPath = "/sys/devices/system/cpu/online"
+		})
+		Expect(os.WriteFile(onlineCPUsPath, []byte("0-7\n"), 0o644)).To(Succeed())
+
+		files := map[string]string{
+			"cpu/type":             "4\n",
+			"cpu/events/mem-loads": "event=0xcd,umask=0x1,ldlat=3\n",
+			"cpu/format/event":     "config:0-7\n",
+			"cpu/format/umask":     "config:8-15\n",
+			"cpu/format/edge":      "config:18\n",
+			"cpu/format/ldlat":     "config1:0-15\n",
+			// an uncore PMU counting the events of a socket, on its first CPU
+			"uncore_imc/type":                  "12\n",
+			"uncore_imc/cpumask":               "0\n",
+			"uncore_imc/events/cas_count_read": "event=0x04,umask=0x03\n",
+			"uncore_imc/format/event":          "config:0-7\n",
+			"uncore_imc/format/umask":          "config:8-15\n",
+			// a PMU counting on every CPU
+			"cstate_core/type":         "13\n",
+			"cstate_core/cpumask":      "0-7\n",
+			"cstate_core/format/event": "config:0-63\n",
+		}
+		for name, content := range files {
+			path := filepath.Join(devices, name)
+			Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+			Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		}
+	})
+
+	DescribeTable("parses the perf events", func(event string, expected perfEvent) {
+		Expect(parsePerfEvent(event)).To(Equal(expected))
+	},
+		Entry("generic event", "instructions", perfEvent{Type: perfTypeHardware, Config: 1}),
+		Entry("generic event alias", "cycles", perfEvent{Type: perfTypeHardware, Config: 0}),
+		Entry("ref-cycles", "ref-cycles", perfEvent{Type: perfTypeHardware, Config: 9}),
+		Entry("cache accesses", "L1-dcache-loads", perfEvent{Type: perfTypeHWCache, Config: 0}),
+		Entry("cache misses", "LLC-load-misses", perfEvent{Type: perfTypeHWCache, Config: 2 | 1<<16}),
+		Entry("cache prefetches", "L1-dcache-prefetches", perfEvent{Type: perfTypeHWCache, Config: 2 << 8}),
+		Entry("PMU event terms", "cpu/event=0xd0,umask=0x81,edge/", perfEvent{Type: 4, Config: 0xd0 | 0x81<<8 | 1<<18}),
+		Entry("PMU named event", "cpu/mem-loads/", perfEvent{Type: 4, Config: 0xcd | 0x1<<8, Config1: 3}),
+		Entry("PMU event counted on every CPU", "cstate_core/event=0x1/", perfEvent{Type: 13, Config: 0x1}),
+	)
+
+	DescribeTable("rejects the unknown perf events", func(event string) {
+		_, err := parsePerfEvent(event)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("unknown event", "not-an-event"),
+		Entry("unknown cache operation", "LLC-flushes"),
+		Entry("unknown PMU", "uncore_cha/unc_cha_tor_inserts/"),
+		Entry("PMU event counted on some CPUs", "uncore_imc/cas_count_read/"),
+		Entry("unknown PMU event", "cpu/mem-stores/"),
+		Entry("unknown PMU term", "cpu/event=0xd0,inv/"),
+		Entry("invalid PMU term value", "cpu/event=zero/"),
+	)
+})
@@ -0,0 +1,197 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bpf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+const (
+	pinnedMapsDir  = "maps"
+	pinnedLinksDir = "links"
+)
+
+// pinVersion returns the version of the eBPF objects, a hash of the object file and of the constants and map sizes
+// it is loaded with. The programs and maps pinned by an exporter are only adopted by an exporter loading the same
+// version, since the programs would otherwise count different metrics or use maps of different sizes.
+func pinVersion(object []byte, specs *ebpf.CollectionSpec, constants map[string]interface{}) string {
+	h := sha256.New()
+	h.Write(object)
+
+	names := make([]string, 0, len(constants))
+	for name := range constants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%v\n", name, constants[name])
+	}
+
+	names = names[:0]
+	for name := range specs.Maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := specs.Maps[name]
+		fmt.Fprintf(h, "%s:%s:%d:%d:%d\n", name, m.Type, m.KeySize, m.ValueSize, m.MaxEntries)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// pinner pins the links and maps of a version of the eBPF objects in the bpffs directory, as
+// <path>/<version>/maps/<map> and <path>/<version>/links/<program>, and adopts the ones already pinned there by a
+// previous exporter. The links keep the programs attached and the maps filled while the exporter restarts.
+// A nil pinner does not pin anything.
+type pinner struct {
+	path    string
+	version string
+	// adoptedMaps is true if the maps were pinned by a previous exporter
+	adoptedMaps bool
+	// attached are the programs attached by this exporter
+	attached map[string]bool
+}
+
+// newPinner returns the pinner of the version in the bpffs directory, nil if the directory is empty
+func newPinner(path, version string) (*pinner, error) {
+	if path == "" {
+		return nil, nil
+	}
+	p := &pinner{path: path, version: version, attached: map[string]bool{}}
+	for _, dir := range []string{p.mapsDir(), p.linksDir()} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("error creating the pin directory: %w", err)
+		}
+	}
+	entries, err := os.ReadDir(p.mapsDir())
+	if err != nil {
+		return nil, fmt.Errorf("error reading the pinned maps: %w", err)
+	}
+	p.adoptedMaps = len(entries) > 0
+	return p, nil
+}
+
+func (p *pinner) mapsDir() string {
+	return filepath.Join(p.path, p.version, pinnedMapsDir)
+}
+
+func (p *pinner) linksDir() string {
+	return filepath.Join(p.path, p.version, pinnedLinksDir)
+}
+
+// collectionOptions pins the maps of the specs by name, a pinned map of the same name is reused instead of created.
+// The maps of the global variables are not pinned, they are private to each program instance.
+func (p *pinner) collectionOptions(specs *ebpf.CollectionSpec) *ebpf.CollectionOptions {
+	if p == nil {
+		return nil
+	}
+	for name, m := range specs.Maps {
+		if !strings.HasPrefix(name, ".") {
+			m.Pinning = ebpf.PinByName
+		}
+	}
+	return &ebpf.CollectionOptions{Maps: ebpf.MapOptions{PinPath: p.mapsDir()}}
+}
+
+// attach returns the pinned link of the program, whose program was attached by a previous exporter, or attaches the
+// program and pins its link. A link that cannot be pinned, e.g. a perf event link on older kernels, is only attached.
+func (p *pinner) attach(program string, attachFunc func() (link.Link, error)) (link.Link, error) {
+	if p == nil {
+		return attachFunc()
+	}
+	p.attached[program] = true
+	path := filepath.Join(p.linksDir(), program)
+	l, err := link.LoadPinnedLink(path, nil)
+	if err == nil {
+		klog.V(5).Infof("adopted the pinned link of %s", program)
+		return l, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		klog.Warningf("failed to load the pinned link %s: %v. Kepler attaches the program again.", path, err)
+		if err := os.Remove(path); err != nil {
+			klog.Warningf("failed to unpin the link %s: %v", path, err)
+		}
+	}
+	l, err = attachFunc()
+	if err != nil {
+		delete(p.attached, program)
+		return nil, err
+	}
+	if err := l.Pin(path); err != nil {
+		klog.Warningf("failed to pin the link of %s: %v. The program will be detached when Kepler exits.", program, err)
+	}
+	return l, nil
+}
+
+// removeStale unpins the links and maps of the other versions and the links of the programs this exporter did not
+// attach, e.g. since a counter was disabled, which detaches their programs
+func (p *pinner) removeStale() {
+	if p == nil {
+		return
+	}
+	links, err := os.ReadDir(p.linksDir())
+	if err != nil {
+		klog.Warningf("failed to read the pinned links: %v", err)
+	}
+	for _, entry := range links {
+		if !p.attached[entry.Name()] {
+			if err := os.Remove(filepath.Join(p.linksDir(), entry.Name())); err != nil {
+				klog.Warningf("failed to unpin the link of %s: %v", entry.Name(), err)
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(p.path)
+	if err != nil {
+		klog.Warningf("failed to read the pinned eBPF objects: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() == p.version {
+			continue
+		}
+		klog.Infof("unpinning the eBPF objects of version %s", entry.Name())
+		if err := os.RemoveAll(filepath.Join(p.path, entry.Name())); err != nil {
+			klog.Warningf("failed to unpin the eBPF objects of version %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// Unpin removes the links and maps pinned in the configured bpffs directory, which detaches the programs once no
+// exporter uses them. It is meant to be run when Kepler is uninstalled.
+func Unpin() error {
+	path := config.GetBPFPinPath()
+	if path == "" {
+		return fmt.Errorf("BPF_PIN_PATH is not set")
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("error unpinning the eBPF objects in %s: %w", path, err)
+	}
+	return nil
+}
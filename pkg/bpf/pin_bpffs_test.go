@@ -0,0 +1,67 @@
+//go:build !darwin
+// +build !darwin
+
+package bpf
+
+import (
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/rlimit"
+	"golang.org/x/sys/unix"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// bpffsPath is the usual mount point of the bpffs
+const bpffsPath = "/sys/fs/bpf"
+
+var _ = Describe("Pinning the eBPF objects", func() {
+	var pinPath string
+
+	// the maps of the embedded objects, the programs are loaded by the exporter
+	mapSpecs := func() *ebpf.CollectionSpec {
+		specs, err := loadKepler()
+		Expect(err).NotTo(HaveOccurred())
+		specs.Programs = nil
+		return specs
+	}
+
+	BeforeEach(func() {
+		var fs unix.Statfs_t
+		if err := unix.Statfs(bpffsPath, &fs); err != nil || fs.Type != unix.BPF_FS_MAGIC {
+			Skip("no bpffs is mounted at " + bpffsPath)
+		}
+		var err error
+		pinPath, err = os.MkdirTemp(bpffsPath, "kepler-test-")
+		if err != nil {
+			Skip("the bpffs is not writable: " + err.Error())
+		}
+		DeferCleanup(os.RemoveAll, pinPath)
+		Expect(rlimit.RemoveMemlock()).To(Succeed())
+	})
+
+	It("adopts the maps pinned by a previous exporter", func() {
+		specs := mapSpecs()
+		version := pinVersion(_KeplerBytes, specs, nil)
+		p, err := newPinner(pinPath, version)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.adoptedMaps).To(BeFalse())
+		coll, err := ebpf.NewCollectionWithOptions(specs, *p.collectionOptions(specs))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(coll.Maps["pid_time_map"].Put(uint32(42), uint64(1))).To(Succeed())
+		coll.Close()
+
+		specs = mapSpecs()
+		p, err = newPinner(pinPath, version)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.adoptedMaps).To(BeTrue())
+		coll, err = ebpf.NewCollectionWithOptions(specs, *p.collectionOptions(specs))
+		Expect(err).NotTo(HaveOccurred())
+		defer coll.Close()
+		var startTime uint64
+		Expect(coll.Maps["pid_time_map"].Lookup(uint32(42), &startTime)).To(Succeed())
+		Expect(startTime).To(Equal(uint64(1)))
+	})
+})
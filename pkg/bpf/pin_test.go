@@ -0,0 +1,94 @@
+package bpf
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// pinnableLink is an attached link recording where it is pinned
+type pinnableLink struct {
+	link.Link
+	path string
+}
+
+func (l *pinnableLink) Pin(path string) error {
+	l.path = path
+	return os.WriteFile(path, nil, 0o600)
+}
+
+var _ = Describe("Pinning", func() {
+	var pinPath string
+
+	specs := func(maxEntries uint32) *ebpf.CollectionSpec {
+		return &ebpf.CollectionSpec{Maps: map[string]*ebpf.MapSpec{
+			"processes": {Name: "processes", Type: ebpf.Hash, KeySize: 4, ValueSize: 8, MaxEntries: maxEntries},
+			".rodata":   {Name: ".rodata", Type: ebpf.Array, KeySize: 4, ValueSize: 16, MaxEntries: 1},
+		}}
+	}
+
+	BeforeEach(func() {
+		pinPath = GinkgoT().TempDir()
+	})
+
+	It("versions the objects by their content, constants and map sizes", func() {
+		object := []byte("kepler")
+		constants := map[string]interface{}{"SAMPLE_RATE": int32(0), "NUM_HW_COUNTERS": int32(4)}
+		version := pinVersion(object, specs(1024), constants)
+		Expect(version).To(HaveLen(16))
+		Expect(pinVersion(object, specs(1024), map[string]interface{}{"NUM_HW_COUNTERS": int32(4), "SAMPLE_RATE": int32(0)})).To(Equal(version))
+
+		Expect(pinVersion([]byte("kepler2"), specs(1024), constants)).NotTo(Equal(version))
+		Expect(pinVersion(object, specs(2048), constants)).NotTo(Equal(version))
+		Expect(pinVersion(object, specs(1024), map[string]interface{}{"SAMPLE_RATE": int32(1), "NUM_HW_COUNTERS": int32(4)})).NotTo(Equal(version))
+	})
+
+	It("does not pin if no pin path is configured", func() {
+		p, err := newPinner("", "v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p).To(BeNil())
+		Expect(p.collectionOptions(specs(1024))).To(BeNil())
+		l := &pinnableLink{}
+		Expect(p.attach("sched_switch", func() (link.Link, error) { return l, nil })).To(BeIdenticalTo(l))
+		Expect(l.path).To(BeEmpty())
+	})
+
+	It("pins the maps by name except the global variables", func() {
+		p, err := newPinner(pinPath, "v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.adoptedMaps).To(BeFalse())
+
+		s := specs(1024)
+		opts := p.collectionOptions(s)
+		Expect(opts.Maps.PinPath).To(Equal(filepath.Join(pinPath, "v1", "maps")))
+		Expect(s.Maps["processes"].Pinning).To(Equal(ebpf.PinByName))
+		Expect(s.Maps[".rodata"].Pinning).To(Equal(ebpf.PinNone))
+
+		Expect(os.WriteFile(filepath.Join(p.mapsDir(), "processes"), nil, 0o600)).To(Succeed())
+		p, err = newPinner(pinPath, "v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.adoptedMaps).To(BeTrue())
+	})
+
+	It("pins the links of the attached programs and unpins the stale objects", func() {
+		Expect(os.MkdirAll(filepath.Join(pinPath, "v0", "links"), 0o700)).To(Succeed())
+		p, err := newPinner(pinPath, "v1")
+		Expect(err).NotTo(HaveOccurred())
+		// the link of a program no longer attached
+		Expect(os.WriteFile(filepath.Join(p.linksDir(), "softirq_entry"), nil, 0o600)).To(Succeed())
+
+		l := &pinnableLink{}
+		Expect(p.attach("sched_switch", func() (link.Link, error) { return l, nil })).To(BeIdenticalTo(l))
+		Expect(l.path).To(Equal(filepath.Join(pinPath, "v1", "links", "sched_switch")))
+
+		p.removeStale()
+		Expect(filepath.Join(pinPath, "v0")).NotTo(BeADirectory())
+		Expect(filepath.Join(p.linksDir(), "softirq_entry")).NotTo(BeAnExistingFile())
+		Expect(l.path).To(BeAnExistingFile())
+	})
+})
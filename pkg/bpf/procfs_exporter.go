@@ -0,0 +1,494 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bpf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+	"golang.org/x/sys/unix"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// userHZ is the frequency of the clock ticks the CPU time is reported in by procfs, USER_HZ is 100 on Linux
+const userHZ = 100
+
+// procfsExporter is the Exporter used when the eBPF programs cannot be loaded, e.g. on kernels without BTF or
+// when the BPF capabilities are not granted. At each collection, it reads the CPU time of the processes from
+// procfs and the CPU usage of their leaf cgroup from cgroupfs, the CPU usage of a leaf cgroup not spent by its
+// running processes being the CPU time of the processes that exited.
+// The CPU time is only as precise as the clock ticks of procfs and is not split per socket. The hardware counters,
+// if enabled, are counted per cgroup and split among its processes by their CPU time.
+type procfsExporter struct {
+	procPath   string
+	cgroupPath string
+	cgroupV2   bool
+	// cgroupID returns the id of the cgroup at path
+	cgroupID func(path string) (uint64, error)
+
+	// processes and cgroups hold the CPU time read at the last collection
+	processes map[uint64]procfsProcess
+	cgroups   map[uint64]*procfsCgroup
+	// cgroupIDs caches the ids of the cgroup paths seen at the last collection
+	cgroupIDs map[string]uint64
+	collected bool
+	// exited holds the CPU time of the processes that exited, per cgroup, until it is collected
+	exited []ProcessMetrics
+
+	// hwEvents are the perf events of the configured hardware counters, the ones not counted are nil
+	hwEvents []*perfEvent
+	numCPU   int
+
+	enabledHardwareCounters sets.Set[string]
+	enabledSoftwareCounters sets.Set[string]
+}
+
+type procfsProcess struct {
+	// startTime tells a process apart from a previous process with the same pid
+	startTime uint64
+	// cpuTime is in microseconds
+	cpuTime uint64
+}
+
+type procfsCgroup struct {
+	path string
+	// usage is the CPU usage in microseconds
+	usage uint64
+	// events holds the perf events of each CPU for each hardware counter and counters their last count
+	events   [][]int
+	counters []uint64
+}
+
+// NewProcfsExporter returns the Exporter reading the CPU time of the processes from procfs.
+func NewProcfsExporter() Exporter {
+	byteOrder := utils.DetermineHostByteOrder()
+	e := newProcfsExporter("/proc", "/sys/fs/cgroup", func(path string) (uint64, error) {
+		return utils.GetCgroupIDFromPath(byteOrder, path)
+	})
+	if config.ExposeHardwareCounterMetrics() && config.IsProcfsCgroupHWCountersEnabled() {
+		e.initHardwareCounters(getCPUCores())
+	}
+	return e
+}
+
+func newProcfsExporter(procPath, cgroupPath string, cgroupID func(path string) (uint64, error)) *procfsExporter {
+	e := &procfsExporter{
+		procPath:                procPath,
+		cgroupPath:              cgroupPath,
+		cgroupV2:                utils.IsFileExists(filepath.Join(cgroupPath, "cgroup.controllers")),
+		cgroupID:                cgroupID,
+		processes:               map[uint64]procfsProcess{},
+		cgroups:                 map[uint64]*procfsCgroup{},
+		cgroupIDs:               map[string]uint64{},
+		enabledHardwareCounters: sets.New[string](),
+		enabledSoftwareCounters: sets.New[string](config.CPUTime),
+	}
+	if !e.cgroupV2 {
+		klog.Warningf("cgroup v2 is not mounted on %s, the CPU time of the exited processes is not accounted", cgroupPath)
+	}
+	return e
+}
+
+// initHardwareCounters resolves the configured hardware counters, a counter whose event cannot be counted for the
+// root cgroup is not enabled.
+func (e *procfsExporter) initHardwareCounters(numCPU int) {
+	if !e.cgroupV2 {
+		klog.Warningf("the hardware counters are not counted per cgroup without cgroup v2")
+		return
+	}
+	root, err := os.Open(e.cgroupPath)
+	if err != nil {
+		klog.Warningf("failed to open the root cgroup, the hardware counters are not counted: %v", err)
+		return
+	}
+	defer root.Close()
+
+	e.numCPU = numCPU
+	names := config.BPFHwCounters()
+	e.hwEvents = make([]*perfEvent, len(names))
+	for i, event := range config.HWCounters() {
+		attr, err := parsePerfEvent(event)
+		if err != nil {
+			klog.Warningf("Failed to resolve perf event %q: %v", event, err)
+			continue
+		}
+		fds, err := unixOpenCgroupPerfEvent(attr, int(root.Fd()), 1)
+		if err != nil {
+			klog.Warningf("Failed to open perf event %q for the cgroups: %v", event, err)
+			continue
+		}
+		unixClosePerfEvents(fds)
+		e.hwEvents[i] = &attr
+		e.enabledHardwareCounters.Insert(names[i])
+	}
+}
+
+func (e *procfsExporter) SupportedMetrics() SupportedMetrics {
+	return SupportedMetrics{
+		HardwareCounters: e.enabledHardwareCounters.Clone(),
+		SoftwareCounters: e.enabledSoftwareCounters.Clone(),
+		Source:           SourceProcfs,
+	}
+}
+
+func (e *procfsExporter) Detach() {
+	for _, cg := range e.cgroups {
+		cg.closeEvents()
+	}
+	e.cgroups = map[uint64]*procfsCgroup{}
+}
+
+func (e *procfsExporter) CollectProcesses() ([]ProcessMetrics, error) {
+	entries, err := os.ReadDir(e.procPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the processes: %w", err)
+	}
+	processes := make(map[uint64]procfsProcess, len(entries))
+	cgroupIDs := map[string]uint64{}
+	// CPU time of the running processes of each cgroup, the cgroups without running processes are not listed
+	cgroupTime := map[uint64]uint64{}
+	cgroupPaths := map[uint64]string{}
+	samples := []ProcessMetrics{}
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		comm, process, err := readProcStat(filepath.Join(e.procPath, entry.Name(), "stat"))
+		if err != nil {
+			// the process exited
+			continue
+		}
+		processes[pid] = process
+		var delta uint64
+		if prev, ok := e.processes[pid]; ok && prev.startTime == process.startTime {
+			if process.cpuTime > prev.cpuTime {
+				delta = process.cpuTime - prev.cpuTime
+			}
+		} else if e.collected {
+			// the process started after the last collection
+			delta = process.cpuTime
+		}
+
+		var cgroupID uint64
+		if e.cgroupV2 {
+			path, err := readProcCgroupPath(filepath.Join(e.procPath, entry.Name(), "cgroup"))
+			if err == nil {
+				path = filepath.Join(e.cgroupPath, path)
+				cgroupID, err = e.resolveCgroupID(path, cgroupIDs)
+			}
+			if err != nil {
+				klog.V(6).Infof("failed to resolve the cgroup of pid %d: %v", pid, err)
+			} else {
+				cgroupTime[cgroupID] += delta
+				cgroupPaths[cgroupID] = path
+			}
+		}
+
+		if delta == 0 {
+			continue
+		}
+		sample := ProcessMetrics{ProcessCounters: ProcessCounters{CgroupId: cgroupID, Pid: pid, ProcessRunTime: delta}}
+		for i := 0; i < len(comm) && i < len(sample.Comm)-1; i++ {
+			sample.Comm[i] = int8(comm[i])
+		}
+		samples = append(samples, sample)
+	}
+	e.processes = processes
+	e.cgroupIDs = cgroupIDs
+	if e.cgroupV2 {
+		e.exited = append(e.exited, e.updateCgroups(cgroupTime, cgroupPaths, samples)...)
+	}
+	e.collected = true
+	return samples, nil
+}
+
+// resolveCgroupID returns the id of the cgroup at path, the ids are cached for the next collection in cgroupIDs
+func (e *procfsExporter) resolveCgroupID(path string, cgroupIDs map[string]uint64) (uint64, error) {
+	if id, ok := cgroupIDs[path]; ok {
+		return id, nil
+	}
+	id, ok := e.cgroupIDs[path]
+	if !ok {
+		var err error
+		if id, err = e.cgroupID(path); err != nil {
+			return 0, err
+		}
+	}
+	cgroupIDs[path] = id
+	return id, nil
+}
+
+// updateCgroups reads the CPU usage and the hardware counters of the cgroups, splits the counters of each cgroup
+// among its processes and returns the CPU time and counters of the processes that exited. A cgroup is tracked
+// while it has processes, the processes exited from a cgroup seen for the first time are not accounted.
+// The cgroups with child cgroups, including the root cgroup, are not tracked: their usage includes the CPU time of
+// their descendants, which is already accounted.
+func (e *procfsExporter) updateCgroups(cgroupTime map[uint64]uint64, cgroupPaths map[uint64]string, samples []ProcessMetrics) []ProcessMetrics {
+	cgroupSamples := map[uint64][]int{}
+	for i := range samples {
+		cgroupSamples[samples[i].CgroupId] = append(cgroupSamples[samples[i].CgroupId], i)
+	}
+	ids := sets.KeySet(cgroupTime).Union(sets.KeySet(e.cgroups))
+	cgroups := make(map[uint64]*procfsCgroup, len(cgroupTime))
+	exited := []ProcessMetrics{}
+	for id := range ids {
+		cg, tracked := e.cgroups[id]
+		if !tracked {
+			cg = &procfsCgroup{path: cgroupPaths[id]}
+		}
+		if !e.isLeafCgroup(cg.path) {
+			// the usage and the perf events of the cgroup also count its descendants, the CPU time of its
+			// processes is only read from procfs
+			cg.closeEvents()
+			continue
+		}
+		usage, err := readCgroupUsage(filepath.Join(cg.path, "cpu.stat"))
+		if err != nil {
+			// the cgroup was removed
+			cg.closeEvents()
+			continue
+		}
+		if !tracked {
+			cg.usage = usage
+			e.openEvents(cg)
+			cgroups[id] = cg
+			continue
+		}
+
+		var usageDelta uint64
+		if usage > cg.usage {
+			usageDelta = usage - cg.usage
+		}
+		cg.usage = usage
+		counters := cg.readCounters()
+		runningTime, running := cgroupTime[id]
+		if running {
+			cgroups[id] = cg
+		} else {
+			// the cgroup has no more processes, the ones that exited since the last collection are still accounted
+			cg.closeEvents()
+		}
+		total := usageDelta
+		if runningTime > total {
+			// the clock ticks of procfs are less precise than the cgroup usage
+			total = runningTime
+		}
+		if total == 0 {
+			continue
+		}
+		for _, i := range cgroupSamples[id] {
+			splitCounters(&samples[i], counters, samples[i].ProcessRunTime, total)
+		}
+		if exitedTime := total - runningTime; exitedTime > 0 {
+			sample := ProcessMetrics{ProcessCounters: ProcessCounters{CgroupId: id, ProcessRunTime: exitedTime}}
+			splitCounters(&sample, counters, exitedTime, total)
+			exited = append(exited, sample)
+		}
+	}
+	e.cgroups = cgroups
+	return exited
+}
+
+// splitCounters sets the share of the counters of the cgroup of the process, by its CPU time
+func splitCounters(sample *ProcessMetrics, counters []uint64, cpuTime, total uint64) {
+	for i, counter := range counters {
+		sample.HwCounters[i] = uint64(float64(counter) * float64(cpuTime) / float64(total))
+	}
+}
+
+// isLeafCgroup tells whether the cgroup at path has no child cgroups. The root cgroup, which holds the kernel
+// threads and whose usage is the CPU usage of the node, is never a leaf.
+func (e *procfsExporter) isLeafCgroup(path string) bool {
+	if filepath.Clean(path) == filepath.Clean(e.cgroupPath) {
+		return false
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		// the cgroup was removed, which reading its usage reports
+		return true
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// openEvents opens the perf events of the enabled hardware counters for the cgroup
+func (e *procfsExporter) openEvents(cg *procfsCgroup) {
+	if len(e.enabledHardwareCounters) == 0 {
+		return
+	}
+	dir, err := os.Open(cg.path)
+	if err != nil {
+		klog.V(3).Infof("failed to open cgroup %s, its hardware counters are not counted: %v", cg.path, err)
+		return
+	}
+	defer dir.Close()
+	cg.events = make([][]int, len(e.hwEvents))
+	cg.counters = make([]uint64, len(e.hwEvents))
+	for i, event := range e.hwEvents {
+		if event == nil {
+			continue
+		}
+		fds, err := unixOpenCgroupPerfEvent(*event, int(dir.Fd()), e.numCPU)
+		if err != nil {
+			klog.V(3).Infof("failed to open the hardware counters of cgroup %s: %v", cg.path, err)
+			continue
+		}
+		cg.events[i] = fds
+	}
+}
+
+// readCounters returns the increase of the hardware counters of the cgroup since the last read
+func (cg *procfsCgroup) readCounters() []uint64 {
+	if cg.events == nil {
+		return nil
+	}
+	deltas := make([]uint64, len(cg.events))
+	for i, fds := range cg.events {
+		if fds == nil {
+			continue
+		}
+		count := readPerfEvents(fds)
+		if count > cg.counters[i] {
+			deltas[i] = count - cg.counters[i]
+		}
+		cg.counters[i] = count
+	}
+	return deltas
+}
+
+func (cg *procfsCgroup) closeEvents() {
+	for _, fds := range cg.events {
+		unixClosePerfEvents(fds)
+	}
+	cg.events = nil
+}
+
+func (e *procfsExporter) CollectExitedProcesses() ([]ProcessMetrics, error) {
+	exited := e.exited
+	e.exited = nil
+	return exited, nil
+}
+
+func (e *procfsExporter) CollectCgroupBlockIO() (map[uint64]BlockIOMetrics, error) {
+	return map[uint64]BlockIOMetrics{}, nil
+}
+
+// CollectCgroups returns nothing, the counters are not aggregated per cgroup when they are read from procfs
+func (e *procfsExporter) CollectCgroups() ([]ProcessMetrics, error) {
+	return []ProcessMetrics{}, nil
+}
+
+// CollectIRQs returns nothing, procfs only counts the interrupts and not the time spent handling them
+func (e *procfsExporter) CollectIRQs() ([]IRQMetrics, error) {
+	return nil, nil
+}
+
+// readPerfEvents returns the sum of the counts of the perf events, scaled by the time they ran when the events
+// were multiplexed
+func readPerfEvents(fds []int) uint64 {
+	var total uint64
+	// value, time enabled and time running, per the read format of the events
+	buf := make([]byte, 24)
+	for _, fd := range fds {
+		if n, err := unix.Read(fd, buf); err != nil || n != len(buf) {
+			continue
+		}
+		value := binary.NativeEndian.Uint64(buf[0:8])
+		enabled := binary.NativeEndian.Uint64(buf[8:16])
+		running := binary.NativeEndian.Uint64(buf[16:24])
+		if running > 0 && running < enabled {
+			value = uint64(float64(value) * float64(enabled) / float64(running))
+		}
+		total += value
+	}
+	return total
+}
+
+// readProcStat returns the command, the start time and the CPU time of a process from its /proc/<pid>/stat
+func readProcStat(path string) (string, procfsProcess, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", procfsProcess{}, err
+	}
+	stat := string(data)
+	// the command is between parentheses and can contain spaces and parentheses
+	start, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if start < 0 || end < start {
+		return "", procfsProcess{}, fmt.Errorf("malformed %s", path)
+	}
+	// fields from the state, the third field of the file
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return "", procfsProcess{}, fmt.Errorf("malformed %s", path)
+	}
+	var values [3]uint64
+	// utime, stime and starttime are the fields 14, 15 and 22
+	for i, field := range []int{14, 15, 22} {
+		if values[i], err = strconv.ParseUint(fields[field-3], 10, 64); err != nil {
+			return "", procfsProcess{}, fmt.Errorf("malformed %s: %w", path, err)
+		}
+	}
+	return stat[start+1 : end], procfsProcess{
+		startTime: values[2],
+		cpuTime:   (values[0] + values[1]) * 1000000 / userHZ,
+	}, nil
+}
+
+// readProcCgroupPath returns the cgroup v2 path of a process from its /proc/<pid>/cgroup
+func readProcCgroupPath(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if cgroup, found := strings.CutPrefix(scanner.Text(), "0::"); found {
+			return cgroup, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 in %s", path)
+}
+
+// readCgroupUsage returns the CPU usage in microseconds of a cgroup from its cpu.stat
+func readCgroupUsage(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if usage, found := strings.CutPrefix(scanner.Text(), "usage_usec "); found {
+			return strconv.ParseUint(strings.TrimSpace(usage), 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no usage_usec in %s", path)
+}
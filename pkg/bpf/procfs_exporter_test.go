@@ -0,0 +1,141 @@
+package bpf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Procfs exporter", func() {
+	var (
+		procPath   string
+		cgroupPath string
+		e          *procfsExporter
+	)
+
+	writeFile := func(path, content string) {
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+	}
+	writeProcess := func(pid int, comm, cgroup string, utime, stime, startTime uint64) {
+		dir := filepath.Join(procPath, fmt.Sprint(pid))
+		writeFile(filepath.Join(dir, "stat"), fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 1 0 %d 1000 100\n",
+			pid, comm, pid, pid, utime, stime, startTime))
+		writeFile(filepath.Join(dir, "cgroup"), "0::"+cgroup+"\n")
+	}
+	writeUsage := func(cgroup string, usage uint64) {
+		writeFile(filepath.Join(cgroupPath, cgroup, "cpu.stat"), fmt.Sprintf("usage_usec %d\nuser_usec 0\nsystem_usec 0\n", usage))
+	}
+
+	BeforeEach(func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		procPath = GinkgoT().TempDir()
+		cgroupPath = GinkgoT().TempDir()
+		writeFile(filepath.Join(cgroupPath, "cgroup.controllers"), "cpu memory\n")
+		cgroupIDs := map[string]uint64{
+			filepath.Join(cgroupPath, "/"):        1,
+			filepath.Join(cgroupPath, "/pod/app"): 42,
+		}
+		e = newProcfsExporter(procPath, cgroupPath, func(path string) (uint64, error) {
+			if id, ok := cgroupIDs[path]; ok {
+				return id, nil
+			}
+			return 0, fmt.Errorf("unknown cgroup %s", path)
+		})
+	})
+
+	It("reports the CPU time of the processes since the last collection", func() {
+		writeProcess(100, "my (odd) app", "/pod/app", 10, 5, 1000)
+		writeProcess(101, "worker", "/pod/app", 20, 0, 1001)
+		writeUsage("/pod/app", 1000000)
+
+		// the first collection only reads the initial CPU time
+		samples, err := e.CollectProcesses()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(samples).To(BeEmpty())
+
+		// 100 ran 100ms, 101 exited after running 50ms and 102 started and ran 30ms
+		writeProcess(100, "my (odd) app", "/pod/app", 20, 5, 1000)
+		Expect(os.RemoveAll(filepath.Join(procPath, "101"))).To(Succeed())
+		writeProcess(102, "job", "/pod/app", 2, 1, 2000)
+		writeUsage("/pod/app", 1180000)
+
+		samples, err = e.CollectProcesses()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(samples).To(HaveLen(2))
+		runTime := map[uint64]uint64{}
+		for _, sample := range samples {
+			Expect(sample.CgroupId).To(Equal(uint64(42)))
+			runTime[sample.Pid] = sample.ProcessRunTime
+		}
+		Expect(runTime).To(Equal(map[uint64]uint64{100: 100000, 102: 30000}))
+
+		exited, err := e.CollectExitedProcesses()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exited).To(HaveLen(1))
+		Expect(exited[0].CgroupId).To(Equal(uint64(42)))
+		Expect(exited[0].ProcessRunTime).To(Equal(uint64(50000)))
+
+		exited, err = e.CollectExitedProcesses()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exited).To(BeEmpty())
+	})
+
+	It("does not account a process whose pid was reused as running since the last collection", func() {
+		writeProcess(100, "app", "/pod/app", 10, 0, 1000)
+		writeUsage("/pod/app", 100000)
+		_, err := e.CollectProcesses()
+		Expect(err).NotTo(HaveOccurred())
+
+		writeProcess(100, "other", "/pod/app", 3, 0, 5000)
+		samples, err := e.CollectProcesses()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(samples).To(HaveLen(1))
+		Expect(samples[0].ProcessRunTime).To(Equal(uint64(30000)))
+	})
+
+	It("does not account the CPU usage of the root cgroup as exited processes", func() {
+		writeProcess(2, "kthreadd", "/", 10, 0, 1)
+		writeProcess(100, "app", "/pod/app", 10, 0, 1000)
+		writeUsage("/", 1000000)
+		writeUsage("/pod/app", 100000)
+		_, err := e.CollectProcesses()
+		Expect(err).NotTo(HaveOccurred())
+
+		// the usage of the root cgroup also counts the CPU time of /pod/app
+		writeProcess(2, "kthreadd", "/", 20, 0, 1)
+		writeProcess(100, "app", "/pod/app", 30, 0, 1000)
+		writeUsage("/", 5000000)
+		writeUsage("/pod/app", 300000)
+		samples, err := e.CollectProcesses()
+		Expect(err).NotTo(HaveOccurred())
+		runTime := map[uint64]uint64{}
+		for _, sample := range samples {
+			runTime[sample.Pid] = sample.ProcessRunTime
+		}
+		Expect(runTime).To(Equal(map[uint64]uint64{2: 100000, 100: 200000}))
+
+		exited, err := e.CollectExitedProcesses()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exited).To(BeEmpty())
+	})
+
+	It("splits the hardware counters of a cgroup by the CPU time of its processes", func() {
+		sample := ProcessMetrics{ProcessCounters: ProcessCounters{ProcessRunTime: 30000}}
+		splitCounters(&sample, []uint64{1000, 0, 90}, sample.ProcessRunTime, 90000)
+		Expect(sample.HwCounters[:3]).To(Equal([]uint64{333, 0, 30}))
+	})
+
+	It("labels its metrics with the procfs source", func() {
+		metrics := e.SupportedMetrics()
+		Expect(metrics.Source).To(Equal(SourceProcfs))
+		Expect(metrics.SoftwareCounters.UnsortedList()).To(ConsistOf(config.CPUTime))
+		Expect(metrics.HardwareCounters).To(BeEmpty())
+	})
+})
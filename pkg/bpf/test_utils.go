@@ -6,14 +6,17 @@ import (
 )
 
 type mockExporter struct {
-	softwareCounters sets.Set[string]
-	hardwareCounters sets.Set[string]
+	softwareCounters  sets.Set[string]
+	hardwareCounters  sets.Set[string]
+	source            string
+	cgroupAggregation bool
 }
 
 func DefaultSupportedMetrics() SupportedMetrics {
 	return SupportedMetrics{
 		HardwareCounters: defaultHardwareCounters(),
 		SoftwareCounters: defaultSoftwareCounters(),
+		Source:           SourceEBPF,
 	}
 }
 
@@ -28,15 +31,19 @@ func defaultSoftwareCounters() sets.Set[string] {
 
 func NewMockExporter(bpfSupportedMetrics SupportedMetrics) Exporter {
 	return &mockExporter{
-		softwareCounters: bpfSupportedMetrics.SoftwareCounters.Clone(),
-		hardwareCounters: bpfSupportedMetrics.HardwareCounters.Clone(),
+		softwareCounters:  bpfSupportedMetrics.SoftwareCounters.Clone(),
+		hardwareCounters:  bpfSupportedMetrics.HardwareCounters.Clone(),
+		source:            bpfSupportedMetrics.Source,
+		cgroupAggregation: bpfSupportedMetrics.CgroupAggregation,
 	}
 }
 
 func (m *mockExporter) SupportedMetrics() SupportedMetrics {
 	return SupportedMetrics{
-		HardwareCounters: m.hardwareCounters,
-		SoftwareCounters: m.softwareCounters,
+		HardwareCounters:  m.hardwareCounters,
+		SoftwareCounters:  m.softwareCounters,
+		Source:            m.source,
+		CgroupAggregation: m.cgroupAggregation,
 	}
 }
 
@@ -45,15 +52,31 @@ func (m *mockExporter) Detach() {}
 func (m *mockExporter) CollectProcesses() ([]ProcessMetrics, error) {
 	return []ProcessMetrics{
 		{
-			CgroupId:       0,
-			Pid:            0,
-			ProcessRunTime: 0,
-			CpuCycles:      0,
-			CpuInstr:       0,
-			CacheMiss:      0,
-			PageCacheHit:   0,
-			VecNr:          [10]uint16{},
-			Comm:           [16]int8{},
+			ProcessCounters: ProcessCounters{
+				CgroupId:       0,
+				Pid:            0,
+				ProcessRunTime: 0,
+				HwCounters:     [config.MaxHWCounters]uint64{},
+				PageCacheHit:   0,
+				VecNr:          [10]uint16{},
+				Comm:           [16]int8{},
+			},
 		},
 	}, nil
 }
+
+func (m *mockExporter) CollectExitedProcesses() ([]ProcessMetrics, error) {
+	return []ProcessMetrics{}, nil
+}
+
+func (m *mockExporter) CollectCgroupBlockIO() (map[uint64]BlockIOMetrics, error) {
+	return map[uint64]BlockIOMetrics{}, nil
+}
+
+func (m *mockExporter) CollectCgroups() ([]ProcessMetrics, error) {
+	return []ProcessMetrics{}, nil
+}
+
+func (m *mockExporter) CollectIRQs() ([]IRQMetrics, error) {
+	return nil, nil
+}
@@ -28,17 +28,71 @@ const (
 	IRQNetTX = 2
 	IRQNetRX = 3
 	IRQBlock = 4
+	// IRQHardIRQ is the index of the hardirqs after the softirq vectors, per HARDIRQ in kepler.bpf.h
+	IRQHardIRQ = 10
+	// NumIRQs is the number of softirq vectors and hardirqs the time spent handling the interrupts is measured for
+	NumIRQs = 11
+
+	// MaxSockets is the number of sockets the CPU time and hardware counters of a process are split by,
+	// per MAX_SOCKETS in kepler.bpf.h
+	MaxSockets = 4
 )
 
-type ProcessMetrics = keplerProcessMetricsT
+// IRQNames are the names of the softirq vectors followed by the hardirqs
+var IRQNames = [NumIRQs]string{"hi", "timer", "net_tx", "net_rx", "block", "irq_poll", "tasklet", "sched", "hrtimer", "rcu", "hardirq"}
+
+// ProcessCounters are the counters of a process, or of a cgroup, as they are read from the eBPF maps
+type ProcessCounters = keplerProcessMetricsT
+
+// SocketMetrics are the CPU time and hardware counters of a process, or of a cgroup, on the CPUs of one socket
+type SocketMetrics = keplerRunMetricsT
+
+type ProcessMetrics struct {
+	ProcessCounters
+	// Sockets holds the CPU time and hardware counters of ProcessCounters split by the socket of the CPUs, indexed
+	// by socket id. It is nil if they are not split, e.g. on the nodes with a single socket.
+	Sockets []SocketMetrics
+}
+
+type BlockIOMetrics = keplerBlockIoMetricsT
+
+// IRQMetrics are the time in ns spent handling an interrupt and the number of interrupts handled
+type IRQMetrics = keplerIrqMetricsT
 
 type Exporter interface {
 	SupportedMetrics() SupportedMetrics
 	Detach()
 	CollectProcesses() ([]ProcessMetrics, error)
+	// CollectExitedProcesses returns the counters of the processes that exited since the last call,
+	// aggregated per cgroup. The Pid and Comm of the returned metrics are not set.
+	CollectExitedProcesses() ([]ProcessMetrics, error)
+	// CollectCgroupBlockIO returns the block I/O completed since the last call, keyed by the id of the cgroup
+	// the I/O was issued for.
+	CollectCgroupBlockIO() (map[uint64]BlockIOMetrics, error)
+	// CollectCgroups returns the counters of the cgroups since the last call, including the processes that exited,
+	// if they are aggregated per cgroup (see SupportedMetrics.CgroupAggregation). The Pid and Comm of the returned
+	// metrics are not set.
+	CollectCgroups() ([]ProcessMetrics, error)
+	// CollectIRQs returns the time spent handling the interrupts on all the CPUs since the programs were attached,
+	// indexed as IRQNames, or nil if the interrupts are not measured.
+	CollectIRQs() ([]IRQMetrics, error)
 }
 
+const (
+	// SourceEBPF is the source of the resource utilization collected by the eBPF programs
+	SourceEBPF = "ebpf"
+	// SourceProcfs is the source of the resource utilization read from procfs and cgroupfs when the eBPF programs
+	// cannot be loaded. Only the CPU time is sampled per process and the hardware counters are counted per cgroup,
+	// so the power attribution is less accurate.
+	SourceProcfs = "procfs"
+)
+
 type SupportedMetrics struct {
 	HardwareCounters sets.Set[string]
 	SoftwareCounters sets.Set[string]
+	// Source is where the resource utilization is collected from, SourceEBPF or SourceProcfs
+	Source string
+	// CgroupAggregation is true if the counters are aggregated per cgroup. CollectProcesses then only returns the
+	// processes if their metrics are needed, and CollectExitedProcesses returns nothing.
+	CgroupAggregation bool
 }
@@ -18,6 +18,20 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// numHWCounters is the number of hardware counters the tests configure, as the CPU cycles, instructions and cache
+// misses counted by default
+const numHWCounters = 3
+
+// Per enum map_stat in kepler.bpf.h
+const (
+	mapStatProcessesInserts      = 0
+	mapStatProcessesInsertErrors = 2
+	mapStatPidTimeMisses         = 3
+)
+
+// hardirqIndex is the index of the hardirqs in the irq_times map, after the softirq vectors, per HARDIRQ in kepler.bpf.h
+const hardirqIndex = 10
+
 func TestBpf(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Bpf Suite")
@@ -49,9 +63,7 @@ var _ = Describe("BPF Exporter", func() {
 			CgroupId:       0,
 			Pid:            0,
 			ProcessRunTime: 0,
-			CpuCycles:      0,
-			CpuInstr:       0,
-			CacheMiss:      0,
+			HwCounters:     [8]uint64{},
 			PageCacheHit:   0,
 			VecNr:          [10]uint16{},
 			Comm:           [16]int8{},
@@ -108,6 +120,127 @@ var _ = Describe("BPF Exporter", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("counts the network traffic of the processes", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST": int32(1),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		key := uint32(42)
+		err = obj.Processes.Put(key, testProcessMetricsT{Pid: 42})
+		Expect(err).NotTo(HaveOccurred())
+
+		// 1500 bytes sent, 3000 bytes in 2 packets received and 3 packets transmitted from a socket of TGID 42
+		out, err := obj.TestKeplerNetTrace.Run(&ebpf.RunOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(uint32(0)))
+
+		var res testProcessMetricsT
+		err = obj.Processes.Lookup(key, &res)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.NetTxBytes).To(Equal(uint64(1500)))
+		// the packet of the socket without owner is not counted
+		Expect(res.NetTxPackets).To(Equal(uint64(3)))
+		Expect(res.NetRxBytes).To(Equal(uint64(3000)))
+		Expect(res.NetRxPackets).To(Equal(uint64(2)))
+
+		var owner testSockOwnerT
+		err = obj.SockOwners.Lookup(uint64(0x1000), &owner)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(owner).To(Equal(testSockOwnerT{Tgid: 42, CgroupId: 7}))
+	})
+
+	It("counts the block I/O of the cgroups", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST": int32(1),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		// a read of 4096 bytes and a write of 8192 bytes completed twice for cgroup 7
+		for i := 0; i < 2; i++ {
+			out, err := obj.TestKeplerBlockRqComplete.Run(&ebpf.RunOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal(uint32(0)))
+		}
+
+		var res testBlockIoMetricsT
+		err = obj.CgroupBlockIo.Lookup(uint64(7), &res)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res).To(Equal(testBlockIoMetricsT{ReadBytes: 8192, WriteBytes: 16384, ReadOps: 2, WriteOps: 2}))
+	})
+
+	It("counts the inserts of the processes and the missing start times", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST": int32(1),
+			"HW":   int32(0),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		// TGID 42 is only inserted once
+		for i := 0; i < 2; i++ {
+			out, err := obj.TestRegisterNewProcessIfNotExist.Run(&ebpf.RunOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal(uint32(0)))
+		}
+		// TGID 42 is switched out without a start time
+		runSchedSwitchTracepoint(&obj)
+
+		mapStat := func(stat uint32) uint64 {
+			var perCPU []uint64
+			Expect(obj.MapStats.Lookup(stat, &perCPU)).To(Succeed())
+			var sum uint64
+			for _, count := range perCPU {
+				sum += count
+			}
+			return sum
+		}
+		Expect(mapStat(mapStatProcessesInserts)).To(Equal(uint64(1)))
+		Expect(mapStat(mapStatProcessesInsertErrors)).To(BeZero())
+		Expect(mapStat(mapStatPidTimeMisses)).To(Equal(uint64(1)))
+	})
+
 	It("should increment the page hit counter efficiently", func() {
 		experiment := gmeasure.NewExperiment("Increment the page hit counter")
 		AddReportEntry(experiment.Name, experiment)
@@ -135,9 +268,7 @@ var _ = Describe("BPF Exporter", func() {
 			CgroupId:       0,
 			Pid:            0,
 			ProcessRunTime: 0,
-			CpuCycles:      0,
-			CpuInstr:       0,
-			CacheMiss:      0,
+			HwCounters:     [8]uint64{},
 			PageCacheHit:   0,
 			VecNr:          [10]uint16{},
 			Comm:           [16]int8{},
@@ -163,8 +294,9 @@ var _ = Describe("BPF Exporter", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		err = specs.RewriteConstants(map[string]interface{}{
-			"TEST": int32(1),
-			"HW":   int32(1),
+			"TEST":            int32(1),
+			"HW":              int32(1),
+			"NUM_HW_COUNTERS": int32(numHWCounters),
 		})
 		Expect(err).NotTo(HaveOccurred())
 
@@ -173,17 +305,16 @@ var _ = Describe("BPF Exporter", func() {
 		err = specs.LoadAndAssign(&obj, nil)
 		Expect(err).NotTo(HaveOccurred())
 
-		perfEvents, err := createHardwarePerfEvents(
-			obj.CpuInstructionsEventReader,
-			obj.CpuCyclesEventReader,
-			obj.CacheMissEventReader,
-		)
-		Expect(err).NotTo(HaveOccurred())
+		perfEvents, readers, err := createHardwarePerfEvents(obj.HwCountersEventReader, specs.Maps["hw_counters_event_reader"].InnerMap)
 		defer func() {
 			for _, fd := range perfEvents {
 				unix.Close(fd)
 			}
+			for _, reader := range readers {
+				reader.Close()
+			}
 		}()
+		Expect(err).NotTo(HaveOccurred())
 
 		// Register TGID 42 - This would be done by register_new_process_if_not_exist
 		// when we get a sched_switch event for a new process
@@ -193,9 +324,7 @@ var _ = Describe("BPF Exporter", func() {
 			CgroupId:       0,
 			Pid:            42,
 			ProcessRunTime: nsecs,
-			CpuCycles:      0,
-			CpuInstr:       0,
-			CacheMiss:      0,
+			HwCounters:     [8]uint64{},
 			PageCacheHit:   0,
 			VecNr:          [10]uint16{},
 			Comm:           [16]int8{},
@@ -214,9 +343,9 @@ var _ = Describe("BPF Exporter", func() {
 		var res testProcessMetricsT
 		err = obj.Processes.Lookup(key, &res)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(res.CpuCycles).To(BeNumerically(">", uint64(0)))
-		Expect(res.CpuInstr).To(BeNumerically(">", uint64(0)))
-		Expect(res.CacheMiss).To(BeNumerically(">", uint64(0)))
+		for i := 0; i < numHWCounters; i++ {
+			Expect(res.HwCounters[i]).To(BeNumerically(">", uint64(0)))
+		}
 
 		err = obj.Processes.Delete(key)
 		Expect(err).NotTo(HaveOccurred())
@@ -232,8 +361,9 @@ var _ = Describe("BPF Exporter", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		err = specs.RewriteConstants(map[string]interface{}{
-			"TEST": int32(1),
-			"HW":   int32(0),
+			"TEST":            int32(1),
+			"HW":              int32(0),
+			"NUM_HW_COUNTERS": int32(numHWCounters),
 		})
 		Expect(err).NotTo(HaveOccurred())
 
@@ -250,9 +380,7 @@ var _ = Describe("BPF Exporter", func() {
 			CgroupId:       0,
 			Pid:            42,
 			ProcessRunTime: nsecs,
-			CpuCycles:      0,
-			CpuInstr:       0,
-			CacheMiss:      0,
+			HwCounters:     [8]uint64{},
 			PageCacheHit:   0,
 			VecNr:          [10]uint16{},
 			Comm:           [16]int8{},
@@ -271,13 +399,238 @@ var _ = Describe("BPF Exporter", func() {
 		var res testProcessMetricsT
 		err = obj.Processes.Lookup(key, &res)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(res.CpuCycles).To(BeNumerically("==", uint64(0)))
+		Expect(res.HwCounters).To(Equal([8]uint64{}))
 		Expect(res.ProcessRunTime).To(BeNumerically(">", uint64(0)))
 
 		err = obj.Processes.Delete(key)
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("accounts the CPU time of the processes to the socket of the CPU", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST":        int32(1),
+			"HW":          int32(0),
+			"NUM_SOCKETS": int32(3),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		// CPU 0 is on socket 2
+		err = obj.CpuSockets.Put(uint32(0), uint32(2))
+		Expect(err).NotTo(HaveOccurred())
+
+		// TGID 42 was switched in 1ms ago
+		key := uint32(42)
+		err = obj.Processes.Put(key, testProcessMetricsT{Pid: 42})
+		Expect(err).NotTo(HaveOccurred())
+		err = obj.PidTimeMap.Put(key, getNSecs()-uint64(time.Millisecond))
+		Expect(err).NotTo(HaveOccurred())
+
+		runSchedSwitchTracepoint(&obj)
+
+		var res testProcessMetricsT
+		err = obj.Processes.Lookup(key, &res)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.ProcessRunTime).To(BeNumerically(">=", uint64(1000)))
+		var socketKey testSocketKeyT
+		var socketRes testRunMetricsT
+		iter := obj.ProcessSockets.Iterate()
+		Expect(iter.Next(&socketKey, &socketRes)).To(BeTrue())
+		Expect(socketKey).To(Equal(testSocketKeyT{Id: 42, Socket: 2}))
+		Expect(socketRes.ProcessRunTime).To(Equal(res.ProcessRunTime))
+		Expect(iter.Next(&socketKey, &socketRes)).To(BeFalse())
+		Expect(iter.Err()).NotTo(HaveOccurred())
+	})
+
+	It("moves the CPU time per socket of the exited processes to their cgroup", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST":        int32(1),
+			"HW":          int32(0),
+			"NUM_SOCKETS": int32(3),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		// TGID 42 of cgroup 7 ran 500us on socket 1 and exits on CPU 0, which is on socket 2
+		err = obj.CpuSockets.Put(uint32(0), uint32(2))
+		Expect(err).NotTo(HaveOccurred())
+		err = obj.Processes.Put(uint32(42), testProcessMetricsT{CgroupId: 7, Pid: 42, ProcessRunTime: 500})
+		Expect(err).NotTo(HaveOccurred())
+		err = obj.ProcessSockets.Put(testSocketKeyT{Id: 42, Socket: 1}, testRunMetricsT{ProcessRunTime: 500})
+		Expect(err).NotTo(HaveOccurred())
+
+		out, err := obj.TestKeplerProcessExit.Run(&ebpf.RunOptions{
+			Flags: uint32(1), // BPF_F_TEST_RUN_ON_CPU
+			CPU:   uint32(0),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(uint32(0)))
+
+		var socketKey testSocketKeyT
+		var socketRes testRunMetricsT
+		Expect(obj.ProcessSockets.Iterate().Next(&socketKey, &socketRes)).To(BeFalse())
+		err = obj.ExitedCgroupSockets.Lookup(testSocketKeyT{Id: 7, Socket: 1}, &socketRes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(socketRes.ProcessRunTime).To(Equal(uint64(500)))
+	})
+
+	It("does not split the CPU time of the processes per socket on a single socket", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST":        int32(1),
+			"HW":          int32(0),
+			"NUM_SOCKETS": int32(1),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		// TGID 42 was switched in 1ms ago
+		key := uint32(42)
+		err = obj.Processes.Put(key, testProcessMetricsT{Pid: 42})
+		Expect(err).NotTo(HaveOccurred())
+		err = obj.PidTimeMap.Put(key, getNSecs()-uint64(time.Millisecond))
+		Expect(err).NotTo(HaveOccurred())
+
+		runSchedSwitchTracepoint(&obj)
+
+		var res testProcessMetricsT
+		err = obj.Processes.Lookup(key, &res)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.ProcessRunTime).To(BeNumerically(">=", uint64(1000)))
+		var socketKey testSocketKeyT
+		var socketRes testRunMetricsT
+		Expect(obj.ProcessSockets.Iterate().Next(&socketKey, &socketRes)).To(BeFalse())
+	})
+
+	It("aggregates the CPU time per cgroup without tracking the processes", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST":               int32(1),
+			"HW":                 int32(0),
+			"CGROUP_AGGREGATION": int32(1),
+			"PROCESS_METRICS":    int32(0),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		// TGID 42 was switched in 1ms ago
+		err = obj.PidTimeMap.Put(uint32(42), getNSecs()-uint64(time.Millisecond))
+		Expect(err).NotTo(HaveOccurred())
+
+		runSchedSwitchTracepoint(&obj)
+
+		// the CPU time is accounted to the cgroup of the task running the test
+		var cgroupID uint64
+		var res testProcessMetricsT
+		entries := obj.Cgroups.Iterate()
+		Expect(entries.Next(&cgroupID, &res)).To(BeTrue())
+		Expect(entries.Next(&cgroupID, &res)).To(BeFalse())
+		Expect(entries.Err()).NotTo(HaveOccurred())
+		Expect(res.CgroupId).To(Equal(cgroupID))
+		Expect(res.ProcessRunTime).To(BeNumerically(">=", uint64(1000)))
+
+		var pid uint32
+		Expect(obj.Processes.Iterate().Next(&pid, &res)).To(BeFalse())
+	})
+
+	It("accounts the time of the interrupts and takes it from the interrupted task", func() {
+		// Remove resource limits for kernels <5.11.
+		err := rlimit.RemoveMemlock()
+		Expect(err).NotTo(HaveOccurred())
+
+		// Load eBPF Specs
+		specs, err := loadTest()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = specs.RewriteConstants(map[string]interface{}{
+			"TEST":            int32(1),
+			"HW":              int32(0),
+			"IRQ_ATTRIBUTION": int32(1),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var obj testObjects
+		// Load eBPF objects
+		err = specs.LoadAndAssign(&obj, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer obj.Close()
+
+		out, err := obj.TestKeplerIrqTrace.Run(&ebpf.RunOptions{
+			Flags: uint32(1), // BPF_F_TEST_RUN_ON_CPU
+			CPU:   uint32(0),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(uint32(0)))
+
+		var softirq, hardirq []testIrqMetricsT
+		Expect(obj.IrqTimes.Lookup(uint32(3), &softirq)).To(Succeed())
+		Expect(obj.IrqTimes.Lookup(uint32(hardirqIndex), &hardirq)).To(Succeed())
+		Expect(softirq[0].Count).To(Equal(uint64(1)))
+		Expect(hardirq[0].Count).To(Equal(uint64(1)))
+
+		// the time of the hardirq is not softirq time, both are taken from the interrupted task
+		var state []testIrqStateT
+		Expect(obj.IrqState.Lookup(uint32(0), &state)).To(Succeed())
+		Expect(state[0]).To(Equal(testIrqStateT{TaskIrqTime: softirq[0].Time + hardirq[0].Time}))
+
+		// the interrupted time is reset once the task is switched out
+		err = obj.PidTimeMap.Put(uint32(42), getNSecs()-uint64(time.Millisecond))
+		Expect(err).NotTo(HaveOccurred())
+		runSchedSwitchTracepoint(&obj)
+		Expect(obj.IrqState.Lookup(uint32(0), &state)).To(Succeed())
+		Expect(state[0].TaskIrqTime).To(BeZero())
+	})
+
 	It("efficiently collects hardware counter metrics for sched_switch events", Label("perf_event"), func() {
 		experiment := gmeasure.NewExperiment("sched_switch tracepoint")
 		AddReportEntry(experiment.Name, experiment)
@@ -290,7 +643,8 @@ var _ = Describe("BPF Exporter", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		err = specs.RewriteConstants(map[string]interface{}{
-			"TEST": int32(1),
+			"TEST":            int32(1),
+			"NUM_HW_COUNTERS": int32(numHWCounters),
 		})
 		Expect(err).NotTo(HaveOccurred())
 
@@ -299,17 +653,16 @@ var _ = Describe("BPF Exporter", func() {
 		err = specs.LoadAndAssign(&obj, nil)
 		Expect(err).NotTo(HaveOccurred())
 
-		perfEvents, err := createHardwarePerfEvents(
-			obj.CpuInstructionsEventReader,
-			obj.CpuCyclesEventReader,
-			obj.CacheMissEventReader,
-		)
-		Expect(err).NotTo(HaveOccurred())
+		perfEvents, readers, err := createHardwarePerfEvents(obj.HwCountersEventReader, specs.Maps["hw_counters_event_reader"].InnerMap)
 		defer func() {
 			for _, fd := range perfEvents {
 				unix.Close(fd)
 			}
+			for _, reader := range readers {
+				reader.Close()
+			}
 		}()
+		Expect(err).NotTo(HaveOccurred())
 		experiment.Sample(func(idx int) {
 			preRunSchedSwitchTracepoint(&obj)
 			experiment.MeasureDuration("sampled sched_switch tracepoint", func() {
@@ -332,8 +685,9 @@ var _ = Describe("BPF Exporter", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		err = specs.RewriteConstants(map[string]interface{}{
-			"TEST":        int32(1),
-			"SAMPLE_RATE": int32(1000),
+			"TEST":            int32(1),
+			"SAMPLE_RATE":     int32(1000),
+			"NUM_HW_COUNTERS": int32(numHWCounters),
 		})
 		Expect(err).NotTo(HaveOccurred())
 
@@ -342,17 +696,16 @@ var _ = Describe("BPF Exporter", func() {
 		err = specs.LoadAndAssign(&obj, nil)
 		Expect(err).NotTo(HaveOccurred())
 
-		perfEvents, err := createHardwarePerfEvents(
-			obj.CpuInstructionsEventReader,
-			obj.CpuCyclesEventReader,
-			obj.CacheMissEventReader,
-		)
-		Expect(err).NotTo(HaveOccurred())
+		perfEvents, readers, err := createHardwarePerfEvents(obj.HwCountersEventReader, specs.Maps["hw_counters_event_reader"].InnerMap)
 		defer func() {
 			for _, fd := range perfEvents {
 				unix.Close(fd)
 			}
+			for _, reader := range readers {
+				reader.Close()
+			}
 		}()
+		Expect(err).NotTo(HaveOccurred())
 		experiment.Sample(func(idx int) {
 			preRunSchedSwitchTracepoint(&obj)
 			experiment.MeasureDuration("sampled sched_switch tracepoint", func() {
@@ -382,9 +735,7 @@ func preRunSchedSwitchTracepoint(obj *testObjects) {
 		CgroupId:       0,
 		Pid:            42,
 		ProcessRunTime: nsecs,
-		CpuCycles:      0,
-		CpuInstr:       0,
-		CacheMiss:      0,
+		HwCounters:     [8]uint64{},
 		PageCacheHit:   0,
 		VecNr:          [10]uint16{},
 		Comm:           [16]int8{},
@@ -419,35 +770,32 @@ func unixOpenPerfEvent(typ, conf int) (int, error) {
 	return fd, nil
 }
 
-// This function is used to create hardware perf events for CPU cycles, instructions and cache misses.
-// Instead of using hardware perf events, we use the software perf event for testing purposes.
-func createHardwarePerfEvents(cpuCyclesMap, cpuInstructionsMap, cacheMissMap *ebpf.Map) ([]int, error) {
-	cpuCyclesFd, err := unixOpenPerfEvent(unix.PERF_TYPE_SOFTWARE, unix.PERF_COUNT_SW_CPU_CLOCK)
-	if err != nil {
-		return nil, err
-	}
-	err = cpuCyclesMap.Update(uint32(0), uint32(cpuCyclesFd), ebpf.UpdateAny)
-	if err != nil {
-		return nil, err
+// This function is used to create the hardware perf events of the first numHWCounters counters on CPU 0, e.g. CPU
+// cycles, instructions and cache misses. Instead of using hardware perf events, we use the software perf event for
+// testing purposes. The perf event array of each counter must stay open for its events to be read.
+func createHardwarePerfEvents(eventReaderMap *ebpf.Map, readerSpec *ebpf.MapSpec) ([]int, []*ebpf.Map, error) {
+	var fds []int
+	var readers []*ebpf.Map
+	for i := 0; i < numHWCounters; i++ {
+		fd, err := unixOpenPerfEvent(unix.PERF_TYPE_SOFTWARE, unix.PERF_COUNT_SW_CPU_CLOCK)
+		if err != nil {
+			return fds, readers, err
+		}
+		fds = append(fds, fd)
+		reader, err := ebpf.NewMap(readerSpec)
+		if err != nil {
+			return fds, readers, err
+		}
+		readers = append(readers, reader)
+		// the event of the counter i on CPU 0 is at index 0 of the perf event array at index i
+		err = reader.Update(uint32(0), uint32(fd), ebpf.UpdateAny)
+		if err != nil {
+			return fds, readers, err
+		}
+		err = eventReaderMap.Update(uint32(i), reader, ebpf.UpdateAny)
+		if err != nil {
+			return fds, readers, err
+		}
 	}
-
-	cpuInstructionsFd, err := unixOpenPerfEvent(unix.PERF_TYPE_SOFTWARE, unix.PERF_COUNT_SW_CPU_CLOCK)
-	if err != nil {
-		return nil, err
-	}
-	err = cpuInstructionsMap.Update(uint32(0), uint32(cpuInstructionsFd), ebpf.UpdateAny)
-	if err != nil {
-		return nil, err
-	}
-
-	cacheMissFd, err := unixOpenPerfEvent(unix.PERF_TYPE_SOFTWARE, unix.PERF_COUNT_SW_CPU_CLOCK)
-	if err != nil {
-		return nil, err
-	}
-	err = cacheMissMap.Update(uint32(0), uint32(cacheMissFd), ebpf.UpdateAny)
-	if err != nil {
-		return nil, err
-	}
-
-	return []int{cpuCyclesFd, cpuInstructionsFd, cacheMissFd}, nil
+	return fds, readers, nil
 }
@@ -12,19 +12,54 @@ import (
 	"github.com/cilium/ebpf"
 )
 
+type testBlockIoMetricsT struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadOps    uint64
+	WriteOps   uint64
+}
+
+type testIrqMetricsT struct {
+	Time  uint64
+	Count uint64
+}
+
+type testIrqStateT struct {
+	SoftirqStart uint64
+	HardirqStart uint64
+	TaskIrqTime  uint64
+}
+
 type testProcessMetricsT struct {
 	CgroupId       uint64
 	Pid            uint64
 	ProcessRunTime uint64
-	CpuCycles      uint64
-	CpuInstr       uint64
-	CacheMiss      uint64
+	HwCounters     [8]uint64
 	PageCacheHit   uint64
+	NetTxBytes     uint64
+	NetRxBytes     uint64
+	NetTxPackets   uint64
+	NetRxPackets   uint64
 	VecNr          [10]uint16
 	Comm           [16]int8
 	_              [4]byte
 }
 
+type testRunMetricsT struct {
+	ProcessRunTime uint64
+	HwCounters     [8]uint64
+}
+
+type testSockOwnerT struct {
+	Tgid     uint64
+	CgroupId uint64
+}
+
+type testSocketKeyT struct {
+	Id     uint64
+	Socket uint64
+}
+
 // loadTest returns the embedded CollectionSpec for test.
 func loadTest() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_TestBytes)
@@ -66,6 +101,10 @@ type testSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type testProgramSpecs struct {
+	TestKeplerBlockRqComplete        *ebpf.ProgramSpec `ebpf:"test_kepler_block_rq_complete"`
+	TestKeplerIrqTrace               *ebpf.ProgramSpec `ebpf:"test_kepler_irq_trace"`
+	TestKeplerNetTrace               *ebpf.ProgramSpec `ebpf:"test_kepler_net_trace"`
+	TestKeplerProcessExit            *ebpf.ProgramSpec `ebpf:"test_kepler_process_exit"`
 	TestKeplerSchedSwitchTrace       *ebpf.ProgramSpec `ebpf:"test_kepler_sched_switch_trace"`
 	TestKeplerWritePageTrace         *ebpf.ProgramSpec `ebpf:"test_kepler_write_page_trace"`
 	TestRegisterNewProcessIfNotExist *ebpf.ProgramSpec `ebpf:"test_register_new_process_if_not_exist"`
@@ -75,14 +114,21 @@ type testProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type testMapSpecs struct {
-	CacheMiss                  *ebpf.MapSpec `ebpf:"cache_miss"`
-	CacheMissEventReader       *ebpf.MapSpec `ebpf:"cache_miss_event_reader"`
-	CpuCycles                  *ebpf.MapSpec `ebpf:"cpu_cycles"`
-	CpuCyclesEventReader       *ebpf.MapSpec `ebpf:"cpu_cycles_event_reader"`
-	CpuInstructions            *ebpf.MapSpec `ebpf:"cpu_instructions"`
-	CpuInstructionsEventReader *ebpf.MapSpec `ebpf:"cpu_instructions_event_reader"`
-	PidTimeMap                 *ebpf.MapSpec `ebpf:"pid_time_map"`
-	Processes                  *ebpf.MapSpec `ebpf:"processes"`
+	CgroupBlockIo         *ebpf.MapSpec `ebpf:"cgroup_block_io"`
+	CgroupSockets         *ebpf.MapSpec `ebpf:"cgroup_sockets"`
+	Cgroups               *ebpf.MapSpec `ebpf:"cgroups"`
+	CpuSockets            *ebpf.MapSpec `ebpf:"cpu_sockets"`
+	ExitedCgroupSockets   *ebpf.MapSpec `ebpf:"exited_cgroup_sockets"`
+	ExitedCgroups         *ebpf.MapSpec `ebpf:"exited_cgroups"`
+	HwCounters            *ebpf.MapSpec `ebpf:"hw_counters"`
+	HwCountersEventReader *ebpf.MapSpec `ebpf:"hw_counters_event_reader"`
+	IrqState              *ebpf.MapSpec `ebpf:"irq_state"`
+	IrqTimes              *ebpf.MapSpec `ebpf:"irq_times"`
+	MapStats              *ebpf.MapSpec `ebpf:"map_stats"`
+	PidTimeMap            *ebpf.MapSpec `ebpf:"pid_time_map"`
+	ProcessSockets        *ebpf.MapSpec `ebpf:"process_sockets"`
+	Processes             *ebpf.MapSpec `ebpf:"processes"`
+	SockOwners            *ebpf.MapSpec `ebpf:"sock_owners"`
 }
 
 // testObjects contains all objects after they have been loaded into the kernel.
@@ -104,26 +150,40 @@ func (o *testObjects) Close() error {
 //
 // It can be passed to loadTestObjects or ebpf.CollectionSpec.LoadAndAssign.
 type testMaps struct {
-	CacheMiss                  *ebpf.Map `ebpf:"cache_miss"`
-	CacheMissEventReader       *ebpf.Map `ebpf:"cache_miss_event_reader"`
-	CpuCycles                  *ebpf.Map `ebpf:"cpu_cycles"`
-	CpuCyclesEventReader       *ebpf.Map `ebpf:"cpu_cycles_event_reader"`
-	CpuInstructions            *ebpf.Map `ebpf:"cpu_instructions"`
-	CpuInstructionsEventReader *ebpf.Map `ebpf:"cpu_instructions_event_reader"`
-	PidTimeMap                 *ebpf.Map `ebpf:"pid_time_map"`
-	Processes                  *ebpf.Map `ebpf:"processes"`
+	CgroupBlockIo         *ebpf.Map `ebpf:"cgroup_block_io"`
+	CgroupSockets         *ebpf.Map `ebpf:"cgroup_sockets"`
+	Cgroups               *ebpf.Map `ebpf:"cgroups"`
+	CpuSockets            *ebpf.Map `ebpf:"cpu_sockets"`
+	ExitedCgroupSockets   *ebpf.Map `ebpf:"exited_cgroup_sockets"`
+	ExitedCgroups         *ebpf.Map `ebpf:"exited_cgroups"`
+	HwCounters            *ebpf.Map `ebpf:"hw_counters"`
+	HwCountersEventReader *ebpf.Map `ebpf:"hw_counters_event_reader"`
+	IrqState              *ebpf.Map `ebpf:"irq_state"`
+	IrqTimes              *ebpf.Map `ebpf:"irq_times"`
+	MapStats              *ebpf.Map `ebpf:"map_stats"`
+	PidTimeMap            *ebpf.Map `ebpf:"pid_time_map"`
+	ProcessSockets        *ebpf.Map `ebpf:"process_sockets"`
+	Processes             *ebpf.Map `ebpf:"processes"`
+	SockOwners            *ebpf.Map `ebpf:"sock_owners"`
 }
 
 func (m *testMaps) Close() error {
 	return _TestClose(
-		m.CacheMiss,
-		m.CacheMissEventReader,
-		m.CpuCycles,
-		m.CpuCyclesEventReader,
-		m.CpuInstructions,
-		m.CpuInstructionsEventReader,
+		m.CgroupBlockIo,
+		m.CgroupSockets,
+		m.Cgroups,
+		m.CpuSockets,
+		m.ExitedCgroupSockets,
+		m.ExitedCgroups,
+		m.HwCounters,
+		m.HwCountersEventReader,
+		m.IrqState,
+		m.IrqTimes,
+		m.MapStats,
 		m.PidTimeMap,
+		m.ProcessSockets,
 		m.Processes,
+		m.SockOwners,
 	)
 }
 
@@ -131,6 +191,10 @@ func (m *testMaps) Close() error {
 //
 // It can be passed to loadTestObjects or ebpf.CollectionSpec.LoadAndAssign.
 type testPrograms struct {
+	TestKeplerBlockRqComplete        *ebpf.Program `ebpf:"test_kepler_block_rq_complete"`
+	TestKeplerIrqTrace               *ebpf.Program `ebpf:"test_kepler_irq_trace"`
+	TestKeplerNetTrace               *ebpf.Program `ebpf:"test_kepler_net_trace"`
+	TestKeplerProcessExit            *ebpf.Program `ebpf:"test_kepler_process_exit"`
 	TestKeplerSchedSwitchTrace       *ebpf.Program `ebpf:"test_kepler_sched_switch_trace"`
 	TestKeplerWritePageTrace         *ebpf.Program `ebpf:"test_kepler_write_page_trace"`
 	TestRegisterNewProcessIfNotExist *ebpf.Program `ebpf:"test_register_new_process_if_not_exist"`
@@ -138,6 +202,10 @@ type testPrograms struct {
 
 func (p *testPrograms) Close() error {
 	return _TestClose(
+		p.TestKeplerBlockRqComplete,
+		p.TestKeplerIrqTrace,
+		p.TestKeplerNetTrace,
+		p.TestKeplerProcessExit,
 		p.TestKeplerSchedSwitchTrace,
 		p.TestKeplerWritePageTrace,
 		p.TestRegisterNewProcessIfNotExist,
@@ -28,6 +28,7 @@ import (
 	"sync"
 
 	"github.com/sustainable-computing-io/kepler/pkg/kubelet"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/utils"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -126,6 +127,7 @@ func (c *cache) getGetContainerIDFromPID(pid uint64) (string, error) {
 
 	path, err := getPathFromPID(procPath, pid)
 	if err != nil {
+		pipeline.ResolutionFailures.WithLabelValues(pipeline.ResolutionContainer).Inc()
 		return utils.SystemProcessName, err
 	}
 
@@ -146,6 +148,7 @@ func (c *cache) getContainerIDFromcGroupID(cGroupID uint64) (string, error) {
 
 	path, err := instance.getPathFromcGroupID(cGroupID)
 	if err != nil {
+		pipeline.ResolutionFailures.WithLabelValues(pipeline.ResolutionContainer).Inc()
 		return utils.SystemProcessName, err
 	}
 
@@ -0,0 +1,147 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package checkpoint persists the aggregated energy counters of the node, containers and virtual machines,
+// so that the counters exposed by Kepler do not reset when the exporter restarts.
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+)
+
+// Version is the version of the checkpoint file format
+const Version = 1
+
+// TmpSuffix is the suffix of the temporary file the checkpoint is written to before replacing the previous one
+const TmpSuffix = ".tmp"
+
+// Counters holds the aggregated values of the energy metrics of an entity, keyed by metric and then by source id.
+type Counters map[string]map[string]uint64
+
+// Checkpoint is a snapshot of the aggregated energy of the node and of its containers and virtual machines.
+type Checkpoint struct {
+	Version   int       `json:"version"`
+	NodeName  string    `json:"nodeName"`
+	Timestamp time.Time `json:"timestamp"`
+	Node      Counters  `json:"node"`
+	// Containers are keyed by container id
+	Containers map[string]Counters `json:"containers"`
+	// VMs are keyed by virtual machine id
+	VMs map[string]Counters `json:"vms"`
+}
+
+// New returns an empty checkpoint of the node.
+func New(nodeName string) *Checkpoint {
+	return &Checkpoint{
+		Version:    Version,
+		NodeName:   nodeName,
+		Timestamp:  time.Now(),
+		Node:       Counters{},
+		Containers: map[string]Counters{},
+		VMs:        map[string]Counters{},
+	}
+}
+
+// Snapshot returns the aggregated values of the energy metrics of s.
+func Snapshot(s *stats.Stats) Counters {
+	counters := Counters{}
+	for metric, collection := range s.EnergyUsage {
+		for id, stat := range collection {
+			if aggr := stat.GetAggr(); aggr > 0 {
+				if counters[metric] == nil {
+					counters[metric] = map[string]uint64{}
+				}
+				counters[metric][id] = aggr
+			}
+		}
+	}
+	return counters
+}
+
+// Restore adds the aggregated values of the counters to the energy metrics of s, except the skipped metrics.
+// The metrics unknown to s, e.g. because the GPU is no longer enabled, are ignored.
+func Restore(s *stats.Stats, counters Counters, skip ...string) {
+	skipped := make(map[string]bool, len(skip))
+	for _, metric := range skip {
+		skipped[metric] = true
+	}
+	for metric, values := range counters {
+		collection, ok := s.EnergyUsage[metric]
+		if !ok || skipped[metric] {
+			continue
+		}
+		for id, aggr := range values {
+			collection.RestoreAggrStat(id, aggr)
+		}
+	}
+}
+
+// Load reads the checkpoint in path, it returns nil without error if there is no checkpoint yet.
+func Load(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checkpoint: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse the checkpoint %s: %w", path, err)
+	}
+	if cp.Version != Version {
+		return nil, fmt.Errorf("unsupported checkpoint version %d in %s", cp.Version, path)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint to path. The previous checkpoint is replaced only once the new one is
+// fully written, so a crash while saving never leaves a truncated checkpoint behind.
+func (cp *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode the checkpoint: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create the checkpoint directory: %w", err)
+	}
+	tmp := path + TmpSuffix
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write the checkpoint: %w", err)
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write the checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to commit the checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+var _ = Describe("Checkpoint", func() {
+	var path string
+
+	BeforeEach(func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(GinkgoT().TempDir(), "checkpoint.json")
+	})
+
+	It("saves and loads the counters", func() {
+		cp := New("node1")
+		cp.Node = Counters{config.DynEnergyInPkg: {"socket0": 1000}}
+		cp.Containers["container1"] = Counters{config.DynEnergyInCore: {"socket0": 42}}
+		Expect(cp.Save(path)).To(Succeed())
+		_, err := os.Stat(path + TmpSuffix)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		loaded, err := Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded.NodeName).To(Equal("node1"))
+		Expect(loaded.Node).To(Equal(cp.Node))
+		Expect(loaded.Containers).To(Equal(cp.Containers))
+		Expect(loaded.VMs).To(BeEmpty())
+	})
+
+	It("returns no checkpoint before the first one is saved", func() {
+		cp, err := Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cp).To(BeNil())
+	})
+
+	It("rejects an unsupported version", func() {
+		Expect(os.WriteFile(path, []byte(`{"version": 99}`), 0o600)).To(Succeed())
+		_, err := Load(path)
+		Expect(err).To(MatchError(ContainSubstring("unsupported checkpoint version 99")))
+	})
+
+	It("restores the snapshot of the aggregated energy", func() {
+		s := stats.NewStats()
+		s.EnergyUsage[config.DynEnergyInPkg].AddDeltaStat("socket0", 1000)
+		s.EnergyUsage[config.AbsEnergyInPkg].SetAggrStat("socket0", 5000)
+		counters := Snapshot(s)
+		Expect(counters).To(Equal(Counters{
+			config.DynEnergyInPkg: {"socket0": 1000},
+			config.AbsEnergyInPkg: {"socket0": 5000},
+		}))
+
+		restored := stats.NewStats()
+		restored.EnergyUsage[config.DynEnergyInPkg].AddDeltaStat("socket0", 10)
+		Restore(restored, counters, config.AbsEnergyInPkg)
+		Expect(restored.EnergyUsage[config.DynEnergyInPkg]["socket0"].GetAggr()).To(Equal(uint64(1010)))
+		Expect(restored.EnergyUsage[config.DynEnergyInPkg]["socket0"].GetDelta()).To(Equal(uint64(10)))
+		Expect(restored.EnergyUsage[config.AbsEnergyInPkg]).To(BeEmpty())
+	})
+})
@@ -0,0 +1,82 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"github.com/sustainable-computing-io/kepler/pkg/checkpoint"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
+
+	"k8s.io/klog/v2"
+)
+
+// restoredCheckpoint holds the counters of the checkpointed containers and virtual machines not seen since the restart
+type restoredCheckpoint struct {
+	containers map[string]checkpoint.Counters
+	vms        map[string]checkpoint.Counters
+}
+
+// RestoreCheckpoint restores the node counters saved in cp. The counters of a container or virtual machine are
+// restored once it is seen again, the ones not seen before the next checkpoint are considered gone.
+func (c *Collector) RestoreCheckpoint(cp *checkpoint.Checkpoint) {
+	if name := c.NodeStats.NodeName(); cp.NodeName != name {
+		klog.Warningf("ignoring the checkpoint of node %q, the exporter runs on node %q", cp.NodeName, name)
+		return
+	}
+	var skip []string
+	if components.IsSystemCollectionSupported() {
+		// the measured components energy is read from hardware counters, which do not reset with the exporter
+		skip = []string{config.AbsEnergyInPkg, config.AbsEnergyInCore, config.AbsEnergyInUnCore, config.AbsEnergyInDRAM}
+	}
+	checkpoint.Restore(&c.NodeStats.Stats, cp.Node, skip...)
+	c.restored = &restoredCheckpoint{containers: cp.Containers, vms: cp.VMs}
+	c.restoreSeen()
+	klog.Infof("restored the energy counters checkpointed at %v", cp.Timestamp)
+}
+
+// restoreSeen restores the counters of the checkpointed containers and virtual machines that are running.
+func (c *Collector) restoreSeen() {
+	if c.restored == nil {
+		return
+	}
+	for id, counters := range c.restored.containers {
+		if container, ok := c.ContainerStats[id]; ok {
+			checkpoint.Restore(&container.Stats, counters)
+			delete(c.restored.containers, id)
+		}
+	}
+	for id, counters := range c.restored.vms {
+		if vm, ok := c.VMStats[id]; ok {
+			checkpoint.Restore(&vm.Stats, counters)
+			delete(c.restored.vms, id)
+		}
+	}
+}
+
+// Checkpoint returns a snapshot of the aggregated energy of the node, containers and virtual machines.
+func (c *Collector) Checkpoint() *checkpoint.Checkpoint {
+	c.restored = nil
+	cp := checkpoint.New(c.NodeStats.NodeName())
+	cp.Node = checkpoint.Snapshot(&c.NodeStats.Stats)
+	for id, container := range c.ContainerStats {
+		cp.Containers[id] = checkpoint.Snapshot(&container.Stats)
+	}
+	for id, vm := range c.VMStats {
+		cp.VMs[id] = checkpoint.Snapshot(&vm.Stats)
+	}
+	return cp
+}
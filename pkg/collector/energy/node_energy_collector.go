@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/model"
 	acc "github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
@@ -34,7 +36,9 @@ import (
 // UpdatePlatformEnergy updates the node platform power consumption, i.e, the node total power consumption
 func UpdatePlatformEnergy(nodeStats *stats.NodeStats) {
 	if platform.IsSystemCollectionSupported() {
-		nodePlatformEnergy, _ := platform.GetAbsEnergyFromPlatform()
+		start := time.Now()
+		nodePlatformEnergy, err := platform.GetAbsEnergyFromPlatform()
+		pipeline.ObservePowerSourceRead(platform.GetSourceName(), start, err != nil)
 		for sourceID, energy := range nodePlatformEnergy {
 			nodeStats.EnergyUsage[config.AbsEnergyInPlatform].SetDeltaStat(sourceID, uint64(energy))
 		}
@@ -47,7 +51,10 @@ func UpdatePlatformEnergy(nodeStats *stats.NodeStats) {
 func UpdateNodeComponentsEnergy(nodeStats *stats.NodeStats, wg *sync.WaitGroup) {
 	defer wg.Done()
 	if components.IsSystemCollectionSupported() {
+		start := time.Now()
 		nodeComponentsEnergy := components.GetAbsEnergyFromNodeComponents()
+		// the sources report the sockets they could read, none means the read failed
+		pipeline.ObservePowerSourceRead(components.GetSourceName(), start, len(nodeComponentsEnergy) == 0)
 		// the RAPL metrics return counter metrics not gauge
 		for socket, energy := range nodeComponentsEnergy {
 			strID := strconv.Itoa(socket)
@@ -68,7 +75,9 @@ func UpdateNodeGPUEnergy(nodeStats *stats.NodeStats, wg *sync.WaitGroup) {
 	defer wg.Done()
 	if config.IsGPUEnabled() {
 		if gpu := acc.GetActiveAcceleratorByType(config.GPU); gpu != nil {
+			start := time.Now()
 			gpuEnergy := gpu.Device().AbsEnergyFromDevice()
+			pipeline.ObservePowerSourceRead(gpu.Device().Name(), start, len(gpuEnergy) == 0)
 			for gpu, energy := range gpuEnergy {
 				nodeStats.EnergyUsage[config.AbsEnergyInGPU].SetDeltaStat(fmt.Sprintf("%d", gpu), uint64(energy))
 			}
@@ -103,6 +112,8 @@ func UpdateNodeEnergyMetrics(nodeStats *stats.NodeStats) {
 	wg.Wait()
 	// update platform power later to avoid race condition when using estimation power model
 	UpdatePlatformEnergy(nodeStats)
+	// the node power models are trained with the measured power
+	model.AddNodePowerTrainingSample(nodeStats)
 	// after updating the total energy we calculate the idle, dynamic and other components energy
 	if config.IsIdlePowerEnabled() {
 		UpdateNodeIdleEnergy(nodeStats)
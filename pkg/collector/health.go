@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
+)
+
+const (
+	// maxStaleIntervals is the number of consecutive collections without energy increase before a power source is considered broken
+	maxStaleIntervals = 3
+	// maxMissedUpdates is the number of sample periods without a completed collection before the collector is considered stalled
+	maxMissedUpdates = 3
+)
+
+// collectorHealth tracks the state of the collection loop, it is written by Update and read by the health checks.
+type collectorHealth struct {
+	lastUpdate              atomic.Int64
+	staleComponentIntervals atomic.Int32
+	stalePlatformIntervals  atomic.Int32
+}
+
+// recordUpdate records a finished collection and whether the measured power sources reported new energy.
+func (c *Collector) recordUpdate() {
+	c.health.lastUpdate.Store(time.Now().UnixNano())
+	if components.IsSystemCollectionSupported() {
+		recordStale(&c.health.staleComponentIntervals, c.NodeStats.EnergyUsage[config.AbsEnergyInPkg].SumAllDeltaValues())
+	}
+	if platform.IsSystemCollectionSupported() {
+		recordStale(&c.health.stalePlatformIntervals, c.NodeStats.EnergyUsage[config.AbsEnergyInPlatform].SumAllDeltaValues())
+	}
+}
+
+func recordStale(counter *atomic.Int32, delta uint64) {
+	if delta == 0 {
+		counter.Add(1)
+	} else {
+		counter.Store(0)
+	}
+}
+
+// CollectionHealthCheck fails if no collection completed in the last sample periods.
+func (c *Collector) CollectionHealthCheck() error {
+	lastUpdate := c.health.lastUpdate.Load()
+	if lastUpdate == 0 {
+		return fmt.Errorf("no collection completed yet")
+	}
+	maxAge := time.Duration(maxMissedUpdates*config.SamplePeriodSec()) * time.Second
+	if age := time.Since(time.Unix(0, lastUpdate)); age > maxAge {
+		return fmt.Errorf("last collection completed %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// PowerSourceHealthCheck fails if a measured power source stopped reporting increasing energy counters.
+func (c *Collector) PowerSourceHealthCheck() error {
+	if n := c.health.staleComponentIntervals.Load(); n >= maxStaleIntervals {
+		return fmt.Errorf("%s reported no energy increase in the last %d collections", components.GetSourceName(), n)
+	}
+	if n := c.health.stalePlatformIntervals.Load(); n >= maxStaleIntervals {
+		return fmt.Errorf("%s reported no energy increase in the last %d collections", platform.GetSourceName(), n)
+	}
+	return nil
+}
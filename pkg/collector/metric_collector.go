@@ -29,8 +29,11 @@ import (
 	resourceBpf "github.com/sustainable-computing-io/kepler/pkg/collector/resourceutilization/bpf"
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/health"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/model"
 	acc "github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/cpu"
 	"github.com/sustainable-computing-io/kepler/pkg/utils"
 
 	"k8s.io/klog/v2"
@@ -49,6 +52,11 @@ type Collector struct {
 	// ProcessStats hold all process energy and resource usage metrics
 	ProcessStats map[uint64]*stats.ProcessStats
 
+	// CgroupStats holds the energy and resource usage metrics of the cgroups, keyed by the cgroup id, when the
+	// counters are aggregated per cgroup by the eBPF programs. The containers are then aggregated from the cgroups
+	// and the processes are only tracked for their own metrics and the virtual machines.
+	CgroupStats map[uint64]*stats.ProcessStats
+
 	// ContainerStats holds the aggregated processes metrics for all containers
 	ContainerStats map[string]*stats.ContainerStats
 
@@ -59,6 +67,12 @@ type Collector struct {
 	bpfExporter bpf.Exporter
 	// bpfSupportedMetrics holds the supported metrics by the bpf exporter
 	bpfSupportedMetrics bpf.SupportedMetrics
+
+	// health tracks the collection loop for the readiness checks
+	health collectorHealth
+
+	// restored holds the checkpointed counters waiting for their container or virtual machine to be seen
+	restored *restoredCheckpoint
 }
 
 func NewCollector(bpfExporter bpf.Exporter) *Collector {
@@ -67,10 +81,13 @@ func NewCollector(bpfExporter bpf.Exporter) *Collector {
 		NodeStats:           *stats.NewNodeStats(),
 		ContainerStats:      map[string]*stats.ContainerStats{},
 		ProcessStats:        map[uint64]*stats.ProcessStats{},
+		CgroupStats:         map[uint64]*stats.ProcessStats{},
 		VMStats:             map[string]*stats.VMStats{},
 		bpfExporter:         bpfExporter,
 		bpfSupportedMetrics: bpfSupportedMetrics,
 	}
+	health.GetRegistry().Register("collection", c.CollectionHealthCheck)
+	health.GetRegistry().Register("power-source", c.PowerSourceHealthCheck)
 	return c
 }
 
@@ -98,8 +115,15 @@ func (c *Collector) Update() {
 	// collect node power and estimate process power
 	c.UpdateEnergyUtilizationMetrics()
 
+	// restore the checkpointed counters of the containers and VMs seen again after a restart
+	c.restoreSeen()
+
+	c.recordUpdate()
+
 	c.printDebugMetrics()
-	klog.V(5).Infof("Collector Update elapsed time: %s", time.Since(start))
+	elapsed := time.Since(start)
+	pipeline.ObserveCollection(elapsed, time.Duration(config.SamplePeriodSec())*time.Second)
+	klog.V(5).Infof("Collector Update elapsed time: %s", elapsed)
 }
 
 // resetDeltaValue resets existing podEnergy previous curr value
@@ -108,6 +132,9 @@ func (c *Collector) resetDeltaValue() {
 	for _, v := range c.ProcessStats {
 		v.ResetDeltaValues()
 	}
+	for _, v := range c.CgroupStats {
+		v.ResetDeltaValues()
+	}
 	if config.IsExposeContainerStatsEnabled() {
 		for _, v := range c.ContainerStats {
 			v.ResetDeltaValues()
@@ -135,6 +162,9 @@ func (c *Collector) UpdateNodeEnergyUtilizationMetrics() {
 
 // UpdateProcessEnergyUtilizationMetrics estimates the process energy consumption using its resource utilization and the node components energy consumption
 func (c *Collector) UpdateProcessEnergyUtilizationMetrics() {
+	if c.bpfSupportedMetrics.CgroupAggregation {
+		energy.UpdateProcessEnergy(c.CgroupStats, &c.NodeStats)
+	}
 	energy.UpdateProcessEnergy(c.ProcessStats, &c.NodeStats)
 }
 
@@ -150,14 +180,39 @@ func (c *Collector) updateResourceUtilizationMetrics() {
 
 // update the node metrics that are not related to aggregated resource utilization of processes
 func (c *Collector) updateNodeResourceUtilizationMetrics(wg *sync.WaitGroup) {
-	wg.Done()
+	defer wg.Done()
+	if config.IsCPUStateMetricsEnabled() {
+		c.updateCPUStateMetrics()
+	}
+}
+
+// updateCPUStateMetrics reads the time the CPUs spent in the idle states and the frequency cpufreq set them to. The
+// effective frequency is computed from APERF and MPERF, which are counted with the hardware counters.
+func (c *Collector) updateCPUStateMetrics() {
+	idleTimes, err := cpu.IdleStateTimes()
+	if err != nil {
+		klog.V(5).Infof("could not read the time spent in the CPU idle states: %v", err)
+	}
+	for state, usec := range idleTimes {
+		c.NodeStats.ResourceUsage[config.CPUIdleTime].SetAggrStat(state, usec/1000)
+	}
+	c.NodeStats.ScalingFrequency = cpu.ScalingFrequency()
 }
 
 func (c *Collector) updateProcessResourceUtilizationMetrics(wg *sync.WaitGroup) {
 	defer wg.Done()
 	// update process metrics regarding the resource utilization to be used to calculate the energy consumption
 	// we first updates the bpf which is responsible to include new processes in the ProcessStats collection
+	if c.bpfSupportedMetrics.CgroupAggregation {
+		resourceBpf.UpdateCgroupBPFMetrics(c.bpfExporter, c.CgroupStats)
+	}
 	resourceBpf.UpdateProcessBPFMetrics(c.bpfExporter, c.ProcessStats)
+	// the interrupts are charged to the entries of the owners of the sockets and block I/O, so after they are updated
+	if c.bpfSupportedMetrics.CgroupAggregation {
+		resourceBpf.UpdateIRQBPFMetrics(c.bpfExporter, c.CgroupStats, &c.NodeStats)
+	} else {
+		resourceBpf.UpdateIRQBPFMetrics(c.bpfExporter, c.ProcessStats, &c.NodeStats)
+	}
 	if config.IsGPUEnabled() {
 		if acc.GetActiveAcceleratorByType(config.GPU) != nil {
 			accelerator.UpdateProcessGPUUtilizationMetrics(c.ProcessStats)
@@ -169,6 +224,8 @@ func (c *Collector) updateProcessResourceUtilizationMetrics(wg *sync.WaitGroup)
 func (c *Collector) AggregateProcessResourceUtilizationMetrics() {
 	foundContainer := make(map[string]bool)
 	foundVM := make(map[string]bool)
+	// the containers and the node are aggregated from the cgroups if the counters are aggregated per cgroup
+	aggregateProcesses := !c.bpfSupportedMetrics.CgroupAggregation
 	for _, process := range c.ProcessStats {
 		if process.IdleCounter > 0 {
 			// if the process metrics were not updated for multiple iterations, very if the process still exist, otherwise delete it from the map
@@ -179,7 +236,7 @@ func (c *Collector) AggregateProcessResourceUtilizationMetrics() {
 				delta := resource[id].GetDelta() // currently the process metrics are single socket
 
 				// aggregate metrics per container
-				if config.IsExposeContainerStatsEnabled() {
+				if aggregateProcesses && config.IsExposeContainerStatsEnabled() {
 					if process.ContainerID != "" {
 						c.createContainerStatsIfNotExist(process.ContainerID, process.CGroupID, process.PID, config.EnabledEBPFCgroupID())
 						c.ContainerStats[process.ContainerID].ResourceUsage[metricName].AddDeltaStat(id, delta)
@@ -199,10 +256,15 @@ func (c *Collector) AggregateProcessResourceUtilizationMetrics() {
 				}
 
 				// aggregate metrics from all process to represent the node resource utilization
-				c.NodeStats.ResourceUsage[metricName].AddDeltaStat(id, delta)
+				if aggregateProcesses {
+					c.NodeStats.ResourceUsage[metricName].AddDeltaStat(id, delta)
+				}
 			}
 		}
 	}
+	if !aggregateProcesses {
+		c.aggregateCgroupResourceUtilizationMetrics(foundContainer)
+	}
 
 	// clean up the cache
 	// TODO: improve the removal of deleted containers from ContainerStats. Currently we verify the maxInactiveContainers using the found map
@@ -214,8 +276,36 @@ func (c *Collector) AggregateProcessResourceUtilizationMetrics() {
 	}
 }
 
+// aggregateCgroupResourceUtilizationMetrics aggregates the cgroups' resource utilization metrics to containers and nodes
+func (c *Collector) aggregateCgroupResourceUtilizationMetrics(foundContainer map[string]bool) {
+	for cgroupID, cgroupStat := range c.CgroupStats {
+		if cgroupStat.IdleCounter > 0 {
+			// the tasks of the cgroup did not run during the last interval, the entry is created again when they do
+			delete(c.CgroupStats, cgroupID)
+			continue
+		}
+		for metricName, resource := range cgroupStat.ResourceUsage {
+			for id := range resource {
+				delta := resource[id].GetDelta()
+				if config.IsExposeContainerStatsEnabled() && cgroupStat.ContainerID != "" {
+					c.createContainerStatsIfNotExist(cgroupStat.ContainerID, cgroupID, cgroupStat.PID, true)
+					c.ContainerStats[cgroupStat.ContainerID].ResourceUsage[metricName].AddDeltaStat(id, delta)
+					foundContainer[cgroupStat.ContainerID] = true
+				}
+				c.NodeStats.ResourceUsage[metricName].AddDeltaStat(id, delta)
+			}
+		}
+	}
+}
+
 // handleInactiveProcesses
 func (c *Collector) handleIdlingProcess(pStat *stats.ProcessStats) {
+	if stats.IsExitedProcesses(pStat.PID) || stats.IsBlockIO(pStat.PID) || pStat.PID == stats.KernelIRQPID {
+		// no process of the cgroup exited, no block I/O of the cgroup completed, or no interrupt was charged to the
+		// kernel, during the last interval
+		delete(c.ProcessStats, pStat.PID)
+		return
+	}
 	proc, _ := os.FindProcess(int(pStat.PID))
 	err := proc.Signal(syscall.Signal(0))
 	if err != nil {
@@ -259,13 +349,14 @@ func (c *Collector) handleInactiveVM(foundVM map[string]bool) {
 
 // AggregateProcessEnergyUtilizationMetrics aggregates processes' utilization metrics to containers and virtual machines
 func (c *Collector) AggregateProcessEnergyUtilizationMetrics() {
+	aggregateProcesses := !c.bpfSupportedMetrics.CgroupAggregation
 	for _, process := range c.ProcessStats {
 		for metricName, stat := range process.EnergyUsage {
 			for id := range stat {
 				delta := stat[id].GetDelta() // currently the process metrics are single socket
 
 				// aggregate metrics per container
-				if config.IsExposeContainerStatsEnabled() {
+				if aggregateProcesses && config.IsExposeContainerStatsEnabled() {
 					if process.ContainerID != "" {
 						c.createContainerStatsIfNotExist(process.ContainerID, process.CGroupID, process.PID, config.EnabledEBPFCgroupID())
 						c.ContainerStats[process.ContainerID].EnergyUsage[metricName].AddDeltaStat(id, delta)
@@ -284,6 +375,27 @@ func (c *Collector) AggregateProcessEnergyUtilizationMetrics() {
 			}
 		}
 	}
+	if !aggregateProcesses {
+		c.aggregateCgroupEnergyUtilizationMetrics()
+	}
+}
+
+// aggregateCgroupEnergyUtilizationMetrics aggregates the cgroups' energy metrics to containers
+func (c *Collector) aggregateCgroupEnergyUtilizationMetrics() {
+	if !config.IsExposeContainerStatsEnabled() {
+		return
+	}
+	for cgroupID, cgroupStat := range c.CgroupStats {
+		if cgroupStat.ContainerID == "" {
+			continue
+		}
+		c.createContainerStatsIfNotExist(cgroupStat.ContainerID, cgroupID, cgroupStat.PID, true)
+		for metricName, stat := range cgroupStat.EnergyUsage {
+			for id := range stat {
+				c.ContainerStats[cgroupStat.ContainerID].EnergyUsage[metricName].AddDeltaStat(id, stat[id].GetDelta())
+			}
+		}
+	}
 }
 
 func (c *Collector) printDebugMetrics() {
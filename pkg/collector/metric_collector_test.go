@@ -1,20 +1,57 @@
 package collector
 
 import (
+	"sync"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/sustainable-computing-io/kepler/pkg/bpf"
 	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
+	"github.com/sustainable-computing-io/kepler/pkg/checkpoint"
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/model"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
 
 	acc "github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
 )
 
+// exitedProcessesExporter reports the processes exited in cgroup 0 on top of the mocked samples
+type exitedProcessesExporter struct {
+	bpf.Exporter
+}
+
+func (e exitedProcessesExporter) CollectExitedProcesses() ([]bpf.ProcessMetrics, error) {
+	return []bpf.ProcessMetrics{{ProcessCounters: bpf.ProcessCounters{CgroupId: 0, ProcessRunTime: 3000000, NetTxBytes: 1500, NetTxPackets: 1}}}, nil
+}
+
+// blockIOExporter reports block I/O of cgroup 0 on top of the mocked samples
+type blockIOExporter struct {
+	bpf.Exporter
+}
+
+func (e blockIOExporter) CollectCgroupBlockIO() (map[uint64]bpf.BlockIOMetrics, error) {
+	return map[uint64]bpf.BlockIOMetrics{0: {ReadBytes: 4096, WriteBytes: 8192, ReadOps: 1, WriteOps: 2}}, nil
+}
+
+// cgroupsExporter reports the counters aggregated per cgroup by the eBPF programs for cgroup 0
+type cgroupsExporter struct {
+	blockIOExporter
+}
+
+func (e cgroupsExporter) SupportedMetrics() bpf.SupportedMetrics {
+	supportedMetrics := e.Exporter.SupportedMetrics()
+	supportedMetrics.CgroupAggregation = true
+	return supportedMetrics
+}
+
+func (e cgroupsExporter) CollectCgroups() ([]bpf.ProcessMetrics, error) {
+	return []bpf.ProcessMetrics{{ProcessCounters: bpf.ProcessCounters{CgroupId: 0, ProcessRunTime: 6000000, NetRxBytes: 3000}}}, nil
+}
+
 func newMockCollector(mockAttacher bpf.Exporter) *Collector {
 	if gpu := acc.GetActiveAcceleratorByType(config.GPU); gpu != nil {
 		d := gpu.Device()
@@ -73,4 +110,110 @@ var _ = Describe("Test Collector Unit", func() {
 		Expect(len(metricCollector.ContainerStats)).Should(Equal(2))
 	})
 
+	It("Attributes the exited processes to their container", func() {
+		bpfExporter := exitedProcessesExporter{bpf.NewMockExporter(bpf.DefaultSupportedMetrics())}
+		metricCollector := newMockCollector(bpfExporter)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		metricCollector.updateProcessResourceUtilizationMetrics(wg)
+
+		exited, ok := metricCollector.ProcessStats[stats.ExitedProcessesPID(0)]
+		Expect(ok).To(BeTrue())
+		Expect(exited.ContainerID).To(Equal("container1"))
+		Expect(exited.Command).To(Equal(utils.ExitedProcessName))
+		Expect(exited.ResourceUsage[config.CPUTime].SumAllDeltaValues()).To(Equal(uint64(3000)))
+		Expect(exited.ResourceUsage[config.NetTXBytes].SumAllDeltaValues()).To(Equal(uint64(1500)))
+		Expect(exited.ResourceUsage[config.NetTXPackets].SumAllDeltaValues()).To(Equal(uint64(1)))
+
+		// the entry is removed once no process of the cgroup exited during an interval
+		exited.ResetDeltaValues()
+		metricCollector.AggregateProcessResourceUtilizationMetrics()
+		Expect(metricCollector.ProcessStats).NotTo(HaveKey(stats.ExitedProcessesPID(0)))
+	})
+
+	It("Attributes the block I/O to the container of its cgroup", func() {
+		bpfExporter := blockIOExporter{bpf.NewMockExporter(bpf.DefaultSupportedMetrics())}
+		metricCollector := newMockCollector(bpfExporter)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		metricCollector.updateProcessResourceUtilizationMetrics(wg)
+
+		blockIO, ok := metricCollector.ProcessStats[stats.BlockIOPID(0)]
+		Expect(ok).To(BeTrue())
+		Expect(blockIO.ContainerID).To(Equal("container1"))
+		Expect(blockIO.Command).To(Equal(utils.BlockIOProcessName))
+		Expect(blockIO.ResourceUsage[config.BlockReadBytes].SumAllDeltaValues()).To(Equal(uint64(4096)))
+		Expect(blockIO.ResourceUsage[config.BlockWriteOps].SumAllDeltaValues()).To(Equal(uint64(2)))
+
+		metricCollector.AggregateProcessResourceUtilizationMetrics()
+		Expect(metricCollector.ContainerStats["container1"].ResourceUsage[config.BlockWriteBytes].SumAllDeltaValues()).To(Equal(uint64(8192)))
+	})
+
+	It("Aggregates the containers from the cgroups", func() {
+		bpfExporter := cgroupsExporter{blockIOExporter{bpf.NewMockExporter(bpf.DefaultSupportedMetrics())}}
+		metricCollector := newMockCollector(bpfExporter)
+		metricCollector.resetDeltaValue()
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		metricCollector.updateProcessResourceUtilizationMetrics(wg)
+
+		cgroupStat, ok := metricCollector.CgroupStats[0]
+		Expect(ok).To(BeTrue())
+		Expect(cgroupStat.ContainerID).To(Equal("container1"))
+		Expect(cgroupStat.Command).To(Equal(utils.CgroupProcessName))
+		Expect(cgroupStat.ResourceUsage[config.CPUTime].SumAllDeltaValues()).To(Equal(uint64(6000)))
+		// the block I/O of the cgroup is accounted in its entry
+		Expect(cgroupStat.ResourceUsage[config.BlockReadBytes].SumAllDeltaValues()).To(Equal(uint64(4096)))
+		Expect(metricCollector.ProcessStats).NotTo(HaveKey(stats.BlockIOPID(0)))
+
+		// the processes are not aggregated to the containers and the node
+		metricCollector.AggregateProcessResourceUtilizationMetrics()
+		Expect(metricCollector.ContainerStats["container1"].ResourceUsage[config.CPUTime].SumAllDeltaValues()).To(Equal(uint64(6000)))
+		Expect(metricCollector.ContainerStats["container1"].ResourceUsage[config.NetRXBytes].SumAllDeltaValues()).To(Equal(uint64(3000)))
+		Expect(metricCollector.NodeStats.ResourceUsage[config.CPUTime].SumAllDeltaValues()).To(Equal(uint64(6000)))
+
+		// the entry is removed once the tasks of the cgroup did not run during an interval
+		metricCollector.resetDeltaValue()
+		metricCollector.AggregateProcessResourceUtilizationMetrics()
+		Expect(metricCollector.CgroupStats).To(BeEmpty())
+	})
+
+	It("Restores the checkpointed counters of the running containers", func() {
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		metricCollector := newMockCollector(bpfExporter)
+		cp := checkpoint.New(metricCollector.NodeStats.NodeName())
+		cp.Node = checkpoint.Counters{config.DynEnergyInPkg: {"socket1": 1000}}
+		cp.Containers["container1"] = checkpoint.Counters{config.DynEnergyInPkg: {"socket1": 500}}
+		cp.Containers["gone"] = checkpoint.Counters{config.DynEnergyInPkg: {"socket1": 500}}
+		metricCollector.RestoreCheckpoint(cp)
+
+		Expect(metricCollector.NodeStats.EnergyUsage[config.DynEnergyInPkg]["socket1"].GetAggr()).To(Equal(uint64(1000)))
+		Expect(metricCollector.ContainerStats["container1"].EnergyUsage[config.DynEnergyInPkg]["socket1"].GetAggr()).To(Equal(uint64(500)))
+
+		// the containers not seen again before the next checkpoint are dropped
+		next := metricCollector.Checkpoint()
+		Expect(next.Containers).To(HaveKey("container1"))
+		Expect(next.Containers).NotTo(HaveKey("gone"))
+		Expect(next.Node[config.DynEnergyInPkg]["socket1"]).To(Equal(uint64(1000)))
+	})
+
+	It("Ignores the checkpoint of another node", func() {
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		metricCollector := newMockCollector(bpfExporter)
+		cp := checkpoint.New("another-node")
+		cp.Node = checkpoint.Counters{config.DynEnergyInPkg: {"socket1": 1000}}
+		metricCollector.RestoreCheckpoint(cp)
+		Expect(metricCollector.NodeStats.EnergyUsage[config.DynEnergyInPkg]).NotTo(HaveKey("socket1"))
+	})
+
+	It("Reports the collection health", func() {
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		metricCollector := newMockCollector(bpfExporter)
+		Expect(metricCollector.CollectionHealthCheck()).To(HaveOccurred())
+		metricCollector.recordUpdate()
+		Expect(metricCollector.CollectionHealthCheck()).NotTo(HaveOccurred())
+		// the measured power sources are disabled in the mocked collector
+		Expect(metricCollector.PowerSourceHealthCheck()).NotTo(HaveOccurred())
+	})
+
 })
@@ -11,3 +11,11 @@ import (
 func UpdateProcessBPFMetrics(bpfExporter bpf.Exporter, processStats map[uint64]*stats.ProcessStats) {
 
 }
+
+func UpdateCgroupBPFMetrics(bpfExporter bpf.Exporter, cgroupStats map[uint64]*stats.ProcessStats) {
+
+}
+
+func UpdateIRQBPFMetrics(bpfExporter bpf.Exporter, statsMap map[uint64]*stats.ProcessStats, nodeStats *stats.NodeStats) {
+
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/bpf"
 	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats/types"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/libvirt"
 	"github.com/sustainable-computing-io/kepler/pkg/utils"
@@ -42,7 +43,7 @@ func updateSWCounters(key uint64, ct *ProcessBPFMetrics, processStats map[uint64
 	for counterKey := range bpfSupportedMetrics.SoftwareCounters {
 		switch counterKey {
 		case config.CPUTime:
-			processStats[key].ResourceUsage[config.CPUTime].AddDeltaStat(utils.GenericSocketID, ct.ProcessRunTime/1000 /* convert microseconds to milliseconds */)
+			addPerSocket(processStats[key].ResourceUsage[config.CPUTime], ct, ct.ProcessRunTime, func(s *bpf.SocketMetrics) uint64 { return s.ProcessRunTime }, 1000 /* convert microseconds to milliseconds */)
 		case config.PageCacheHit:
 			processStats[key].ResourceUsage[config.PageCacheHit].AddDeltaStat(utils.GenericSocketID, ct.PageCacheHit/(1000*1000))
 		case config.IRQNetTXLabel:
@@ -51,6 +52,16 @@ func updateSWCounters(key uint64, ct *ProcessBPFMetrics, processStats map[uint64
 			processStats[key].ResourceUsage[config.IRQNetRXLabel].AddDeltaStat(utils.GenericSocketID, uint64(ct.VecNr[bpf.IRQNetRX]))
 		case config.IRQBlockLabel:
 			processStats[key].ResourceUsage[config.IRQBlockLabel].AddDeltaStat(utils.GenericSocketID, uint64(ct.VecNr[bpf.IRQBlock]))
+		case config.NetTXBytes:
+			processStats[key].ResourceUsage[config.NetTXBytes].AddDeltaStat(utils.GenericSocketID, ct.NetTxBytes)
+		case config.NetRXBytes:
+			processStats[key].ResourceUsage[config.NetRXBytes].AddDeltaStat(utils.GenericSocketID, ct.NetRxBytes)
+		case config.NetTXPackets:
+			processStats[key].ResourceUsage[config.NetTXPackets].AddDeltaStat(utils.GenericSocketID, ct.NetTxPackets)
+		case config.NetRXPackets:
+			processStats[key].ResourceUsage[config.NetRXPackets].AddDeltaStat(utils.GenericSocketID, ct.NetRxPackets)
+		case config.BlockReadBytes, config.BlockWriteBytes, config.BlockReadOps, config.BlockWriteOps:
+			// the block I/O is accounted per cgroup, see updateBlockIOBPFMetrics
 		default:
 			klog.Errorf("counter %s is not supported\n", counterKey)
 		}
@@ -59,26 +70,31 @@ func updateSWCounters(key uint64, ct *ProcessBPFMetrics, processStats map[uint64
 
 // update hardware counter metrics
 func updateHWCounters(key uint64, ct *ProcessBPFMetrics, processStats map[uint64]*stats.ProcessStats, bpfSupportedMetrics bpf.SupportedMetrics) {
-	for counterKey := range bpfSupportedMetrics.HardwareCounters {
-		var val uint64
-		var event string
-		switch counterKey {
-		case config.CPUCycle:
-			val = ct.CpuCycles
-			event = config.CPUCycle
-		case config.CPURefCycle:
-			val = ct.CpuCycles
-			event = config.CPURefCycle
-		case config.CPUInstruction:
-			val = ct.CpuInstr
-			event = config.CPUInstruction
-		case config.CacheMiss:
-			val = ct.CacheMiss
-			event = config.CacheMiss
-		default:
-			klog.Errorf("counter %s is not supported\n", counterKey)
+	// the counters are collected in the order they are configured
+	for i, counterKey := range config.BPFHwCounters() {
+		if !bpfSupportedMetrics.HardwareCounters.Has(counterKey) {
+			continue
+		}
+		addPerSocket(processStats[key].ResourceUsage[counterKey], ct, ct.HwCounters[i], func(s *bpf.SocketMetrics) uint64 { return s.HwCounters[i] }, 1)
+	}
+}
+
+// addPerSocket adds a counter of the process to the sockets it ran on, or the total to the generic socket
+// if the eBPF program did not split the counters of the process per socket. The counters per socket are read apart
+// from the total and can include the counts of the next collection, so they only give the share of each socket.
+func addPerSocket(stat types.UInt64StatCollection, ct *ProcessBPFMetrics, total uint64, socketVal func(*bpf.SocketMetrics) uint64, divisor uint64) {
+	var sum uint64
+	for i := range ct.Sockets {
+		sum += socketVal(&ct.Sockets[i])
+	}
+	if sum == 0 {
+		stat.AddDeltaStat(utils.GenericSocketID, total/divisor)
+		return
+	}
+	for i := range ct.Sockets {
+		if val := socketVal(&ct.Sockets[i]); val > 0 {
+			stat.AddDeltaStat(utils.SocketID(i), uint64(float64(total)*float64(val)/float64(sum))/divisor)
 		}
-		processStats[key].ResourceUsage[event].AddDeltaStat(utils.GenericSocketID, val)
 	}
 }
 
@@ -98,8 +114,8 @@ func UpdateProcessBPFMetrics(bpfExporter bpf.Exporter, processStats map[uint64]*
 		}
 
 		if ct.Pid != 0 {
-			klog.V(6).Infof("process %s (pid=%d, cgroup=%d) has %d process run time, %d CPU cycles, %d instructions, %d cache misses, %d page cache hits",
-				comm, ct.Pid, ct.CgroupId, ct.ProcessRunTime, ct.CpuCycles, ct.CpuInstr, ct.CacheMiss, ct.PageCacheHit)
+			klog.V(6).Infof("process %s (pid=%d, cgroup=%d) has %d process run time, %v hardware counters, %d page cache hits",
+				comm, ct.Pid, ct.CgroupId, ct.ProcessRunTime, ct.HwCounters, ct.PageCacheHit)
 		}
 
 		// if the pid is within a container, it will have a container ID
@@ -141,4 +157,271 @@ func UpdateProcessBPFMetrics(bpfExporter bpf.Exporter, processStats map[uint64]*
 		updateSWCounters(mapKey, &ct, processStats, bpfSupportedMetrics)
 		updateHWCounters(mapKey, &ct, processStats, bpfSupportedMetrics)
 	}
+	// the exited processes and the block I/O are accounted in the cgroup entries, see UpdateCgroupBPFMetrics
+	if bpfExporter.SupportedMetrics().CgroupAggregation {
+		return
+	}
+	updateExitedProcessBPFMetrics(bpfExporter, processStats)
+	updateBlockIOBPFMetrics(bpfExporter, processStats)
+}
+
+// UpdateCgroupBPFMetrics reads the counters aggregated per cgroup by the eBPF programs, to an entry per cgroup keyed
+// by the cgroup id. The entries include the processes that exited and the block I/O of the cgroup, and their container
+// is resolved from the cgroup id only when the entry is created.
+func UpdateCgroupBPFMetrics(bpfExporter bpf.Exporter, cgroupStats map[uint64]*stats.ProcessStats) {
+	cgroupsData, err := bpfExporter.CollectCgroups()
+	if err != nil {
+		klog.Errorln("could not collect ebpf metrics of the cgroups")
+		return
+	}
+	bpfSupportedMetrics := bpfExporter.SupportedMetrics()
+	for _, ct := range cgroupsData {
+		cgroupStatsEntry(cgroupStats, ct.CgroupId)
+		updateSWCounters(ct.CgroupId, &ct, cgroupStats, bpfSupportedMetrics)
+		updateHWCounters(ct.CgroupId, &ct, cgroupStats, bpfSupportedMetrics)
+	}
+
+	if !bpfSupportedMetrics.SoftwareCounters.Has(config.BlockReadBytes) {
+		return
+	}
+	blockIO, err := bpfExporter.CollectCgroupBlockIO()
+	if err != nil {
+		klog.Errorln("could not collect ebpf metrics of the block I/O")
+		return
+	}
+	for cgroupID, io := range blockIO {
+		addBlockIO(cgroupStatsEntry(cgroupStats, cgroupID), io)
+	}
+}
+
+// cgroupStatsEntry returns the entry of the cgroup, which is created the first time the cgroup is seen
+func cgroupStatsEntry(cgroupStats map[uint64]*stats.ProcessStats, cgroupID uint64) *stats.ProcessStats {
+	cStat, ok := cgroupStats[cgroupID]
+	if !ok {
+		containerID, err := cgroup.GetContainerID(cgroupID, 0, true)
+		if err != nil {
+			klog.V(6).Infof("failed to resolve container for cgroup %d: %v, set containerID=%s", cgroupID, err, utils.SystemProcessName)
+		}
+		process := utils.CgroupProcessName
+		if cgroupID == 1 {
+			process = utils.KernelProcessName
+		}
+		cStat = stats.NewProcessStats(0, cgroupID, containerID, utils.EmptyString, process)
+		cgroupStats[cgroupID] = cStat
+	}
+	cStat.IdleCounter = 0
+	return cStat
+}
+
+// updateExitedProcessBPFMetrics accounts the processes that exited since the last collection to an entry per cgroup,
+// so that the resource utilization of short-lived processes is still attributed to their container
+func updateExitedProcessBPFMetrics(bpfExporter bpf.Exporter, processStats map[uint64]*stats.ProcessStats) {
+	exitedData, err := bpfExporter.CollectExitedProcesses()
+	if err != nil {
+		klog.Errorln("could not collect ebpf metrics of the exited processes")
+		return
+	}
+	bpfSupportedMetrics := bpfExporter.SupportedMetrics()
+	for _, ct := range exitedData {
+		mapKey := stats.ExitedProcessesPID(ct.CgroupId)
+		process := utils.ExitedProcessName
+		if ct.CgroupId == 1 && config.EnabledEBPFCgroupID() {
+			mapKey = 1
+			process = utils.KernelProcessName
+		}
+
+		pStat, ok := processStats[mapKey]
+		if !ok {
+			// the processes are gone, so the container can only be resolved from the cgroup id
+			containerID, err := cgroup.GetContainerID(ct.CgroupId, 0, true)
+			if err != nil {
+				klog.V(6).Infof("failed to resolve container for the processes exited in cgroup %d: %v, set containerID=%s", ct.CgroupId, err, utils.SystemProcessName)
+			}
+			pStat = stats.NewProcessStats(mapKey, ct.CgroupId, containerID, utils.EmptyString, process)
+			processStats[mapKey] = pStat
+		}
+		pStat.IdleCounter = 0
+
+		updateSWCounters(mapKey, &ct, processStats, bpfSupportedMetrics)
+		updateHWCounters(mapKey, &ct, processStats, bpfSupportedMetrics)
+	}
+}
+
+// updateBlockIOBPFMetrics accounts the block I/O completed since the last collection to an entry per cgroup.
+// The I/O is written back by kernel threads, so it is only known which cgroup it was issued for.
+func updateBlockIOBPFMetrics(bpfExporter bpf.Exporter, processStats map[uint64]*stats.ProcessStats) {
+	bpfSupportedMetrics := bpfExporter.SupportedMetrics()
+	if !bpfSupportedMetrics.SoftwareCounters.Has(config.BlockReadBytes) {
+		return
+	}
+	blockIO, err := bpfExporter.CollectCgroupBlockIO()
+	if err != nil {
+		klog.Errorln("could not collect ebpf metrics of the block I/O")
+		return
+	}
+	for cgroupID, io := range blockIO {
+		mapKey := stats.BlockIOPID(cgroupID)
+		process := utils.BlockIOProcessName
+		if cgroupID == 1 && config.EnabledEBPFCgroupID() {
+			mapKey = 1
+			process = utils.KernelProcessName
+		}
+
+		pStat, ok := processStats[mapKey]
+		if !ok {
+			containerID, err := cgroup.GetContainerID(cgroupID, 0, true)
+			if err != nil {
+				klog.V(6).Infof("failed to resolve container for the block I/O of cgroup %d: %v, set containerID=%s", cgroupID, err, utils.SystemProcessName)
+			}
+			pStat = stats.NewProcessStats(mapKey, cgroupID, containerID, utils.EmptyString, process)
+			processStats[mapKey] = pStat
+		}
+		pStat.IdleCounter = 0
+
+		addBlockIO(pStat, io)
+	}
+}
+
+func addBlockIO(pStat *stats.ProcessStats, io bpf.BlockIOMetrics) {
+	pStat.ResourceUsage[config.BlockReadBytes].AddDeltaStat(utils.GenericSocketID, io.ReadBytes)
+	pStat.ResourceUsage[config.BlockWriteBytes].AddDeltaStat(utils.GenericSocketID, io.WriteBytes)
+	pStat.ResourceUsage[config.BlockReadOps].AddDeltaStat(utils.GenericSocketID, io.ReadOps)
+	pStat.ResourceUsage[config.BlockWriteOps].AddDeltaStat(utils.GenericSocketID, io.WriteOps)
+}
+
+// irqCountLabels are the resource utilization metrics counting the interrupts of the softirq vectors
+var irqCountLabels = map[int]string{
+	bpf.IRQNetTX: config.IRQNetTXLabel,
+	bpf.IRQNetRX: config.IRQNetRXLabel,
+	bpf.IRQBlock: config.IRQBlockLabel,
+}
+
+// irqOwnerCounters are the counters the time spent in a softirq vector is split by between the owners of the sockets
+// or block requests it processed
+var irqOwnerCounters = map[int][]string{
+	bpf.IRQNetTX: {config.NetTXPackets},
+	bpf.IRQNetRX: {config.NetRXPackets},
+	bpf.IRQBlock: {config.BlockReadOps, config.BlockWriteOps},
+}
+
+// UpdateIRQBPFMetrics accounts the time spent handling the interrupts since the last collection to the node and
+// attributes it per the IRQ attribution policy. With the task policy, the eBPF programs already charged the interrupts
+// to the task they interrupted. The stats map holds the entries of the cgroups if the counters are aggregated per
+// cgroup, otherwise the entries of the processes.
+func UpdateIRQBPFMetrics(bpfExporter bpf.Exporter, statsMap map[uint64]*stats.ProcessStats, nodeStats *stats.NodeStats) {
+	irqs, err := bpfExporter.CollectIRQs()
+	if err != nil {
+		klog.Errorln("could not collect ebpf metrics of the interrupts")
+		return
+	}
+	if irqs == nil {
+		return
+	}
+	for i, irq := range irqs {
+		nodeStats.IRQTime.SetAggrStat(bpf.IRQNames[i], irq.Time)
+		nodeStats.IRQCount.SetAggrStat(bpf.IRQNames[i], irq.Count)
+	}
+
+	policy := config.GetIRQAttribution()
+	if policy == config.IRQAttributionTask {
+		return
+	}
+	bpfSupportedMetrics := bpfExporter.SupportedMetrics()
+	kernelEntry := func() *stats.ProcessStats {
+		if bpfSupportedMetrics.CgroupAggregation {
+			return cgroupStatsEntry(statsMap, 1)
+		}
+		return kernelIRQEntry(statsMap)
+	}
+	attributeIRQs(policy, nodeStats, statsMap, kernelEntry, bpfSupportedMetrics)
+}
+
+// attributeIRQs charges the time spent in the interrupts, which the eBPF programs did not charge to the task they
+// interrupted, to the CPU time of the kernel processes. With the owner policy, the time spent in a softirq vector
+// processing packets or block requests is first split between the entries by their packets or operations.
+func attributeIRQs(policy string, nodeStats *stats.NodeStats, statsMap map[uint64]*stats.ProcessStats, kernelEntry func() *stats.ProcessStats, bpfSupportedMetrics bpf.SupportedMetrics) {
+	var kernelTime uint64
+	kernelCounts := map[string]uint64{}
+	for i, name := range bpf.IRQNames {
+		time := nodeStats.IRQTime.GetDelta(name) / 1000000 // convert nanoseconds to milliseconds
+		count := nodeStats.IRQCount.GetDelta(name)
+		countLabel := irqCountLabels[i]
+		if !bpfSupportedMetrics.SoftwareCounters.Has(countLabel) {
+			countLabel = ""
+		}
+		if policy == config.IRQAttributionOwner {
+			ownedTime, ownedCount := chargeIRQOwners(statsMap, irqOwnerCounters[i], time, count, countLabel)
+			time -= ownedTime
+			count -= ownedCount
+		}
+		kernelTime += time
+		if countLabel != "" && count > 0 {
+			kernelCounts[countLabel] += count
+		}
+	}
+
+	if kernelTime == 0 && len(kernelCounts) == 0 {
+		return
+	}
+	kernel := kernelEntry()
+	kernel.ResourceUsage[config.CPUTime].AddDeltaStat(utils.GenericSocketID, kernelTime)
+	for label, count := range kernelCounts {
+		kernel.ResourceUsage[label].AddDeltaStat(utils.GenericSocketID, count)
+	}
+}
+
+// chargeIRQOwners splits the time and number of interrupts of a softirq vector between the entries in proportion to
+// their delta of the counters, and returns the time and number charged. Nothing is charged if no entry has counters.
+func chargeIRQOwners(statsMap map[uint64]*stats.ProcessStats, counters []string, time, count uint64, countLabel string) (chargedTime, chargedCount uint64) {
+	if len(counters) == 0 {
+		return 0, 0
+	}
+	weights := map[uint64]uint64{}
+	var total uint64
+	for key, pStat := range statsMap {
+		var weight uint64
+		for _, counter := range counters {
+			if stat, ok := pStat.ResourceUsage[counter]; ok {
+				weight += stat.SumAllDeltaValues()
+			}
+		}
+		if weight > 0 {
+			weights[key] = weight
+			total += weight
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	for key, weight := range weights {
+		ownedTime := time * weight / total
+		ownedCount := count * weight / total
+		statsMap[key].ResourceUsage[config.CPUTime].AddDeltaStat(utils.GenericSocketID, ownedTime)
+		if countLabel != "" {
+			statsMap[key].ResourceUsage[countLabel].AddDeltaStat(utils.GenericSocketID, ownedCount)
+		}
+		chargedTime += ownedTime
+		chargedCount += ownedCount
+	}
+	return chargedTime, chargedCount
+}
+
+// kernelIRQEntry returns the entry of the kernel processes the interrupts are charged to, which is the entry
+// aggregating the kernel processes if they are aggregated by cgroup id
+func kernelIRQEntry(processStats map[uint64]*stats.ProcessStats) *stats.ProcessStats {
+	var mapKey uint64 = stats.KernelIRQPID
+	if config.EnabledEBPFCgroupID() {
+		mapKey = 1
+	}
+	pStat, ok := processStats[mapKey]
+	if !ok {
+		containerID, err := cgroup.GetContainerID(1, 0, true)
+		if err != nil {
+			klog.V(6).Infof("failed to resolve container for the kernel processes: %v, set containerID=%s", err, utils.KernelProcessName)
+		}
+		pStat = stats.NewProcessStats(mapKey, 1, containerID, utils.EmptyString, utils.KernelProcessName)
+		processStats[mapKey] = pStat
+	}
+	pStat.IdleCounter = 0
+	return pStat
 }
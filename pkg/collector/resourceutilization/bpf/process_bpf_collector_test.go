@@ -4,8 +4,100 @@
 package bpf
 
 import (
+	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+
 	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Test hc collector", func() {
+	Context("IRQ attribution", func() {
+		var (
+			nodeStats    *stats.NodeStats
+			processStats map[uint64]*stats.ProcessStats
+			kernel       *stats.ProcessStats
+			kernelEntry  func() *stats.ProcessStats
+		)
+
+		BeforeEach(func() {
+			_, err := config.Initialize(".")
+			Expect(err).NotTo(HaveOccurred())
+			nodeStats = stats.NewNodeStats()
+			// 100ms in NET_RX, 30ms in TIMER and 3 NET_RX softirqs
+			nodeStats.IRQTime.SetDeltaStat(bpf.IRQNames[bpf.IRQNetRX], 100*1000*1000)
+			nodeStats.IRQTime.SetDeltaStat(bpf.IRQNames[1], 30*1000*1000)
+			nodeStats.IRQCount.SetDeltaStat(bpf.IRQNames[bpf.IRQNetRX], 3)
+
+			processStats = map[uint64]*stats.ProcessStats{}
+			for pid, packets := range map[uint64]uint64{10: 3000, 20: 1000, 30: 0} {
+				processStats[pid] = stats.NewProcessStats(pid, 0, "", "", "app")
+				processStats[pid].ResourceUsage[config.NetRXPackets].SetDeltaStat(utils.GenericSocketID, packets)
+			}
+			kernel = nil
+			kernelEntry = func() *stats.ProcessStats {
+				if kernel == nil {
+					kernel = stats.NewProcessStats(stats.KernelIRQPID, 1, utils.KernelProcessName, "", utils.KernelProcessName)
+				}
+				return kernel
+			}
+		})
+
+		cpuTime := func(pStat *stats.ProcessStats) uint64 {
+			return pStat.ResourceUsage[config.CPUTime].SumAllDeltaValues()
+		}
+
+		It("charges the interrupts to the kernel processes", func() {
+			attributeIRQs(config.IRQAttributionKernel, nodeStats, processStats, kernelEntry, bpf.DefaultSupportedMetrics())
+			Expect(cpuTime(kernel)).To(Equal(uint64(130)))
+			Expect(kernel.ResourceUsage[config.IRQNetRXLabel].SumAllDeltaValues()).To(Equal(uint64(3)))
+			Expect(cpuTime(processStats[10])).To(BeZero())
+		})
+
+		It("charges the softirqs processing packets to the owners of the sockets", func() {
+			attributeIRQs(config.IRQAttributionOwner, nodeStats, processStats, kernelEntry, bpf.DefaultSupportedMetrics())
+			Expect(cpuTime(processStats[10])).To(Equal(uint64(75)))
+			Expect(cpuTime(processStats[20])).To(Equal(uint64(25)))
+			Expect(cpuTime(processStats[30])).To(BeZero())
+			Expect(processStats[10].ResourceUsage[config.IRQNetRXLabel].SumAllDeltaValues()).To(Equal(uint64(2)))
+			// the timer softirqs and the interrupts left by the rounding
+			Expect(cpuTime(kernel)).To(Equal(uint64(30)))
+			Expect(kernel.ResourceUsage[config.IRQNetRXLabel].SumAllDeltaValues()).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("socket split", func() {
+		BeforeEach(func() {
+			_, err := config.Initialize(".")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("splits the CPU time of a process by the share of each socket", func() {
+			// the counters per socket were read after the total and include 100ms more
+			ct := ProcessBPFMetrics{
+				ProcessCounters: bpf.ProcessCounters{ProcessRunTime: 300000},
+				Sockets:         make([]bpf.SocketMetrics, bpf.MaxSockets),
+			}
+			ct.Sockets[0].ProcessRunTime = 100000
+			ct.Sockets[2].ProcessRunTime = 300000
+			processStats := map[uint64]*stats.ProcessStats{1: stats.NewProcessStats(1, 0, "", "", "app")}
+			updateSWCounters(1, &ct, processStats, bpf.DefaultSupportedMetrics())
+
+			cpuTime := processStats[1].ResourceUsage[config.CPUTime]
+			Expect(cpuTime.SumAllDeltaValues()).To(Equal(uint64(300)))
+			Expect(cpuTime.GetDelta(utils.SocketID(0))).To(Equal(uint64(75)))
+			Expect(cpuTime.GetDelta(utils.SocketID(2))).To(Equal(uint64(225)))
+		})
+
+		It("adds the CPU time of a process not split per socket to the generic socket", func() {
+			ct := ProcessBPFMetrics{ProcessCounters: bpf.ProcessCounters{ProcessRunTime: 300000}}
+			processStats := map[uint64]*stats.ProcessStats{1: stats.NewProcessStats(1, 0, "", "", "app")}
+			updateSWCounters(1, &ct, processStats, bpf.DefaultSupportedMetrics())
+
+			cpuTime := processStats[1].ResourceUsage[config.CPUTime]
+			Expect(cpuTime.GetDelta(utils.GenericSocketID)).To(Equal(uint64(300)))
+		})
+	})
 })
@@ -19,6 +19,7 @@ package stats
 import (
 	"fmt"
 
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats/types"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/node"
 	acc "github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
@@ -31,21 +32,38 @@ type NodeStats struct {
 	// IdleResUtilization is used to determine idle pmap[string]eriods
 	IdleResUtilization map[string]uint64
 
+	// IRQTime is the time in ns spent handling each interrupt, keyed by the names of the softirq vectors and hardirq
+	IRQTime types.UInt64StatCollection
+	// IRQCount is the number of interrupts handled, keyed as IRQTime
+	IRQCount types.UInt64StatCollection
+
+	// ScalingFrequency is the average frequency in MHz cpufreq set the CPUs to
+	ScalingFrequency uint64
+
 	// nodeInfo allows access to node information
 	nodeInfo node.Node
 }
 
 func NewNodeStats() *NodeStats {
-	return &NodeStats{
+	ne := &NodeStats{
 		Stats:              *NewStats(),
 		IdleResUtilization: map[string]uint64{},
+		IRQTime:            types.NewUInt64StatCollection(),
+		IRQCount:           types.NewUInt64StatCollection(),
 		nodeInfo:           node.NewNodeInfo(),
 	}
+	if config.IsCPUStateMetricsEnabled() {
+		// the time spent in the idle states is keyed by the name of the state
+		ne.ResourceUsage[config.CPUIdleTime] = types.NewUInt64StatCollection()
+	}
+	return ne
 }
 
 // ResetDeltaValues reset all delta values to 0
 func (ne *NodeStats) ResetDeltaValues() {
 	ne.Stats.ResetDeltaValues()
+	ne.IRQTime.ResetDeltaValues()
+	ne.IRQCount.ResetDeltaValues()
 }
 
 func (ne *NodeStats) UpdateIdleEnergyWithMinValue(isComponentsSystemCollectionSupported bool) {
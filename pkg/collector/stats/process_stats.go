@@ -20,6 +20,18 @@ import (
 	"fmt"
 )
 
+// exitedProcessesPIDOffset is above the largest pid (PID_MAX_LIMIT is 2^22), so the pid of the
+// processes exited in a cgroup cannot collide with the pid of a running process.
+const exitedProcessesPIDOffset = 1 << 32
+
+// blockIOPIDOffset is above the pids of the exited processes entries, for the entries accounting the block I/O
+// of a cgroup.
+const blockIOPIDOffset = 2 << 32
+
+// KernelIRQPID is above the pids of the block I/O entries, for the entry accounting the interrupts charged to the
+// kernel when the kernel processes are not aggregated in an entry.
+const KernelIRQPID = 3 << 32
+
 type ProcessStats struct {
 	Stats
 	PID         uint64
@@ -43,6 +55,26 @@ func NewProcessStats(pid, cGroupID uint64, containerID, vmID, command string) *P
 	return p
 }
 
+// ExitedProcessesPID returns the pid of the entry accounting the processes exited in the cgroup.
+func ExitedProcessesPID(cGroupID uint64) uint64 {
+	return exitedProcessesPIDOffset + cGroupID
+}
+
+// IsExitedProcesses returns whether the pid is the one of an entry accounting exited processes.
+func IsExitedProcesses(pid uint64) bool {
+	return pid >= exitedProcessesPIDOffset && pid < blockIOPIDOffset
+}
+
+// BlockIOPID returns the pid of the entry accounting the block I/O of the cgroup.
+func BlockIOPID(cGroupID uint64) uint64 {
+	return blockIOPIDOffset + cGroupID
+}
+
+// IsBlockIO returns whether the pid is the one of an entry accounting the block I/O of a cgroup.
+func IsBlockIO(pid uint64) bool {
+	return pid >= blockIOPIDOffset && pid < KernelIRQPID
+}
+
 // ResetDeltaValues reset all delta values to 0
 func (p *ProcessStats) ResetDeltaValues() {
 	p.Stats.ResetDeltaValues()
@@ -20,4 +20,18 @@ var _ = Describe("ProcessMetric", func() {
 		p.ResetDeltaValues()
 		Expect(p.ResourceUsage[config.CPUTime].SumAllDeltaValues()).To(Equal(uint64(0)))
 	})
+
+	It("Test ExitedProcessesPID", func() {
+		pid := ExitedProcessesPID(1234)
+		Expect(IsExitedProcesses(pid)).To(BeTrue())
+		Expect(IsExitedProcesses(4194304)).To(BeFalse())
+		Expect(pid).NotTo(Equal(ExitedProcessesPID(1235)))
+	})
+
+	It("Test BlockIOPID", func() {
+		pid := BlockIOPID(1234)
+		Expect(IsBlockIO(pid)).To(BeTrue())
+		Expect(IsExitedProcesses(pid)).To(BeFalse())
+		Expect(IsBlockIO(ExitedProcessesPID(1234))).To(BeFalse())
+	})
 })
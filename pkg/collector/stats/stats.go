@@ -23,6 +23,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats/types"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	acc "github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/cpu"
 	"k8s.io/klog/v2"
 )
 
@@ -257,7 +258,17 @@ func (s *Stats) ToEstimatorValues(featuresName []string, shouldNormalize bool) [
 			value := normalize(float64(s.EnergyUsage[config.IdleEnergyInGPU].SumAllDeltaValues()), shouldNormalize)
 			featureValues = append(featureValues, value)
 
+		case config.CPUFrequency: // The frequency is not normalized since it is not accumulated over the interval.
+			featureValues = append(featureValues, float64(s.CPUFrequency()))
+
 		default:
+			// The time spent in an idle state, only collected for the node.
+			if state, found := strings.CutPrefix(feature, config.CPUIdleTimePrefix); found {
+				if idleTime, exists := s.ResourceUsage[config.CPUIdleTime]; exists {
+					featureValues = append(featureValues, normalize(float64(idleTime.GetDelta(state)), shouldNormalize))
+					continue
+				}
+			}
 			klog.V(10).Infof("Unknown node feature: %s, adding 0 value", feature)
 			featureValues = append(featureValues, 0)
 		}
@@ -265,6 +276,39 @@ func (s *Stats) ToEstimatorValues(featuresName []string, shouldNormalize bool) [
 	return featureValues
 }
 
+// CPUFrequency returns the average effective frequency in MHz of the CPUs while running during the last interval,
+// or 0 if APERF and MPERF are not counted
+func (s *Stats) CPUFrequency() uint64 {
+	aperf, aperfExists := s.ResourceUsage[config.APERF]
+	mperf, mperfExists := s.ResourceUsage[config.MPERF]
+	if !aperfExists || !mperfExists {
+		return 0
+	}
+	return cpu.EffectiveFrequency(aperf.SumAllDeltaValues(), mperf.SumAllDeltaValues())
+}
+
+// ToSocketEstimatorValues returns the values of a single socket for the specified metric names, normalized if required.
+// The resource utilization is read from the resourceID source and the power consumption from the energyID source,
+// since the resource utilization and the energy of a socket are not stored with the same id.
+func (s *Stats) ToSocketEstimatorValues(featuresName []string, resourceID, energyID string, shouldNormalize bool) []float64 {
+	featureValues := make([]float64, 0, len(featuresName))
+	for _, feature := range featuresName {
+		var value uint64
+		if feature == config.CPUFrequency {
+			aperf, mperf := s.ResourceUsage[config.APERF], s.ResourceUsage[config.MPERF]
+			featureValues = append(featureValues, float64(cpu.EffectiveFrequency(aperf.GetDelta(resourceID), mperf.GetDelta(resourceID))))
+			continue
+		}
+		if collection, exists := s.ResourceUsage[feature]; exists {
+			value = collection.GetDelta(resourceID)
+		} else if collection, exists := s.EnergyUsage[feature]; exists {
+			value = collection.GetDelta(energyID)
+		}
+		featureValues = append(featureValues, normalize(float64(value), shouldNormalize))
+	}
+	return featureValues
+}
+
 func (s *Stats) AbsEnergyMetrics() []string {
 	return s.availableMetrics.absEnergyMetrics
 }
@@ -3,6 +3,7 @@ package stats
 import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats/types"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 )
 
@@ -15,4 +16,16 @@ var _ = Describe("Stats", func() {
 		exp := []string{}
 		Expect(len(GetProcessFeatureNames()) >= len(exp)).To(BeTrue())
 	})
+	It("Test the CPU state features", func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+
+		s := NewStats()
+		s.ResourceUsage[config.CPUIdleTime] = types.NewUInt64StatCollection()
+		s.ResourceUsage[config.CPUIdleTime].SetDeltaStat("c6", 1200)
+		s.ResourceUsage[config.CPUIdleTime].SetDeltaStat("poll", 3)
+		values := s.ToEstimatorValues([]string{config.CPUIdleTimePrefix + "c6", config.CPUIdleTime, config.CPUFrequency}, false)
+		// the effective frequency is unknown without APERF and MPERF
+		Expect(values).To(Equal([]float64{1200, 1203, 0}))
+	})
 })
@@ -82,6 +82,11 @@ func (s *UInt64Stat) SetNewAggr(newAggr uint64) error {
 	return nil
 }
 
+// RestoreAggr adds an aggregated value accumulated before a restart, the delta value is unchanged
+func (s *UInt64Stat) RestoreAggr(aggr uint64) {
+	s.aggr.Add(aggr)
+}
+
 func (s *UInt64Stat) GetDelta() uint64 {
 	return s.delta.Load()
 }
@@ -125,6 +130,23 @@ func (s UInt64StatCollection) SetDeltaStat(key string, newDelta uint64) {
 	}
 }
 
+// RestoreAggrStat adds an aggregated value accumulated before a restart to the stat of key
+func (s UInt64StatCollection) RestoreAggrStat(key string, aggr uint64) {
+	if instance, found := s[key]; !found {
+		s[key] = NewUInt64Stat(aggr, 0)
+	} else {
+		instance.RestoreAggr(aggr)
+	}
+}
+
+// GetDelta returns the delta of the given source, or 0 if the source is unknown
+func (s UInt64StatCollection) GetDelta(key string) uint64 {
+	if stat, found := s[key]; found {
+		return stat.GetDelta()
+	}
+	return 0
+}
+
 // SumAllDeltaValues aggregates the delta metrics of all sources (i.e., stat keys)
 func (s UInt64StatCollection) SumAllDeltaValues() uint64 {
 	sum := uint64(0)
@@ -128,6 +128,15 @@ var _ = Describe("Types", func() {
 			Expect(instance["SetDeltaStat"].GetAggr()).To(Equal(uint64(3)))
 			Expect(instance["SetDeltaStat"].GetDelta()).To(Equal(uint64(2)))
 		})
+		It("RestoreAggrStat", func() {
+			instance.RestoreAggrStat("RestoreAggrStat", uint64(5))
+			Expect(instance["RestoreAggrStat"].GetAggr()).To(Equal(uint64(5)))
+			Expect(instance["RestoreAggrStat"].GetDelta()).To(Equal(uint64(0)))
+			instance.AddDeltaStat("RestoreAggrStat", uint64(2))
+			instance.RestoreAggrStat("RestoreAggrStat", uint64(5))
+			Expect(instance["RestoreAggrStat"].GetAggr()).To(Equal(uint64(12)))
+			Expect(instance["RestoreAggrStat"].GetDelta()).To(Equal(uint64(2)))
+		})
 		It("SumAllDeltaValues", func() {
 			value := instance.SumAllDeltaValues()
 			Expect(value).To(Equal(uint64(0)))
@@ -38,5 +38,10 @@ func GetProcessFeatureNames() []string {
 		}
 	}
 
+	// cpu state metric, derived from the APERF and MPERF hardware counters
+	if config.IsCPUStateMetricsEnabled() {
+		metrics = append(metrics, config.CPUFrequency)
+	}
+
 	return metrics
 }
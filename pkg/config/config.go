@@ -34,6 +34,8 @@ var (
 	versionRegex = regexp.MustCompile(`^(\d+)\.(\d+).`)
 	instance     *Config
 	once         sync.Once
+	// parseErrors collects malformed values found while building the config
+	parseErrors ValidationErrors
 )
 
 type Client interface {
@@ -66,6 +68,22 @@ type KeplerConfig struct {
 	MachineSpecFilePath          string
 	ExcludeSwapperProcess        bool
 	RAPLPath                     string
+	// HWCounters are the perf events of the hardware counters, see ParseHWCounters
+	HWCounters []string
+	// ProcfsFallback reads the CPU time of the processes from procfs if the eBPF programs cannot be loaded
+	ProcfsFallback bool
+	// ProcfsCgroupHWCounters counts the hardware counters per cgroup when reading the CPU time from procfs
+	ProcfsCgroupHWCounters bool
+	// CgroupAggregation aggregates the counters per cgroup in the eBPF programs
+	CgroupAggregation bool
+	// BPFMapSize is the number of entries of the eBPF maps of the processes and cgroups
+	BPFMapSize int
+	// BPFPinPath is the bpffs directory the eBPF programs and maps are pinned in to survive restarts, empty disables pinning
+	BPFPinPath string
+	// IRQAttribution is the policy the time spent handling the interrupts is attributed with, see IRQAttributionTask
+	IRQAttribution string
+	// CPUStateMetrics counts APERF and MPERF with the hardware counters and reads the residency of the CPU idle states
+	CPUStateMetrics bool
 }
 type MetricsConfig struct {
 	CoreUsageMetric    string
@@ -73,6 +91,8 @@ type MetricsConfig struct {
 	UncoreUsageMetric  string
 	GPUUsageMetric     string
 	GeneralUsageMetric string
+	// OtherUsageMetric is the resource usage the energy of the other components, e.g. the NICs, is split by
+	OtherUsageMetric string
 }
 
 type RedfishConfig struct {
@@ -91,6 +111,8 @@ type ModelConfig struct {
 	ContainerComponentsPowerKey string
 	ProcessPlatformPowerKey     string
 	ProcessComponentsPowerKey   string
+	// RefreshIntervalSec is the interval the regressor model weights are fetched again, 0 disables the refresh
+	RefreshIntervalSec int
 }
 
 type LibvirtConfig struct {
@@ -98,6 +120,46 @@ type LibvirtConfig struct {
 	MetadataToken string
 }
 
+// OTLPConfig configures the OpenTelemetry OTLP metrics push exporter, it is disabled when Endpoint is empty.
+type OTLPConfig struct {
+	Endpoint          string
+	Protocol          string
+	Headers           map[string]string
+	ExportIntervalSec int
+	Insecure          bool
+	CAFile            string
+	CertFile          string
+	KeyFile           string
+}
+
+// RemoteWriteConfig configures the Prometheus remote-write push mode, it is disabled when URL is empty.
+type RemoteWriteConfig struct {
+	URL            string
+	Headers        map[string]string
+	ExternalLabels map[string]string
+	IntervalSec    int
+	TimeoutSec     int
+	WALDir         string
+	WALMaxSizeMB   int
+}
+
+// CheckpointConfig configures the periodic snapshot of the aggregated energy counters, which are
+// restored on startup so that the counters do not reset when the exporter restarts.
+type CheckpointConfig struct {
+	Enabled     bool
+	File        string
+	IntervalSec int
+}
+
+// OnlineTrainingConfig configures the training of the node power models from the power measured on the node.
+// The models are fitted every IntervalSec once MinSamples collections were sampled, and saved to Dir.
+type OnlineTrainingConfig struct {
+	Enabled     bool
+	Dir         string
+	MinSamples  int
+	IntervalSec int
+}
+
 type Config struct {
 	ModelServerService     string
 	KernelVersion          float32
@@ -107,6 +169,10 @@ type Config struct {
 	Metrics                MetricsConfig
 	Redfish                RedfishConfig
 	Libvirt                LibvirtConfig
+	OTLP                   OTLPConfig
+	RemoteWrite            RemoteWriteConfig
+	Checkpoint             CheckpointConfig
+	OnlineTraining         OnlineTrainingConfig
 	DCGMHostEngineEndpoint string
 }
 
@@ -132,7 +198,17 @@ func newConfig() (*Config, error) {
 		return nil, fmt.Errorf("config-dir %s is not a directory", BaseDir)
 	}
 
-	return &Config{
+	values, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	// the getters read the values of the new document, the values of the running configuration are restored if it
+	// is rejected so that the reported provenance keeps matching the running configuration
+	previousValues := fileValues
+	fileValues = values
+
+	parseErrors = nil
+	c := &Config{
 		ModelServerService:     fmt.Sprintf("kepler-model-server.%s.svc.cluster.local", getConfig("KEPLER_NAMESPACE", defaultNamespace)),
 		Kepler:                 getKeplerConfig(),
 		SamplePeriodSec:        uint64(getIntConfig("SAMPLE_PERIOD_SEC", defaultSamplePeriodSec)),
@@ -140,9 +216,100 @@ func newConfig() (*Config, error) {
 		Metrics:                getMetricsConfig(),
 		Redfish:                getRedfishConfig(),
 		Libvirt:                getLibvirtConfig(),
+		OTLP:                   getOTLPConfig(),
+		RemoteWrite:            getRemoteWriteConfig(),
+		Checkpoint:             getCheckpointConfig(),
+		OnlineTraining:         getOnlineTrainingConfig(),
 		DCGMHostEngineEndpoint: getConfig("NVIDIA_HOSTENGINE_ENDPOINT", defaultDCGMHostEngineEndpoint),
 		KernelVersion:          float32(0),
-	}, nil
+	}
+	if errs := append(parseErrors, c.validate()...); len(errs) > 0 {
+		fileValues = previousValues
+		return nil, errs
+	}
+	return c, nil
+}
+
+// validate checks the semantic constraints of the loaded configuration
+// regardless of which source each value came from.
+func (c *Config) validate() ValidationErrors {
+	var errs ValidationErrors
+	if c.SamplePeriodSec == 0 {
+		errs = append(errs, newValidationError("SAMPLE_PERIOD_SEC", "must be greater than 0"))
+	}
+	if c.Kepler.MaxLookupRetry < 0 {
+		errs = append(errs, newValidationError("MAX_LOOKUP_RETRY", "must not be negative"))
+	}
+	if c.Kepler.BPFSampleRate < 0 {
+		errs = append(errs, newValidationError("EXPERIMENTAL_BPF_SAMPLE_RATE", "must not be negative"))
+	}
+	if c.Kepler.BPFMapSize <= 0 {
+		errs = append(errs, newValidationError("BPF_MAP_SIZE", "must be greater than 0"))
+	}
+	if c.Kepler.BPFPinPath != "" && !filepath.IsAbs(c.Kepler.BPFPinPath) {
+		errs = append(errs, newValidationError("BPF_PIN_PATH", "must be an absolute path"))
+	}
+	switch c.Kepler.IRQAttribution {
+	case IRQAttributionTask, IRQAttributionKernel, IRQAttributionOwner:
+	default:
+		errs = append(errs, newValidationError("IRQ_ATTRIBUTION",
+			fmt.Sprintf("must be %q, %q or %q", IRQAttributionTask, IRQAttributionKernel, IRQAttributionOwner)))
+	}
+	if c.Model.RefreshIntervalSec < 0 {
+		errs = append(errs, newValidationError("MODEL_REFRESH_INTERVAL_SEC", "must not be negative"))
+	}
+	if interval, err := strconv.Atoi(c.Redfish.ProbeIntervalInSeconds); err != nil || interval <= 0 {
+		errs = append(errs, newValidationError("REDFISH_PROBE_INTERVAL_IN_SECONDS", "must be a positive integer"))
+	}
+	if c.OTLP.Protocol != OTLPProtocolGRPC && c.OTLP.Protocol != OTLPProtocolHTTP {
+		errs = append(errs, newValidationError("OTLP_PROTOCOL", fmt.Sprintf("must be %q or %q", OTLPProtocolGRPC, OTLPProtocolHTTP)))
+	}
+	if c.OTLP.ExportIntervalSec <= 0 {
+		errs = append(errs, newValidationError("OTLP_EXPORT_INTERVAL_SEC", "must be greater than 0"))
+	}
+	if (c.OTLP.CertFile == "") != (c.OTLP.KeyFile == "") {
+		errs = append(errs, newValidationError("OTLP_CERT_FILE", "OTLP_CERT_FILE and OTLP_KEY_FILE must be set together"))
+	}
+	if c.RemoteWrite.URL != "" && !strings.HasPrefix(c.RemoteWrite.URL, "http://") && !strings.HasPrefix(c.RemoteWrite.URL, "https://") {
+		errs = append(errs, newValidationError("REMOTE_WRITE_URL", "must be an http or https URL"))
+	}
+	if c.RemoteWrite.IntervalSec <= 0 {
+		errs = append(errs, newValidationError("REMOTE_WRITE_INTERVAL_SEC", "must be greater than 0"))
+	}
+	if c.RemoteWrite.TimeoutSec <= 0 {
+		errs = append(errs, newValidationError("REMOTE_WRITE_TIMEOUT_SEC", "must be greater than 0"))
+	}
+	if c.RemoteWrite.WALMaxSizeMB < 0 {
+		errs = append(errs, newValidationError("REMOTE_WRITE_WAL_MAX_SIZE_MB", "must not be negative"))
+	}
+	if c.Checkpoint.IntervalSec <= 0 {
+		errs = append(errs, newValidationError("CHECKPOINT_INTERVAL_SEC", "must be greater than 0"))
+	}
+	if c.OnlineTraining.MinSamples <= 0 {
+		errs = append(errs, newValidationError("ONLINE_TRAINING_MIN_SAMPLES", "must be greater than 0"))
+	}
+	if c.OnlineTraining.IntervalSec <= 0 {
+		errs = append(errs, newValidationError("ONLINE_TRAINING_INTERVAL_SEC", "must be greater than 0"))
+	}
+	if len(c.Kepler.HWCounters) > MaxHWCounters {
+		errs = append(errs, newValidationError("HW_COUNTERS", fmt.Sprintf("must not list more than %d perf events", MaxHWCounters)))
+	}
+	names := map[string]bool{}
+	for _, event := range c.Kepler.HWCounters {
+		name := HWCounterName(event)
+		if name == "" || names[name] {
+			errs = append(errs, newValidationError("HW_COUNTERS", fmt.Sprintf("perf event %q is empty or duplicated", event)))
+			break
+		}
+		names[name] = true
+	}
+	return errs
+}
+
+// newValidationError reports an invalid value for key, annotated with the source it was read from.
+func newValidationError(key, reason string) *ValidationError {
+	value, source, _ := lookupConfig(key)
+	return &ValidationError{Key: key, Value: value, Source: source, Reason: reason}
 }
 
 // Instance returns the singleton Config instance
@@ -156,12 +323,16 @@ func Initialize(baseDir string) (*Config, error) {
 	once.Do(func() {
 		BaseDir = baseDir
 		instance, err = newConfig()
+		if err == nil {
+			c := *instance
+			loaded = &c
+		}
 	})
 	return instance, err
 }
 
 func getKeplerConfig() KeplerConfig {
-	return KeplerConfig{
+	c := KeplerConfig{
 		KeplerNamespace:              getConfig("KEPLER_NAMESPACE", defaultNamespace),
 		EnabledEBPFCgroupID:          getBoolConfig("ENABLE_EBPF_CGROUPID", true),
 		EnabledGPU:                   getBoolConfig("ENABLE_GPU", false),
@@ -184,7 +355,19 @@ func getKeplerConfig() KeplerConfig {
 		CPUArchOverride:              getConfig("CPU_ARCH_OVERRIDE", defaultCPUArchOverride),
 		ExcludeSwapperProcess:        getBoolConfig("EXCLUDE_SWAPPER_PROCESS", defaultExcludeSwapperProcess),
 		RAPLPath:                     getConfig("RAPL_PATH", "/sys/class/powercap/intel-rapl"),
+		HWCounters:                   ParseHWCounters(getConfig("HW_COUNTERS", defaultHWCounters)),
+		ProcfsFallback:               getBoolConfig("ENABLE_PROCFS_FALLBACK", defaultProcfsFallback),
+		ProcfsCgroupHWCounters:       getBoolConfig("PROCFS_CGROUP_HW_COUNTERS", defaultProcfsCgroupHWCounters),
+		CgroupAggregation:            getBoolConfig("ENABLE_CGROUP_AGGREGATION", defaultCgroupAggregation),
+		BPFMapSize:                   getIntConfig("BPF_MAP_SIZE", DefaultBPFMapSize),
+		BPFPinPath:                   getConfig("BPF_PIN_PATH", defaultBPFPinPath),
+		IRQAttribution:               getConfig("IRQ_ATTRIBUTION", IRQAttributionTask),
+		CPUStateMetrics:              getBoolConfig("ENABLE_CPU_STATE_METRICS", defaultCPUStateMetrics),
 	}
+	if c.CPUStateMetrics {
+		c.HWCounters = withCPUStateCounters(c.HWCounters)
+	}
+	return c
 }
 
 func getMetricsConfig() MetricsConfig {
@@ -194,6 +377,7 @@ func getMetricsConfig() MetricsConfig {
 		UncoreUsageMetric:  getConfig("UNCORE_USAGE_METRIC", defaultMetricValue),
 		GPUUsageMetric:     getConfig("GPU_USAGE_METRIC", GPUComputeUtilization),
 		GeneralUsageMetric: getConfig("GENERAL_USAGE_METRIC", defaultMetricValue),
+		OtherUsageMetric:   getConfig("OTHER_USAGE_METRIC", defaultMetricValue),
 	}
 }
 
@@ -216,6 +400,7 @@ func getModelConfig() ModelConfig {
 		ContainerComponentsPowerKey: getConfig("CONTAINER_COMPONENTS_POWER_KEY", defaultContainerComponentsPowerKey),
 		ProcessPlatformPowerKey:     getConfig("PROCESS_TOTAL_POWER_KEY", defaultProcessPlatformPowerKey),
 		ProcessComponentsPowerKey:   getConfig("PROCESS_COMPONENTS_POWER_KEY", defaultProcessComponentsPowerKey),
+		RefreshIntervalSec:          getIntConfig("MODEL_REFRESH_INTERVAL_SEC", 0),
 	}
 }
 
@@ -226,39 +411,127 @@ func getLibvirtConfig() LibvirtConfig {
 	}
 }
 
+func getOTLPConfig() OTLPConfig {
+	return OTLPConfig{
+		Endpoint:          getConfig("OTLP_ENDPOINT", ""),
+		Protocol:          getConfig("OTLP_PROTOCOL", OTLPProtocolGRPC),
+		Headers:           getMapConfig("OTLP_HEADERS"),
+		ExportIntervalSec: getIntConfig("OTLP_EXPORT_INTERVAL_SEC", defaultOTLPExportIntervalSec),
+		Insecure:          getBoolConfig("OTLP_INSECURE", false),
+		CAFile:            getConfig("OTLP_CA_FILE", ""),
+		CertFile:          getConfig("OTLP_CERT_FILE", ""),
+		KeyFile:           getConfig("OTLP_KEY_FILE", ""),
+	}
+}
+
+func getCheckpointConfig() CheckpointConfig {
+	return CheckpointConfig{
+		Enabled:     getBoolConfig("ENABLE_CHECKPOINT", false),
+		File:        getConfig("CHECKPOINT_FILE", defaultCheckpointFile),
+		IntervalSec: getIntConfig("CHECKPOINT_INTERVAL_SEC", defaultCheckpointIntervalSec),
+	}
+}
+
+func getOnlineTrainingConfig() OnlineTrainingConfig {
+	return OnlineTrainingConfig{
+		Enabled:     getBoolConfig("ENABLE_ONLINE_TRAINING", false),
+		Dir:         getConfig("ONLINE_TRAINING_DIR", defaultOnlineTrainingDir),
+		MinSamples:  getIntConfig("ONLINE_TRAINING_MIN_SAMPLES", defaultOnlineTrainingMinSamples),
+		IntervalSec: getIntConfig("ONLINE_TRAINING_INTERVAL_SEC", defaultOnlineTrainingIntervalSec),
+	}
+}
+
+func getRemoteWriteConfig() RemoteWriteConfig {
+	return RemoteWriteConfig{
+		URL:            getConfig("REMOTE_WRITE_URL", ""),
+		Headers:        getMapConfig("REMOTE_WRITE_HEADERS"),
+		ExternalLabels: getMapConfig("REMOTE_WRITE_EXTERNAL_LABELS"),
+		IntervalSec:    getIntConfig("REMOTE_WRITE_INTERVAL_SEC", defaultRemoteWriteIntervalSec),
+		TimeoutSec:     getIntConfig("REMOTE_WRITE_TIMEOUT_SEC", defaultRemoteWriteTimeoutSec),
+		WALDir:         getConfig("REMOTE_WRITE_WAL_DIR", defaultRemoteWriteWALDir),
+		WALMaxSizeMB:   getIntConfig("REMOTE_WRITE_WAL_MAX_SIZE_MB", defaultRemoteWriteWALMaxSizeMB),
+	}
+}
+
 // Helper functions
 func getBoolConfig(configKey string, defaultBool bool) bool {
-	defaultValue := "false"
-	if defaultBool {
-		defaultValue = "true"
+	value, source, ok := lookupConfig(configKey)
+	if !ok {
+		return defaultBool
 	}
-	return strings.ToLower(getConfig(configKey, defaultValue)) == "true"
+	b, err := strconv.ParseBool(strings.ToLower(value))
+	if err != nil {
+		parseErrors = append(parseErrors, &ValidationError{Key: configKey, Value: value, Source: source, Reason: "expected a boolean"})
+		return defaultBool
+	}
+	return b
 }
 
 func getIntConfig(configKey string, defaultInt int) int {
-	defaultValue := strconv.Itoa(defaultInt)
-	value, err := strconv.Atoi(getConfig(configKey, defaultValue))
-	if err == nil {
-		return value
+	value, source, ok := lookupConfig(configKey)
+	if !ok {
+		return defaultInt
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		parseErrors = append(parseErrors, &ValidationError{Key: configKey, Value: value, Source: source, Reason: "expected an integer"})
+		return defaultInt
 	}
-	return defaultInt
+	return i
 }
 
-// getConfig returns the value of the key by first looking in the environment
-// and then in the config file if it exists or else returns the default value.
+// getMapConfig parses a comma separated list of key=value pairs.
+func getMapConfig(configKey string) map[string]string {
+	m := map[string]string{}
+	value, source, ok := lookupConfig(configKey)
+	if !ok || strings.TrimSpace(value) == "" {
+		return m
+	}
+	for _, pair := range strings.Split(value, ",") {
+		k, v, found := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !found || k == "" {
+			parseErrors = append(parseErrors, &ValidationError{Key: configKey, Value: value, Source: source, Reason: "expected a comma separated list of key=value pairs"})
+			return map[string]string{}
+		}
+		m[k] = strings.TrimSpace(v)
+	}
+	return m
+}
+
+// getConfig returns the value of the key from the first source that defines it,
+// or else returns the default value.
 func getConfig(key, defaultValue string) string {
-	// env var takes precedence over config file
+	if value, _, ok := lookupConfig(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// lookupConfig resolves the key with the precedence environment > YAML config
+// file > legacy per-key file and reports which source the value came from.
+// Command line flags are applied on top of this by the caller.
+func lookupConfig(key string) (string, Source, bool) {
 	if envValue, exists := os.LookupEnv(key); exists {
-		return envValue
+		return envValue, SourceEnv, true
+	}
+
+	if value, exists := fileValues[key]; exists {
+		return value, SourceConfigFile, true
 	}
 
-	// return config file value if there is one
 	configFile := filepath.Join(BaseDir, key)
 	if value, err := os.ReadFile(configFile); err == nil {
-		return strings.TrimSpace(bytes.NewBuffer(value).String())
+		return strings.TrimSpace(bytes.NewBuffer(value).String()), SourceLegacyFile, true
 	}
 
-	return defaultValue
+	return "", SourceDefault, false
+}
+
+// IsSet returns true if the key is defined by the environment or a config file.
+func IsSet(key string) bool {
+	_, _, ok := lookupConfig(key)
+	return ok
 }
 
 func setModelServerReqEndpoint() string {
@@ -289,6 +562,14 @@ func logBoolConfigs() {
 		klog.V(5).Infof("EXPOSE_ESTIMATED_IDLE_POWER_METRICS: %t. This only impacts when the power is estimated using pre-prained models. Estimated idle power is meaningful only when Kepler is running on bare-metal or with a single virtual machine (VM) on the node.", instance.Kepler.ExposeIdlePowerMetrics)
 		klog.V(5).Infof("EXPERIMENTAL_BPF_SAMPLE_RATE: %d", instance.Kepler.BPFSampleRate)
 		klog.V(5).Infof("EXCLUDE_SWAPPER_PROCESS: %t", instance.Kepler.ExcludeSwapperProcess)
+		klog.V(5).Infof("HW_COUNTERS: %v", instance.Kepler.HWCounters)
+		klog.V(5).Infof("ENABLE_PROCFS_FALLBACK: %t", instance.Kepler.ProcfsFallback)
+		klog.V(5).Infof("PROCFS_CGROUP_HW_COUNTERS: %t", instance.Kepler.ProcfsCgroupHWCounters)
+		klog.V(5).Infof("ENABLE_CGROUP_AGGREGATION: %t", instance.Kepler.CgroupAggregation)
+		klog.V(5).Infof("BPF_MAP_SIZE: %d", instance.Kepler.BPFMapSize)
+		klog.V(5).Infof("BPF_PIN_PATH: %s", instance.Kepler.BPFPinPath)
+		klog.V(5).Infof("IRQ_ATTRIBUTION: %s", instance.Kepler.IRQAttribution)
+		klog.V(5).Infof("ENABLE_CPU_STATE_METRICS: %t", instance.Kepler.CPUStateMetrics)
 	}
 }
 
@@ -365,6 +646,11 @@ func SetKubeConfig(k string) {
 	instance.Kepler.KubeConfig = k
 }
 
+// SetBPFPinPath sets the bpffs directory the eBPF programs and maps are pinned in, empty disables pinning
+func SetBPFPinPath(path string) {
+	instance.Kepler.BPFPinPath = path
+}
+
 // SetEnableAPIServer enables Kepler to watch apiserver
 func SetEnableAPIServer(enabled bool) {
 	instance.Kepler.EnableAPIServer = enabled
@@ -511,6 +797,11 @@ func IsModelServerEnabled() bool {
 	return instance.Model.ModelServerEnable
 }
 
+// ModelRefreshIntervalSec returns the interval the regressor model weights are fetched again, 0 if they are not refreshed
+func ModelRefreshIntervalSec() int {
+	return instance.Model.RefreshIntervalSec
+}
+
 func ModelServerEndpoint() string {
 	return instance.Model.ModelServerEndpoint
 }
@@ -546,6 +837,27 @@ func GetBPFSampleRate() int {
 	return instance.Kepler.BPFSampleRate
 }
 
+// GetBPFMapSize returns the number of entries of the eBPF maps of the processes and cgroups
+func GetBPFMapSize() int {
+	return instance.Kepler.BPFMapSize
+}
+
+// GetIRQAttribution returns the policy the time spent handling the interrupts is attributed with
+func GetIRQAttribution() string {
+	return instance.Kepler.IRQAttribution
+}
+
+// IsCPUStateMetricsEnabled returns true if APERF and MPERF are counted with the hardware counters and the residency of
+// the CPU idle states is read, for the effective frequency and idle state metrics and model features
+func IsCPUStateMetricsEnabled() bool {
+	return instance.Kepler.CPUStateMetrics
+}
+
+// GetBPFPinPath returns the bpffs directory the eBPF programs and maps are pinned in, empty if pinning is disabled
+func GetBPFPinPath() string {
+	return instance.Kepler.BPFPinPath
+}
+
 func GetRedfishCredFilePath() string {
 	return instance.Redfish.CredFilePath
 }
@@ -598,6 +910,15 @@ func GeneralUsageMetric() string {
 	return instance.Metrics.GeneralUsageMetric
 }
 
+// OtherUsageMetric returns the resource usage the energy of the other components is split by,
+// the general usage metric if it is not set
+func OtherUsageMetric() string {
+	if instance.Metrics.OtherUsageMetric == "" {
+		return instance.Metrics.GeneralUsageMetric
+	}
+	return instance.Metrics.OtherUsageMetric
+}
+
 func KubeConfig() string {
 	return instance.Kepler.KubeConfig
 }
@@ -636,12 +957,23 @@ func IsAPIServerEnabled() bool {
 	return instance.Kepler.EnableAPIServer
 }
 
+// BPFHwCounters returns the resource metric names of the configured hardware counters, in the configuration order
 func BPFHwCounters() []string {
-	return []string{CPUCycle, CPUInstruction, CacheMiss, CPURefCycle}
+	names := make([]string, 0, len(instance.Kepler.HWCounters))
+	for _, event := range instance.Kepler.HWCounters {
+		names = append(names, HWCounterName(event))
+	}
+	return names
+}
+
+// HWCounters returns the perf events of the configured hardware counters
+func HWCounters() []string {
+	return instance.Kepler.HWCounters
 }
 
 func BPFSwCounters() []string {
-	return []string{CPUTime, IRQNetTXLabel, IRQNetRXLabel, IRQBlockLabel, PageCacheHit}
+	return []string{CPUTime, IRQNetTXLabel, IRQNetRXLabel, IRQBlockLabel, PageCacheHit, NetTXBytes, NetRXBytes, NetTXPackets, NetRXPackets,
+		BlockReadBytes, BlockWriteBytes, BlockReadOps, BlockWriteOps}
 }
 
 func DCGMHostEngineEndpoint() string {
@@ -651,3 +983,61 @@ func DCGMHostEngineEndpoint() string {
 func ExcludeSwapperProcess() bool {
 	return instance.Kepler.ExcludeSwapperProcess
 }
+
+// IsProcfsFallbackEnabled returns true if the CPU time of the processes is read from procfs when the eBPF
+// programs cannot be loaded.
+func IsProcfsFallbackEnabled() bool {
+	return instance.Kepler.ProcfsFallback
+}
+
+// IsProcfsCgroupHWCountersEnabled returns true if the hardware counters are counted per cgroup when the CPU time
+// of the processes is read from procfs.
+func IsProcfsCgroupHWCountersEnabled() bool {
+	return instance.Kepler.ProcfsCgroupHWCounters
+}
+
+// IsCgroupAggregationEnabled returns true if the eBPF programs aggregate the counters per cgroup, the containers
+// are then accounted from the cgroups and the processes are only tracked if their metrics are exposed.
+func IsCgroupAggregationEnabled() bool {
+	return instance.Kepler.CgroupAggregation
+}
+
+// IsOTLPEnabled returns true if an OTLP endpoint is configured to push the metrics to.
+func IsOTLPEnabled() bool {
+	return instance.OTLP.Endpoint != ""
+}
+
+// GetOTLPConfig returns the OTLP exporter configuration.
+func GetOTLPConfig() OTLPConfig {
+	return instance.OTLP
+}
+
+// IsRemoteWriteEnabled returns true if a remote-write URL is configured to push the metrics to.
+func IsRemoteWriteEnabled() bool {
+	return instance.RemoteWrite.URL != ""
+}
+
+// GetRemoteWriteConfig returns the remote-write push mode configuration.
+func GetRemoteWriteConfig() RemoteWriteConfig {
+	return instance.RemoteWrite
+}
+
+// IsCheckpointEnabled returns true if the aggregated energy counters are persisted across restarts.
+func IsCheckpointEnabled() bool {
+	return instance.Checkpoint.Enabled
+}
+
+// GetCheckpointConfig returns the checkpoint store configuration.
+func GetCheckpointConfig() CheckpointConfig {
+	return instance.Checkpoint
+}
+
+// IsOnlineTrainingEnabled returns true if the node power models are trained from the measured power.
+func IsOnlineTrainingEnabled() bool {
+	return instance.OnlineTraining.Enabled
+}
+
+// GetOnlineTrainingConfig returns the online training configuration.
+func GetOnlineTrainingConfig() OnlineTrainingConfig {
+	return instance.OnlineTraining
+}
@@ -194,3 +194,12 @@ var _ = Describe("Test Configuration", func() {
 		Expect(ExposeHardwareCounterMetrics()).To(BeFalse())
 	})
 })
+
+var _ = DescribeTable("Test HWCounterName", func(event, name string) {
+	Expect(HWCounterName(event)).To(Equal(name))
+},
+	Entry("default counter", "instructions", CPUInstruction),
+	Entry("generic hardware event", "stalled-cycles-backend", "stalled_cycles_backend"),
+	Entry("cache event", "LLC-load-misses", "llc_load_misses"),
+	Entry("PMU event", "uncore_imc/cas_count_read/", "uncore_imc_cas_count_read"),
+)
@@ -0,0 +1,472 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source identifies where a configuration value was taken from.
+type Source string
+
+const (
+	SourceDefault    Source = "default"
+	SourceLegacyFile Source = "legacy-file"
+	SourceConfigFile Source = "config-file"
+	SourceEnv        Source = "environment"
+	SourceFlag       Source = "flag"
+)
+
+var (
+	// ConfigFile is the path of the YAML configuration document. When empty,
+	// <BaseDir>/kepler.yaml is used if it exists.
+	ConfigFile string
+
+	// fileValues holds the values of the YAML configuration document keyed by
+	// their legacy per-key names, so that getConfig can apply the precedence order.
+	fileValues map[string]string
+
+	yamlFieldErrRegex = regexp.MustCompile(`^line (\d+): field (\S+) not found in type`)
+	yamlLineErrRegex  = regexp.MustCompile(`^line (\d+): (.*)$`)
+)
+
+// ValidationError describes a single invalid configuration value.
+type ValidationError struct {
+	Key    string
+	Value  string
+	Source Source
+	Line   int
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if e.Source != "" {
+		fmt.Fprintf(&b, "%s: ", e.Source)
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", e.Line)
+	}
+	if e.Key != "" {
+		fmt.Fprintf(&b, "%s: ", e.Key)
+	}
+	if e.Value != "" {
+		fmt.Fprintf(&b, "invalid value %q: ", e.Value)
+	}
+	b.WriteString(e.Reason)
+	return b.String()
+}
+
+// ValidationErrors is the list of all problems found while loading the configuration.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(msgs, "; "))
+}
+
+// FileConfig is the versioned YAML configuration document. Every field is
+// optional and maps onto one of the legacy per-key settings.
+type FileConfig struct {
+	APIVersion             string                   `yaml:"apiVersion"`
+	SamplePeriodSec        *int                     `yaml:"samplePeriodSec"`
+	MetricPath             *string                  `yaml:"metricPath"`
+	BindAddress            *string                  `yaml:"bindAddress"`
+	DCGMHostEngineEndpoint *string                  `yaml:"dcgmHostEngineEndpoint"`
+	Kepler                 KeplerFileConfig         `yaml:"kepler"`
+	Metrics                MetricsFileConfig        `yaml:"metrics"`
+	Redfish                RedfishFileConfig        `yaml:"redfish"`
+	Model                  ModelFileConfig          `yaml:"model"`
+	Libvirt                LibvirtFileConfig        `yaml:"libvirt"`
+	OTLP                   OTLPFileConfig           `yaml:"otlp"`
+	RemoteWrite            RemoteWriteFileConfig    `yaml:"remoteWrite"`
+	Checkpoint             CheckpointFileConfig     `yaml:"checkpoint"`
+	OnlineTraining         OnlineTrainingFileConfig `yaml:"onlineTraining"`
+}
+
+type KeplerFileConfig struct {
+	Namespace                    *string  `yaml:"namespace"`
+	EnableEBPFCgroupID           *bool    `yaml:"enableEBPFCgroupID"`
+	EnableGPU                    *bool    `yaml:"enableGPU"`
+	EnableMSR                    *bool    `yaml:"enableMSR"`
+	EnableProcessMetrics         *bool    `yaml:"enableProcessMetrics"`
+	EnableAPIServer              *bool    `yaml:"enableAPIServer"`
+	ExposeContainerMetrics       *bool    `yaml:"exposeContainerMetrics"`
+	ExposeVMMetrics              *bool    `yaml:"exposeVMMetrics"`
+	ExposeHardwareCounterMetrics *bool    `yaml:"exposeHardwareCounterMetrics"`
+	ExposeIRQCounterMetrics      *bool    `yaml:"exposeIRQCounterMetrics"`
+	ExposeBPFMetrics             *bool    `yaml:"exposeBPFMetrics"`
+	ExposeComponentPower         *bool    `yaml:"exposeComponentPower"`
+	ExposeEstimatedIdlePower     *bool    `yaml:"exposeEstimatedIdlePowerMetrics"`
+	MockACPIPowerPath            *string  `yaml:"mockACPIPowerPath"`
+	MaxLookupRetry               *int     `yaml:"maxLookupRetry"`
+	KubeConfig                   *string  `yaml:"kubeConfig"`
+	BPFSampleRate                *int     `yaml:"bpfSampleRate"`
+	EstimatorModel               *string  `yaml:"estimatorModel"`
+	EstimatorSelectFilter        *string  `yaml:"estimatorSelectFilter"`
+	CPUArchOverride              *string  `yaml:"cpuArchOverride"`
+	ExcludeSwapperProcess        *bool    `yaml:"excludeSwapperProcess"`
+	RAPLPath                     *string  `yaml:"raplPath"`
+	HWCounters                   []string `yaml:"hwCounters"`
+	ProcfsFallback               *bool    `yaml:"procfsFallback"`
+	ProcfsCgroupHWCounters       *bool    `yaml:"procfsCgroupHWCounters"`
+	CgroupAggregation            *bool    `yaml:"cgroupAggregation"`
+	BPFMapSize                   *int     `yaml:"bpfMapSize"`
+	BPFPinPath                   *string  `yaml:"bpfPinPath"`
+	IRQAttribution               *string  `yaml:"irqAttribution"`
+	CPUStateMetrics              *bool    `yaml:"cpuStateMetrics"`
+}
+
+type MetricsFileConfig struct {
+	CoreUsageMetric    *string `yaml:"coreUsageMetric"`
+	DRAMUsageMetric    *string `yaml:"dramUsageMetric"`
+	UncoreUsageMetric  *string `yaml:"uncoreUsageMetric"`
+	GPUUsageMetric     *string `yaml:"gpuUsageMetric"`
+	GeneralUsageMetric *string `yaml:"generalUsageMetric"`
+	OtherUsageMetric   *string `yaml:"otherUsageMetric"`
+}
+
+type RedfishFileConfig struct {
+	CredFilePath           *string `yaml:"credFilePath"`
+	ProbeIntervalInSeconds *int    `yaml:"probeIntervalInSeconds"`
+	SkipSSLVerify          *bool   `yaml:"skipSSLVerify"`
+}
+
+type ModelFileConfig struct {
+	ModelServerEnable           *bool             `yaml:"modelServerEnable"`
+	ModelServerURL              *string           `yaml:"modelServerURL"`
+	ModelServerPort             *string           `yaml:"modelServerPort"`
+	ModelServerRequestPath      *string           `yaml:"modelServerRequestPath"`
+	ModelConfig                 map[string]string `yaml:"modelConfig"`
+	NodePlatformPowerKey        *string           `yaml:"nodeTotalPowerKey"`
+	NodeComponentsPowerKey      *string           `yaml:"nodeComponentsPowerKey"`
+	ContainerPlatformPowerKey   *string           `yaml:"containerTotalPowerKey"`
+	ContainerComponentsPowerKey *string           `yaml:"containerComponentsPowerKey"`
+	ProcessPlatformPowerKey     *string           `yaml:"processTotalPowerKey"`
+	ProcessComponentsPowerKey   *string           `yaml:"processComponentsPowerKey"`
+	RefreshIntervalSec          *int              `yaml:"refreshIntervalSec"`
+}
+
+type LibvirtFileConfig struct {
+	MetadataURI   *string `yaml:"metadataURI"`
+	MetadataToken *string `yaml:"metadataToken"`
+}
+
+type OTLPFileConfig struct {
+	Endpoint          *string           `yaml:"endpoint"`
+	Protocol          *string           `yaml:"protocol"`
+	Headers           map[string]string `yaml:"headers"`
+	ExportIntervalSec *int              `yaml:"exportIntervalSec"`
+	Insecure          *bool             `yaml:"insecure"`
+	CAFile            *string           `yaml:"caFile"`
+	CertFile          *string           `yaml:"certFile"`
+	KeyFile           *string           `yaml:"keyFile"`
+}
+
+type RemoteWriteFileConfig struct {
+	URL            *string           `yaml:"url"`
+	Headers        map[string]string `yaml:"headers"`
+	ExternalLabels map[string]string `yaml:"externalLabels"`
+	IntervalSec    *int              `yaml:"intervalSec"`
+	TimeoutSec     *int              `yaml:"timeoutSec"`
+	WALDir         *string           `yaml:"walDir"`
+	WALMaxSizeMB   *int              `yaml:"walMaxSizeMB"`
+}
+
+type CheckpointFileConfig struct {
+	Enabled     *bool   `yaml:"enabled"`
+	File        *string `yaml:"file"`
+	IntervalSec *int    `yaml:"intervalSec"`
+}
+
+type OnlineTrainingFileConfig struct {
+	Enabled     *bool   `yaml:"enabled"`
+	Dir         *string `yaml:"dir"`
+	MinSamples  *int    `yaml:"minSamples"`
+	IntervalSec *int    `yaml:"intervalSec"`
+}
+
+// parseFileConfig strictly decodes a YAML configuration document. Unknown keys,
+// type mismatches and unsupported versions are reported as ValidationErrors.
+func parseFileConfig(r io.Reader) (*FileConfig, error) {
+	var fc FileConfig
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fc); err != nil {
+		if errors.Is(err, io.EOF) {
+			// an empty document is valid and sets nothing
+			return &fc, nil
+		}
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			errs := make(ValidationErrors, 0, len(typeErr.Errors))
+			for _, msg := range typeErr.Errors {
+				errs = append(errs, yamlValidationError(msg))
+			}
+			return nil, errs
+		}
+		return nil, ValidationErrors{yamlValidationError(err.Error())}
+	}
+	if errs := fc.validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return &fc, nil
+}
+
+func yamlValidationError(msg string) *ValidationError {
+	msg = strings.TrimPrefix(msg, "yaml: ")
+	verr := &ValidationError{Source: SourceConfigFile, Reason: msg}
+	if m := yamlFieldErrRegex.FindStringSubmatch(msg); m != nil {
+		verr.Line, _ = strconv.Atoi(m[1])
+		verr.Key = m[2]
+		verr.Reason = "unknown field"
+	} else if m := yamlLineErrRegex.FindStringSubmatch(msg); m != nil {
+		verr.Line, _ = strconv.Atoi(m[1])
+		verr.Reason = m[2]
+	}
+	return verr
+}
+
+func (fc *FileConfig) validate() ValidationErrors {
+	var errs ValidationErrors
+	if fc.APIVersion != FileConfigAPIVersion {
+		errs = append(errs, &ValidationError{
+			Key:    "apiVersion",
+			Value:  fc.APIVersion,
+			Source: SourceConfigFile,
+			Reason: fmt.Sprintf("unsupported version, expected %q", FileConfigAPIVersion),
+		})
+	}
+	for prefix, m := range map[string]map[string]string{
+		"otlp.headers.":               fc.OTLP.Headers,
+		"remoteWrite.headers.":        fc.RemoteWrite.Headers,
+		"remoteWrite.externalLabels.": fc.RemoteWrite.ExternalLabels,
+	} {
+		for k, v := range m {
+			if strings.ContainsAny(k, "=,") || strings.Contains(v, ",") {
+				errs = append(errs, &ValidationError{
+					Key:    prefix + k,
+					Source: SourceConfigFile,
+					Reason: "names must not contain '=' or ',' and values must not contain ','",
+				})
+			}
+		}
+	}
+	for k, v := range fc.Model.ModelConfig {
+		if strings.ContainsAny(k, "= \t\n") || strings.ContainsAny(v, "= \t\n") {
+			errs = append(errs, &ValidationError{
+				Key:    "model.modelConfig." + k,
+				Value:  v,
+				Source: SourceConfigFile,
+				Reason: "keys and values must not contain '=' or whitespace",
+			})
+		}
+	}
+	return errs
+}
+
+// values flattens the document into the legacy per-key names.
+func (fc *FileConfig) values() map[string]string {
+	v := make(map[string]string)
+	setInt(v, "SAMPLE_PERIOD_SEC", fc.SamplePeriodSec)
+	setString(v, metricPathKey, fc.MetricPath)
+	setString(v, bindAddressKey, fc.BindAddress)
+	setString(v, "NVIDIA_HOSTENGINE_ENDPOINT", fc.DCGMHostEngineEndpoint)
+
+	k := &fc.Kepler
+	setString(v, "KEPLER_NAMESPACE", k.Namespace)
+	setBool(v, "ENABLE_EBPF_CGROUPID", k.EnableEBPFCgroupID)
+	setBool(v, "ENABLE_GPU", k.EnableGPU)
+	setBool(v, "ENABLE_MSR", k.EnableMSR)
+	setBool(v, "ENABLE_PROCESS_METRICS", k.EnableProcessMetrics)
+	setBool(v, "ENABLE_API_SERVER", k.EnableAPIServer)
+	setBool(v, "EXPOSE_CONTAINER_METRICS", k.ExposeContainerMetrics)
+	setBool(v, "EXPOSE_VM_METRICS", k.ExposeVMMetrics)
+	setBool(v, "EXPOSE_HW_COUNTER_METRICS", k.ExposeHardwareCounterMetrics)
+	setBool(v, "EXPOSE_IRQ_COUNTER_METRICS", k.ExposeIRQCounterMetrics)
+	setBool(v, "EXPOSE_BPF_METRICS", k.ExposeBPFMetrics)
+	setBool(v, "EXPOSE_COMPONENT_POWER", k.ExposeComponentPower)
+	setBool(v, "EXPOSE_ESTIMATED_IDLE_POWER_METRICS", k.ExposeEstimatedIdlePower)
+	setString(v, "MOCK_ACPI_POWER_PATH", k.MockACPIPowerPath)
+	setInt(v, "MAX_LOOKUP_RETRY", k.MaxLookupRetry)
+	setString(v, "KUBE_CONFIG", k.KubeConfig)
+	setInt(v, "EXPERIMENTAL_BPF_SAMPLE_RATE", k.BPFSampleRate)
+	setString(v, "ESTIMATOR_MODEL", k.EstimatorModel)
+	setString(v, "ESTIMATOR_SELECT_FILTER", k.EstimatorSelectFilter)
+	setString(v, "CPU_ARCH_OVERRIDE", k.CPUArchOverride)
+	setBool(v, "EXCLUDE_SWAPPER_PROCESS", k.ExcludeSwapperProcess)
+	setString(v, "RAPL_PATH", k.RAPLPath)
+	setList(v, "HW_COUNTERS", k.HWCounters)
+	setBool(v, "ENABLE_PROCFS_FALLBACK", k.ProcfsFallback)
+	setBool(v, "PROCFS_CGROUP_HW_COUNTERS", k.ProcfsCgroupHWCounters)
+	setBool(v, "ENABLE_CGROUP_AGGREGATION", k.CgroupAggregation)
+	setInt(v, "BPF_MAP_SIZE", k.BPFMapSize)
+	setString(v, "BPF_PIN_PATH", k.BPFPinPath)
+	setString(v, "IRQ_ATTRIBUTION", k.IRQAttribution)
+	setBool(v, "ENABLE_CPU_STATE_METRICS", k.CPUStateMetrics)
+
+	m := &fc.Metrics
+	setString(v, "CORE_USAGE_METRIC", m.CoreUsageMetric)
+	setString(v, "DRAM_USAGE_METRIC", m.DRAMUsageMetric)
+	setString(v, "UNCORE_USAGE_METRIC", m.UncoreUsageMetric)
+	setString(v, "GPU_USAGE_METRIC", m.GPUUsageMetric)
+	setString(v, "GENERAL_USAGE_METRIC", m.GeneralUsageMetric)
+	setString(v, "OTHER_USAGE_METRIC", m.OtherUsageMetric)
+
+	r := &fc.Redfish
+	setString(v, "REDFISH_CRED_FILE_PATH", r.CredFilePath)
+	setInt(v, "REDFISH_PROBE_INTERVAL_IN_SECONDS", r.ProbeIntervalInSeconds)
+	setBool(v, "REDFISH_SKIP_SSL_VERIFY", r.SkipSSLVerify)
+
+	md := &fc.Model
+	setBool(v, "MODEL_SERVER_ENABLE", md.ModelServerEnable)
+	setString(v, "MODEL_SERVER_URL", md.ModelServerURL)
+	setString(v, "MODEL_SERVER_PORT", md.ModelServerPort)
+	setString(v, "MODEL_SERVER_MODEL_REQ_PATH", md.ModelServerRequestPath)
+	setString(v, "NODE_TOTAL_POWER_KEY", md.NodePlatformPowerKey)
+	setString(v, "NODE_COMPONENTS_POWER_KEY", md.NodeComponentsPowerKey)
+	setString(v, "CONTAINER_TOTAL_POWER_KEY", md.ContainerPlatformPowerKey)
+	setString(v, "CONTAINER_COMPONENTS_POWER_KEY", md.ContainerComponentsPowerKey)
+	setString(v, "PROCESS_TOTAL_POWER_KEY", md.ProcessPlatformPowerKey)
+	setString(v, "PROCESS_COMPONENTS_POWER_KEY", md.ProcessComponentsPowerKey)
+	setInt(v, "MODEL_REFRESH_INTERVAL_SEC", md.RefreshIntervalSec)
+	if md.ModelConfig != nil {
+		keys := make([]string, 0, len(md.ModelConfig))
+		for key := range md.ModelConfig {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		lines := make([]string, 0, len(keys))
+		for _, key := range keys {
+			lines = append(lines, key+"="+md.ModelConfig[key])
+		}
+		v["MODEL_CONFIG"] = strings.Join(lines, "\n")
+	}
+
+	setString(v, "LIBVIRT_METADATA_URI", fc.Libvirt.MetadataURI)
+	setString(v, "LIBVIRT_METADATA_TOKEN", fc.Libvirt.MetadataToken)
+
+	o := &fc.OTLP
+	setString(v, "OTLP_ENDPOINT", o.Endpoint)
+	setString(v, "OTLP_PROTOCOL", o.Protocol)
+	setMap(v, "OTLP_HEADERS", o.Headers)
+	setInt(v, "OTLP_EXPORT_INTERVAL_SEC", o.ExportIntervalSec)
+	setBool(v, "OTLP_INSECURE", o.Insecure)
+	setString(v, "OTLP_CA_FILE", o.CAFile)
+	setString(v, "OTLP_CERT_FILE", o.CertFile)
+	setString(v, "OTLP_KEY_FILE", o.KeyFile)
+
+	rw := &fc.RemoteWrite
+	setString(v, "REMOTE_WRITE_URL", rw.URL)
+	setMap(v, "REMOTE_WRITE_HEADERS", rw.Headers)
+	setMap(v, "REMOTE_WRITE_EXTERNAL_LABELS", rw.ExternalLabels)
+	setInt(v, "REMOTE_WRITE_INTERVAL_SEC", rw.IntervalSec)
+	setInt(v, "REMOTE_WRITE_TIMEOUT_SEC", rw.TimeoutSec)
+	setString(v, "REMOTE_WRITE_WAL_DIR", rw.WALDir)
+	setInt(v, "REMOTE_WRITE_WAL_MAX_SIZE_MB", rw.WALMaxSizeMB)
+
+	cp := &fc.Checkpoint
+	setBool(v, "ENABLE_CHECKPOINT", cp.Enabled)
+	setString(v, "CHECKPOINT_FILE", cp.File)
+	setInt(v, "CHECKPOINT_INTERVAL_SEC", cp.IntervalSec)
+
+	ot := &fc.OnlineTraining
+	setBool(v, "ENABLE_ONLINE_TRAINING", ot.Enabled)
+	setString(v, "ONLINE_TRAINING_DIR", ot.Dir)
+	setInt(v, "ONLINE_TRAINING_MIN_SAMPLES", ot.MinSamples)
+	setInt(v, "ONLINE_TRAINING_INTERVAL_SEC", ot.IntervalSec)
+	return v
+}
+
+func setString(v map[string]string, key string, value *string) {
+	if value != nil {
+		v[key] = *value
+	}
+}
+
+func setBool(v map[string]string, key string, value *bool) {
+	if value != nil {
+		v[key] = strconv.FormatBool(*value)
+	}
+}
+
+func setInt(v map[string]string, key string, value *int) {
+	if value != nil {
+		v[key] = strconv.Itoa(*value)
+	}
+}
+
+// loadFileConfig reads the YAML configuration document and returns its values
+// keyed by the legacy per-key names. A missing default document is not an error.
+func loadFileConfig() (map[string]string, error) {
+	path := ConfigFile
+	explicit := path != ""
+	if !explicit {
+		path = filepath.Join(BaseDir, defaultConfigFileName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	fc, err := parseFileConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file %s: %w", path, err)
+	}
+	return fc.values(), nil
+}
+
+// setList joins the list into the comma separated list read by ParseHWCounters.
+func setList(v map[string]string, key string, value []string) {
+	if value == nil {
+		return
+	}
+	v[key] = strings.Join(value, ",")
+}
+
+// setMap joins the map into the comma separated key=value list read by getMapConfig.
+func setMap(v map[string]string, key string, value map[string]string) {
+	if value == nil {
+		return
+	}
+	keys := make([]string, 0, len(value))
+	for k := range value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+value[k])
+	}
+	v[key] = strings.Join(pairs, ",")
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const validConfigFile = `apiVersion: kepler.sustainable-computing.io/v1alpha1
+samplePeriodSec: 5
+kepler:
+  enableGPU: true
+  exposeBPFMetrics: false
+  maxLookupRetry: 10
+redfish:
+  probeIntervalInSeconds: 30
+model:
+  modelConfig:
+    NODE_COMPONENTS_ESTIMATOR: "true"
+    NODE_COMPONENTS_INIT_URL: https://example.com/model.json
+`
+
+var _ = Describe("Test YAML configuration file", func() {
+	var (
+		origBaseDir    string
+		origConfigFile string
+	)
+
+	BeforeEach(func() {
+		origBaseDir = BaseDir
+		origConfigFile = ConfigFile
+		BaseDir = GinkgoT().TempDir()
+		ConfigFile = ""
+	})
+
+	AfterEach(func() {
+		BaseDir = origBaseDir
+		ConfigFile = origConfigFile
+		fileValues = nil
+	})
+
+	writeFile := func(name, content string) {
+		Expect(os.WriteFile(filepath.Join(BaseDir, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	It("maps the document onto the legacy keys", func() {
+		fc, err := parseFileConfig(strings.NewReader(validConfigFile))
+		Expect(err).NotTo(HaveOccurred())
+		values := fc.values()
+		Expect(values).To(HaveKeyWithValue("SAMPLE_PERIOD_SEC", "5"))
+		Expect(values).To(HaveKeyWithValue("ENABLE_GPU", "true"))
+		Expect(values).To(HaveKeyWithValue("EXPOSE_BPF_METRICS", "false"))
+		Expect(values).To(HaveKeyWithValue("MAX_LOOKUP_RETRY", "10"))
+		Expect(values).To(HaveKeyWithValue("REDFISH_PROBE_INTERVAL_IN_SECONDS", "30"))
+		Expect(values).To(HaveKeyWithValue("MODEL_CONFIG",
+			"NODE_COMPONENTS_ESTIMATOR=true\nNODE_COMPONENTS_INIT_URL=https://example.com/model.json"))
+		Expect(values).NotTo(HaveKey("ENABLE_MSR"))
+	})
+
+	It("rejects unknown keys", func() {
+		_, err := parseFileConfig(strings.NewReader(validConfigFile + "  enableGPUs: true\n"))
+		var errs ValidationErrors
+		Expect(errors.As(err, &errs)).To(BeTrue())
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Key).To(Equal("enableGPUs"))
+		Expect(errs[0].Line).To(Equal(13))
+	})
+
+	It("rejects values of the wrong type", func() {
+		_, err := parseFileConfig(strings.NewReader("apiVersion: kepler.sustainable-computing.io/v1alpha1\nkepler:\n  enableGPU: maybe\n"))
+		var errs ValidationErrors
+		Expect(errors.As(err, &errs)).To(BeTrue())
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Line).To(Equal(3))
+	})
+
+	It("rejects unsupported versions", func() {
+		_, err := parseFileConfig(strings.NewReader("apiVersion: v0\n"))
+		var errs ValidationErrors
+		Expect(errors.As(err, &errs)).To(BeTrue())
+		Expect(errs[0].Key).To(Equal("apiVersion"))
+	})
+
+	It("applies env > YAML > legacy file > default precedence", func() {
+		writeFile(defaultConfigFileName, validConfigFile)
+		writeFile("ENABLE_GPU", "false")
+		writeFile("ENABLE_MSR", "true")
+		GinkgoT().Setenv("EXPOSE_BPF_METRICS", "true")
+
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Kepler.EnabledGPU).To(BeTrue())
+		Expect(c.Kepler.EnabledMSR).To(BeTrue())
+		Expect(c.Kepler.ExposeBPFMetrics).To(BeTrue())
+		Expect(c.Kepler.ExposeContainerStats).To(BeTrue())
+		Expect(c.SamplePeriodSec).To(Equal(uint64(5)))
+
+		_, source, _ := lookupConfig("ENABLE_GPU")
+		Expect(source).To(Equal(SourceConfigFile))
+		_, source, _ = lookupConfig("ENABLE_MSR")
+		Expect(source).To(Equal(SourceLegacyFile))
+		_, source, _ = lookupConfig("EXPOSE_BPF_METRICS")
+		Expect(source).To(Equal(SourceEnv))
+	})
+
+	It("fails loudly on malformed legacy values", func() {
+		writeFile("ENABLE_GPU", "yes please")
+		writeFile("SAMPLE_PERIOD_SEC", "0")
+
+		_, err := newConfig()
+		var errs ValidationErrors
+		Expect(errors.As(err, &errs)).To(BeTrue())
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[0].Key).To(Equal("ENABLE_GPU"))
+		Expect(errs[0].Source).To(Equal(SourceLegacyFile))
+		Expect(errs[1].Key).To(Equal("SAMPLE_PERIOD_SEC"))
+	})
+
+	It("reads the OTLP exporter settings", func() {
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+otlp:
+  endpoint: otel-collector:4317
+  headers:
+    x-tenant: edge
+    authorization: Bearer token
+  exportIntervalSec: 15
+`)
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.OTLP.Endpoint).To(Equal("otel-collector:4317"))
+		Expect(c.OTLP.Protocol).To(Equal(OTLPProtocolGRPC))
+		Expect(c.OTLP.ExportIntervalSec).To(Equal(15))
+		Expect(c.OTLP.Headers).To(Equal(map[string]string{"x-tenant": "edge", "authorization": "Bearer token"}))
+
+		writeFile("OTLP_PROTOCOL", "udp")
+		_, err = newConfig()
+		Expect(err).To(MatchError(ContainSubstring("OTLP_PROTOCOL")))
+	})
+
+	It("reads the checkpoint settings", func() {
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Checkpoint.Enabled).To(BeFalse())
+		Expect(c.Checkpoint.File).To(Equal(defaultCheckpointFile))
+		Expect(c.Checkpoint.IntervalSec).To(Equal(defaultCheckpointIntervalSec))
+
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+checkpoint:
+  enabled: true
+  file: /var/lib/kepler/checkpoint.json
+  intervalSec: 0
+`)
+		_, err = newConfig()
+		Expect(err).To(MatchError(ContainSubstring("CHECKPOINT_INTERVAL_SEC")))
+	})
+
+	It("reads the online training settings", func() {
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.OnlineTraining).To(Equal(OnlineTrainingConfig{
+			Dir:         defaultOnlineTrainingDir,
+			MinSamples:  defaultOnlineTrainingMinSamples,
+			IntervalSec: defaultOnlineTrainingIntervalSec,
+		}))
+
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+onlineTraining:
+  enabled: true
+  dir: /var/lib/kepler/models
+  minSamples: 20
+`)
+		c, err = newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.OnlineTraining.Enabled).To(BeTrue())
+		Expect(c.OnlineTraining.Dir).To(Equal("/var/lib/kepler/models"))
+		Expect(c.OnlineTraining.MinSamples).To(Equal(20))
+
+		GinkgoT().Setenv("ONLINE_TRAINING_INTERVAL_SEC", "0")
+		_, err = newConfig()
+		Expect(err).To(MatchError(ContainSubstring("ONLINE_TRAINING_INTERVAL_SEC")))
+	})
+
+	It("reads the model refresh interval", func() {
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Model.RefreshIntervalSec).To(BeZero())
+
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+model:
+  refreshIntervalSec: 600
+`)
+		c, err = newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Model.RefreshIntervalSec).To(Equal(600))
+
+		GinkgoT().Setenv("MODEL_REFRESH_INTERVAL_SEC", "-1")
+		_, err = newConfig()
+		Expect(err).To(MatchError(ContainSubstring("MODEL_REFRESH_INTERVAL_SEC")))
+	})
+
+	It("reads the hardware counters", func() {
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Kepler.HWCounters).To(Equal([]string{"cpu-cycles", "instructions", "cache-misses", "ref-cycles"}))
+
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+kepler:
+  hwCounters:
+    - stalled-cycles-backend
+    - LLC-loads
+    - cpu/event=0xd0,umask=0x81/
+`)
+		c, err = newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Kepler.HWCounters).To(Equal([]string{"stalled-cycles-backend", "LLC-loads", "cpu/event=0xd0,umask=0x81/"}))
+
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+kepler:
+  hwCounters: [cpu-cycles, cycles]
+`)
+		_, err = newConfig()
+		Expect(err).To(MatchError(ContainSubstring("HW_COUNTERS")))
+	})
+
+	It("reads the other usage metric", func() {
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Metrics.OtherUsageMetric).To(BeEmpty())
+
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+metrics:
+  otherUsageMetric: bpf_net_tx_bytes
+`)
+		c, err = newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Metrics.OtherUsageMetric).To(Equal(NetTXBytes))
+	})
+
+	It("reads the IRQ attribution policy", func() {
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Kepler.IRQAttribution).To(Equal(IRQAttributionTask))
+
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+kepler:
+  irqAttribution: owner
+`)
+		c, err = newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Kepler.IRQAttribution).To(Equal(IRQAttributionOwner))
+
+		GinkgoT().Setenv("IRQ_ATTRIBUTION", "victim")
+		_, err = newConfig()
+		Expect(err).To(MatchError(ContainSubstring("IRQ_ATTRIBUTION")))
+	})
+
+	It("counts APERF and MPERF for the CPU state metrics", func() {
+		writeFile(defaultConfigFileName, `apiVersion: kepler.sustainable-computing.io/v1alpha1
+kepler:
+  cpuStateMetrics: true
+  hwCounters: [instructions, msr/mperf/]
+`)
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Kepler.CPUStateMetrics).To(BeTrue())
+		Expect(c.Kepler.HWCounters).To(Equal([]string{"instructions", MPERFEvent, APERFEvent}))
+		Expect(HWCounterName(APERFEvent)).To(Equal(APERF))
+	})
+
+	It("fails when an explicit config file is missing", func() {
+		ConfigFile = filepath.Join(BaseDir, "missing.yaml")
+		_, err := newConfig()
+		Expect(err).To(HaveOccurred())
+	})
+})
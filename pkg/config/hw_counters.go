@@ -0,0 +1,95 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"strings"
+)
+
+// hwCounterNames keeps the resource metric names of the hardware counters collected before they were configurable
+var hwCounterNames = map[string]string{
+	"cpu-cycles":   CPUCycle,
+	"cycles":       CPUCycle,
+	"instructions": CPUInstruction,
+	"cache-misses": CacheMiss,
+	"ref-cycles":   CPURefCycle,
+	APERFEvent:     APERF,
+	MPERFEvent:     MPERF,
+}
+
+// ParseHWCounters splits the comma separated list of perf events. Like in perf, an event is either a generic
+// hardware event (e.g. instructions), a cache event (e.g. LLC-load-misses) or a PMU event from sysfs written
+// pmu/event/ or pmu/term=value,.../, whose commas between the slashes do not separate events. The events of the
+// PMUs that only count on some CPUs, such as the uncore PMUs, cannot be attributed to the processes and are rejected.
+func ParseHWCounters(value string) []string {
+	events := []string{}
+	var event strings.Builder
+	inPMU := false
+	for _, r := range value {
+		switch {
+		case r == '/':
+			inPMU = !inPMU
+		case r == ',' && !inPMU:
+			if e := strings.TrimSpace(event.String()); e != "" {
+				events = append(events, e)
+			}
+			event.Reset()
+			continue
+		}
+		event.WriteRune(r)
+	}
+	if e := strings.TrimSpace(event.String()); e != "" {
+		events = append(events, e)
+	}
+	return events
+}
+
+// withCPUStateCounters adds the APERF and MPERF perf events to the events if they are not configured already
+func withCPUStateCounters(events []string) []string {
+	for _, event := range []string{APERFEvent, MPERFEvent} {
+		found := false
+		for _, e := range events {
+			found = found || HWCounterName(e) == HWCounterName(event)
+		}
+		if !found {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// HWCounterName returns the resource metric name of a perf event, e.g. llc_load_misses for LLC-load-misses
+// or uncore_imc_cas_count_read for uncore_imc/cas_count_read/.
+func HWCounterName(event string) string {
+	if name, found := hwCounterNames[event]; found {
+		return name
+	}
+	var name strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(event) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if underscore && name.Len() > 0 {
+				name.WriteByte('_')
+			}
+			name.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return name.String()
+}
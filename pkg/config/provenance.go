@@ -0,0 +1,148 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+)
+
+// settingFields maps the config keys onto the Config fields holding their effective value.
+var settingFields = []struct {
+	key   string
+	field string
+}{
+	{"KEPLER_NAMESPACE", "Kepler.KeplerNamespace"},
+	{"ENABLE_EBPF_CGROUPID", "Kepler.EnabledEBPFCgroupID"},
+	{"ENABLE_GPU", "Kepler.EnabledGPU"},
+	{"ENABLE_MSR", "Kepler.EnabledMSR"},
+	{"ENABLE_PROCESS_METRICS", "Kepler.EnableProcessStats"},
+	{"EXPOSE_CONTAINER_METRICS", "Kepler.ExposeContainerStats"},
+	{"EXPOSE_VM_METRICS", "Kepler.ExposeVMStats"},
+	{"EXPOSE_HW_COUNTER_METRICS", "Kepler.ExposeHardwareCounterMetrics"},
+	{"EXPOSE_IRQ_COUNTER_METRICS", "Kepler.ExposeIRQCounterMetrics"},
+	{"EXPOSE_BPF_METRICS", "Kepler.ExposeBPFMetrics"},
+	{"EXPOSE_COMPONENT_POWER", "Kepler.ExposeComponentPower"},
+	{"EXPOSE_ESTIMATED_IDLE_POWER_METRICS", "Kepler.ExposeIdlePowerMetrics"},
+	{"ENABLE_API_SERVER", "Kepler.EnableAPIServer"},
+	{"MOCK_ACPI_POWER_PATH", "Kepler.MockACPIPowerPath"},
+	{"MAX_LOOKUP_RETRY", "Kepler.MaxLookupRetry"},
+	{"KUBE_CONFIG", "Kepler.KubeConfig"},
+	{"EXPERIMENTAL_BPF_SAMPLE_RATE", "Kepler.BPFSampleRate"},
+	{"ESTIMATOR_MODEL", "Kepler.EstimatorModel"},
+	{"ESTIMATOR_SELECT_FILTER", "Kepler.EstimatorSelectFilter"},
+	{"CPU_ARCH_OVERRIDE", "Kepler.CPUArchOverride"},
+	{"EXCLUDE_SWAPPER_PROCESS", "Kepler.ExcludeSwapperProcess"},
+	{"RAPL_PATH", "Kepler.RAPLPath"},
+	{"HW_COUNTERS", "Kepler.HWCounters"},
+	{"ENABLE_PROCFS_FALLBACK", "Kepler.ProcfsFallback"},
+	{"PROCFS_CGROUP_HW_COUNTERS", "Kepler.ProcfsCgroupHWCounters"},
+	{"ENABLE_CGROUP_AGGREGATION", "Kepler.CgroupAggregation"},
+	{"BPF_MAP_SIZE", "Kepler.BPFMapSize"},
+	{"BPF_PIN_PATH", "Kepler.BPFPinPath"},
+	{"IRQ_ATTRIBUTION", "Kepler.IRQAttribution"},
+	{"ENABLE_CPU_STATE_METRICS", "Kepler.CPUStateMetrics"},
+	{"SAMPLE_PERIOD_SEC", "SamplePeriodSec"},
+	{"CORE_USAGE_METRIC", "Metrics.CoreUsageMetric"},
+	{"DRAM_USAGE_METRIC", "Metrics.DRAMUsageMetric"},
+	{"UNCORE_USAGE_METRIC", "Metrics.UncoreUsageMetric"},
+	{"GPU_USAGE_METRIC", "Metrics.GPUUsageMetric"},
+	{"GENERAL_USAGE_METRIC", "Metrics.GeneralUsageMetric"},
+	{"OTHER_USAGE_METRIC", "Metrics.OtherUsageMetric"},
+	{"REDFISH_CRED_FILE_PATH", "Redfish.CredFilePath"},
+	{"REDFISH_PROBE_INTERVAL_IN_SECONDS", "Redfish.ProbeIntervalInSeconds"},
+	{"REDFISH_SKIP_SSL_VERIFY", "Redfish.SkipSSLVerify"},
+	{"MODEL_SERVER_ENABLE", "Model.ModelServerEnable"},
+	{"MODEL_SERVER_URL", "Model.ModelServerEndpoint"},
+	{"MODEL_CONFIG", "Model.ModelConfigValues"},
+	{"NODE_TOTAL_POWER_KEY", "Model.NodePlatformPowerKey"},
+	{"NODE_COMPONENTS_POWER_KEY", "Model.NodeComponentsPowerKey"},
+	{"CONTAINER_TOTAL_POWER_KEY", "Model.ContainerPlatformPowerKey"},
+	{"CONTAINER_COMPONENTS_POWER_KEY", "Model.ContainerComponentsPowerKey"},
+	{"PROCESS_TOTAL_POWER_KEY", "Model.ProcessPlatformPowerKey"},
+	{"PROCESS_COMPONENTS_POWER_KEY", "Model.ProcessComponentsPowerKey"},
+	{"MODEL_REFRESH_INTERVAL_SEC", "Model.RefreshIntervalSec"},
+	{"LIBVIRT_METADATA_URI", "Libvirt.MetadataURI"},
+	// LIBVIRT_METADATA_TOKEN is not listed since it is a credential
+	{"NVIDIA_HOSTENGINE_ENDPOINT", "DCGMHostEngineEndpoint"},
+	// OTLP_HEADERS is not listed since headers usually carry credentials
+	{"OTLP_ENDPOINT", "OTLP.Endpoint"},
+	{"OTLP_PROTOCOL", "OTLP.Protocol"},
+	{"OTLP_EXPORT_INTERVAL_SEC", "OTLP.ExportIntervalSec"},
+	{"OTLP_INSECURE", "OTLP.Insecure"},
+	{"OTLP_CA_FILE", "OTLP.CAFile"},
+	{"OTLP_CERT_FILE", "OTLP.CertFile"},
+	{"OTLP_KEY_FILE", "OTLP.KeyFile"},
+	// REMOTE_WRITE_HEADERS is not listed for the same reason
+	{"REMOTE_WRITE_URL", "RemoteWrite.URL"},
+	{"REMOTE_WRITE_EXTERNAL_LABELS", "RemoteWrite.ExternalLabels"},
+	{"REMOTE_WRITE_INTERVAL_SEC", "RemoteWrite.IntervalSec"},
+	{"REMOTE_WRITE_TIMEOUT_SEC", "RemoteWrite.TimeoutSec"},
+	{"REMOTE_WRITE_WAL_DIR", "RemoteWrite.WALDir"},
+	{"REMOTE_WRITE_WAL_MAX_SIZE_MB", "RemoteWrite.WALMaxSizeMB"},
+	{"ENABLE_CHECKPOINT", "Checkpoint.Enabled"},
+	{"CHECKPOINT_FILE", "Checkpoint.File"},
+	{"CHECKPOINT_INTERVAL_SEC", "Checkpoint.IntervalSec"},
+	{"ENABLE_ONLINE_TRAINING", "OnlineTraining.Enabled"},
+	{"ONLINE_TRAINING_DIR", "OnlineTraining.Dir"},
+	{"ONLINE_TRAINING_MIN_SAMPLES", "OnlineTraining.MinSamples"},
+	{"ONLINE_TRAINING_INTERVAL_SEC", "OnlineTraining.IntervalSec"},
+}
+
+// flagKeys holds the keys that were explicitly overridden by command line flags
+var flagKeys = map[string]bool{}
+
+// Setting is the effective value of a config key together with its origin.
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source Source      `json:"source"`
+}
+
+// SetFlagSource records that the value of key was set by a command line flag.
+func SetFlagSource(key string) {
+	flagKeys[key] = true
+}
+
+// EffectiveSettings returns the effective configuration annotated with the origin of each value.
+func EffectiveSettings() []Setting {
+	fields := flattenConfig(reflect.ValueOf(instance).Elem(), "")
+	settings := make([]Setting, 0, len(settingFields))
+	for _, s := range settingFields {
+		source := SourceDefault
+		if flagKeys[s.key] {
+			source = SourceFlag
+		} else if _, src, ok := lookupConfig(s.key); ok {
+			source = src
+		}
+		settings = append(settings, Setting{
+			Key:    s.key,
+			Value:  fields[s.field].Interface(),
+			Source: source,
+		})
+	}
+	return settings
+}
+
+// KernelVersion returns the kernel version detected when the eBPF cgroup id support was configured.
+func KernelVersion() float32 {
+	return instance.KernelVersion
+}
+
+// IsCGroupV2 returns true if the node uses the cgroup v2 unified hierarchy.
+func IsCGroupV2() bool {
+	return isCGroupV2(&realSystem{})
+}
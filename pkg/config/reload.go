@@ -0,0 +1,107 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// reloadableFields lists the Config fields that can be changed while the exporter is running.
+// Every other field is only read at startup and requires a restart to take effect.
+var reloadableFields = map[string]bool{
+	"Kepler.ExposeContainerStats": true,
+	"Kepler.ExposeBPFMetrics":     true,
+	"Kepler.ExposeComponentPower": true,
+	"SamplePeriodSec":             true,
+	"Model.ModelConfigValues":     true,
+}
+
+// loaded is the configuration as read from the config sources at the last (re)load,
+// before command line flags were applied, so that reloads only report real source changes.
+var loaded *Config
+
+// ReloadResult describes the outcome of a configuration reload.
+type ReloadResult struct {
+	// Applied lists the fields that changed and were applied live
+	Applied []string
+	// RequireRestart lists the fields that changed but only take effect after a restart
+	RequireRestart []string
+}
+
+// Changed returns true if the reload applied at least one new value.
+func (r *ReloadResult) Changed(field string) bool {
+	for _, f := range r.Applied {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload re-reads all config sources and applies the reloadable subset of the changes to the
+// running configuration. Callers must make sure no collection is in progress while reloading.
+// Invalid configurations are rejected as a whole and leave the running configuration untouched.
+func Reload() (*ReloadResult, error) {
+	if instance == nil {
+		return nil, fmt.Errorf("config is not initialized")
+	}
+	next, err := newConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReloadResult{}
+	current := reflect.ValueOf(instance).Elem()
+	previous := flattenConfig(reflect.ValueOf(loaded).Elem(), "")
+	for field, value := range flattenConfig(reflect.ValueOf(next).Elem(), "") {
+		if reflect.DeepEqual(previous[field].Interface(), value.Interface()) {
+			continue
+		}
+		if !reloadableFields[field] {
+			result.RequireRestart = append(result.RequireRestart, field)
+			continue
+		}
+		fieldByPath(current, field).Set(value)
+		result.Applied = append(result.Applied, field)
+	}
+	sort.Strings(result.Applied)
+	sort.Strings(result.RequireRestart)
+	loaded = next
+	return result, nil
+}
+
+// flattenConfig returns the leaf fields of a config struct keyed by their dotted path.
+func flattenConfig(v reflect.Value, prefix string) map[string]reflect.Value {
+	fields := make(map[string]reflect.Value)
+	for i := 0; i < v.NumField(); i++ {
+		name := prefix + v.Type().Field(i).Name
+		if v.Field(i).Kind() == reflect.Struct {
+			for k, f := range flattenConfig(v.Field(i), name+".") {
+				fields[k] = f
+			}
+			continue
+		}
+		fields[name] = v.Field(i)
+	}
+	return fields
+}
+
+func fieldByPath(v reflect.Value, path string) reflect.Value {
+	return flattenConfig(v, "")[path]
+}
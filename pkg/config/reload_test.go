@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test configuration reload", func() {
+	var (
+		origBaseDir  string
+		origInstance *Config
+		origLoaded   *Config
+	)
+
+	BeforeEach(func() {
+		origBaseDir, origInstance, origLoaded = BaseDir, instance, loaded
+		BaseDir = GinkgoT().TempDir()
+		c, err := newConfig()
+		Expect(err).NotTo(HaveOccurred())
+		instance = c
+		l := *c
+		loaded = &l
+	})
+
+	AfterEach(func() {
+		BaseDir, instance, loaded = origBaseDir, origInstance, origLoaded
+		fileValues = nil
+	})
+
+	writeFile := func(name, content string) {
+		Expect(os.WriteFile(filepath.Join(BaseDir, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	It("applies reloadable changes and reports the others", func() {
+		fingerprint := Fingerprint()
+		writeFile("EXPOSE_BPF_METRICS", "false")
+		writeFile("SAMPLE_PERIOD_SEC", "10")
+		writeFile("MODEL_CONFIG", "NODE_COMPONENTS_ESTIMATOR=true")
+		writeFile("ENABLE_GPU", "true")
+		Expect(Fingerprint()).NotTo(Equal(fingerprint))
+
+		result, err := Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Applied).To(Equal([]string{"Kepler.ExposeBPFMetrics", "Model.ModelConfigValues", "SamplePeriodSec"}))
+		Expect(result.RequireRestart).To(Equal([]string{"Kepler.EnabledGPU"}))
+		Expect(IsExposeBPFMetricsEnabled()).To(BeFalse())
+		Expect(SamplePeriodSec()).To(Equal(uint64(10)))
+		Expect(ModelConfigValues("NODE_COMPONENTS_ESTIMATOR")).To(Equal("true"))
+		Expect(IsGPUEnabled()).To(BeFalse())
+
+		result, err = Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Applied).To(BeEmpty())
+		Expect(result.RequireRestart).To(BeEmpty())
+	})
+
+	It("keeps the running configuration on invalid changes", func() {
+		writeFile("SAMPLE_PERIOD_SEC", "fast")
+		_, err := Reload()
+		Expect(err).To(HaveOccurred())
+		Expect(SamplePeriodSec()).To(Equal(uint64(defaultSamplePeriodSec)))
+	})
+
+	It("keeps reporting the provenance of the running configuration on invalid documents", func() {
+		writeFile(defaultConfigFileName, "apiVersion: kepler.sustainable-computing.io/v1alpha1\nsamplePeriodSec: 5\n")
+		_, err := Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(SamplePeriodSec()).To(Equal(uint64(5)))
+
+		samplePeriodSource := func() Source {
+			for _, s := range EffectiveSettings() {
+				if s.Key == "SAMPLE_PERIOD_SEC" {
+					return s.Source
+				}
+			}
+			return ""
+		}
+		// a document that does not parse and a document that does not validate
+		for _, document := range []string{"samplePeriodSec: [", "apiVersion: kepler.sustainable-computing.io/v1alpha1\nsamplePeriodSec: 0\n"} {
+			writeFile(defaultConfigFileName, document)
+			_, err = Reload()
+			Expect(err).To(HaveOccurred())
+			Expect(SamplePeriodSec()).To(Equal(uint64(5)))
+			Expect(IsSet("SAMPLE_PERIOD_SEC")).To(BeTrue())
+			Expect(samplePeriodSource()).To(Equal(SourceConfigFile))
+			value, _, _ := lookupConfig("SAMPLE_PERIOD_SEC")
+			Expect(value).To(Equal("5"))
+		}
+	})
+})
@@ -31,6 +31,19 @@ const (
 	CPURefCycle    = "cpu_ref_cycles"
 	CPUInstruction = "cpu_instructions"
 	CacheMiss      = "cache_miss"
+	// the cycles counted at the actual and at the base frequency while the CPU is not idle
+	APERF = "aperf"
+	MPERF = "mperf"
+	// APERFEvent and MPERFEvent are the perf events counting APERF and MPERF
+	APERFEvent = "msr/aperf/"
+	MPERFEvent = "msr/mperf/"
+
+	// cpu state - the effective frequency in MHz derived from APERF and MPERF, and the time in ms the CPUs
+	// spent in the idle states, per state
+	CPUFrequency = "cpu_frequency"
+	CPUIdleTime  = "cpu_idle_time"
+	// CPUIdleTimePrefix prefixes the name of an idle state, in lowercase, for the time spent in the state
+	CPUIdleTimePrefix = CPUIdleTime + "_"
 
 	// bpf - attacher package
 	CPUTime       = "bpf_cpu_time_ms"
@@ -38,6 +51,15 @@ const (
 	IRQNetTXLabel = "bpf_net_tx_irq"
 	IRQNetRXLabel = "bpf_net_rx_irq"
 	IRQBlockLabel = "bpf_block_irq"
+	NetTXBytes    = "bpf_net_tx_bytes"
+	NetRXBytes    = "bpf_net_rx_bytes"
+	NetTXPackets  = "bpf_net_tx_packets"
+	NetRXPackets  = "bpf_net_rx_packets"
+	// the block I/O is accounted per cgroup
+	BlockReadBytes  = "bpf_block_read_bytes"
+	BlockWriteBytes = "bpf_block_write_bytes"
+	BlockReadOps    = "bpf_block_read_ops"
+	BlockWriteOps   = "bpf_block_write_ops"
 
 	// GPU
 	GPUComputeUtilization = "gpu_compute_util"
@@ -74,6 +96,9 @@ const (
 	cGroupV2Path   = "/sys/fs/cgroup/cgroup.controllers"
 	metricPathKey  = "METRIC_PATH"
 	bindAddressKey = "BIND_ADDRESS"
+	// FileConfigAPIVersion is the supported version of the YAML configuration document
+	FileConfigAPIVersion  = "kepler.sustainable-computing.io/v1alpha1"
+	defaultConfigFileName = "kepler.yaml"
 	// model_parameter_attributes
 	EstimatorEnabledKey      = "ESTIMATOR"
 	LocalRegressorEnabledKey = "LOCAL_REGRESSOR"
@@ -89,12 +114,25 @@ const (
 	defaultMaxLookupRetry   = 500
 	// MaxIRQ is the maximum number of IRQs to be monitored
 	MaxIRQ = 10
+	// MaxHWCounters is the maximum number of hardware counters collected by the eBPF program, per MAX_HW_COUNTERS in kepler.bpf.h
+	MaxHWCounters = 8
+	// DefaultBPFMapSize is the number of entries of the eBPF maps of the processes and cgroups, per MAP_SIZE in kepler.bpf.h
+	DefaultBPFMapSize = 32768
 	// defaultSamplePeriodSec is the time in seconds that the reader will wait before reading the metrics again
 	defaultSamplePeriodSec       = 3
 	defaultKubeConfig            = ""
 	defaultBPFSampleRate         = 0
 	defaultCPUArchOverride       = ""
 	defaultExcludeSwapperProcess = false
+	defaultHWCounters            = "cpu-cycles,instructions,cache-misses,ref-cycles"
+	defaultProcfsFallback        = true
+	// the perf events are opened on every CPU for every cgroup, which takes many file descriptors
+	defaultProcfsCgroupHWCounters = false
+	defaultCgroupAggregation      = false
+	// the APERF and MPERF counters take two hardware counters and are only available on x86
+	defaultCPUStateMetrics = false
+	// the eBPF objects are not pinned unless a bpffs directory, e.g. /sys/fs/bpf/kepler, is configured
+	defaultBPFPinPath = ""
 	// model_parameter_prefix
 	defaultNodePlatformPowerKey        = "NODE_TOTAL"
 	defaultNodeComponentsPowerKey      = "NODE_COMPONENTS"
@@ -104,6 +142,25 @@ const (
 	defaultProcessComponentsPowerKey   = "PROCESS_COMPONENTS"
 	DefaultMachineSpecFilePath         = "/etc/kepler/models/machine/spec.json"
 	defaultDCGMHostEngineEndpoint      = "localhost:5555"
+	defaultOTLPExportIntervalSec       = 30
+	defaultRemoteWriteIntervalSec      = 30
+	defaultRemoteWriteTimeoutSec       = 30
+	defaultRemoteWriteWALDir           = "/var/lib/kepler/wal"
+	defaultRemoteWriteWALMaxSizeMB     = 256
+	defaultCheckpointFile              = "/var/lib/kepler/checkpoint.json"
+	defaultCheckpointIntervalSec       = 60
+	defaultOnlineTrainingDir           = "/var/lib/kepler/trained_model_weight"
+	defaultOnlineTrainingMinSamples    = 100
+	defaultOnlineTrainingIntervalSec   = 300
+	// OTLP transport protocols
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+	// IRQ attribution policies: the interrupts are charged to the task they interrupted, to the kernel processes,
+	// or the network and block softirqs to the processes and cgroups owning the sockets and requests and the other
+	// interrupts to the kernel processes
+	IRQAttributionTask   = "task"
+	IRQAttributionKernel = "kernel"
+	IRQAttributionOwner  = "owner"
 )
 
 var BaseDir string = "/etc/kepler/kepler.config"
@@ -0,0 +1,90 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Fingerprint returns a hash of the contents of the config directory and the YAML config file.
+// Kubernetes updates mounted ConfigMaps by atomically swapping a symlink, so the files are
+// compared by content rather than by modification events.
+func Fingerprint() string {
+	h := sha256.New()
+	paths, _ := filepath.Glob(filepath.Join(BaseDir, "*"))
+	if ConfigFile != "" {
+		paths = append(paths, ConfigFile)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if isCheckpointFile(path) {
+			// the checkpoint is written by the exporter, it is not a config source
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			// directories and unreadable files do not hold config values
+			continue
+		}
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isCheckpointFile(path string) bool {
+	if instance == nil {
+		return false
+	}
+	// the checkpoint is first written to a temporary file next to it
+	p, err := filepath.Abs(strings.TrimSuffix(path, ".tmp"))
+	if err != nil {
+		return false
+	}
+	checkpoint, err := filepath.Abs(instance.Checkpoint.File)
+	return err == nil && p == checkpoint
+}
+
+// Watch polls the config sources every interval and calls onChange when their content changed.
+// It returns when stop is closed.
+func Watch(interval time.Duration, stop <-chan struct{}, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := Fingerprint()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if current := Fingerprint(); current != last {
+				klog.V(3).Infof("detected a change in config-dir %s", BaseDir)
+				last = current
+				onChange()
+			}
+		}
+	}
+}
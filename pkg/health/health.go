@@ -0,0 +1,157 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+var (
+	globalRegistry *Registry
+	once           sync.Once
+)
+
+// Check reports whether a subsystem is working. It returns nil when the subsystem is healthy.
+type Check func() error
+
+// Registry holds the health checks registered by each subsystem.
+type Registry struct {
+	mx     sync.RWMutex
+	checks map[string]registeredCheck
+}
+
+type registeredCheck struct {
+	check Check
+	// optional checks cover the subsystems Kepler works without, their failure does not make Kepler not ready
+	optional bool
+}
+
+// Result is the outcome of a single health check.
+type Result struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+	// Degraded is set when an optional check fails
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// Status is the outcome of all registered health checks.
+type Status struct {
+	Ready  bool     `json:"ready"`
+	Checks []Result `json:"checks"`
+}
+
+// GetRegistry gets the default health check Registry instance
+func GetRegistry() *Registry {
+	once.Do(func() {
+		globalRegistry = NewRegistry()
+	})
+	return globalRegistry
+}
+
+// NewRegistry creates an empty health check Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		checks: map[string]registeredCheck{},
+	}
+}
+
+// Register adds or replaces the health check with the given name.
+func (r *Registry) Register(name string, check Check) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.checks[name] = registeredCheck{check: check}
+}
+
+// RegisterOptional adds or replaces the health check with the given name, for a subsystem Kepler works without.
+// Its failure is only reported as degraded in the verbose readiness.
+func (r *Registry) RegisterOptional(name string, check Check) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.checks[name] = registeredCheck{check: check, optional: true}
+}
+
+// Unregister removes the health check with the given name.
+func (r *Registry) Unregister(name string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	delete(r.checks, name)
+}
+
+// Run executes all registered health checks.
+func (r *Registry) Run() Status {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+	status := Status{Ready: true, Checks: make([]Result, 0, len(r.checks))}
+	for name, c := range r.checks {
+		result := Result{Name: name, Healthy: true}
+		if err := c.check(); err != nil {
+			result.Healthy = false
+			result.Error = err.Error()
+			if c.optional {
+				result.Degraded = true
+			} else {
+				status.Ready = false
+			}
+		}
+		status.Checks = append(status.Checks, result)
+	}
+	sort.Slice(status.Checks, func(i, j int) bool {
+		return status.Checks[i].Name < status.Checks[j].Name
+	})
+	return status
+}
+
+// ReadyHandler serves the readiness of Kepler. It returns 200 if all checks pass and 503 otherwise,
+// listing the failed checks. The JSON detail of every check is returned when the verbose query parameter is set.
+func (r *Registry) ReadyHandler(w http.ResponseWriter, req *http.Request) {
+	status := r.Run()
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	if _, verbose := req.URL.Query()["verbose"]; verbose {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			klog.Errorf("failed to write readiness status: %v", err)
+		}
+		return
+	}
+
+	var b strings.Builder
+	for _, result := range status.Checks {
+		if !result.Healthy && !result.Degraded {
+			fmt.Fprintf(&b, "[-]%s failed: %s\n", result.Name, result.Error)
+		}
+	}
+	if status.Ready {
+		b.WriteString("ok")
+	}
+	w.WriteHeader(code)
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		klog.Errorf("failed to write readiness response: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Test health registry", func() {
+	var r *Registry
+
+	BeforeEach(func() {
+		r = NewRegistry()
+		r.Register("bpf", func() error { return nil })
+	})
+
+	It("is ready when all checks pass", func() {
+		rec := httptest.NewRecorder()
+		r.ReadyHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(Equal("ok"))
+	})
+
+	It("is not ready when a check fails", func() {
+		r.Register("redfish", func() error { return fmt.Errorf("BMC unreachable") })
+		rec := httptest.NewRecorder()
+		r.ReadyHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Body.String()).To(ContainSubstring("[-]redfish failed: BMC unreachable"))
+
+		rec = httptest.NewRecorder()
+		r.ReadyHandler(rec, httptest.NewRequest("GET", "/readyz?verbose", nil))
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		var status Status
+		Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.Ready).To(BeFalse())
+		Expect(status.Checks).To(Equal([]Result{
+			{Name: "bpf", Healthy: true},
+			{Name: "redfish", Healthy: false, Error: "BMC unreachable"},
+		}))
+
+		r.Unregister("redfish")
+		Expect(r.Run().Ready).To(BeTrue())
+	})
+
+	It("stays ready when an optional check fails", func() {
+		r.RegisterOptional("perf-events", func() error { return fmt.Errorf("no PMU") })
+
+		rec := httptest.NewRecorder()
+		r.ReadyHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(Equal("ok"))
+
+		rec = httptest.NewRecorder()
+		r.ReadyHandler(rec, httptest.NewRequest("GET", "/readyz?verbose", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		var status Status
+		Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.Ready).To(BeTrue())
+		Expect(status.Checks).To(Equal([]Result{
+			{Name: "bpf", Healthy: true},
+			{Name: "perf-events", Healthy: false, Error: "no PMU", Degraded: true},
+		}))
+	})
+})
@@ -37,6 +37,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/bpf"
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/health"
 	"github.com/sustainable-computing-io/kepler/pkg/node"
 )
 
@@ -150,9 +151,18 @@ func NewObjListWatcher(bpfSupportedMetrics bpf.SupportedMetrics) (*ObjListWatche
 		return nil, err
 	}
 	IsWatcherEnabled = true
+	health.GetRegistry().Register("kubernetes-watcher", w.healthCheck)
 	return w, nil
 }
 
+// healthCheck fails until the pod informer cache is synced with the apiserver
+func (w *ObjListWatcher) healthCheck() error {
+	if !w.informer.HasSynced() {
+		return fmt.Errorf("pod informer has not synced with the apiserver")
+	}
+	return nil
+}
+
 func (w *ObjListWatcher) processNextItem() bool {
 	key, quit := w.workqueue.Get()
 	if quit {
@@ -27,6 +27,7 @@ import (
 	"github.com/digitalocean/go-libvirt"
 
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/utils"
 )
 
@@ -58,6 +59,7 @@ func getVMID(pid uint64, fileName string) (string, error) {
 	// Read the file
 	fileContents, err := os.ReadFile(fileName)
 	if err != nil {
+		pipeline.ResolutionFailures.WithLabelValues(pipeline.ResolutionVM).Inc()
 		addToNotExistCache(pid)
 		return "", err
 	}
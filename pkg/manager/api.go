@@ -0,0 +1,338 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/consts"
+	"github.com/sustainable-computing-io/kepler/pkg/model"
+	"github.com/sustainable-computing-io/kepler/pkg/model/utils"
+	"k8s.io/klog/v2"
+)
+
+// APIPrefix is the path prefix of the versioned REST query API.
+const APIPrefix = "/api/v1/"
+
+// Energy holds the per-component values of a workload in one mode, "total" is the sum of the
+// package, dram, other and gpu components, as in the kepler_*_joules_total metrics.
+type Energy map[string]float64
+
+// Usage is the power over the last collection interval and the cumulative energy of a workload.
+type Usage struct {
+	// PowerWatts is the average power over the last collection interval
+	PowerWatts map[string]Energy `json:"powerWatts"`
+	// EnergyJoules is the energy consumed since Kepler started
+	EnergyJoules map[string]Energy `json:"energyJoules"`
+}
+
+// NodeUsage is the response of /api/v1/nodes/self.
+type NodeUsage struct {
+	Name            string   `json:"name"`
+	IntervalSec     uint64   `json:"intervalSec"`
+	CPUArchitecture string   `json:"cpuArchitecture"`
+	Packages        []string `json:"packages"`
+	Usage
+}
+
+// ContainerUsage is an item of the /api/v1/containers response.
+type ContainerUsage struct {
+	ContainerID   string `json:"containerId"`
+	ContainerName string `json:"containerName"`
+	PodName       string `json:"podName"`
+	Namespace     string `json:"namespace"`
+	Usage
+}
+
+// ProcessUsage is an item of the /api/v1/processes response.
+type ProcessUsage struct {
+	PID         uint64 `json:"pid"`
+	Command     string `json:"command"`
+	ContainerID string `json:"containerId"`
+	VMID        string `json:"vmId"`
+	Usage
+}
+
+// VMUsage is an item of the /api/v1/vms response.
+type VMUsage struct {
+	VMID string `json:"vmId"`
+	PID  uint64 `json:"pid"`
+	Usage
+}
+
+// ListResponse wraps the items of a list endpoint.
+type ListResponse[T any] struct {
+	IntervalSec uint64 `json:"intervalSec"`
+	Items       []T    `json:"items"`
+}
+
+// snapshot is a copy of the collector stats taken under the collector lock.
+type snapshot struct {
+	interval   uint64
+	node       NodeUsage
+	containers []ContainerUsage
+	processes  []ProcessUsage
+	vms        []VMUsage
+	// processContainers holds the names of the containers of the processes, without their usage
+	processContainers map[string]ContainerUsage
+}
+
+// snapshotParts selects the stats copied by takeSnapshot.
+type snapshotParts int
+
+const (
+	snapshotNode snapshotParts = 1 << iota
+	snapshotContainers
+	snapshotProcesses
+	snapshotVMs
+)
+
+// takeSnapshot copies the selected stats while holding the lock shared with Collector.Update,
+// so the values returned by the API always come from the same collection. Only the stats an
+// endpoint returns are copied, to hold the lock as briefly as possible, and the response is
+// encoded once it is released.
+func (m *CollectorManager) takeSnapshot(parts snapshotParts) *snapshot {
+	m.PrometheusCollector.Mx.Lock()
+	defer m.PrometheusCollector.Mx.Unlock()
+
+	interval := config.SamplePeriodSec()
+	c := m.StatsCollector
+	s := &snapshot{interval: interval}
+
+	if parts&snapshotNode != 0 {
+		s.node = NodeUsage{
+			Name:            c.NodeStats.NodeName(),
+			IntervalSec:     interval,
+			CPUArchitecture: c.NodeStats.CPUArchitecture(),
+			Usage:           newUsage(&c.NodeStats.Stats, interval),
+		}
+		packages := map[string]bool{}
+		for _, name := range consts.DynEnergyMetricNames {
+			for id := range c.NodeStats.EnergyUsage[name] {
+				packages[id] = true
+			}
+		}
+		for id := range packages {
+			s.node.Packages = append(s.node.Packages, id)
+		}
+		sort.Strings(s.node.Packages)
+	}
+
+	if parts&snapshotContainers != 0 {
+		for _, container := range c.ContainerStats {
+			s.containers = append(s.containers, ContainerUsage{
+				ContainerID:   container.ContainerID,
+				ContainerName: container.ContainerName,
+				PodName:       container.PodName,
+				Namespace:     container.Namespace,
+				Usage:         newUsage(&container.Stats, interval),
+			})
+		}
+	}
+	if parts&snapshotProcesses != 0 {
+		s.processContainers = map[string]ContainerUsage{}
+		for _, process := range c.ProcessStats {
+			s.processes = append(s.processes, ProcessUsage{
+				PID:         process.PID,
+				Command:     process.Command,
+				ContainerID: process.ContainerID,
+				VMID:        process.VMID,
+				Usage:       newUsage(&process.Stats, interval),
+			})
+			if container, ok := c.ContainerStats[process.ContainerID]; ok {
+				s.processContainers[process.ContainerID] = ContainerUsage{
+					ContainerID:   container.ContainerID,
+					ContainerName: container.ContainerName,
+					PodName:       container.PodName,
+					Namespace:     container.Namespace,
+				}
+			}
+		}
+	}
+	if parts&snapshotVMs != 0 {
+		for _, vm := range c.VMStats {
+			s.vms = append(s.vms, VMUsage{
+				VMID:  vm.VMID,
+				PID:   vm.PID,
+				Usage: newUsage(&vm.Stats, interval),
+			})
+		}
+	}
+	// map iteration is random, order by id so that ties keep a stable order
+	sort.Slice(s.containers, func(i, j int) bool { return s.containers[i].ContainerID < s.containers[j].ContainerID })
+	sort.Slice(s.processes, func(i, j int) bool { return s.processes[i].PID < s.processes[j].PID })
+	sort.Slice(s.vms, func(i, j int) bool { return s.vms[i].VMID < s.vms[j].VMID })
+	return s
+}
+
+func newUsage(st *stats.Stats, interval uint64) Usage {
+	u := Usage{
+		PowerWatts:   map[string]Energy{"dynamic": {}, "idle": {}},
+		EnergyJoules: map[string]Energy{"dynamic": {}, "idle": {}},
+	}
+	for i, component := range consts.EnergyMetricNames {
+		for mode, name := range map[string]string{"dynamic": consts.DynEnergyMetricNames[i], "idle": consts.IdleEnergyMetricNames[i]} {
+			delta := float64(st.EnergyUsage[name].SumAllDeltaValues()) / utils.JouleMillijouleConversionFactor
+			aggr := float64(st.EnergyUsage[name].SumAllAggrValues()) / utils.JouleMillijouleConversionFactor
+			u.PowerWatts[mode][component] = delta / float64(interval)
+			u.EnergyJoules[mode][component] = aggr
+		}
+	}
+	for _, mode := range []string{"dynamic", "idle"} {
+		for _, e := range []Energy{u.PowerWatts[mode], u.EnergyJoules[mode]} {
+			e["total"] = e[config.PKG] + e[config.DRAM] + e[config.OTHER] + e[config.GPU]
+		}
+	}
+	return u
+}
+
+// APIHandler serves the REST query API under APIPrefix.
+func (m *CollectorManager) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(APIPrefix+"nodes/self", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.takeSnapshot(snapshotNode).node)
+	})
+	mux.HandleFunc(APIPrefix+"containers", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		s := m.takeSnapshot(snapshotContainers)
+		items := filter(s.containers, func(c *ContainerUsage) bool {
+			return matches(q.Get("namespace"), c.Namespace) &&
+				matches(q.Get("pod"), c.PodName) &&
+				(matches(q.Get("container"), c.ContainerName) || matches(q.Get("container"), c.ContainerID))
+		})
+		respondList(w, r, s.interval, items, func(c *ContainerUsage) *Usage { return &c.Usage })
+	})
+	mux.HandleFunc(APIPrefix+"processes", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		pid, ok := parsePID(w, q.Get("pid"))
+		if !ok {
+			return
+		}
+		s := m.takeSnapshot(snapshotProcesses)
+		items := filter(s.processes, func(p *ProcessUsage) bool {
+			// the pod and namespace of a process are known through its container
+			c := s.processContainers[p.ContainerID]
+			return (pid == 0 || p.PID == pid) &&
+				matches(q.Get("namespace"), c.Namespace) &&
+				matches(q.Get("pod"), c.PodName) &&
+				(matches(q.Get("container"), c.ContainerName) || matches(q.Get("container"), p.ContainerID))
+		})
+		respondList(w, r, s.interval, items, func(p *ProcessUsage) *Usage { return &p.Usage })
+	})
+	mux.HandleFunc(APIPrefix+"vms", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		pid, ok := parsePID(w, q.Get("pid"))
+		if !ok {
+			return
+		}
+		s := m.takeSnapshot(snapshotVMs)
+		items := filter(s.vms, func(vm *VMUsage) bool {
+			return pid == 0 || vm.PID == pid
+		})
+		respondList(w, r, s.interval, items, func(vm *VMUsage) *Usage { return &vm.Usage })
+	})
+	// the node power models trained on this node, e.g. models/intel_rapl, can be loaded as the initial models of the VMs
+	// of the same machine type
+	mux.HandleFunc(APIPrefix+"models/", func(w http.ResponseWriter, r *http.Request) {
+		source := strings.TrimPrefix(r.URL.Path, APIPrefix+"models/")
+		weights := model.TrainedNodePowerModel(source)
+		if weights == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no trained power model for the energy source %q", source))
+			return
+		}
+		writeJSON(w, http.StatusOK, weights)
+	})
+	mux.HandleFunc(APIPrefix, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown endpoint %s", r.URL.Path))
+	})
+	return mux
+}
+
+func matches(filter, value string) bool {
+	return filter == "" || filter == value
+}
+
+func parsePID(w http.ResponseWriter, s string) (uint64, bool) {
+	if s == "" {
+		return 0, true
+	}
+	pid, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || pid == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pid %q", s))
+		return 0, false
+	}
+	return pid, true
+}
+
+func filter[T any](items []T, keep func(*T) bool) []T {
+	filtered := make([]T, 0, len(items))
+	for i := range items {
+		if keep(&items[i]) {
+			filtered = append(filtered, items[i])
+		}
+	}
+	return filtered
+}
+
+// respondList sorts the items by the sort query parameter, "power" (default) or "energy",
+// in descending order of their total dynamic value and returns the first limit items.
+func respondList[T any](w http.ResponseWriter, r *http.Request, interval uint64, items []T, usage func(*T) *Usage) {
+	q := r.URL.Query()
+	var value func(*Usage) float64
+	switch q.Get("sort") {
+	case "", "power":
+		value = func(u *Usage) float64 { return u.PowerWatts["dynamic"]["total"] }
+	case "energy":
+		value = func(u *Usage) float64 { return u.EnergyJoules["dynamic"]["total"] }
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid sort %q, expected power or energy", q.Get("sort")))
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return value(usage(&items[i])) > value(usage(&items[j]))
+	})
+	if l := q.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", l))
+			return
+		}
+		if limit < len(items) {
+			items = items[:limit]
+		}
+	}
+	writeJSON(w, http.StatusOK, ListResponse[T]{IntervalSec: interval, Items: items})
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Errorf("failed to write API response: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/checkpoint"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// checkpointStore restores the energy counters from the checkpoint file when started, then saves them
+// every checkpoint interval and once more when stopped, after the last collection.
+func (m *CollectorManager) checkpointStore() Component {
+	cfg := config.GetCheckpointConfig()
+	c := goroutineComponent("checkpoint", func(ctx context.Context) {
+		ticker := time.NewTicker(time.Duration(cfg.IntervalSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.saveCheckpoint(cfg.File); err != nil {
+					klog.Errorf("failed to checkpoint the energy counters: %v", err)
+				}
+			}
+		}
+	})
+	start, stop := c.Start, c.Stop
+	c.Start = func(ctx context.Context) error {
+		// a missing or unreadable checkpoint must not prevent the exporter from starting
+		if cp, err := checkpoint.Load(cfg.File); err != nil {
+			klog.Warningf("the energy counters are not restored: %v", err)
+		} else if cp != nil {
+			m.PrometheusCollector.Mx.Lock()
+			m.StatsCollector.RestoreCheckpoint(cp)
+			m.PrometheusCollector.Mx.Unlock()
+		}
+		return start(ctx)
+	}
+	c.Stop = func(ctx context.Context) error {
+		if err := stop(ctx); err != nil {
+			return err
+		}
+		return m.saveCheckpoint(cfg.File)
+	}
+	return c
+}
+
+func (m *CollectorManager) saveCheckpoint(path string) error {
+	m.PrometheusCollector.Mx.Lock()
+	cp := m.StatsCollector.Checkpoint()
+	m.PrometheusCollector.Mx.Unlock()
+	return cp.Save(path)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+// EffectiveConfig is the configuration Kepler is running with and the runtime facts it detected.
+type EffectiveConfig struct {
+	Settings []config.Setting `json:"settings"`
+	Runtime  RuntimeInfo      `json:"runtime"`
+}
+
+// RuntimeInfo holds the facts detected on the node that influence how power is measured or estimated.
+type RuntimeInfo struct {
+	KernelVersion         float32           `json:"kernelVersion"`
+	CGroupV2              bool              `json:"cgroupV2"`
+	ComponentsPowerSource string            `json:"componentsPowerSource"`
+	PlatformPowerSource   string            `json:"platformPowerSource"`
+	Accelerator           string            `json:"accelerator"`
+	BPFHardwareCounters   []string          `json:"bpfHardwareCounters"`
+	BPFSoftwareCounters   []string          `json:"bpfSoftwareCounters"`
+	ResourceSource        string            `json:"resourceSource"`
+	ModelTypes            map[string]string `json:"modelTypes"`
+}
+
+// EffectiveConfig returns a snapshot of the effective configuration.
+func (m *CollectorManager) EffectiveConfig() *EffectiveConfig {
+	// the lock prevents reading the config while it is being reloaded
+	m.PrometheusCollector.Mx.Lock()
+	defer m.PrometheusCollector.Mx.Unlock()
+
+	info := RuntimeInfo{
+		KernelVersion:         config.KernelVersion(),
+		CGroupV2:              config.IsCGroupV2(),
+		ComponentsPowerSource: components.GetSourceName(),
+		PlatformPowerSource:   platform.GetSourceName(),
+		BPFHardwareCounters:   sets.List(m.bpfSupportedMetrics.HardwareCounters),
+		BPFSoftwareCounters:   sets.List(m.bpfSupportedMetrics.SoftwareCounters),
+		ResourceSource:        m.bpfSupportedMetrics.Source,
+		ModelTypes:            model.SelectedModelTypes(),
+	}
+	if config.IsGPUEnabled() {
+		if gpu := accelerator.GetActiveAcceleratorByType(config.GPU); gpu != nil {
+			info.Accelerator = gpu.Device().Name()
+		}
+	}
+	return &EffectiveConfig{
+		Settings: config.EffectiveSettings(),
+		Runtime:  info,
+	}
+}
+
+// EffectiveConfigHandler serves the effective configuration as JSON.
+func (m *CollectorManager) EffectiveConfigHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(m.EffectiveConfig()); err != nil {
+		klog.Errorf("failed to write effective config: %v", err)
+	}
+}
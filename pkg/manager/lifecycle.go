@@ -0,0 +1,151 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Component is a part of Kepler whose lifecycle is handled by the CollectorManager.
+// The components are started in the order they are registered and stopped in the reverse order,
+// so a component can rely on the ones registered before it while it is running.
+type Component struct {
+	Name string
+	// Start starts the component, the goroutines it creates must return when ctx is cancelled. Optional.
+	Start func(ctx context.Context) error
+	// Stop stops the component and waits for its goroutines to return. Optional.
+	Stop func(ctx context.Context) error
+}
+
+type lifecycleState int
+
+const (
+	stateNew lifecycleState = iota
+	stateStarting
+	stateRunning
+	stateStopping
+	stateStopped
+)
+
+// Register adds a component started before the collection loop and stopped after it, e.g. the power
+// meters and the eBPF programs the collector reads from, or an exporter that pushes the collected metrics.
+// It must be called before Start.
+func (m *CollectorManager) Register(c Component) {
+	m.components = append(m.components, c)
+}
+
+// Start starts the registered components, the Kubernetes watcher and the collection loop. If a component
+// fails to start, the components already started are stopped and the error is returned.
+// Cancelling ctx stops the goroutines of the manager, Stop must still be called to release the components.
+func (m *CollectorManager) Start(ctx context.Context) error {
+	m.setState(stateStarting)
+	if err := m.StatsCollector.Initialize(); err != nil {
+		return err
+	}
+	m.ctx, m.cancel = context.WithCancel(ctx)
+
+	components := append(append([]Component{}, m.components...), m.internalComponents()...)
+	for _, c := range components {
+		if c.Start != nil {
+			if err := c.Start(m.ctx); err != nil {
+				stopCtx, cancel := context.WithTimeout(context.Background(), defaultStopTimeout)
+				defer cancel()
+				if stopErr := m.Stop(stopCtx); stopErr != nil {
+					klog.Errorf("failed to stop the started components: %v", stopErr)
+				}
+				return fmt.Errorf("failed to start %s: %w", c.Name, err)
+			}
+		}
+		klog.V(3).Infof("started %s", c.Name)
+		m.started = append(m.started, c)
+	}
+	m.setState(stateRunning)
+	return nil
+}
+
+// Stop stops the started components in the reverse order. The collection loop runs a last collection
+// before returning, so the exporters stopped after it push the latest values.
+// A component that does not stop before ctx is done is abandoned and reported in the returned error.
+func (m *CollectorManager) Stop(ctx context.Context) error {
+	m.setState(stateStopping)
+	var errs []error
+	for i := len(m.started) - 1; i >= 0; i-- {
+		c := m.started[i]
+		if c.Stop == nil {
+			continue
+		}
+		if err := stopComponent(ctx, c); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", c.Name, err))
+			continue
+		}
+		klog.V(3).Infof("stopped %s", c.Name)
+	}
+	m.started = nil
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.setState(stateStopped)
+	return errors.Join(errs...)
+}
+
+// Run starts the manager and blocks until ctx is cancelled, then stops it within timeout.
+func (m *CollectorManager) Run(ctx context.Context, timeout time.Duration) error {
+	// the components are stopped by Stop, in order, rather than all at once by the cancellation of ctx
+	if err := m.Start(context.WithoutCancel(ctx)); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	stopCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.Stop(stopCtx)
+}
+
+func stopComponent(ctx context.Context, c Component) error {
+	done := make(chan error, 1)
+	go func() { done <- c.Stop(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *CollectorManager) setState(s lifecycleState) {
+	m.stateMx.Lock()
+	defer m.stateMx.Unlock()
+	m.state = s
+}
+
+// healthCheck fails until all the components are started and once the shutdown begins.
+func (m *CollectorManager) healthCheck() error {
+	m.stateMx.Lock()
+	defer m.stateMx.Unlock()
+	switch m.state {
+	case stateRunning:
+		return nil
+	case stateStopping, stateStopped:
+		return fmt.Errorf("shutting down")
+	default:
+		return fmt.Errorf("starting")
+	}
+}
@@ -17,16 +17,23 @@ limitations under the License.
 package manager
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/sustainable-computing-io/kepler/pkg/bpf"
 	"github.com/sustainable-computing-io/kepler/pkg/collector"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/health"
 	"github.com/sustainable-computing-io/kepler/pkg/kubernetes"
 	exporter "github.com/sustainable-computing-io/kepler/pkg/metrics"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/otlp"
 	"k8s.io/klog/v2"
 )
 
+// defaultStopTimeout bounds the shutdown of the components when Start fails
+const defaultStopTimeout = 5 * time.Second
+
 type CollectorManager struct {
 	// StatsCollector is responsible to collect resource and energy consumption metrics and calculate them when needed
 	StatsCollector *collector.Collector
@@ -34,14 +41,39 @@ type CollectorManager struct {
 	// PrometheusCollector implements the external Collector interface provided by the Prometheus client
 	PrometheusCollector *exporter.PrometheusExporter
 
+	// OTLPExporter pushes the metrics to an OpenTelemetry collector, it is nil until the manager is started with an
+	// OTLP endpoint configured
+	OTLPExporter *otlp.Exporter
+
 	// Watcher register in the kubernetes apiserver to watch for pod events to add or remove it from the ContainerStats map
 	Watcher *kubernetes.ObjListWatcher
+
+	// ticker triggers the metric collection every sample period
+	ticker *time.Ticker
+
+	// configReloadInterval is the interval of the config watcher, which is disabled if 0
+	configReloadInterval time.Duration
+
+	// components are the registered components, started before the internal ones
+	components []Component
+	// started are the components started so far, in order
+	started []Component
+	// ctx is cancelled once the manager is stopped
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	stateMx sync.Mutex
+	state   lifecycleState
+
+	// bpfSupportedMetrics holds the metrics supported by the bpf exporter
+	bpfSupportedMetrics bpf.SupportedMetrics
 }
 
 func New(bpfExporter bpf.Exporter) *CollectorManager {
 	var err error
 	manager := &CollectorManager{}
 	supportedMetrics := bpfExporter.SupportedMetrics()
+	manager.bpfSupportedMetrics = supportedMetrics
 	manager.StatsCollector = collector.NewCollector(bpfExporter)
 	manager.PrometheusCollector = exporter.NewPrometheusExporter(supportedMetrics)
 	// the collector and prometheusExporter share structures and collections
@@ -55,35 +87,175 @@ func New(bpfExporter bpf.Exporter) *CollectorManager {
 	}
 	manager.Watcher.Mx = &manager.PrometheusCollector.Mx
 	manager.Watcher.ContainerStats = manager.StatsCollector.ContainerStats
-	if err = manager.Watcher.Run(); err != nil {
-		klog.Errorf("could not run the watcher %v", err)
-	}
+	health.GetRegistry().Register("manager", manager.healthCheck)
 	return manager
 }
 
-func (m *CollectorManager) Start() error {
-	if err := m.StatsCollector.Initialize(); err != nil {
-		return err
+// EnableConfigWatcher reloads the configuration whenever the config sources change, the sources
+// are checked every interval. It must be called before Start.
+func (m *CollectorManager) EnableConfigWatcher(interval time.Duration) {
+	m.configReloadInterval = interval
+}
+
+// internalComponents returns the components of the manager in start order: the Kubernetes watcher,
+// the OTLP exporter, the checkpoint store, the model trainer, the collection loop, the model refresher and the
+// config watcher.
+func (m *CollectorManager) internalComponents() []Component {
+	components := []Component{{
+		Name: "kubernetes-watcher",
+		Start: func(context.Context) error {
+			if err := m.Watcher.Run(); err != nil {
+				klog.Errorf("could not run the watcher %v", err)
+			}
+			return nil
+		},
+		Stop: func(context.Context) error {
+			if kubernetes.IsWatcherEnabled {
+				m.Watcher.Stop()
+			}
+			m.Watcher.ShutDownWithDrain()
+			return nil
+		},
+	}}
+	if config.IsOTLPEnabled() {
+		components = append(components, m.otlpExporter())
+	}
+	if config.IsCheckpointEnabled() {
+		// started before the collection loop, so the counters are restored before the first collection
+		components = append(components, m.checkpointStore())
+	}
+	if config.IsOnlineTrainingEnabled() {
+		// stopped after the collection loop, so the last fit includes the last collection
+		components = append(components, m.modelTrainer())
+	}
+	components = append(components, m.collectionLoop())
+	if config.ModelRefreshIntervalSec() > 0 {
+		components = append(components, m.modelRefresher())
 	}
+	if m.configReloadInterval > 0 {
+		components = append(components, goroutineComponent("config-watcher", func(ctx context.Context) {
+			config.Watch(m.configReloadInterval, ctx.Done(), func() {
+				if err := m.Reload(); err != nil {
+					klog.Errorf("failed to reload config: %v", err)
+				}
+			})
+		}))
+	}
+	return components
+}
 
-	samplePeriod := time.Duration((config.SamplePeriodSec()) * uint64(time.Second))
+// otlpExporter pushes the metrics to the OTLP endpoint, the periodic push starts with the component.
+func (m *CollectorManager) otlpExporter() Component {
+	return Component{
+		Name: "otlp-exporter",
+		Start: func(ctx context.Context) error {
+			otlpConfig := config.GetOTLPConfig()
+			e, err := otlp.NewExporter(ctx, &otlpConfig, otlp.Stats{
+				NodeStats:      &m.StatsCollector.NodeStats,
+				ContainerStats: m.StatsCollector.ContainerStats,
+				ProcessStats:   m.StatsCollector.ProcessStats,
+				VMStats:        m.StatsCollector.VMStats,
+				Mx:             &m.PrometheusCollector.Mx,
+			})
+			if err != nil {
+				klog.Errorf("could not create the OTLP exporter: %v", err)
+				return nil
+			}
+			m.OTLPExporter = e
+			return nil
+		},
+		// pushes the values of the last collection
+		Stop: func(ctx context.Context) error {
+			if m.OTLPExporter == nil {
+				return nil
+			}
+			return m.OTLPExporter.Shutdown(ctx)
+		},
+	}
+}
 
-	go func() {
-		ticker := time.NewTicker(samplePeriod)
+// collectionLoop updates the metrics every sample period, it runs a last collection when stopped.
+func (m *CollectorManager) collectionLoop() Component {
+	c := goroutineComponent("collector", func(ctx context.Context) {
 		for {
-			// wait x seconds before updating the metrics
-			<-ticker.C
-
-			// acquire the lock to wait prometheus finish the metric collection before updating the metrics
-			m.PrometheusCollector.Mx.Lock()
-			m.StatsCollector.Update()
-			m.PrometheusCollector.Mx.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.ticker.C:
+				m.update()
+			}
+		}
+	})
+	start, stop := c.Start, c.Stop
+	c.Start = func(ctx context.Context) error {
+		m.PrometheusCollector.Mx.Lock()
+		m.ticker = time.NewTicker(time.Duration(config.SamplePeriodSec()) * time.Second)
+		m.PrometheusCollector.Mx.Unlock()
+		return start(ctx)
+	}
+	c.Stop = func(ctx context.Context) error {
+		if err := stop(ctx); err != nil {
+			return err
 		}
-	}()
+		m.ticker.Stop()
+		m.update()
+		return nil
+	}
+	return c
+}
 
-	return nil
+func (m *CollectorManager) update() {
+	// acquire the lock to wait prometheus finish the metric collection before updating the metrics
+	m.PrometheusCollector.Mx.Lock()
+	defer m.PrometheusCollector.Mx.Unlock()
+	m.StatsCollector.Update()
+}
+
+// goroutineComponent runs fn in a goroutine until the component is stopped.
+func goroutineComponent(name string, fn func(ctx context.Context)) Component {
+	var cancel context.CancelFunc
+	done := make(chan struct{})
+	return Component{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			ctx, cancel = context.WithCancel(ctx)
+			go func() {
+				defer close(done)
+				fn(ctx)
+			}()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			cancel()
+			<-done
+			return nil
+		},
+	}
 }
 
-func (m *CollectorManager) Stop() {
-	m.Watcher.ShutDownWithDrain()
+// Reload re-reads the configuration and applies the changes that do not require a restart.
+// The collection is paused while the new values are applied, so the accumulated counters are kept.
+func (m *CollectorManager) Reload() error {
+	m.PrometheusCollector.Mx.Lock()
+	defer m.PrometheusCollector.Mx.Unlock()
+
+	result, err := config.Reload()
+	if err != nil {
+		return err
+	}
+	if result.Changed("SamplePeriodSec") && m.ticker != nil {
+		m.ticker.Reset(time.Duration(config.SamplePeriodSec() * uint64(time.Second)))
+	}
+	if result.Changed("Model.ModelConfigValues") {
+		if err := m.StatsCollector.Initialize(); err != nil {
+			return err
+		}
+	}
+	if len(result.Applied) > 0 {
+		klog.Infof("applied config changes: %v", result.Applied)
+	}
+	if len(result.RequireRestart) > 0 {
+		klog.Warningf("config changes require a restart to take effect: %v", result.RequireRestart)
+	}
+	return nil
 }
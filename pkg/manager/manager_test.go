@@ -1,9 +1,17 @@
 package manager
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"runtime"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 )
 
@@ -14,8 +22,184 @@ var _ = Describe("Manager", func() {
 		Expect(err).NotTo(HaveOccurred())
 		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
 		CollectorManager := New(bpfExporter)
-		err = CollectorManager.Start()
+		err = CollectorManager.Start(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(CollectorManager.Stop(context.Background())).To(Succeed())
+	})
+
+	It("Should start and stop the components in order", func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		before := runtime.NumGoroutine()
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		CollectorManager := New(bpfExporter)
+		CollectorManager.EnableConfigWatcher(time.Hour)
+
+		var events []string
+		for _, name := range []string{"sensors", "exporter"} {
+			name := name
+			CollectorManager.Register(Component{
+				Name: name,
+				Start: func(context.Context) error {
+					events = append(events, "start "+name)
+					return nil
+				},
+				Stop: func(context.Context) error {
+					events = append(events, "stop "+name)
+					return nil
+				},
+			})
+		}
+		Expect(CollectorManager.Start(context.Background())).To(Succeed())
+		Expect(CollectorManager.healthCheck()).To(Succeed())
+		Expect(CollectorManager.Stop(context.Background())).To(Succeed())
+		Expect(CollectorManager.healthCheck()).To(HaveOccurred())
+		Expect(events).To(Equal([]string{"start sensors", "start exporter", "stop exporter", "stop sensors"}))
+
+		// the last collection ran when the collection loop stopped
+		Expect(CollectorManager.StatsCollector.CollectionHealthCheck()).To(Succeed())
+		// the collection loop, the config watcher and the Kubernetes work queue are stopped
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", before))
+	})
+
+	It("Should create the OTLP exporter when the component starts", func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		CollectorManager := New(bpfExporter)
+		Expect(CollectorManager.OTLPExporter).To(BeNil())
+
+		c := CollectorManager.otlpExporter()
+		Expect(c.Start(context.Background())).To(Succeed())
+		Expect(CollectorManager.OTLPExporter).NotTo(BeNil())
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		// the last push fails without an OTLP collector, the exporter is shut down anyway
+		_ = c.Stop(ctx)
+		Expect(CollectorManager.OTLPExporter.Shutdown(context.Background())).NotTo(Succeed())
+	})
+
+	It("Should stop the started components when a component fails to start", func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		CollectorManager := New(bpfExporter)
+
+		stopped := false
+		CollectorManager.Register(Component{
+			Name: "first",
+			Stop: func(context.Context) error {
+				stopped = true
+				return nil
+			},
+		})
+		CollectorManager.Register(Component{
+			Name:  "broken",
+			Start: func(context.Context) error { return fmt.Errorf("no device") },
+		})
+		err = CollectorManager.Start(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("failed to start broken: no device")))
+		Expect(stopped).To(BeTrue())
+	})
+
+	It("Should not wait past the deadline for a component to stop", func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		CollectorManager := New(bpfExporter)
+
+		block := make(chan struct{})
+		defer close(block)
+		CollectorManager.Register(Component{
+			Name: "stuck",
+			Stop: func(context.Context) error {
+				<-block
+				return nil
+			},
+		})
+		Expect(CollectorManager.Start(context.Background())).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err = CollectorManager.Stop(ctx)
+		Expect(err).To(MatchError(ContainSubstring("failed to stop stuck")))
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("Should serve the effective config", func() {
+		_, err := config.Initialize(".")
 		Expect(err).NotTo(HaveOccurred())
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		CollectorManager := New(bpfExporter)
+
+		rec := httptest.NewRecorder()
+		CollectorManager.EffectiveConfigHandler(rec, httptest.NewRequest("GET", "/debug/config", nil))
+		var effective EffectiveConfig
+		Expect(json.Unmarshal(rec.Body.Bytes(), &effective)).To(Succeed())
+		Expect(effective.Settings).To(ContainElement(config.Setting{Key: "SAMPLE_PERIOD_SEC", Value: float64(3), Source: config.SourceDefault}))
+		Expect(effective.Runtime.BPFHardwareCounters).To(ContainElement(config.CPUCycle))
+		Expect(effective.Runtime.ComponentsPowerSource).NotTo(BeEmpty())
 	})
 
+	It("Should serve the per-workload power", func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		bpfExporter := bpf.NewMockExporter(bpf.DefaultSupportedMetrics())
+		CollectorManager := New(bpfExporter)
+		for i, name := range []string{"low", "high"} {
+			c := stats.NewContainerStats(name, name+"-pod", "ns1", name)
+			// 3J over the 3s interval is 1W
+			c.EnergyUsage[config.DynEnergyInPkg].SetDeltaStat(stats.MockedSocketID, uint64(3000*(i+1)))
+			CollectorManager.StatsCollector.ContainerStats[name] = c
+		}
+		CollectorManager.StatsCollector.ContainerStats["other"] = stats.NewContainerStats("other", "other-pod", "ns2", "other")
+		CollectorManager.StatsCollector.ProcessStats[1] = stats.NewProcessStats(1, 0, "low", "", "app")
+		CollectorManager.StatsCollector.ProcessStats[2] = stats.NewProcessStats(2, 0, "other", "", "app")
+		handler := CollectorManager.APIHandler()
+
+		get := func(path string) (int, []byte) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			return rec.Code, rec.Body.Bytes()
+		}
+
+		code, body := get("/api/v1/containers?namespace=ns1&limit=1")
+		Expect(code).To(Equal(200))
+		var containers ListResponse[ContainerUsage]
+		Expect(json.Unmarshal(body, &containers)).To(Succeed())
+		Expect(containers.IntervalSec).To(Equal(uint64(3)))
+		Expect(containers.Items).To(HaveLen(1))
+		Expect(containers.Items[0].ContainerName).To(Equal("high"))
+		Expect(containers.Items[0].PowerWatts["dynamic"][config.PKG]).To(BeNumerically("~", 2.0))
+		Expect(containers.Items[0].PowerWatts["dynamic"]["total"]).To(BeNumerically("~", 2.0))
+		Expect(containers.Items[0].EnergyJoules["dynamic"][config.PKG]).To(BeNumerically("~", 6.0))
+
+		code, body = get("/api/v1/containers?pod=low-pod")
+		Expect(code).To(Equal(200))
+		Expect(json.Unmarshal(body, &containers)).To(Succeed())
+		Expect(containers.Items).To(HaveLen(1))
+		Expect(containers.Items[0].ContainerName).To(Equal("low"))
+
+		code, body = get("/api/v1/nodes/self")
+		Expect(code).To(Equal(200))
+		var node NodeUsage
+		Expect(json.Unmarshal(body, &node)).To(Succeed())
+		Expect(node.PowerWatts).To(HaveKey("dynamic"))
+
+		code, body = get("/api/v1/processes?namespace=ns1")
+		Expect(code).To(Equal(200))
+		var processes ListResponse[ProcessUsage]
+		Expect(json.Unmarshal(body, &processes)).To(Succeed())
+		Expect(processes.Items).To(HaveLen(1))
+		Expect(processes.Items[0].PID).To(Equal(uint64(1)))
+
+		code, _ = get("/api/v1/processes?pid=abc")
+		Expect(code).To(Equal(400))
+		code, _ = get("/api/v1/containers?sort=name")
+		Expect(code).To(Equal(400))
+		code, _ = get("/api/v1/unknown")
+		Expect(code).To(Equal(404))
+		// the node power models are not trained
+		code, _ = get("/api/v1/models/intel_rapl")
+		Expect(code).To(Equal(404))
+	})
 })
@@ -0,0 +1,45 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model"
+)
+
+// modelRefresher fetches the weights of the power models again every refresh interval and swaps the changed ones
+// between two collections. A refresh is abandoned if it does not complete within the interval.
+func (m *CollectorManager) modelRefresher() Component {
+	interval := time.Duration(config.ModelRefreshIntervalSec()) * time.Second
+	return goroutineComponent("model-refresher", func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refreshCtx, cancel := context.WithTimeout(ctx, interval)
+				model.RefreshPowerModels(refreshCtx, &m.PrometheusCollector.Mx)
+				cancel()
+			}
+		}
+	})
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model"
+	"k8s.io/klog/v2"
+)
+
+// modelTrainer fits the node power models with the samples of the collections every training interval and once
+// more when stopped, after the last collection, and saves their weights in the training directory.
+func (m *CollectorManager) modelTrainer() Component {
+	cfg := config.GetOnlineTrainingConfig()
+	c := goroutineComponent("model-trainer", func(ctx context.Context) {
+		ticker := time.NewTicker(time.Duration(cfg.IntervalSec) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := model.TrainNodePowerModels(cfg.Dir); err != nil {
+					klog.Errorf("failed to train the node power models: %v", err)
+				}
+			}
+		}
+	})
+	stop := c.Stop
+	c.Stop = func(ctx context.Context) error {
+		if err := stop(ctx); err != nil {
+			return err
+		}
+		return model.TrainNodePowerModels(cfg.Dir)
+	}
+	return c
+}
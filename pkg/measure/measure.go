@@ -0,0 +1,151 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package measure reports the energy consumed by a single command run, like perf stat does for the hardware counters.
+// The command is started in its own cgroup and the processes of that cgroup, which include all the processes
+// forked by the command, are attributed their energy by the regular collector loop.
+package measure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+	"github.com/sustainable-computing-io/kepler/pkg/collector"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/consts"
+	"github.com/sustainable-computing-io/kepler/pkg/model/utils"
+)
+
+// Energy holds the joules consumed per component, keyed by the component names of the kepler metrics.
+type Energy map[string]float64
+
+// Usage is the dynamic and idle energy consumed during the command run.
+type Usage struct {
+	Dynamic Energy `json:"dynamicJoules"`
+	Idle    Energy `json:"idleJoules"`
+}
+
+// Result is the energy report of a measured command run.
+type Result struct {
+	Command     []string `json:"command"`
+	ExitCode    int      `json:"exitCode"`
+	DurationSec float64  `json:"durationSec"`
+	// Processes is the number of processes of the command process tree seen by the collector
+	Processes int `json:"processes"`
+	// Process is the energy attributed to the command process tree
+	Process Usage `json:"process"`
+	// Node is the energy consumed by the whole node over the same period, for comparison
+	Node Usage `json:"node"`
+	// Source is where the resource usage of the processes was read from, ebpf or procfs
+	Source string `json:"source"`
+}
+
+// tracker accumulates the energy of the processes in the command cgroup after every collector update.
+// The collector drops the processes that exited, so the energy is summed from the per-interval deltas.
+type tracker struct {
+	cgroupID uint64
+	pids     map[uint64]bool
+
+	// the accumulated energy in millijoules, keyed by the stats metric names
+	process map[string]uint64
+	node    map[string]uint64
+}
+
+func newTracker(cgroupID uint64) *tracker {
+	return &tracker{
+		cgroupID: cgroupID,
+		pids:     map[uint64]bool{},
+		process:  map[string]uint64{},
+		node:     map[string]uint64{},
+	}
+}
+
+// accumulate adds the deltas of the last collector update, it must be called after every Update.
+func (t *tracker) accumulate(c *collector.Collector) {
+	for _, p := range c.ProcessStats {
+		if p.CGroupID != t.cgroupID {
+			continue
+		}
+		t.pids[p.PID] = true
+		addDeltas(t.process, &p.Stats)
+	}
+	addDeltas(t.node, &c.NodeStats.Stats)
+}
+
+func addDeltas(energy map[string]uint64, s *stats.Stats) {
+	for _, names := range [][]string{consts.DynEnergyMetricNames, consts.IdleEnergyMetricNames} {
+		for _, name := range names {
+			if stat, ok := s.EnergyUsage[name]; ok {
+				energy[name] += stat.SumAllDeltaValues()
+			}
+		}
+	}
+}
+
+func (t *tracker) report(command []string, exitCode int, duration time.Duration) *Result {
+	return &Result{
+		Command:     command,
+		ExitCode:    exitCode,
+		DurationSec: duration.Seconds(),
+		Processes:   len(t.pids),
+		Process:     newUsage(t.process),
+		Node:        newUsage(t.node),
+	}
+}
+
+func newUsage(millijoules map[string]uint64) Usage {
+	u := Usage{Dynamic: Energy{}, Idle: Energy{}}
+	for i, component := range consts.EnergyMetricNames {
+		u.Dynamic[component] = float64(millijoules[consts.DynEnergyMetricNames[i]]) / utils.JouleMillijouleConversionFactor
+		u.Idle[component] = float64(millijoules[consts.IdleEnergyMetricNames[i]]) / utils.JouleMillijouleConversionFactor
+	}
+	return u
+}
+
+// WriteJSON writes the report as a JSON document.
+func (r *Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report as a table with one row per component.
+func (r *Result) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "\n Energy stats for '%s' (%d processes):\n\n", strings.Join(r.Command, " "), r.Processes); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "component\tprocess dynamic (J)\tprocess idle (J)\tnode dynamic (J)\tnode idle (J)\t")
+	for _, component := range consts.EnergyMetricNames {
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%.3f\t\n", component,
+			r.Process.Dynamic[component], r.Process.Idle[component], r.Node.Dynamic[component], r.Node.Idle[component])
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.Source == bpf.SourceProcfs {
+		if _, err := fmt.Fprintf(w, "\n The eBPF programs could not be loaded, the CPU time of the processes was read from procfs\n"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n %.3f seconds time elapsed, exit code %d\n\n", r.DurationSec, r.ExitCode)
+	return err
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package measure
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+	"github.com/sustainable-computing-io/kepler/pkg/collector"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+const measuredCgroupID = 4242
+
+// update simulates a collector update where each process consumed the given package energy in millijoules.
+func update(c *collector.Collector, pkgEnergy map[uint64]uint64) {
+	c.NodeStats.ResetDeltaValues()
+	for pid, p := range c.ProcessStats {
+		p.ResetDeltaValues()
+		if e, ok := pkgEnergy[pid]; ok {
+			p.EnergyUsage[config.DynEnergyInPkg].SetDeltaStat(stats.MockedSocketID, e)
+		}
+	}
+	c.NodeStats.EnergyUsage[config.DynEnergyInPkg].SetDeltaStat(stats.MockedSocketID, 10000)
+}
+
+var _ = Describe("Test measure", func() {
+	BeforeEach(func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("accumulates the energy of the processes of the cgroup, including the ones that exited", func() {
+		c := collector.NewCollector(bpf.NewMockExporter(bpf.DefaultSupportedMetrics()))
+		c.ProcessStats[10] = stats.NewProcessStats(10, measuredCgroupID, "", "", "bench")
+		c.ProcessStats[11] = stats.NewProcessStats(11, measuredCgroupID, "", "", "worker")
+		c.ProcessStats[20] = stats.NewProcessStats(20, 1000, "", "", "other")
+		t := newTracker(measuredCgroupID)
+
+		update(c, map[uint64]uint64{10: 1000, 11: 2000, 20: 5000})
+		t.accumulate(c)
+		// the worker exited and was removed by the collector
+		delete(c.ProcessStats, 11)
+		update(c, map[uint64]uint64{10: 1500, 20: 5000})
+		t.accumulate(c)
+
+		r := t.report([]string{"./bench.sh", "-n", "1"}, 3, 2*time.Second)
+		Expect(r.Processes).To(Equal(2))
+		Expect(r.ExitCode).To(Equal(3))
+		Expect(r.DurationSec).To(Equal(2.0))
+		Expect(r.Process.Dynamic[config.PKG]).To(Equal(4.5))
+		Expect(r.Process.Dynamic[config.DRAM]).To(Equal(0.0))
+		Expect(r.Node.Dynamic[config.PKG]).To(Equal(20.0))
+		Expect(r.Node.Idle).To(HaveKey(config.PLATFORM))
+	})
+
+	It("writes the report as text and JSON", func() {
+		t := newTracker(measuredCgroupID)
+		t.process[config.DynEnergyInPkg] = 1500
+		t.node[config.DynEnergyInPkg] = 30000
+		r := t.report([]string{"sleep", "1"}, 0, time.Second)
+
+		var text bytes.Buffer
+		Expect(r.WriteText(&text)).To(Succeed())
+		Expect(text.String()).To(ContainSubstring("'sleep 1'"))
+		Expect(text.String()).To(MatchRegexp(`package\s+1\.500\s+0\.000\s+30\.000`))
+
+		var out bytes.Buffer
+		Expect(r.WriteJSON(&out)).To(Succeed())
+		var decoded Result
+		Expect(json.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded.Command).To(Equal([]string{"sleep", "1"}))
+		Expect(decoded.Process.Dynamic[config.PKG]).To(Equal(1.5))
+		Expect(decoded.Node.Dynamic[config.PKG]).To(Equal(30.0))
+	})
+
+	It("notes in the report that the CPU time was read from procfs", func() {
+		r := newTracker(1).report([]string{"sleep", "1"}, 0, time.Second)
+		var text bytes.Buffer
+		Expect(r.WriteText(&text)).To(Succeed())
+		Expect(text.String()).NotTo(ContainSubstring("procfs"))
+
+		r.Source = bpf.SourceProcfs
+		text.Reset()
+		Expect(r.WriteText(&text)).To(Succeed())
+		Expect(text.String()).To(ContainSubstring("read from procfs"))
+	})
+})
@@ -0,0 +1,143 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package measure
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+	"github.com/sustainable-computing-io/kepler/pkg/collector"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"golang.org/x/sys/unix"
+	"k8s.io/klog/v2"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// Run starts the command in a new cgroup, runs the collector loop every sample period until the
+// command exits and returns the energy attributed to the processes of the cgroup.
+// SIGINT and SIGTERM are forwarded to the command, so an interrupted run is still reported.
+func Run(bpfExporter bpf.Exporter, args []string) (*Result, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command to measure")
+	}
+	cg, err := newCgroup()
+	if err != nil {
+		return nil, err
+	}
+	defer cg.remove()
+
+	c := collector.NewCollector(bpfExporter)
+	if err := c.Initialize(); err != nil {
+		return nil, err
+	}
+	// the first update drains the samples taken before the command started and sets the energy baseline
+	c.Update()
+	t := newTracker(cg.id)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: cg.fd}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", args[0], err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	ticker := time.NewTicker(time.Duration(config.SamplePeriodSec()) * time.Second)
+	defer ticker.Stop()
+	var waitErr error
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			c.Update()
+			t.accumulate(c)
+		case sig := <-signals:
+			_ = cmd.Process.Signal(sig)
+		case waitErr = <-done:
+			break loop
+		}
+	}
+	duration := time.Since(start)
+	// collect the samples of the last, partial, interval
+	c.Update()
+	t.accumulate(c)
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if waitErr != nil {
+		return nil, waitErr
+	}
+	report := t.report(args, exitCode, duration)
+	report.Source = bpfExporter.SupportedMetrics().Source
+	return report, nil
+}
+
+// cgroup is the cgroup v2 directory the measured command runs in, its id is the one recorded by the eBPF programs.
+type cgroup struct {
+	path string
+	fd   int
+	id   uint64
+}
+
+func newCgroup() (*cgroup, error) {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(cgroupRoot, &fs); err != nil || fs.Type != unix.CGROUP2_SUPER_MAGIC {
+		return nil, fmt.Errorf("measuring a command requires the cgroup v2 unified hierarchy mounted at %s", cgroupRoot)
+	}
+	path := filepath.Join(cgroupRoot, fmt.Sprintf("kepler-measure-%d", os.Getpid()))
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the cgroup of the command: %w", err)
+	}
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("failed to open the cgroup of the command: %w", err)
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		_ = unix.Close(fd)
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("failed to get the cgroup id of the command: %w", err)
+	}
+	// on cgroup v2 the cgroup id returned by bpf_get_current_cgroup_id is the inode of the cgroup directory
+	return &cgroup{path: path, fd: fd, id: st.Ino}, nil
+}
+
+func (cg *cgroup) remove() {
+	_ = unix.Close(cg.fd)
+	// the cgroup can only be removed once empty, the command may have left background processes behind
+	if err := os.Remove(cg.path); err != nil {
+		klog.Warningf("failed to remove the cgroup %s, processes started by the command may still be running: %v", cg.path, err)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+// +build !linux
+
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package measure
+
+import (
+	"fmt"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpf"
+)
+
+// Run is only supported on Linux, where the command can be started in its own cgroup.
+func Run(bpfExporter bpf.Exporter, args []string) (*Result, error) {
+	return nil, fmt.Errorf("measuring a command is only supported on Linux")
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/consts"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/metricfactory"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/utils"
 )
 
@@ -58,11 +59,9 @@ func NewContainerCollector(containerMetrics map[string]*stats.ContainerStats, mx
 	return c
 }
 
-// initMetrics creates prometheus metric description for container
+// initMetrics creates prometheus metric description for container.
+// The descriptions are always created since the container metrics exposure can be enabled at runtime.
 func (c *collector) initMetrics() {
-	if !config.IsExposeContainerStatsEnabled() {
-		return
-	}
 	for name, desc := range metricfactory.HCMetricsPromDesc(context, c.bpfSupportedMetrics) {
 		c.descriptions[name] = desc
 		c.collectors[name] = metricfactory.NewPromCounter(desc)
@@ -92,12 +91,15 @@ func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	c.Mx.Lock()
+	pipeline.Lock(c.Mx, "container")
+	defer c.Mx.Unlock()
+	if !config.IsExposeContainerStatsEnabled() {
+		return
+	}
 	for _, container := range c.ContainerStats {
 		utils.CollectEnergyMetrics(ch, container, c.collectors)
 		utils.CollectResUtilizationMetrics(ch, container, c.collectors, c.bpfSupportedMetrics)
 		// update container total joules
 		utils.CollectTotalEnergyMetrics(ch, container, c.collectors)
 	}
-	c.Mx.Unlock()
 }
@@ -21,7 +21,9 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/metricfactory"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/utils"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
@@ -68,6 +70,28 @@ func (c *collector) initMetrics() {
 	})
 	c.descriptions["info"] = desc
 	c.collectors["info"] = metricfactory.NewPromCounter(desc)
+
+	// the time spent handling each softirq vector and the hardirqs, measured by the eBPF programs
+	desc = metricfactory.MetricsPromDesc(context, "irq", "_time_seconds_total", "ebpf", []string{"irq", "instance"})
+	c.descriptions["irq_time"] = desc
+	c.collectors["irq_time"] = metricfactory.NewPromCounter(desc)
+	desc = metricfactory.MetricsPromDesc(context, "irq", "_total", "ebpf", []string{"irq", "instance"})
+	c.descriptions["irq_count"] = desc
+	c.collectors["irq_count"] = metricfactory.NewPromCounter(desc)
+
+	if config.IsCPUStateMetricsEnabled() {
+		// the time spent in each CPU idle state, and the effective frequency of the CPUs while running during the
+		// last interval and the frequency cpufreq set them to
+		desc = metricfactory.MetricsPromDesc(context, "cpu_idle_state", "_seconds_total", "sysfs", []string{"state", "instance"})
+		c.descriptions["cpu_idle_state"] = desc
+		c.collectors["cpu_idle_state"] = metricfactory.NewPromCounter(desc)
+		desc = metricfactory.MetricsPromDesc(context, "cpu_effective_frequency", "_hertz", "msr", []string{"instance"})
+		c.descriptions["cpu_effective_frequency"] = desc
+		c.collectors["cpu_effective_frequency"] = metricfactory.NewPromGauge(desc)
+		desc = metricfactory.MetricsPromDesc(context, "cpu_scaling_frequency", "_hertz", "sysfs", []string{"instance"})
+		c.descriptions["cpu_scaling_frequency"] = desc
+		c.collectors["cpu_scaling_frequency"] = metricfactory.NewPromGauge(desc)
+	}
 }
 
 func (c *collector) Describe(ch chan<- *prometheus.Desc) {
@@ -77,8 +101,25 @@ func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	c.Mx.Lock()
+	pipeline.Lock(c.Mx, "node")
 	utils.CollectEnergyMetrics(ch, c.NodeStats, c.collectors)
+	for irq, stat := range c.NodeStats.IRQTime {
+		ch <- c.collectors["irq_time"].MustMetric(float64(stat.GetAggr())/1e9, irq, c.NodeStats.NodeName())
+	}
+	for irq, stat := range c.NodeStats.IRQCount {
+		ch <- c.collectors["irq_count"].MustMetric(float64(stat.GetAggr()), irq, c.NodeStats.NodeName())
+	}
+	if config.IsCPUStateMetricsEnabled() {
+		for state, stat := range c.NodeStats.ResourceUsage[config.CPUIdleTime] {
+			ch <- c.collectors["cpu_idle_state"].MustMetric(float64(stat.GetAggr())/1000, state, c.NodeStats.NodeName())
+		}
+		if freq := c.NodeStats.CPUFrequency(); freq > 0 {
+			ch <- c.collectors["cpu_effective_frequency"].MustMetric(float64(freq)*1e6, c.NodeStats.NodeName())
+		}
+		if c.NodeStats.ScalingFrequency > 0 {
+			ch <- c.collectors["cpu_scaling_frequency"].MustMetric(float64(c.NodeStats.ScalingFrequency)*1e6, c.NodeStats.NodeName())
+		}
+	}
 	// we export different node resource utilization metrics than process, container and vms
 	// TODO: verify if the resource utilization metrics are needed
 	c.Mx.Unlock()
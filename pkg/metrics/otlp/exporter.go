@@ -0,0 +1,272 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package otlp pushes the Kepler energy metrics to an OpenTelemetry collector using OTLP.
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/build"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/consts"
+	"github.com/sustainable-computing-io/kepler/pkg/model/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"google.golang.org/grpc/credentials"
+	"k8s.io/klog/v2"
+)
+
+const (
+	meterName = "github.com/sustainable-computing-io/kepler"
+
+	// attribute keys without an OpenTelemetry semantic convention
+	componentKey = attribute.Key("kepler.component")
+	modeKey      = attribute.Key("kepler.mode")
+	packageKey   = attribute.Key("kepler.package")
+	vmIDKey      = attribute.Key("kepler.vm.id")
+)
+
+// Stats holds the collector structures the exporter reads from, they are shared with the Prometheus exporter.
+type Stats struct {
+	NodeStats      *stats.NodeStats
+	ContainerStats map[string]*stats.ContainerStats
+	ProcessStats   map[uint64]*stats.ProcessStats
+	VMStats        map[string]*stats.VMStats
+
+	// Lock to synchronize the collector update with the exporter
+	Mx *sync.Mutex
+}
+
+// Exporter periodically pushes the energy counters as OTLP cumulative sums.
+type Exporter struct {
+	provider *sdkmetric.MeterProvider
+	stats    Stats
+
+	nodeEnergy      metric.Float64ObservableCounter
+	containerEnergy metric.Float64ObservableCounter
+	processEnergy   metric.Float64ObservableCounter
+	vmEnergy        metric.Float64ObservableCounter
+}
+
+// NewExporter creates an exporter pushing to the endpoint of cfg every export interval.
+func NewExporter(ctx context.Context, cfg *config.OTLPConfig, s Stats) (*Exporter, error) {
+	exporter, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("kepler"),
+		semconv.ServiceVersion(build.Version),
+		semconv.HostName(s.NodeStats.NodeName()),
+		semconv.HostArchKey.String(s.NodeStats.CPUArchitecture()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OTLP resource: %w", err)
+	}
+	e := &Exporter{
+		stats: s,
+		provider: sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter,
+				sdkmetric.WithInterval(time.Duration(cfg.ExportIntervalSec)*time.Second))),
+		),
+	}
+	if err := e.initMetrics(); err != nil {
+		_ = e.provider.Shutdown(ctx)
+		return nil, err
+	}
+	klog.Infof("pushing OTLP metrics to %s every %ds", cfg.Endpoint, cfg.ExportIntervalSec)
+	return e, nil
+}
+
+func newMetricExporter(ctx context.Context, cfg *config.OTLPConfig) (sdkmetric.Exporter, error) {
+	var tlsConfig *tls.Config
+	if !cfg.Insecure && (cfg.CAFile != "" || cfg.CertFile != "") {
+		var err error
+		if tlsConfig, err = newTLSConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+	// a full URL also sets the scheme and path, otherwise the endpoint is a host:port
+	isURL := strings.Contains(cfg.Endpoint, "://")
+
+	switch cfg.Protocol {
+	case config.OTLPProtocolGRPC:
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithHeaders(cfg.Headers)}
+		if isURL {
+			opts = append(opts, otlpmetricgrpc.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		} else if tlsConfig != nil {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	case config.OTLPProtocolHTTP:
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithHeaders(cfg.Headers)}
+		if isURL {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		} else if tlsConfig != nil {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q", cfg.Protocol)
+	}
+}
+
+func newTLSConfig(cfg *config.OTLPConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the OTLP CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the OTLP CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the OTLP client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// initMetrics creates the OpenTelemetry instruments, which are observed on every export.
+func (e *Exporter) initMetrics() error {
+	meter := e.provider.Meter(meterName, metric.WithInstrumentationVersion(build.Version))
+	var err error
+	if e.nodeEnergy, err = newEnergyCounter(meter, "node", "Energy consumed by the node components"); err != nil {
+		return err
+	}
+	if e.containerEnergy, err = newEnergyCounter(meter, "container", "Energy consumed by the containers"); err != nil {
+		return err
+	}
+	if e.processEnergy, err = newEnergyCounter(meter, "process", "Energy consumed by the processes"); err != nil {
+		return err
+	}
+	if e.vmEnergy, err = newEnergyCounter(meter, "vm", "Energy consumed by the virtual machines"); err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(e.observe, e.nodeEnergy, e.containerEnergy, e.processEnergy, e.vmEnergy)
+	return err
+}
+
+func newEnergyCounter(meter metric.Meter, level, description string) (metric.Float64ObservableCounter, error) {
+	return meter.Float64ObservableCounter(
+		fmt.Sprintf("%s.%s.energy", consts.MetricsNamespace, level),
+		metric.WithUnit("J"),
+		metric.WithDescription(description),
+	)
+}
+
+// observe reads the counters under the collector lock, so an export never sees a partially updated collection.
+func (e *Exporter) observe(_ context.Context, o metric.Observer) error {
+	e.stats.Mx.Lock()
+	defer e.stats.Mx.Unlock()
+	if !config.IsExposeComponentPowerEnabled() {
+		return nil
+	}
+
+	for i, component := range consts.EnergyMetricNames {
+		if component == config.GPU && !config.IsGPUEnabled() {
+			continue
+		}
+		e.observeComponent(o, component, consts.DynEnergyMetricNames[i], "dynamic")
+		if config.IsIdlePowerEnabled() {
+			e.observeComponent(o, component, consts.IdleEnergyMetricNames[i], "idle")
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) observeComponent(o metric.Observer, component, metricName, mode string) {
+	common := []attribute.KeyValue{componentKey.String(component), modeKey.String(mode)}
+
+	for deviceID, energy := range e.stats.NodeStats.EnergyUsage[metricName] {
+		o.ObserveFloat64(e.nodeEnergy, toJoules(energy.GetAggr()),
+			metric.WithAttributes(append(common, packageKey.String(deviceID))...))
+	}
+	if config.IsExposeContainerStatsEnabled() {
+		for _, c := range e.stats.ContainerStats {
+			o.ObserveFloat64(e.containerEnergy, toJoules(c.EnergyUsage[metricName].SumAllAggrValues()),
+				metric.WithAttributes(append(common,
+					semconv.ContainerID(c.ContainerID),
+					semconv.K8SContainerName(c.ContainerName),
+					semconv.K8SPodName(c.PodName),
+					semconv.K8SNamespaceName(c.Namespace),
+				)...))
+		}
+	}
+	if config.IsExposeProcessStatsEnabled() {
+		for _, p := range e.stats.ProcessStats {
+			o.ObserveFloat64(e.processEnergy, toJoules(p.EnergyUsage[metricName].SumAllAggrValues()),
+				metric.WithAttributes(append(common,
+					semconv.ProcessPID(int(p.PID)),
+					semconv.ProcessCommand(p.Command),
+					semconv.ContainerID(p.ContainerID),
+					vmIDKey.String(p.VMID),
+				)...))
+		}
+	}
+	if config.IsExposeVMStatsEnabled() {
+		for _, vm := range e.stats.VMStats {
+			o.ObserveFloat64(e.vmEnergy, toJoules(vm.EnergyUsage[metricName].SumAllAggrValues()),
+				metric.WithAttributes(append(common, vmIDKey.String(vm.VMID), semconv.ProcessPID(int(vm.PID)))...))
+		}
+	}
+}
+
+func toJoules(millijoules uint64) float64 {
+	return float64(millijoules) / utils.JouleMillijouleConversionFactor
+}
+
+// ForceFlush pushes the current values immediately.
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	return e.provider.ForceFlush(ctx)
+}
+
+// Shutdown pushes the last values and stops the periodic export.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.provider.Shutdown(ctx)
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// receiver is an in-process OTLP receiver recording the exported requests and headers.
+type receiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mx       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+	headers  []map[string]string
+}
+
+func (r *receiver) record(req *collectormetrics.ExportMetricsServiceRequest, headers map[string]string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.requests = append(r.requests, req)
+	r.headers = append(r.headers, headers)
+}
+
+func (r *receiver) Export(ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	headers := map[string]string{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		headers[k] = v[0]
+	}
+	r.record(req, headers)
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exportReq := &collectormetrics.ExportMetricsServiceRequest{}
+	if err := proto.Unmarshal(body, exportReq); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	headers := map[string]string{}
+	for k := range req.Header {
+		headers[http.CanonicalHeaderKey(k)] = req.Header.Get(k)
+	}
+	r.record(exportReq, headers)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	resp, _ := proto.Marshal(&collectormetrics.ExportMetricsServiceResponse{})
+	_, _ = w.Write(resp)
+}
+
+// lastMetrics returns the metrics of the last export by name.
+func (r *receiver) lastMetrics() (map[string]*metricspb.Metric, []*commonpb.KeyValue) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	Expect(r.requests).NotTo(BeEmpty())
+	rm := r.requests[len(r.requests)-1].ResourceMetrics
+	Expect(rm).To(HaveLen(1))
+	metrics := map[string]*metricspb.Metric{}
+	for _, sm := range rm[0].ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics, rm[0].Resource.Attributes
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range kvs {
+		if v, ok := kv.Value.Value.(*commonpb.AnyValue_StringValue); ok {
+			attrs[kv.Key] = v.StringValue
+		}
+	}
+	return attrs
+}
+
+func newMockStats() Stats {
+	nodeStats := stats.CreateMockedNodeStats()
+	container := stats.NewContainerStats("app", "pod1", "ns1", "container1")
+	container.EnergyUsage[config.DynEnergyInPkg].SetAggrStat(stats.MockedSocketID, 15000)
+	return Stats{
+		NodeStats:      &nodeStats,
+		ContainerStats: map[string]*stats.ContainerStats{"container1": container},
+		ProcessStats:   map[uint64]*stats.ProcessStats{},
+		VMStats:        map[string]*stats.VMStats{},
+		Mx:             &sync.Mutex{},
+	}
+}
+
+func expectEnergyMetrics(r *receiver) {
+	metrics, resourceAttrs := r.lastMetrics()
+	Expect(attributes(resourceAttrs)).To(HaveKeyWithValue("service.name", "kepler"))
+	Expect(attributes(resourceAttrs)).To(HaveKey("host.name"))
+
+	Expect(metrics).To(HaveKey("kepler.node.energy"))
+	Expect(metrics).To(HaveKey("kepler.container.energy"))
+	sum := metrics["kepler.container.energy"].GetSum()
+	Expect(sum).NotTo(BeNil())
+	Expect(sum.IsMonotonic).To(BeTrue())
+	Expect(sum.AggregationTemporality).To(Equal(metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE))
+	Expect(metrics["kepler.container.energy"].Unit).To(Equal("J"))
+
+	found := false
+	for _, dp := range sum.DataPoints {
+		attrs := attributes(dp.Attributes)
+		if attrs["kepler.component"] == config.PKG && attrs["kepler.mode"] == "dynamic" {
+			found = true
+			Expect(attrs).To(HaveKeyWithValue("k8s.pod.name", "pod1"))
+			Expect(attrs).To(HaveKeyWithValue("k8s.namespace.name", "ns1"))
+			Expect(attrs).To(HaveKeyWithValue("k8s.container.name", "app"))
+			Expect(attrs).To(HaveKeyWithValue("container.id", "container1"))
+			Expect(dp.GetAsDouble()).To(Equal(15.0))
+		}
+	}
+	Expect(found).To(BeTrue())
+}
+
+var _ = Describe("Test OTLP exporter", func() {
+	var r *receiver
+
+	BeforeEach(func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		r = &receiver{}
+	})
+
+	It("pushes the energy counters over gRPC", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		srv := grpc.NewServer()
+		collectormetrics.RegisterMetricsServiceServer(srv, r)
+		go func() { _ = srv.Serve(lis) }()
+		defer srv.Stop()
+
+		e, err := NewExporter(context.Background(), &config.OTLPConfig{
+			Endpoint:          lis.Addr().String(),
+			Protocol:          config.OTLPProtocolGRPC,
+			Headers:           map[string]string{"x-tenant": "edge"},
+			ExportIntervalSec: 3600,
+			Insecure:          true,
+		}, newMockStats())
+		Expect(err).NotTo(HaveOccurred())
+		defer e.Shutdown(context.Background())
+
+		Expect(e.ForceFlush(context.Background())).To(Succeed())
+		expectEnergyMetrics(r)
+		Expect(r.headers[0]).To(HaveKeyWithValue("x-tenant", "edge"))
+	})
+
+	It("pushes the energy counters over HTTP", func() {
+		srv := httptest.NewServer(r)
+		defer srv.Close()
+
+		e, err := NewExporter(context.Background(), &config.OTLPConfig{
+			Endpoint:          srv.URL + "/v1/metrics",
+			Protocol:          config.OTLPProtocolHTTP,
+			Headers:           map[string]string{"X-Tenant": "edge"},
+			ExportIntervalSec: 3600,
+		}, newMockStats())
+		Expect(err).NotTo(HaveOccurred())
+		defer e.Shutdown(context.Background())
+
+		Expect(e.ForceFlush(context.Background())).To(Succeed())
+		expectEnergyMetrics(r)
+		Expect(r.headers[0]).To(HaveKeyWithValue("X-Tenant", "edge"))
+	})
+
+	It("rejects an unknown protocol", func() {
+		_, err := NewExporter(context.Background(), &config.OTLPConfig{
+			Endpoint:          "localhost:4317",
+			Protocol:          "udp",
+			ExportIntervalSec: 30,
+		}, newMockStats())
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,221 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pipeline holds the metrics Kepler exposes about itself, to alert when the collection pipeline misbehaves.
+// It only depends on the Prometheus client so that every stage of the pipeline can record its metrics.
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kepler_exporter"
+
+// Labels of the model estimation errors
+const (
+	ModelNodeComponents    = "node_components"
+	ModelNodePlatform      = "node_platform"
+	ModelProcessComponents = "process_components"
+	ModelProcessGPU        = "process_gpu"
+	ModelProcessPlatform   = "process_platform"
+)
+
+// Labels of the reasons the entries of an eBPF map are lost
+const (
+	MapLossEvicted          = "evicted"
+	MapLossInsertFailed     = "insert_failed"
+	MapLossMissingStartTime = "missing_start_time"
+)
+
+// Labels of the model refresh status
+const (
+	ModelRefreshUpdated   = "updated"
+	ModelRefreshUnchanged = "unchanged"
+	ModelRefreshFailed    = "failed"
+)
+
+// Labels of the resolution failures
+const (
+	ResolutionContainer = "container"
+	ResolutionVM        = "vm"
+)
+
+var (
+	// CollectionDuration is the duration of Collector.Update
+	CollectionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "collection_duration_seconds",
+		Help:      "Duration of a collection of the resource usage and energy metrics.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+	// CollectionOverruns counts the collections that took longer than the sample period
+	CollectionOverruns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "collection_overruns_total",
+		Help:      "Number of collections that took longer than the sample period.",
+	})
+	// BPFProcessSamples is the number of samples read from the eBPF processes map in the last collection
+	BPFProcessSamples = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bpf_process_samples",
+		Help:      "Number of process samples read from the eBPF processes map in the last collection.",
+	})
+	// BPFProcessesMapFillRatio is the ratio of the eBPF processes map entries in use when it was last read
+	BPFProcessesMapFillRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bpf_processes_map_fill_ratio",
+		Help:      "Ratio of the eBPF processes map entries in use when it was last read, samples are lost once it reaches 1.",
+	})
+	// BPFMapFillRatio is the ratio of the entries of an eBPF map in use when it was last read
+	BPFMapFillRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bpf_map_fill_ratio",
+		Help:      "Ratio of the entries of an eBPF map in use when it was last read, entries are lost once it reaches 1.",
+	}, []string{"map"})
+	// BPFMapLostEntries counts the entries of the eBPF maps lost before they were read
+	BPFMapLostEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bpf_map_lost_entries_total",
+		Help:      "Number of entries of an eBPF map lost before they were read, the resource usage they counted is not reported.",
+	}, []string{"map", "reason"})
+	// ResolutionFailures counts the failures to resolve the container or VM of a process
+	ResolutionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resolution_failures_total",
+		Help:      "Number of failures to resolve the container or virtual machine of a process.",
+	}, []string{"target"})
+	// PowerSourceReadErrors counts the failed reads of a power source
+	PowerSourceReadErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "power_source_read_errors_total",
+		Help:      "Number of failed reads of a power source.",
+	}, []string{"source"})
+	// PowerSourceReadDuration is the latency of the power source reads
+	PowerSourceReadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "power_source_read_duration_seconds",
+		Help:      "Duration of the reads of a power source.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+	}, []string{"source"})
+	// ModelEstimationErrors counts the failed power estimations of a model
+	ModelEstimationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_estimation_errors_total",
+		Help:      "Number of failed power estimations.",
+	}, []string{"model"})
+	// ModelInfo is 1 for the name of the model whose weights a power model uses
+	ModelInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "model_info",
+		Help:      "Name of the model whose weights a power model uses, the value is always 1.",
+	}, []string{"model", "model_name"})
+	// ModelRefreshes counts the refreshes of the model weights by status
+	ModelRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_refreshes_total",
+		Help:      "Number of refreshes of the model weights, by whether the weights were updated, unchanged or could not be refreshed.",
+	}, []string{"model", "status"})
+	// ModelLastRefreshSuccess is 1 if the last refresh of the model weights succeeded
+	ModelLastRefreshSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "model_last_refresh_success",
+		Help:      "Whether the last refresh of the model weights succeeded.",
+	}, []string{"model"})
+	// ModelLastRefreshTimestamp is the time of the last refresh of the model weights
+	ModelLastRefreshTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "model_last_refresh_timestamp_seconds",
+		Help:      "Unix time of the last refresh of the model weights.",
+	}, []string{"model"})
+	// ProcessUsageSource is 1 for the source the resource usage of the processes is read from
+	ProcessUsageSource = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "process_usage_source_info",
+		Help:      "Source the resource usage of the processes is read from, ebpf or procfs if the eBPF programs could not be loaded, the value is always 1.",
+	}, []string{"source"})
+	// CollectLockWait is the time the Prometheus collectors wait for the lock shared with the collection
+	CollectLockWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "collect_lock_wait_seconds",
+		Help:      "Time a Prometheus collector waited for the lock held while the metrics are collected.",
+		Buckets:   []float64{.0001, .001, .01, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"collector"})
+)
+
+// Collectors returns the pipeline metrics to register.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		CollectionDuration,
+		CollectionOverruns,
+		BPFProcessSamples,
+		BPFProcessesMapFillRatio,
+		BPFMapFillRatio,
+		BPFMapLostEntries,
+		ResolutionFailures,
+		PowerSourceReadErrors,
+		PowerSourceReadDuration,
+		ModelEstimationErrors,
+		ModelInfo,
+		ModelRefreshes,
+		ModelLastRefreshSuccess,
+		ModelLastRefreshTimestamp,
+		ProcessUsageSource,
+		CollectLockWait,
+	}
+}
+
+// ObserveCollection records the duration of a collection, and an overrun if it exceeded the sample period.
+func ObserveCollection(duration, samplePeriod time.Duration) {
+	CollectionDuration.Observe(duration.Seconds())
+	if duration > samplePeriod {
+		CollectionOverruns.Inc()
+	}
+}
+
+// ObservePowerSourceRead records the latency of a power source read and whether it failed.
+func ObservePowerSourceRead(source string, start time.Time, failed bool) {
+	PowerSourceReadDuration.WithLabelValues(source).Observe(time.Since(start).Seconds())
+	if failed {
+		PowerSourceReadErrors.WithLabelValues(source).Inc()
+	}
+}
+
+// ObserveModelRefresh records the status of a refresh of the model weights.
+func ObserveModelRefresh(model, status string) {
+	ModelRefreshes.WithLabelValues(model, status).Inc()
+	ModelLastRefreshTimestamp.WithLabelValues(model).SetToCurrentTime()
+	if status == ModelRefreshFailed {
+		ModelLastRefreshSuccess.WithLabelValues(model).Set(0)
+	} else {
+		ModelLastRefreshSuccess.WithLabelValues(model).Set(1)
+	}
+}
+
+// SetProcessUsageSource records the source the resource usage of the processes is read from.
+func SetProcessUsageSource(source string) {
+	ProcessUsageSource.Reset()
+	ProcessUsageSource.WithLabelValues(source).Set(1)
+}
+
+// Lock acquires mx and records the time the collector waited for it.
+func Lock(mx *sync.Mutex, collector string) {
+	start := time.Now()
+	mx.Lock()
+	CollectLockWait.WithLabelValues(collector).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func write(m prometheus.Metric) *dto.Metric {
+	out := &dto.Metric{}
+	Expect(m.Write(out)).To(Succeed())
+	return out
+}
+
+var _ = Describe("Test pipeline metrics", func() {
+	It("registers all the metrics", func() {
+		r := prometheus.NewRegistry()
+		Expect(func() { r.MustRegister(Collectors()...) }).NotTo(Panic())
+	})
+
+	It("counts the collections exceeding the sample period", func() {
+		before := write(CollectionOverruns).GetCounter().GetValue()
+		ObserveCollection(time.Second, 3*time.Second)
+		Expect(write(CollectionOverruns).GetCounter().GetValue()).To(Equal(before))
+		ObserveCollection(4*time.Second, 3*time.Second)
+		Expect(write(CollectionOverruns).GetCounter().GetValue()).To(Equal(before + 1))
+	})
+
+	It("records the power source reads per source", func() {
+		ObservePowerSourceRead("rapl-sysfs", time.Now(), false)
+		ObservePowerSourceRead("redfish", time.Now(), true)
+		Expect(write(PowerSourceReadErrors.WithLabelValues("redfish")).GetCounter().GetValue()).To(Equal(1.0))
+		Expect(write(PowerSourceReadErrors.WithLabelValues("rapl-sysfs")).GetCounter().GetValue()).To(Equal(0.0))
+		latency := PowerSourceReadDuration.WithLabelValues("rapl-sysfs").(prometheus.Metric)
+		Expect(write(latency).GetHistogram().GetSampleCount()).To(Equal(uint64(1)))
+	})
+
+	It("records the status of the last model refresh", func() {
+		ObserveModelRefresh(ModelNodePlatform, ModelRefreshUpdated)
+		Expect(write(ModelLastRefreshSuccess.WithLabelValues(ModelNodePlatform)).GetGauge().GetValue()).To(Equal(1.0))
+		ObserveModelRefresh(ModelNodePlatform, ModelRefreshFailed)
+		Expect(write(ModelLastRefreshSuccess.WithLabelValues(ModelNodePlatform)).GetGauge().GetValue()).To(Equal(0.0))
+		Expect(write(ModelRefreshes.WithLabelValues(ModelNodePlatform, ModelRefreshFailed)).GetCounter().GetValue()).To(Equal(1.0))
+		Expect(write(ModelLastRefreshTimestamp.WithLabelValues(ModelNodePlatform)).GetGauge().GetValue()).To(BeNumerically(">", 0))
+	})
+
+	It("records the source of the process resource usage", func() {
+		SetProcessUsageSource("ebpf")
+		SetProcessUsageSource("procfs")
+		r := prometheus.NewRegistry()
+		r.MustRegister(ProcessUsageSource)
+		families, err := r.Gather()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(families).To(HaveLen(1))
+		Expect(families[0].GetMetric()).To(HaveLen(1))
+		Expect(families[0].GetMetric()[0].GetLabel()[0].GetValue()).To(Equal("procfs"))
+		Expect(families[0].GetMetric()[0].GetGauge().GetValue()).To(Equal(1.0))
+	})
+
+	It("records the time waited for the collection lock", func() {
+		var mx sync.Mutex
+		mx.Lock()
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			mx.Unlock()
+		}()
+		Lock(&mx, "node")
+		mx.Unlock()
+		wait := write(CollectLockWait.WithLabelValues("node").(prometheus.Metric)).GetHistogram()
+		Expect(wait.GetSampleCount()).To(Equal(uint64(1)))
+		Expect(wait.GetSampleSum()).To(BeNumerically(">=", 0.02))
+	})
+})
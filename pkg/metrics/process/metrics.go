@@ -25,6 +25,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/consts"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/metricfactory"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/utils"
 )
 
@@ -91,7 +92,7 @@ func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	c.Mx.Lock()
+	pipeline.Lock(c.Mx, "process")
 	for _, process := range c.ProcessStats {
 		utils.CollectEnergyMetrics(ch, process, c.collectors)
 		utils.CollectResUtilizationMetrics(ch, process, c.collectors, c.bpfSupportedMetrics)
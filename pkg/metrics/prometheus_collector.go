@@ -25,6 +25,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/container"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/node"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/process"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/virtualmachine"
 	"k8s.io/klog/v2"
@@ -90,10 +91,9 @@ func (e *PrometheusExporter) RegisterMetrics() *prometheus.Registry {
 		klog.Infoln("Registered Process Prometheus metrics")
 	}
 
-	if config.IsExposeContainerStatsEnabled() {
-		r.MustRegister(e.ContainerStatsCollector)
-		klog.Infoln("Registered Container Prometheus metrics")
-	}
+	// the container collector is always registered since its exposure can be toggled at runtime
+	r.MustRegister(e.ContainerStatsCollector)
+	klog.Infoln("Registered Container Prometheus metrics")
 
 	if config.IsExposeVMStatsEnabled() {
 		r.MustRegister(e.VMStatsCollector)
@@ -103,6 +103,8 @@ func (e *PrometheusExporter) RegisterMetrics() *prometheus.Registry {
 	r.MustRegister(e.NodeStatsCollector)
 	klog.Infoln("Registered Node Prometheus metrics")
 
+	r.MustRegister(pipeline.Collectors()...)
+
 	// log prometheus errors
 	_, err := r.Gather()
 	if err != nil {
@@ -24,6 +24,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/metricfactory"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/metrics/utils"
 )
 
@@ -83,7 +84,7 @@ func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
-	c.Mx.Lock()
+	pipeline.Lock(c.Mx, "vm")
 	for _, vm := range c.VMStats {
 		utils.CollectEnergyMetrics(ch, vm, c.collectors)
 		utils.CollectResUtilizationMetrics(ch, vm, c.collectors, c.bpfSupportedMetrics)
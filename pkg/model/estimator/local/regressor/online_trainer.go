@@ -0,0 +1,261 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+online_trainer.go
+train linear (node) component and total power models from the resource utilization and the measured power.
+The trained weights use the linear regression format, so they can be loaded by the Regressor on machines of the same type.
+*/
+
+package regressor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+// ridgePenalty is the L2 penalty of the weights of the normalized features, relative to the number of samples.
+// It keeps the fit stable when features are correlated, e.g. the CPU time and the CPU instructions.
+const ridgePenalty = 1e-3
+
+// ErrNotEnoughSamples is returned by Train until MinSamples samples were added
+var ErrNotEnoughSamples = errors.New("not enough samples")
+
+// OnlineTrainer fits a linear power model per component with a ridge regression updated with each sample.
+// Only the sums of the products of the samples are kept, so the memory and the cost of a fit do not depend on
+// the number of samples. The weights are constrained to be non-negative, since the power does not decrease
+// with the resource utilization, and the bias weight is the idle power.
+type OnlineTrainer struct {
+	ModelName                   string
+	FloatFeatureNames           []string
+	SystemMetaDataFeatureNames  []string
+	SystemMetaDataFeatureValues []string
+	// Components are the components whose power is fitted, e.g. config.PKG or config.PLATFORM
+	Components []string
+	// MinSamples is the number of samples required to fit the models
+	MinSamples  int
+	MachineSpec *config.MachineSpec
+
+	mx      sync.Mutex
+	samples int
+	// xtx is the sum of the outer products of the features with an intercept, the intercept being the last one
+	xtx [][]float64
+	// xty is the sum of the features with an intercept weighted by the power of each component
+	xty map[string][]float64
+	// powerSum is the sum of the power of each component
+	powerSum map[string]float64
+	weights  *ComponentModelWeights
+}
+
+// AddSample adds the node resource utilization x and the power in Watts measured for each component.
+// The samples with a wrong number of features or invalid values are ignored.
+func (t *OnlineTrainer) AddSample(x []float64, power map[string]float64) {
+	if len(x) != len(t.FloatFeatureNames) {
+		return
+	}
+	for _, v := range x {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+	}
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	n := len(x) + 1
+	if t.xtx == nil {
+		t.xtx = make([][]float64, n)
+		for i := range t.xtx {
+			t.xtx[i] = make([]float64, n)
+		}
+		t.xty = map[string][]float64{}
+		t.powerSum = map[string]float64{}
+		for _, comp := range t.Components {
+			t.xty[comp] = make([]float64, n)
+		}
+	}
+	xi := append(append(make([]float64, 0, n), x...), 1)
+	for i := range xi {
+		for j := range xi {
+			t.xtx[i][j] += xi[i] * xi[j]
+		}
+	}
+	for _, comp := range t.Components {
+		y := power[comp]
+		for i := range xi {
+			t.xty[comp][i] += xi[i] * y
+		}
+		t.powerSum[comp] += y
+	}
+	t.samples++
+}
+
+// Samples returns the number of samples added so far
+func (t *OnlineTrainer) Samples() int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.samples
+}
+
+// Train fits the model of each component with the samples added so far. The components whose power was
+// always 0, e.g. the uncore on processors not reporting it, have no model.
+func (t *OnlineTrainer) Train() error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.samples < t.MinSamples || t.samples == 0 {
+		return fmt.Errorf("%w to train %s: %d of %d", ErrNotEnoughSamples, t.ModelName, t.samples, t.MinSamples)
+	}
+	weights := &ComponentModelWeights{ModelName: t.ModelName, ModelMachineSpec: t.MachineSpec}
+	for _, comp := range t.Components {
+		if t.powerSum[comp] == 0 {
+			continue
+		}
+		w, err := t.fit(comp)
+		if err != nil {
+			return fmt.Errorf("failed to train the %s model of %s: %w", comp, t.ModelName, err)
+		}
+		switch comp {
+		case config.PLATFORM:
+			weights.Platform = w
+		case config.PKG:
+			weights.Package = w
+		case config.CORE:
+			weights.Core = w
+		case config.UNCORE:
+			weights.Uncore = w
+		case config.DRAM:
+			weights.DRAM = w
+		}
+	}
+	t.weights = weights
+	return nil
+}
+
+// Weights returns the weights of the last fit, nil if the models were not trained yet
+func (t *OnlineTrainer) Weights() *ComponentModelWeights {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.weights
+}
+
+// fit solves the ridge regression of the component on the features normalized by their root mean square.
+// The coefficients are fitted again without the most negative one until none is negative.
+func (t *OnlineTrainer) fit(comp string) (*ModelWeights, error) {
+	numFeatures := len(t.FloatFeatureNames)
+	samples := float64(t.samples)
+	scales := make([]float64, numFeatures+1)
+	active := make([]int, 0, numFeatures+1)
+	for i := 0; i < numFeatures; i++ {
+		if t.xtx[i][i] > 0 {
+			scales[i] = math.Sqrt(t.xtx[i][i] / samples)
+			active = append(active, i)
+		}
+	}
+	// the intercept is not normalized nor penalized
+	scales[numFeatures] = 1
+	active = append(active, numFeatures)
+
+	coeffs := make([]float64, numFeatures+1)
+	for len(active) > 0 {
+		a := make([][]float64, len(active))
+		b := make([]float64, len(active))
+		for i, fi := range active {
+			a[i] = make([]float64, len(active))
+			for j, fj := range active {
+				a[i][j] = t.xtx[fi][fj] / (scales[fi] * scales[fj])
+			}
+			if fi != numFeatures {
+				a[i][i] += ridgePenalty * samples
+			}
+			b[i] = t.xty[comp][fi] / scales[fi]
+		}
+		solution, err := solveLinearSystem(a, b)
+		if err != nil {
+			return nil, err
+		}
+		negative := -1
+		for i, v := range solution {
+			if v < 0 && (negative < 0 || v < solution[negative]) {
+				negative = i
+			}
+		}
+		if negative < 0 {
+			for i, fi := range active {
+				coeffs[fi] = solution[i]
+			}
+			break
+		}
+		active = append(active[:negative], active[negative+1:]...)
+	}
+
+	weights := &ModelWeights{AllWeights: AllWeights{
+		NumericalVariables: map[string]NormalizedNumericalFeature{},
+		BiasWeight:         coeffs[numFeatures],
+	}}
+	for i, name := range t.FloatFeatureNames {
+		scale := scales[i]
+		if scale == 0 {
+			scale = 1
+		}
+		weights.NumericalVariables[name] = NormalizedNumericalFeature{Scale: scale, Weight: coeffs[i]}
+	}
+	// the categorical variables record the machine type the model was trained on, the bias weight holds the idle power
+	if len(t.SystemMetaDataFeatureNames) > 0 {
+		weights.CategoricalVariables = map[string]map[string]CategoricalFeature{}
+		for i, name := range t.SystemMetaDataFeatureNames {
+			if i < len(t.SystemMetaDataFeatureValues) {
+				weights.CategoricalVariables[name] = map[string]CategoricalFeature{t.SystemMetaDataFeatureValues[i]: {}}
+			}
+		}
+	}
+	return weights, nil
+}
+
+// solveLinearSystem solves a x = b by Gaussian elimination with partial pivoting, a and b are modified
+func solveLinearSystem(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("singular system")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+			b[row] -= factor * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, nil
+}
@@ -0,0 +1,80 @@
+package regressor
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+)
+
+var _ = Describe("Test Online Trainer", func() {
+	features := []string{config.CPUTime, config.CPUInstruction}
+
+	newTrainer := func(components ...string) *OnlineTrainer {
+		return &OnlineTrainer{
+			ModelName:                   types.OnlineRidgeTrainer + "_node-1",
+			FloatFeatureNames:           features,
+			SystemMetaDataFeatureNames:  []string{"cpu_architecture"},
+			SystemMetaDataFeatureValues: []string{"Sky Lake"},
+			Components:                  components,
+			MinSamples:                  10,
+		}
+	}
+
+	predict := func(w *ModelWeights, x []float64) float64 {
+		predictor, err := NewLinearPredictor(*w)
+		Expect(err).NotTo(HaveOccurred())
+		return predictor.predict(features, [][]float64{x}, []string{"cpu_architecture"}, []string{"Sky Lake"})[0]
+	}
+
+	It("fits the power of each measured component", func() {
+		trainer := newTrainer(config.PKG, config.UNCORE, config.DRAM)
+		Expect(trainer.Train()).To(MatchError(ErrNotEnoughSamples))
+		for i := 0; i < 50; i++ {
+			cpuTime := float64(i%10) * 100
+			instructions := float64((i*7)%13) * 1e8
+			trainer.AddSample([]float64{cpuTime, instructions}, map[string]float64{
+				config.PKG:  20 + 0.05*cpuTime + 2e-8*instructions,
+				config.DRAM: 5 + 0.01*cpuTime,
+			})
+		}
+		// invalid samples are ignored
+		trainer.AddSample([]float64{1}, map[string]float64{config.PKG: 100})
+		Expect(trainer.Samples()).To(Equal(50))
+
+		Expect(trainer.Train()).To(Succeed())
+		weights := trainer.Weights()
+		Expect(weights.Trainer()).To(Equal(types.OnlineRidgeTrainer))
+		Expect(weights.Uncore).To(BeNil())
+		Expect(weights.Package.BiasWeight).To(BeNumerically("~", 20, 0.5))
+		Expect(predict(weights.Package, []float64{500, 6e8})).To(BeNumerically("~", 20+25+12, 0.5))
+		Expect(predict(weights.DRAM, []float64{900, 0})).To(BeNumerically("~", 14, 0.2))
+
+		// the weights can be loaded as the initial model weights
+		data, err := json.Marshal(weights)
+		Expect(err).NotTo(HaveOccurred())
+		var loaded ComponentModelWeights
+		Expect(json.Unmarshal(data, &loaded)).To(Succeed())
+		Expect(loaded.Package.CategoricalVariables).To(HaveKey("cpu_architecture"))
+		Expect(predict(loaded.Package, []float64{0, 0})).To(BeNumerically("~", weights.Package.BiasWeight))
+	})
+
+	It("does not fit negative weights", func() {
+		trainer := newTrainer(config.PLATFORM)
+		for i := 0; i < 50; i++ {
+			cpuTime := float64(i%10) * 100
+			instructions := float64((i*7)%13) * 1e8
+			trainer.AddSample([]float64{cpuTime, instructions}, map[string]float64{
+				config.PLATFORM: 100 + 0.1*cpuTime - 1e-8*instructions,
+			})
+		}
+		Expect(trainer.Train()).To(Succeed())
+		weights := trainer.Weights().Platform
+		Expect(weights.NumericalVariables[config.CPUInstruction].Weight).To(BeZero())
+		Expect(weights.NumericalVariables[config.CPUTime].Weight).To(BeNumerically(">", 0))
+		Expect(weights.BiasWeight).To(BeNumerically(">", 0))
+	})
+})
@@ -19,9 +19,13 @@ package regressor
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 
@@ -71,83 +75,144 @@ type Regressor struct {
 	// xidx represents the instance slide window position, where an instance can be process/process/pod/node
 	xidx int
 
-	enabled               bool
-	modelWeight           *ComponentModelWeights
-	coreRatio             float64
-	modelPredictors       map[string]Predictor
+	enabled bool
+	// model holds the weights in use and their predictors, it is replaced as a whole when the weights are refreshed
+	model                 *loadedModel
 	RequestMachineSpec    *config.MachineSpec
 	DiscoveredMachineSpec *config.MachineSpec
 }
 
+// weightSource is where the model weights were obtained, in the order the sources are tried
+type weightSource int
+
+const (
+	modelServerSource weightSource = iota
+	initModelURLSource
+	initModelFileSource
+)
+
+// errWeightNotModified is returned when the initial model URL reports that the weights did not change
+var errWeightNotModified = errors.New("model weights not modified")
+
+// loadedModel is a set of model weights with the predictors created from them
+type loadedModel struct {
+	weight      *ComponentModelWeights
+	trainerName string
+	coreRatio   float64
+	predictors  map[string]Predictor
+	source      weightSource
+	// version is the hash of the weights, etag the ETag of the initial model URL response if any
+	version string
+	etag    string
+}
+
+func weightVersion(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
 // Start returns nil if model weight is obtainable
 func (r *Regressor) Start() error {
-	var err error
-	var weight *ComponentModelWeights
 	outputStr := r.OutputType.String()
 	r.enabled = false
-	r.coreRatio = 1
+	m, err := r.fetchModel(context.Background(), initModelFileSource)
+	if m != nil {
+		r.setModel(m)
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("the regression model (%s): has no config", outputStr)
+	}
+	klog.V(3).Infof("Regression Model (%s): %v", outputStr, err)
+	return err
+}
+
+// Refresh fetches the model weights again and returns a function swapping the predictors with the ones of the new
+// weights, or nil if the weights did not change. A source after the one of the current weights is not tried, e.g. the
+// weights of the model server are not replaced by the initial ones while the model server is unreachable. The new
+// weights must have a model for the energy source and must only use the features of the Regressor.
+// The swap function is not safe to call concurrently with the power estimations.
+func (r *Regressor) Refresh(ctx context.Context) (func(), error) {
+	if r.model == nil {
+		return nil, fmt.Errorf("the regression model (%s) was not started", r.OutputType.String())
+	}
+	m, err := r.fetchModel(ctx, r.model.source)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	if err := r.validateWeight(m.weight); err != nil {
+		return nil, err
+	}
+	return func() { r.setModel(m) }, nil
+}
+
+// ModelName returns the name of the model whose weights are used, empty if the Regressor has no weights
+func (r *Regressor) ModelName() string {
+	if r.model == nil {
+		return ""
+	}
+	return r.model.weight.ModelName
+}
+
+func (r *Regressor) setModel(m *loadedModel) {
+	r.model = m
+	r.TrainerName = m.trainerName
+	r.enabled = true
+}
+
+// fetchModel gets the model weights from the model server if it is enabled, then from the initial model URL and
+// file, without trying the sources after lastSource, and creates their predictors. It returns nil without error if
+// the weights did not change since the current ones.
+func (r *Regressor) fetchModel(ctx context.Context, lastSource weightSource) (*loadedModel, error) {
+	var m *loadedModel
+	var err error
+	outputStr := r.OutputType.String()
 	// try getting weight from model server if it is enabled
 	if config.IsModelServerEnabled() && config.ModelServerEndpoint() != "" {
-		weight, err = r.getWeightFromServer()
-		klog.V(3).Infof("Regression Model (%s): getWeightFromServer: %v (error: %v)", outputStr, weight, err)
+		m, err = r.getWeightFromServer(ctx)
+		klog.V(3).Infof("Regression Model (%s): getWeightFromServer: %v (error: %v)", outputStr, m, err)
 	}
-	if weight == nil {
+	if m == nil && lastSource != modelServerSource {
 		// next try loading from URL by config
-		weight, err = r.loadWeightFromURLorLocal()
-		klog.V(3).Infof("Regression Model (%s): loadWeightFromURLorLocal(%v): %v (error: %v)", outputStr, r.ModelWeightsURL, weight, err)
-	}
-	if weight != nil {
-		r.enabled = true
-		r.modelWeight = weight
-		r.modelPredictors = map[string]Predictor{}
-		if weight.Platform != nil {
-			if predictor, err := r.createPredictor(*weight.Platform); err != nil {
-				return err
-			} else {
-				r.modelPredictors[config.PLATFORM] = predictor
-			}
+		m, err = r.loadWeightFromURLorLocal(ctx, lastSource)
+		klog.V(3).Infof("Regression Model (%s): loadWeightFromURLorLocal(%v): %v (error: %v)", outputStr, r.ModelWeightsURL, m, err)
+	}
+	if errors.Is(err, errWeightNotModified) || (m != nil && r.model != nil && m.version == r.model.version) {
+		return nil, nil
+	}
+	if m == nil {
+		return nil, err
+	}
+	m.coreRatio = r.getCoreRatio(m.weight.ModelMachineSpec)
+	m.predictors = map[string]Predictor{}
+	if m.weight.Platform != nil {
+		if predictor, err := r.createPredictor(m.trainerName, *m.weight.Platform); err != nil {
+			return nil, err
 		} else {
-			if weight.Package != nil {
-				if predictor, err := r.createPredictor(*weight.Package); err != nil {
-					return err
-				} else {
-					r.modelPredictors[config.PKG] = predictor
-				}
-			}
-			if weight.Core != nil {
-				if predictor, err := r.createPredictor(*weight.Core); err != nil {
-					return err
-				} else {
-					r.modelPredictors[config.CORE] = predictor
-				}
-			}
-			if weight.Uncore != nil {
-				if predictor, err := r.createPredictor(*weight.Uncore); err != nil {
-					return err
-				} else {
-					r.modelPredictors[config.UNCORE] = predictor
-				}
-			}
-			if weight.DRAM != nil {
-				if predictor, err := r.createPredictor(*weight.DRAM); err != nil {
-					return err
-				} else {
-					r.modelPredictors[config.DRAM] = predictor
-				}
-			}
+			m.predictors[config.PLATFORM] = predictor
 		}
-		return nil
 	} else {
-		if err == nil {
-			err = fmt.Errorf("the regression model (%s): has no config", outputStr)
+		for comp, weight := range map[string]*ModelWeights{
+			config.PKG:    m.weight.Package,
+			config.CORE:   m.weight.Core,
+			config.UNCORE: m.weight.Uncore,
+			config.DRAM:   m.weight.DRAM,
+		} {
+			if weight == nil {
+				continue
+			}
+			if predictor, err := r.createPredictor(m.trainerName, *weight); err != nil {
+				return nil, err
+			} else {
+				m.predictors[comp] = predictor
+			}
 		}
-		klog.V(3).Infof("Regression Model (%s): %v", outputStr, err)
 	}
-	return err
+	return m, nil
 }
 
 // getWeightFromServer tries getting weights for Kepler Model Server
-func (r *Regressor) getWeightFromServer() (*ComponentModelWeights, error) {
+func (r *Regressor) getWeightFromServer(ctx context.Context) (*loadedModel, error) {
 	modelRequest := ModelRequest{
 		MetricNames:  append(r.FloatFeatureNames, r.SystemMetaDataFeatureNames...),
 		OutputType:   r.OutputType.String(),
@@ -162,7 +227,7 @@ func (r *Regressor) getWeightFromServer() (*ComponentModelWeights, error) {
 		return nil, fmt.Errorf("marshal error: %v (%v)", err, modelRequest)
 	}
 
-	request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, r.ModelServerEndpoint, bytes.NewBuffer(modelRequestJSON))
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, r.ModelServerEndpoint, bytes.NewBuffer(modelRequestJSON))
 	if err != nil {
 		return nil, fmt.Errorf("connection error: %s (%v)", r.ModelServerEndpoint, err)
 	}
@@ -186,23 +251,29 @@ func (r *Regressor) getWeightFromServer() (*ComponentModelWeights, error) {
 	if err != nil {
 		return nil, fmt.Errorf("model unmarshal error: %v (%s)", err, string(body))
 	}
+	trainerName := r.TrainerName
 	if weightResponse.ModelName != "" {
-		r.TrainerName = weightResponse.Trainer()
-		klog.V(3).Infof("Using weights from model %s trained by %s for %s", weightResponse.ModelName, r.TrainerName, r.EnergySource)
+		trainerName = weightResponse.Trainer()
+		klog.V(3).Infof("Using weights from model %s trained by %s for %s", weightResponse.ModelName, trainerName, r.EnergySource)
 	}
-	r.updateCoreRatio(weightResponse.ModelMachineSpec)
-	return &weightResponse, nil
+	return &loadedModel{weight: &weightResponse, trainerName: trainerName, source: modelServerSource, version: weightVersion(body)}, nil
 }
 
 // loadWeightFromURLorLocal get weight from either local or URL
 // if string start with '/', we take it as local file
-func (r *Regressor) loadWeightFromURLorLocal() (*ComponentModelWeights, error) {
+func (r *Regressor) loadWeightFromURLorLocal(ctx context.Context, lastSource weightSource) (*loadedModel, error) {
 	var modelName string // to be set by ModelWeightsURL
-	var body []byte
-	var err error
-
-	body, err = r.loadWeightFromURL()
+	var etag string
+	source := initModelURLSource
+	body, etag, err := r.loadWeightFromURL(ctx)
+	if errors.Is(err, errWeightNotModified) {
+		return nil, err
+	}
 	if err != nil {
+		if lastSource != initModelFileSource {
+			return nil, err
+		}
+		source = initModelFileSource
 		body, err = r.loadWeightFromLocal()
 		if err != nil {
 			return nil, err
@@ -220,10 +291,9 @@ func (r *Regressor) loadWeightFromURLorLocal() (*ComponentModelWeights, error) {
 		// ModelWeightsFilepath should contain model_name field
 		content.ModelName = modelName
 	}
-	r.TrainerName = content.Trainer()
-	klog.V(3).Infof("Using weights from model %s trained by %s for %s", content.ModelName, r.TrainerName, r.EnergySource)
-	r.updateCoreRatio(content.ModelMachineSpec)
-	return &content, nil
+	trainerName := content.Trainer()
+	klog.V(3).Infof("Using weights from model %s trained by %s for %s", content.ModelName, trainerName, r.EnergySource)
+	return &loadedModel{weight: &content, trainerName: trainerName, source: source, version: weightVersion(body), etag: etag}, nil
 }
 
 // loadWeightFromLocal tries loading weights from local file given by r.ModelWeightsURL
@@ -235,34 +305,83 @@ func (r *Regressor) loadWeightFromLocal() ([]byte, error) {
 	return data, nil
 }
 
-// loadWeightFromURL tries loading weights from initial model URL
-func (r *Regressor) loadWeightFromURL() ([]byte, error) {
+// loadWeightFromURL tries loading weights from initial model URL, it returns the weights with their ETag.
+// The weights are only requested if they do not match the ETag of the current weights.
+func (r *Regressor) loadWeightFromURL(ctx context.Context) ([]byte, string, error) {
 	if r.ModelWeightsURL == "" {
-		return nil, fmt.Errorf("ModelWeightsURL is empty")
+		return nil, "", fmt.Errorf("ModelWeightsURL is empty")
 	}
-	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, r.ModelWeightsURL, http.NoBody)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.ModelWeightsURL, http.NoBody)
 	if err != nil {
-		return nil, fmt.Errorf("connection error: %s (%v)", r.ModelWeightsURL, err)
+		return nil, "", fmt.Errorf("connection error: %s (%v)", r.ModelWeightsURL, err)
+	}
+	if r.model != nil && r.model.source == initModelURLSource && r.model.etag != "" {
+		request.Header.Set("If-None-Match", r.model.etag)
 	}
 	client := &http.Client{}
 	response, err := client.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("connection error: %v (%v)", err, r.ModelWeightsURL)
+		return nil, "", fmt.Errorf("connection error: %v (%v)", err, r.ModelWeightsURL)
 	}
 
 	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotModified {
+		return nil, "", errWeightNotModified
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status not ok: %v (%v)", response.Status, r.ModelWeightsURL)
+	}
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return body, nil
+	return body, response.Header.Get("ETag"), nil
+}
+
+// validateWeight checks that the weights have a model for the energy source and only use the features of the Regressor
+func (r *Regressor) validateWeight(weight *ComponentModelWeights) error {
+	weights := map[string]*ModelWeights{config.PLATFORM: weight.Platform}
+	if r.EnergySource != types.PlatformEnergySource {
+		weights = map[string]*ModelWeights{
+			config.PKG:    weight.Package,
+			config.CORE:   weight.Core,
+			config.UNCORE: weight.Uncore,
+			config.DRAM:   weight.DRAM,
+		}
+	}
+	features := map[string]bool{}
+	for _, name := range r.FloatFeatureNames {
+		features[name] = true
+	}
+	found := false
+	for comp, w := range weights {
+		if w == nil {
+			continue
+		}
+		found = true
+		for name, feature := range w.NumericalVariables {
+			if !features[name] {
+				return fmt.Errorf("model %s: the %s weights use the unknown feature %q", weight.ModelName, comp, name)
+			}
+			if math.IsNaN(feature.Weight) || math.IsInf(feature.Weight, 0) || math.IsNaN(feature.Scale) || math.IsInf(feature.Scale, 0) {
+				return fmt.Errorf("model %s: the %s weight of %q is not a number", weight.ModelName, comp, name)
+			}
+		}
+		if math.IsNaN(w.BiasWeight) || math.IsInf(w.BiasWeight, 0) {
+			return fmt.Errorf("model %s: the %s bias weight is not a number", weight.ModelName, comp)
+		}
+	}
+	if !found {
+		return fmt.Errorf("model %s: %w, no weights for %s", weight.ModelName, errModelWeightsInvalid, r.EnergySource)
+	}
+	return nil
 }
 
 // Create Predictor based on trainer name
-func (r *Regressor) createPredictor(weight ModelWeights) (predictor Predictor, err error) {
-	switch r.TrainerName {
-	case types.LinearRegressionTrainer:
+func (r *Regressor) createPredictor(trainerName string, weight ModelWeights) (predictor Predictor, err error) {
+	switch trainerName {
+	case types.LinearRegressionTrainer, types.OnlineRidgeTrainer:
 		predictor, err = NewLinearPredictor(weight)
 	case types.LogarithmicTrainer:
 		predictor, err = NewLogarithmicPredictor(weight)
@@ -273,7 +392,10 @@ func (r *Regressor) createPredictor(weight ModelWeights) (predictor Predictor, e
 	default:
 		predictor, err = NewLinearPredictor(weight)
 	}
-	klog.Infof("Created predictor %s for trainer: %q", predictor.name(), r.TrainerName)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Created predictor %s for trainer: %q", predictor.name(), trainerName)
 	return
 }
 
@@ -282,19 +404,19 @@ func (r *Regressor) GetPlatformPower(isIdlePower bool) ([]uint64, error) {
 	if !r.enabled {
 		return []uint64{}, fmt.Errorf("disabled power model call: %s", r.OutputType.String())
 	}
-	if r.modelPredictors != nil {
+	if r.model != nil {
 		floatFeatureValues := r.floatFeatureValues[0:r.xidx]
 		if isIdlePower {
 			floatFeatureValues = r.floatFeatureValuesForIdlePower[0:r.xidx]
 		}
-		if predictor, found := (r.modelPredictors)[config.PLATFORM]; found {
-			coreRatio := utils.GetCoreRatio(isIdlePower, r.coreRatio)
+		if predictor, found := r.model.predictors[config.PLATFORM]; found {
+			coreRatio := utils.GetCoreRatio(isIdlePower, r.model.coreRatio)
 			powers := predictor.predict(
 				r.FloatFeatureNames, floatFeatureValues,
 				r.SystemMetaDataFeatureNames, r.SystemMetaDataFeatureValues)
 			return utils.GetPlatformPower(powers, coreRatio), nil
 		}
-		return []uint64{}, fmt.Errorf("model Weight for model type %s is not valid: %v", r.OutputType.String(), r.modelWeight)
+		return []uint64{}, fmt.Errorf("model Weight for model type %s is not valid: %v", r.OutputType.String(), r.model.weight)
 	}
 	return []uint64{}, fmt.Errorf("model Weight for model type %s is nil", r.OutputType.String())
 }
@@ -304,12 +426,12 @@ func (r *Regressor) GetComponentsPower(isIdlePower bool) ([]source.NodeComponent
 	if !r.enabled {
 		return []source.NodeComponentsEnergy{}, fmt.Errorf("disabled power model call: %s", r.OutputType.String())
 	}
-	if r.modelPredictors == nil {
+	if r.model == nil {
 		r.enabled = false
 		return []source.NodeComponentsEnergy{}, fmt.Errorf("model weight is not set")
 	}
 	compPowers := make(map[string][]float64)
-	for comp, predictor := range r.modelPredictors {
+	for comp, predictor := range r.model.predictors {
 		floatFeatureValues := r.floatFeatureValues[0:r.xidx]
 		if isIdlePower {
 			floatFeatureValues = r.floatFeatureValuesForIdlePower[0:r.xidx]
@@ -318,7 +440,7 @@ func (r *Regressor) GetComponentsPower(isIdlePower bool) ([]source.NodeComponent
 			r.FloatFeatureNames, floatFeatureValues,
 			r.SystemMetaDataFeatureNames, r.SystemMetaDataFeatureValues)
 	}
-	coreRatio := utils.GetCoreRatio(isIdlePower, r.coreRatio)
+	coreRatio := utils.GetCoreRatio(isIdlePower, r.model.coreRatio)
 	nodeComponentsPower := []source.NodeComponentsEnergy{}
 	num := r.xidx // number of processes
 	for index := 0; index < num; index++ {
@@ -332,15 +454,17 @@ func (r *Regressor) GetComponentsPower(isIdlePower bool) ([]source.NodeComponent
 	return nodeComponentsPower, nil
 }
 
-// updateCoreRatio sets coreRatio attribute as a ratio of the discovered number of cores over the cores of machine used for training a model
-func (r *Regressor) updateCoreRatio(mSpec *config.MachineSpec) {
+// getCoreRatio returns the ratio of the discovered number of cores over the cores of machine used for training a model
+func (r *Regressor) getCoreRatio(mSpec *config.MachineSpec) float64 {
 	if mSpec == nil || r.DiscoveredMachineSpec == nil {
-		return
+		return 1
 	}
 	if r.DiscoveredMachineSpec.Cores > 0 && mSpec.Cores >= r.DiscoveredMachineSpec.Cores {
-		r.coreRatio = float64(r.DiscoveredMachineSpec.Cores) / float64(mSpec.Cores)
-		klog.Infof("Update core ratio to %.2f for computing %s idle power", r.coreRatio, r.EnergySource)
+		coreRatio := float64(r.DiscoveredMachineSpec.Cores) / float64(mSpec.Cores)
+		klog.Infof("Update core ratio to %.2f for computing %s idle power", coreRatio, r.EnergySource)
+		return coreRatio
 	}
+	return 1
 }
 
 // GetComponentsPower returns GPU Power in Watts associated to each each process
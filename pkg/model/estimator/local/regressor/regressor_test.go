@@ -26,10 +26,13 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
@@ -339,3 +342,106 @@ var _ = Describe("Test Regressor Weight Unit (default trainer)", func() {
 		Entry("invalid GradientBoostingRegressorTrainer", "GradientBoostingRegressorTrainer_0", ""),
 	)
 })
+
+var _ = Describe("Test Regressor Weight Refresh", func() {
+	var (
+		mx      sync.Mutex
+		weights ComponentModelWeights
+		version int
+		server  *httptest.Server
+	)
+
+	// the initial model URL serves the weights with their version as ETag
+	weightsURLHandler := func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		etag := fmt.Sprintf("%q", fmt.Sprint(version))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		Expect(json.NewEncoder(w).Encode(weights)).To(Succeed())
+	}
+
+	setWeights := func(w ComponentModelWeights) {
+		mx.Lock()
+		defer mx.Unlock()
+		weights = w
+		version++
+	}
+
+	nodePlatformPower := func(r *Regressor) uint64 {
+		r.ResetSampleIdx()
+		r.AddNodeFeatureValues(nodeFeatureValues)
+		powers, err := r.GetPlatformPower(false)
+		Expect(err).NotTo(HaveOccurred())
+		return powers[0]
+	}
+
+	BeforeEach(func() {
+		_, err := config.Initialize(".")
+		Expect(err).ShouldNot(HaveOccurred())
+		setWeights(GenPlatformModelWeights([]float64{}, types.LinearRegressionTrainer))
+		server = httptest.NewServer(http.HandlerFunc(weightsURLHandler))
+		DeferCleanup(server.Close)
+	})
+
+	startRegressor := func() *Regressor {
+		r := genRegressor(types.AbsPower, types.PlatformEnergySource, "", server.URL+"/LinearRegressionTrainer_0.json", "", "")
+		config.SetModelServerEnable(false)
+		Expect(r.Start()).To(Succeed())
+		Expect(r.ModelName()).To(Equal(types.LinearRegressionTrainer + "_0"))
+		return &r
+	}
+
+	It("swaps the predictors when the weights change", func() {
+		r := startRegressor()
+		power := nodePlatformPower(r)
+
+		swap, err := r.Refresh(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(swap).To(BeNil())
+
+		updated := GenPlatformModelWeights([]float64{}, types.LinearRegressionTrainer)
+		updated.ModelName = types.LinearRegressionTrainer + "_1"
+		updated.Platform.BiasWeight = 2
+		setWeights(updated)
+		swap, err = r.Refresh(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(swap).NotTo(BeNil())
+		// the weights in use are only replaced by the swap
+		Expect(nodePlatformPower(r)).To(Equal(power))
+		swap()
+		Expect(r.ModelName()).To(Equal(types.LinearRegressionTrainer + "_1"))
+		Expect(nodePlatformPower(r)).To(BeNumerically(">", power))
+	})
+
+	It("keeps the weights when the new weights are invalid", func() {
+		r := startRegressor()
+		power := nodePlatformPower(r)
+
+		invalid := GenPlatformModelWeights([]float64{}, types.LinearRegressionTrainer)
+		invalid.Platform.NumericalVariables = map[string]NormalizedNumericalFeature{"unknown": {Weight: 1, Scale: 1}}
+		setWeights(invalid)
+		swap, err := r.Refresh(context.Background())
+		Expect(err).To(HaveOccurred())
+		Expect(swap).To(BeNil())
+
+		setWeights(GenComponentModelWeights([]float64{}))
+		_, err = r.Refresh(context.Background())
+		Expect(err).To(MatchError(errModelWeightsInvalid))
+		Expect(nodePlatformPower(r)).To(Equal(power))
+	})
+
+	It("does not fall back to the initial model URL when the model server is unreachable", func() {
+		modelServer := httptest.NewServer(DummyWeightHandler)
+		r := genRegressor(types.AbsPower, types.PlatformEnergySource, modelServer.URL, server.URL+"/LinearRegressionTrainer_0.json", "", "")
+		Expect(r.Start()).To(Succeed())
+		modelServer.Close()
+
+		swap, err := r.Refresh(context.Background())
+		Expect(err).To(HaveOccurred())
+		Expect(swap).To(BeNil())
+	})
+})
@@ -21,10 +21,12 @@ import (
 	"strings"
 
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/health"
 	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local"
 	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local/regressor"
 	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/sidecar"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/components/source"
 	"k8s.io/klog/v2"
 )
@@ -76,6 +78,20 @@ func CreatePowerEstimatorModels(processFeatureNames []string) {
 	// Node power estimator uses the process features to estimate node power, expect for the Ratio power model that contains additional metrics.
 	CreateNodePlatformPoweEstimatorModel(processFeatureNames)
 	CreateNodeComponentPowerEstimatorModel(processFeatureNames)
+	CreateNodePowerTrainers(processFeatureNames)
+	recordActiveModels()
+	health.GetRegistry().Register("power-model", modelHealthCheck)
+}
+
+// modelHealthCheck fails if a power model required to attribute energy is not enabled
+func modelHealthCheck() error {
+	if !components.IsSystemCollectionSupported() && !IsNodeComponentPowerModelEnabled() {
+		return fmt.Errorf("node components power is not measured and no power model is enabled to estimate it")
+	}
+	if processComponentPowerModel == nil || !processComponentPowerModel.IsEnabled() {
+		return fmt.Errorf("process components power model is not enabled")
+	}
+	return nil
 }
 
 // createPowerModelEstimator called by CreatePowerEstimatorModels to initiate estimate function for each power model.
@@ -277,3 +293,23 @@ func isNodeLevel(powerSourceTarget string) bool {
 	}
 	return false
 }
+
+// SelectedModelTypes returns the type of the power model selected for each power key.
+// Power keys without an estimator, e.g. when the node power is measured by sensors, are reported as "none".
+func SelectedModelTypes() map[string]string {
+	models := map[string]PowerModelInterface{
+		config.NodePlatformPowerKey():      nodePlatformPowerModel,
+		config.NodeComponentsPowerKey():    nodeComponentPowerModel,
+		config.ProcessPlatformPowerKey():   processPlatformPowerModel,
+		config.ProcessComponentsPowerKey(): processComponentPowerModel,
+	}
+	modelTypes := make(map[string]string, len(models))
+	for key, m := range models {
+		if m == nil {
+			modelTypes[key] = "none"
+			continue
+		}
+		modelTypes[key] = m.GetModelType().String()
+	}
+	return modelTypes
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
+	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local/regressor"
+	"k8s.io/klog/v2"
+)
+
+// regressorModels returns the power models using the Regressor, keyed by their pipeline model label
+func regressorModels() map[string]*regressor.Regressor {
+	models := map[string]*regressor.Regressor{}
+	for label, m := range map[string]PowerModelInterface{
+		pipeline.ModelNodeComponents:    nodeComponentPowerModel,
+		pipeline.ModelNodePlatform:      nodePlatformPowerModel,
+		pipeline.ModelProcessComponents: processComponentPowerModel,
+		pipeline.ModelProcessPlatform:   processPlatformPowerModel,
+	} {
+		if r, ok := m.(*regressor.Regressor); ok && r != nil {
+			models[label] = r
+		}
+	}
+	return models
+}
+
+// RefreshPowerModels fetches the weights of the Regressor power models again and swaps the changed ones.
+// The weights are fetched without holding mx, the lock of the collection, so the collection is not delayed by the
+// model server, and swapped while holding it, so a collection always estimates the power with a single model.
+func RefreshPowerModels(ctx context.Context, mx *sync.Mutex) {
+	mx.Lock()
+	models := regressorModels()
+	mx.Unlock()
+
+	swaps := map[string]func(){}
+	for label, r := range models {
+		swap, err := r.Refresh(ctx)
+		switch {
+		case err != nil:
+			klog.Errorf("failed to refresh the weights of the %s power model: %v", label, err)
+			pipeline.ObserveModelRefresh(label, pipeline.ModelRefreshFailed)
+		case swap == nil:
+			klog.V(5).Infof("The weights of the %s power model did not change", label)
+			pipeline.ObserveModelRefresh(label, pipeline.ModelRefreshUnchanged)
+		default:
+			swaps[label] = swap
+		}
+	}
+	if len(swaps) == 0 {
+		return
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	for label, swap := range swaps {
+		swap()
+		klog.Infof("Refreshed the weights of the %s power model to %s", label, models[label].ModelName())
+		pipeline.ObserveModelRefresh(label, pipeline.ModelRefreshUpdated)
+	}
+	recordActiveModels()
+}
+
+// recordActiveModels sets the name of the model whose weights each Regressor power model uses
+func recordActiveModels() {
+	pipeline.ModelInfo.Reset()
+	for label, r := range regressorModels() {
+		if name := r.ModelName(); name != "" {
+			pipeline.ModelInfo.WithLabelValues(label, name).Set(1)
+		}
+	}
+}
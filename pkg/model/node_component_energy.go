@@ -21,6 +21,7 @@ import (
 
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 	"github.com/sustainable-computing-io/kepler/pkg/node"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
@@ -87,6 +88,7 @@ func GetNodeComponentPowers(nodeMetrics *stats.NodeStats, isIdlePower bool) (nod
 	}
 	powers, err := nodeComponentPowerModel.GetComponentsPower(isIdlePower)
 	if err != nil {
+		pipeline.ModelEstimationErrors.WithLabelValues(pipeline.ModelNodeComponents).Inc()
 		klog.Infof("Failed to get node components power %v\n", err)
 		return
 	}
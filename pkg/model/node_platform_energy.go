@@ -21,6 +21,7 @@ import (
 
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 	"github.com/sustainable-computing-io/kepler/pkg/node"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
@@ -81,6 +82,7 @@ func GetNodePlatformPower(nodeMetrics *stats.NodeStats, isIdlePower bool) (platf
 	}
 	powers, err := nodePlatformPowerModel.GetPlatformPower(isIdlePower)
 	if err != nil {
+		pipeline.ModelEstimationErrors.WithLabelValues(pipeline.ModelNodePlatform).Inc()
 		klog.Infof("Failed to get node platform power %v\n", err)
 		return
 	}
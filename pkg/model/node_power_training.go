@@ -0,0 +1,183 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local/regressor"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+	"github.com/sustainable-computing-io/kepler/pkg/node"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/components"
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// nodePowerTrainers train the node power models from the measured power, keyed by energy source.
+	// There is no trainer for a power that is not measured, the node power models estimate it instead.
+	nodePowerTrainers map[string]*regressor.OnlineTrainer
+	// trainersMx guards nodePowerTrainers, which is replaced when the power models are created again
+	trainersMx sync.RWMutex
+)
+
+// CreateNodePowerTrainers creates the trainers of the node component and platform power models if their power is measured.
+// A trainer of the same features keeps its samples when the power models are created again, e.g. on a config reload.
+func CreateNodePowerTrainers(nodeFeatureNames []string) {
+	trainersMx.Lock()
+	defer trainersMx.Unlock()
+	previous := nodePowerTrainers
+	nodePowerTrainers = nil
+	if !config.IsOnlineTrainingEnabled() {
+		return
+	}
+	trainers := map[string]*regressor.OnlineTrainer{}
+	if components.IsSystemCollectionSupported() {
+		trainers[types.ComponentEnergySource] = newNodePowerTrainer(nodeFeatureNames, config.PKG, config.CORE, config.UNCORE, config.DRAM)
+	}
+	if platform.IsSystemCollectionSupported() {
+		trainers[types.PlatformEnergySource] = newNodePowerTrainer(nodeFeatureNames, config.PLATFORM)
+	}
+	if len(trainers) == 0 {
+		klog.Infof("Skipping the online training of the node power models since the node power is not measured")
+		return
+	}
+	for source, trainer := range trainers {
+		if prev, found := previous[source]; found && slices.Equal(prev.FloatFeatureNames, trainer.FloatFeatureNames) {
+			trainers[source] = prev
+			continue
+		}
+		klog.V(1).Infof("Training the %s node power model with the measured power", source)
+	}
+	nodePowerTrainers = trainers
+}
+
+func getNodePowerTrainers() map[string]*regressor.OnlineTrainer {
+	trainersMx.RLock()
+	defer trainersMx.RUnlock()
+	return nodePowerTrainers
+}
+
+func newNodePowerTrainer(nodeFeatureNames []string, components ...string) *regressor.OnlineTrainer {
+	// the trainer name is parsed from the model name up to the last underscore
+	nodeName := strings.ReplaceAll(node.Name(), "_", "-")
+	return &regressor.OnlineTrainer{
+		ModelName:                   types.OnlineRidgeTrainer + "_" + nodeName,
+		FloatFeatureNames:           nodeFeatureNames,
+		SystemMetaDataFeatureNames:  node.MetadataFeatureNames(),
+		SystemMetaDataFeatureValues: node.MetadataFeatureValues(),
+		Components:                  components,
+		MinSamples:                  config.GetOnlineTrainingConfig().MinSamples,
+		MachineSpec:                 config.GenerateSpec(),
+	}
+}
+
+// AddNodePowerTrainingSample adds the node resource utilization and the measured power of the last collection to the trainers.
+// The power models predict the power of all sockets, the energy of the sockets is summed.
+func AddNodePowerTrainingSample(nodeMetrics *stats.NodeStats) {
+	for source, trainer := range getNodePowerTrainers() {
+		power := map[string]float64{}
+		var measured bool
+		switch source {
+		case types.ComponentEnergySource:
+			power[config.PKG] = nodeMeasuredPower(nodeMetrics, config.AbsEnergyInPkg)
+			power[config.CORE] = nodeMeasuredPower(nodeMetrics, config.AbsEnergyInCore)
+			power[config.UNCORE] = nodeMeasuredPower(nodeMetrics, config.AbsEnergyInUnCore)
+			power[config.DRAM] = nodeMeasuredPower(nodeMetrics, config.AbsEnergyInDRAM)
+			measured = power[config.PKG] > 0
+		case types.PlatformEnergySource:
+			power[config.PLATFORM] = nodeMeasuredPower(nodeMetrics, config.AbsEnergyInPlatform)
+			measured = power[config.PLATFORM] > 0
+		}
+		// the power is not known in the first collection, nor when the power meter could not be read
+		if !measured {
+			continue
+		}
+		trainer.AddSample(nodeMetrics.ToEstimatorValues(trainer.FloatFeatureNames, true), power)
+	}
+}
+
+// nodeMeasuredPower returns the power in Watts of the energy metric in the last collection
+func nodeMeasuredPower(nodeMetrics *stats.NodeStats, metric string) float64 {
+	collection, found := nodeMetrics.EnergyUsage[metric]
+	if !found {
+		return 0
+	}
+	return float64(collection.SumAllDeltaValues()) / 1000 / float64(config.SamplePeriodSec())
+}
+
+// TrainNodePowerModels fits the node power models with the samples added so far and saves their weights in dir,
+// as <energy source>_AbsPowerModel.json in the format of the initial model weights. The models without enough samples are skipped.
+func TrainNodePowerModels(dir string) error {
+	var errs []error
+	for source, trainer := range getNodePowerTrainers() {
+		if err := trainer.Train(); errors.Is(err, regressor.ErrNotEnoughSamples) {
+			klog.V(3).Infof("Skipping the training of the %s node power model: %v", source, err)
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		klog.V(3).Infof("Trained the %s node power model with %d samples: %v", source, trainer.Samples(), trainer.Weights())
+		if err := saveModelWeights(filepath.Join(dir, trainedModelFileName(source)), trainer.Weights()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TrainedNodePowerModel returns the last weights of the node power model trained for the energy source,
+// nil if the model was not trained yet
+func TrainedNodePowerModel(source string) *regressor.ComponentModelWeights {
+	if trainer, found := getNodePowerTrainers()[source]; found {
+		return trainer.Weights()
+	}
+	return nil
+}
+
+func trainedModelFileName(source string) string {
+	return filepath.Base(config.GetDefaultPowerModelURL(types.AbsPower.String(), source))
+}
+
+// saveModelWeights writes the weights to a temporary file first, so the weights loaded from path are never truncated
+func saveModelWeights(path string, weights *regressor.ComponentModelWeights) error {
+	data, err := json.Marshal(weights)
+	if err != nil {
+		return fmt.Errorf("failed to encode the model weights: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create the model weights directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write the model weights: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save the model weights: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local/regressor"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+)
+
+var _ = Describe("NodePowerTraining", func() {
+	BeforeEach(func() {
+		_, err := config.Initialize(".")
+		Expect(err).NotTo(HaveOccurred())
+		stats.SetMockedCollectorMetrics()
+		nodePowerTrainers = map[string]*regressor.OnlineTrainer{
+			types.ComponentEnergySource: {
+				ModelName:         types.OnlineRidgeTrainer + "_node-1",
+				FloatFeatureNames: []string{config.CPUTime},
+				Components:        []string{config.PKG, config.CORE, config.UNCORE, config.DRAM},
+				MinSamples:        5,
+			},
+		}
+	})
+
+	AfterEach(func() {
+		nodePowerTrainers = nil
+	})
+
+	It("trains the node power models with the measured power and saves them", func() {
+		dir := GinkgoT().TempDir()
+		for i := 0; i < 10; i++ {
+			nodeStats := stats.NewNodeStats()
+			// the power of the sockets is summed, the power is 10W + 10W per second of CPU time
+			nodeStats.ResourceUsage[config.CPUTime].SetDeltaStat(stats.MockedSocketID, uint64(300*i))
+			nodeStats.EnergyUsage[config.AbsEnergyInPkg].SetDeltaStat("0", uint64(15000+1500*i))
+			nodeStats.EnergyUsage[config.AbsEnergyInPkg].SetDeltaStat("1", uint64(15000+1500*i))
+			AddNodePowerTrainingSample(nodeStats)
+		}
+		// the power is not known in the first collection
+		AddNodePowerTrainingSample(stats.NewNodeStats())
+		Expect(nodePowerTrainers[types.ComponentEnergySource].Samples()).To(Equal(10))
+
+		Expect(TrainNodePowerModels(dir)).To(Succeed())
+		weights := TrainedNodePowerModel(types.ComponentEnergySource)
+		Expect(weights).NotTo(BeNil())
+		Expect(weights.Core).To(BeNil())
+		Expect(weights.Package.BiasWeight).To(BeNumerically("~", 10, 0.1))
+		Expect(TrainedNodePowerModel(types.PlatformEnergySource)).To(BeNil())
+
+		data, err := os.ReadFile(filepath.Join(dir, "intel_rapl_AbsPowerModel.json"))
+		Expect(err).NotTo(HaveOccurred())
+		var saved regressor.ComponentModelWeights
+		Expect(json.Unmarshal(data, &saved)).To(Succeed())
+		Expect(saved.ModelName).To(Equal(weights.ModelName))
+		Expect(saved.Package.NumericalVariables).To(HaveKey(config.CPUTime))
+	})
+
+	It("does not train the node power models without enough samples", func() {
+		dir := GinkgoT().TempDir()
+		Expect(TrainNodePowerModels(dir)).To(Succeed())
+		Expect(TrainedNodePowerModel(types.ComponentEnergySource)).To(BeNil())
+		Expect(filepath.Join(dir, "intel_rapl_AbsPowerModel.json")).NotTo(BeAnExistingFile())
+	})
+})
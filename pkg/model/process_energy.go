@@ -18,10 +18,13 @@ package model
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/sustainable-computing-io/kepler/pkg/bpf"
 	"github.com/sustainable-computing-io/kepler/pkg/collector/stats"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/metrics/pipeline"
+	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 	"github.com/sustainable-computing-io/kepler/pkg/node"
 	acc "github.com/sustainable-computing-io/kepler/pkg/sensors/accelerator"
@@ -33,8 +36,19 @@ import (
 var (
 	processPlatformPowerModel  PowerModelInterface
 	processComponentPowerModel PowerModelInterface
+
+	// socketComponentPowerModels split the energy of each socket among the processes that ran on it, keyed by
+	// the socket id of the node energy. They are used in place of the process component power model when it is
+	// the Ratio power model and the node reports the energy of several sockets.
+	socketComponentPowerModels = map[string]*socketPowerModel{}
 )
 
+// socketPowerModel is the Ratio power model of a socket and the processes that ran on it, in the sample order
+type socketPowerModel struct {
+	model      PowerModelInterface
+	processIDs []uint64
+}
+
 // createProcessPowerModelConfig: the process component power model must be set by default.
 func createProcessPowerModelConfig(powerSourceTarget string, processFeatureNames []string, energySource string) (modelConfig *types.ModelConfig) {
 	systemMetaDataFeatureNames := node.MetadataFeatureNames()
@@ -70,7 +84,7 @@ func createProcessPowerModelConfig(powerSourceTarget string, processFeatureNames
 				coreUsageMetric,             // for CORE resource usage
 				dramUsageMetric,             // for DRAM resource usage
 				config.GeneralUsageMetric(), // for UNCORE resource usage
-				config.GeneralUsageMetric(), // for OTHER resource usage
+				config.OtherUsageMetric(),   // for OTHER resource usage
 				config.GPUUsageMetric(),     // for GPU resource usage
 			}
 			// NodeFeatureNames contains the metrics that represents the node resource utilization plus the dynamic and idle power power consumption
@@ -147,8 +161,9 @@ func UpdateProcessEnergy(processesMetrics map[uint64]*stats.ProcessStats, nodeMe
 
 	// add features values for prediction
 	processIDList := addSamplesToPowerModels(processesMetrics, nodeMetrics)
-	addEstimatedEnergy(processIDList, processesMetrics, idlePower)
-	addEstimatedEnergy(processIDList, processesMetrics, absPower)
+	socketModels := addSocketSamplesToPowerModels(processIDList, processesMetrics, nodeMetrics)
+	addEstimatedEnergy(processIDList, processesMetrics, socketModels, idlePower)
+	addEstimatedEnergy(processIDList, processesMetrics, socketModels, absPower)
 }
 
 // addSamplesToPowerModels converts process's metrics to array to add the samples to the power model
@@ -183,8 +198,91 @@ func addSamplesToPowerModels(processesMetrics map[uint64]*stats.ProcessStats, no
 	return processIDList
 }
 
+// addSocketSamplesToPowerModels adds the samples of the processes that ran on each socket to the power model of the socket.
+// It returns the socket power models keyed by the socket id of the process resource utilization, or nil if the
+// components power cannot be estimated per socket.
+func addSocketSamplesToPowerModels(processIDList []uint64, processesMetrics map[uint64]*stats.ProcessStats, nodeMetrics *stats.NodeStats) map[string]*socketPowerModel {
+	if !processComponentPowerModel.IsEnabled() || processComponentPowerModel.GetModelType() != types.Ratio {
+		return nil
+	}
+	// the node reports the energy of a single socket, or the processes CPU time is not split per socket
+	if len(nodeMetrics.EnergyUsage[config.AbsEnergyInPkg]) < 2 || len(nodeMetrics.ResourceUsage[config.CPUTime]) < 2 {
+		return nil
+	}
+	socketModels := map[string]*socketPowerModel{}
+	for energyID := range nodeMetrics.EnergyUsage[config.AbsEnergyInPkg] {
+		socket, err := strconv.Atoi(energyID)
+		if err != nil {
+			klog.V(5).Infof("Could not estimate the Process Components Power per socket, unknown socket %q", energyID)
+			return nil
+		}
+		resourceID := utils.SocketID(socket)
+
+		m, found := socketComponentPowerModels[energyID]
+		if !found {
+			m = &socketPowerModel{
+				model: &local.RatioPowerModel{
+					ProcessFeatureNames: processComponentPowerModel.GetProcessFeatureNamesList(),
+					NodeFeatureNames:    processComponentPowerModel.GetNodeFeatureNamesList(),
+				},
+			}
+			socketComponentPowerModels[energyID] = m
+		}
+		m.model.ResetSampleIdx()
+		m.processIDs = m.processIDs[:0]
+		for _, processID := range processIDList {
+			process := processesMetrics[processID]
+			if process.ResourceUsage[config.CPUTime].GetDelta(resourceID) == 0 {
+				continue
+			}
+			featureValues := process.ToSocketEstimatorValues(m.model.GetProcessFeatureNamesList(), resourceID, energyID, true)
+			m.model.AddProcessFeatureValues(featureValues)
+			m.processIDs = append(m.processIDs, processID)
+		}
+		featureValues := nodeMetrics.ToSocketEstimatorValues(m.model.GetNodeFeatureNamesList(), resourceID, energyID, true)
+		m.model.AddNodeFeatureValues(featureValues)
+		socketModels[resourceID] = m
+	}
+	return socketModels
+}
+
+// addSocketComponentsEnergy sets the components energy of the processes on each socket they ran on.
+// It returns the components power of the processes summed over the sockets, in the order of processIDList.
+func addSocketComponentsEnergy(processIDList []uint64, processesMetrics map[uint64]*stats.ProcessStats, socketModels map[string]*socketPowerModel, isIdlePower bool) ([]source.NodeComponentsEnergy, error) {
+	totalPower := map[uint64]*source.NodeComponentsEnergy{}
+	for _, processID := range processIDList {
+		totalPower[processID] = &source.NodeComponentsEnergy{}
+	}
+	pkgMetric, coreMetric, dramMetric, uncoreMetric := config.DynEnergyInPkg, config.DynEnergyInCore, config.DynEnergyInDRAM, config.DynEnergyInUnCore
+	if isIdlePower {
+		pkgMetric, coreMetric, dramMetric, uncoreMetric = config.IdleEnergyInPkg, config.IdleEnergyInCore, config.IdleEnergyInDRAM, config.IdleEnergyInUnCore
+	}
+	for socketID, m := range socketModels {
+		powers, err := m.model.GetComponentsPower(isIdlePower)
+		if err != nil {
+			return nil, err
+		}
+		for i, processID := range m.processIDs {
+			process := processesMetrics[processID]
+			process.EnergyUsage[pkgMetric].SetDeltaStat(socketID, powers[i].Pkg*config.SamplePeriodSec())
+			process.EnergyUsage[coreMetric].SetDeltaStat(socketID, powers[i].Core*config.SamplePeriodSec())
+			process.EnergyUsage[dramMetric].SetDeltaStat(socketID, powers[i].DRAM*config.SamplePeriodSec())
+			process.EnergyUsage[uncoreMetric].SetDeltaStat(socketID, powers[i].Uncore*config.SamplePeriodSec())
+			totalPower[processID].Pkg += powers[i].Pkg
+			totalPower[processID].Core += powers[i].Core
+			totalPower[processID].DRAM += powers[i].DRAM
+			totalPower[processID].Uncore += powers[i].Uncore
+		}
+	}
+	processComponentsPower := make([]source.NodeComponentsEnergy, 0, len(processIDList))
+	for _, processID := range processIDList {
+		processComponentsPower = append(processComponentsPower, *totalPower[processID])
+	}
+	return processComponentsPower, nil
+}
+
 // addEstimatedEnergy estimates the idle power consumption
-func addEstimatedEnergy(processIDList []uint64, processesMetrics map[uint64]*stats.ProcessStats, isIdlePower bool) {
+func addEstimatedEnergy(processIDList []uint64, processesMetrics map[uint64]*stats.ProcessStats, socketModels map[string]*socketPowerModel, isIdlePower bool) {
 	var processGPUPower []uint64
 	var processPlatformPower []uint64
 	var processComponentsPower []source.NodeComponentsEnergy
@@ -195,8 +293,13 @@ func addEstimatedEnergy(processIDList []uint64, processesMetrics map[uint64]*sta
 
 	// estimate the associated power consumption of all RAPL node components for each process
 	if processComponentPowerModel.IsEnabled() {
-		processComponentsPower, errComp = processComponentPowerModel.GetComponentsPower(isIdlePower)
+		if socketModels != nil {
+			processComponentsPower, errComp = addSocketComponentsEnergy(processIDList, processesMetrics, socketModels, isIdlePower)
+		} else {
+			processComponentsPower, errComp = processComponentPowerModel.GetComponentsPower(isIdlePower)
+		}
 		if errComp != nil {
+			pipeline.ModelEstimationErrors.WithLabelValues(pipeline.ModelProcessComponents).Inc()
 			klog.V(5).Infoln("Could not estimate the Process Components Power")
 		}
 		// estimate the associated power consumption of GPU for each process
@@ -204,6 +307,7 @@ func addEstimatedEnergy(processIDList []uint64, processesMetrics map[uint64]*sta
 			if gpu := acc.GetActiveAcceleratorByType(config.GPU); gpu != nil {
 				processGPUPower, errGPU = processComponentPowerModel.GetGPUPower(isIdlePower)
 				if errGPU != nil {
+					pipeline.ModelEstimationErrors.WithLabelValues(pipeline.ModelProcessGPU).Inc()
 					klog.V(5).Infoln("Could not estimate the Process GPU Power")
 				}
 			}
@@ -213,13 +317,15 @@ func addEstimatedEnergy(processIDList []uint64, processesMetrics map[uint64]*sta
 	if processPlatformPowerModel.IsEnabled() {
 		processPlatformPower, errPlat = processPlatformPowerModel.GetPlatformPower(isIdlePower)
 		if errPlat != nil {
+			pipeline.ModelEstimationErrors.WithLabelValues(pipeline.ModelProcessPlatform).Inc()
 			klog.V(5).Infoln("Could not estimate the Process Platform Power")
 		}
 	}
 
 	var energy uint64
 	for i, processID := range processIDList {
-		if errComp == nil {
+		// the components energy estimated per socket is already set
+		if errComp == nil && socketModels == nil {
 			// add PKG power consumption
 			// since Kepler collects metrics at intervals of SamplePeriodSec, which is greater than 1 second, it is necessary to calculate the energy consumption for the entire waiting period
 			energy = processComponentsPower[i].Pkg * config.SamplePeriodSec()
@@ -252,15 +358,15 @@ func addEstimatedEnergy(processIDList []uint64, processesMetrics map[uint64]*sta
 			} else {
 				processesMetrics[processID].EnergyUsage[config.DynEnergyInUnCore].SetDeltaStat(utils.GenericSocketID, energy)
 			}
+		}
 
-			// add GPU power consumption
-			if errGPU == nil {
-				energy = processGPUPower[i] * (config.SamplePeriodSec())
-				if isIdlePower {
-					processesMetrics[processID].EnergyUsage[config.IdleEnergyInGPU].SetDeltaStat(utils.GenericSocketID, energy)
-				} else {
-					processesMetrics[processID].EnergyUsage[config.DynEnergyInGPU].SetDeltaStat(utils.GenericSocketID, energy)
-				}
+		// add GPU power consumption
+		if errComp == nil && errGPU == nil {
+			energy = processGPUPower[i] * (config.SamplePeriodSec())
+			if isIdlePower {
+				processesMetrics[processID].EnergyUsage[config.IdleEnergyInGPU].SetDeltaStat(utils.GenericSocketID, energy)
+			} else {
+				processesMetrics[processID].EnergyUsage[config.DynEnergyInGPU].SetDeltaStat(utils.GenericSocketID, energy)
 			}
 		}
 
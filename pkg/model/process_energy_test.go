@@ -125,6 +125,50 @@ var _ = Describe("ProcessPower", func() {
 			Expect(processStats[uint64(1)].EnergyUsage[config.DynEnergyInPlatform][utils.GenericSocketID].GetDelta()).To(Equal(uint64(17502)))
 		})
 
+		It("Splits the energy of each socket among the processes that ran on it", func() {
+			configStr := "CONTAINER_COMPONENTS_ESTIMATOR=false\n"
+			os.Setenv("MODEL_CONFIG", configStr)
+
+			CreatePowerEstimatorModels(stats.GetProcessFeatureNames())
+
+			// process 1 ran on the first socket, process 2 on the second one and process 3 on both
+			processStats = map[uint64]*stats.ProcessStats{}
+			nodeStats = *stats.NewNodeStats()
+			runOn := func(pid uint64, sockets ...int) {
+				if _, found := processStats[pid]; !found {
+					processStats[pid] = stats.NewProcessStats(pid, pid, "container", "", "command")
+				}
+				for _, socket := range sockets {
+					for _, metric := range []string{config.CPUCycle, config.CPUInstruction, config.CacheMiss, config.CPUTime} {
+						processStats[pid].ResourceUsage[metric].SetDeltaStat(utils.SocketID(socket), 30000)
+						nodeStats.ResourceUsage[metric].AddDeltaStat(utils.SocketID(socket), 30000)
+					}
+				}
+			}
+			runOn(1, 0)
+			runOn(2, 1)
+			runOn(3, 0, 1)
+
+			// the node energy is read per socket, the first socket has 35000mJ of dynamic energy and the second one 15000mJ
+			for _, socketID := range []string{"0", "1"} {
+				nodeStats.EnergyUsage[config.AbsEnergyInPkg].SetDeltaStat(socketID, 10000)
+			}
+			nodeStats.UpdateIdleEnergyWithMinValue(true)
+			nodeStats.EnergyUsage[config.AbsEnergyInPkg].SetDeltaStat("0", 45000)
+			nodeStats.EnergyUsage[config.AbsEnergyInPkg].SetDeltaStat("1", 25000)
+			nodeStats.UpdateDynEnergy()
+
+			UpdateProcessEnergy(processStats, &nodeStats)
+
+			// The first socket power is 11667mJ, split between processes 1 and 3: (30000/60000)*11667*3 = 17502 mJ
+			// The second socket power is 5000mJ, split between processes 2 and 3: (30000/60000)*5000*3 = 7500 mJ
+			Expect(processStats[uint64(1)].EnergyUsage[config.DynEnergyInPkg][utils.SocketID(0)].GetDelta()).To(Equal(uint64(17502)))
+			Expect(processStats[uint64(1)].EnergyUsage[config.DynEnergyInPkg]).NotTo(HaveKey(utils.SocketID(1)))
+			Expect(processStats[uint64(2)].EnergyUsage[config.DynEnergyInPkg][utils.SocketID(1)].GetDelta()).To(Equal(uint64(7500)))
+			Expect(processStats[uint64(2)].EnergyUsage[config.DynEnergyInPkg]).NotTo(HaveKey(utils.SocketID(0)))
+			Expect(processStats[uint64(3)].EnergyUsage[config.DynEnergyInPkg].SumAllDeltaValues()).To(Equal(uint64(17502 + 7500)))
+		})
+
 		// TODO: Get process power with no dependency and no node power.
 		// The current LR model has some problems, all the model weights are negative, which means that the energy consumption will decrease with larger resource utilization.
 		// Consequently the dynamic power will be 0 since the idle power with 0 resource utilization will be higher than the absolute power with non zero utilization
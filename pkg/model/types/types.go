@@ -48,6 +48,8 @@ const (
 	LogarithmicTrainer      = "LogarithmicRegressionTrainer"
 	LogisticTrainer         = "LogisticRegressionTrainer"
 	ExponentialTrainer      = "ExponentialRegressionTrainer"
+	// OnlineRidgeTrainer trains linear models within kepler from the measured power
+	OnlineRidgeTrainer = "OnlineRidgeRegressionTrainer"
 )
 
 var (
@@ -56,6 +58,7 @@ var (
 		LogarithmicTrainer,
 		LogisticTrainer,
 		ExponentialTrainer,
+		OnlineRidgeTrainer,
 	}
 	ModelOutputTypeConverter = []string{"AbsPower", "DynPower"}
 	ModelTypeConverter       = []string{"Ratio", "Regressor", "EstimatorSidecar"}
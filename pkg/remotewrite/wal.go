@@ -0,0 +1,108 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const segmentSuffix = ".rw"
+
+// wal buffers the compressed remote-write requests on disk until they are delivered.
+// Every request is stored in its own segment file named after its creation time,
+// so the segments are sent in order and survive a restart of Kepler.
+type wal struct {
+	dir     string
+	maxSize int64
+	seq     uint64
+}
+
+func newWAL(dir string, maxSize int64) (*wal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create the remote-write WAL directory: %w", err)
+	}
+	return &wal{dir: dir, maxSize: maxSize}, nil
+}
+
+// append stores a request, dropping the oldest segments if the WAL exceeds its maximum size.
+func (w *wal) append(data []byte) error {
+	w.seq++
+	name := fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), w.seq%1000000, segmentSuffix)
+	tmp := filepath.Join(w.dir, name+".tmp")
+	// write to a temporary file first so a crash never leaves a truncated segment behind
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write remote-write WAL segment: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(w.dir, name)); err != nil {
+		return fmt.Errorf("failed to commit remote-write WAL segment: %w", err)
+	}
+	return w.truncate()
+}
+
+// segments returns the buffered segment paths, oldest first.
+func (w *wal) segments() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), segmentSuffix) {
+			segments = append(segments, filepath.Join(w.dir, e.Name()))
+		}
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+func (w *wal) truncate() error {
+	if w.maxSize <= 0 {
+		return nil
+	}
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(segments))
+	var total int64
+	for i, s := range segments {
+		if info, err := os.Stat(s); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	dropped := 0
+	// always keep the newest segment
+	for i := 0; total > w.maxSize && i < len(segments)-1; i++ {
+		if err := os.Remove(segments[i]); err != nil {
+			return err
+		}
+		total -= sizes[i]
+		dropped++
+	}
+	if dropped > 0 {
+		klog.Warningf("remote-write WAL exceeded %d bytes, dropped the %d oldest requests", w.maxSize, dropped)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package remotewrite pushes the gathered Prometheus metrics to a remote-write endpoint,
+// for nodes that cannot be scraped.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sustainable-computing-io/kepler/pkg/build"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// maxBackoff caps the delay between retries of a failed request
+	maxBackoff = 30 * time.Second
+	// minBackoff is the delay before the first retry of a failed request
+	minBackoff = 500 * time.Millisecond
+	// maxRetries is the number of retries per send before the request is left in the WAL for the next interval
+	maxRetries = 3
+)
+
+// recoverableError is returned for failures that are worth retrying: network errors, 5xx and 429 responses.
+type recoverableError struct {
+	error
+}
+
+// Writer periodically gathers the registry and pushes it to the remote-write endpoint.
+type Writer struct {
+	cfg      config.RemoteWriteConfig
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	wal      *wal
+	// after waits between retries, it is replaced in the tests
+	after func(time.Duration) <-chan time.Time
+}
+
+// NewWriter creates a Writer buffering the requests in cfg.WALDir.
+func NewWriter(cfg *config.RemoteWriteConfig, gatherer prometheus.Gatherer) (*Writer, error) {
+	w, err := newWAL(cfg.WALDir, int64(cfg.WALMaxSizeMB)*1024*1024)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		cfg:      *cfg,
+		gatherer: gatherer,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutSec) * time.Second},
+		wal:      w,
+		after:    time.After,
+	}, nil
+}
+
+// Run pushes the metrics every interval until ctx is cancelled, then pushes the latest values a last time.
+// The requests that could not be delivered are kept on disk and sent in order once the endpoint is reachable again.
+func (w *Writer) Run(ctx context.Context) {
+	klog.Infof("pushing metrics to %s every %ds", w.cfg.URL, w.cfg.IntervalSec)
+	ticker := time.NewTicker(time.Duration(w.cfg.IntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			pushCtx, cancel := context.WithTimeout(context.Background(), time.Duration(w.cfg.TimeoutSec)*time.Second)
+			defer cancel()
+			if err := w.Push(pushCtx); err != nil {
+				klog.Errorf("remote-write: %v", err)
+			}
+			return
+		case <-ticker.C:
+			// the push is interrupted when ctx is cancelled, the request stays in the WAL for the last push
+			if err := w.Push(ctx); err != nil {
+				klog.Errorf("remote-write: %v", err)
+			}
+		}
+	}
+}
+
+// Push gathers the current metrics into the WAL and sends all the buffered requests.
+func (w *Writer) Push(ctx context.Context) error {
+	req, err := w.gather(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+	data, err := req.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to serialize the write request: %w", err)
+	}
+	if err := w.wal.append(snappy.Encode(nil, data)); err != nil {
+		return err
+	}
+	return w.flush(ctx)
+}
+
+// flush sends the WAL segments oldest first, it stops at the first request that cannot be delivered yet.
+func (w *Writer) flush(ctx context.Context) error {
+	segments, err := w.wal.segments()
+	if err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		body, err := os.ReadFile(segment)
+		if err != nil {
+			return err
+		}
+		if err := w.sendWithRetry(ctx, body); err != nil {
+			var recoverable recoverableError
+			if errors.As(err, &recoverable) {
+				return fmt.Errorf("endpoint unavailable, %d requests buffered: %w", len(segments), err)
+			}
+			// the endpoint will never accept this request, e.g. it is malformed or out of order
+			klog.Errorf("remote-write: dropping rejected request: %v", err)
+		}
+		if err := os.Remove(segment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) sendWithRetry(ctx context.Context, body []byte) error {
+	backoff := minBackoff
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				// keep the request for the next push
+				return recoverableError{ctx.Err()}
+			case <-w.after(backoff):
+			}
+			backoff = min(2*backoff, maxBackoff)
+		}
+		if err = w.send(ctx, body); err == nil {
+			return nil
+		}
+		var recoverable recoverableError
+		if !errors.As(err, &recoverable) {
+			return err
+		}
+	}
+	return err
+}
+
+func (w *Writer) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "kepler/"+build.Version)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
+
+// gather converts the gathered metric families into remote-write time series stamped with now.
+func (w *Writer) gather(now time.Time) (*prompb.WriteRequest, error) {
+	families, err := w.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return nil, err
+	}
+	if err != nil {
+		// the registry returns the metrics it could gather together with the error
+		klog.V(5).Infof("remote-write: partial gather: %v", err)
+	}
+	ts := now.UnixMilli()
+	req := &prompb.WriteRequest{}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			base := w.labels(m.GetLabel())
+			name := mf.GetName()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				req.Timeseries = append(req.Timeseries, series(name, base, m.GetCounter().GetValue(), ts))
+			case dto.MetricType_GAUGE:
+				req.Timeseries = append(req.Timeseries, series(name, base, m.GetGauge().GetValue(), ts))
+			case dto.MetricType_UNTYPED:
+				req.Timeseries = append(req.Timeseries, series(name, base, m.GetUntyped().GetValue(), ts))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					req.Timeseries = append(req.Timeseries, series(name, withLabel(base, "quantile", formatFloat(q.GetQuantile())), q.GetValue(), ts))
+				}
+				req.Timeseries = append(req.Timeseries,
+					series(name+"_sum", base, s.GetSampleSum(), ts),
+					series(name+"_count", base, float64(s.GetSampleCount()), ts))
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				hasInf := false
+				for _, b := range h.GetBucket() {
+					hasInf = hasInf || math.IsInf(b.GetUpperBound(), 1)
+					req.Timeseries = append(req.Timeseries, series(name+"_bucket", withLabel(base, "le", formatFloat(b.GetUpperBound())), float64(b.GetCumulativeCount()), ts))
+				}
+				if !hasInf {
+					// the +Inf bucket is implicit in the exposition format
+					req.Timeseries = append(req.Timeseries, series(name+"_bucket", withLabel(base, "le", "+Inf"), float64(h.GetSampleCount()), ts))
+				}
+				req.Timeseries = append(req.Timeseries,
+					series(name+"_sum", base, h.GetSampleSum(), ts),
+					series(name+"_count", base, float64(h.GetSampleCount()), ts))
+			}
+		}
+	}
+	return req, nil
+}
+
+// labels returns the metric labels together with the external labels that the metric does not already define.
+func (w *Writer) labels(pairs []*dto.LabelPair) []prompb.Label {
+	labels := make([]prompb.Label, 0, len(pairs)+len(w.cfg.ExternalLabels))
+	defined := make(map[string]bool, len(pairs))
+	for _, p := range pairs {
+		labels = append(labels, prompb.Label{Name: p.GetName(), Value: p.GetValue()})
+		defined[p.GetName()] = true
+	}
+	for name, value := range w.cfg.ExternalLabels {
+		if !defined[name] {
+			labels = append(labels, prompb.Label{Name: name, Value: value})
+		}
+	}
+	return labels
+}
+
+func withLabel(labels []prompb.Label, name, value string) []prompb.Label {
+	l := make([]prompb.Label, len(labels), len(labels)+1)
+	copy(l, labels)
+	return append(l, prompb.Label{Name: name, Value: value})
+}
+
+// series builds a single sample time series, the labels are sorted by name as required by remote-write.
+func series(name string, labels []prompb.Label, value float64, ts int64) prompb.TimeSeries {
+	l := make([]prompb.Label, 0, len(labels)+1)
+	l = append(l, prompb.Label{Name: "__name__", Value: name})
+	l = append(l, labels...)
+	sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return prompb.TimeSeries{
+		Labels:  l,
+		Samples: []prompb.Sample{{Value: value, Timestamp: ts}},
+	}
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
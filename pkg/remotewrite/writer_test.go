@@ -0,0 +1,196 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+// endpoint is a remote-write receiver which fails with status while it is set.
+type endpoint struct {
+	mx       sync.Mutex
+	status   int
+	requests []*prompb.WriteRequest
+	headers  []http.Header
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	if e.status != 0 {
+		w.WriteHeader(e.status)
+		return
+	}
+	compressed, err := io.ReadAll(r.Body)
+	Expect(err).NotTo(HaveOccurred())
+	data, err := snappy.Decode(nil, compressed)
+	Expect(err).NotTo(HaveOccurred())
+	req := &prompb.WriteRequest{}
+	Expect(req.Unmarshal(data)).To(Succeed())
+	e.requests = append(e.requests, req)
+	e.headers = append(e.headers, r.Header)
+}
+
+func (e *endpoint) setStatus(status int) {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	e.status = status
+}
+
+func labelMap(labels []prompb.Label) map[string]string {
+	m := map[string]string{}
+	for _, l := range labels {
+		m[l.Name] = l.Value
+	}
+	return m
+}
+
+var _ = Describe("Test remote-write push mode", func() {
+	var (
+		ep      *endpoint
+		srv     *httptest.Server
+		writer  *Writer
+		counter *prometheus.CounterVec
+	)
+
+	BeforeEach(func() {
+		ep = &endpoint{}
+		srv = httptest.NewServer(ep)
+		reg := prometheus.NewRegistry()
+		counter = prometheus.NewCounterVec(prometheus.CounterOpts{Name: "kepler_node_package_joules_total"}, []string{"instance"})
+		reg.MustRegister(counter)
+		counter.WithLabelValues("node1").Add(42)
+		reg.MustRegister(prometheus.NewHistogram(prometheus.HistogramOpts{Name: "kepler_test_seconds", Buckets: []float64{1}}))
+
+		var err error
+		writer, err = NewWriter(&config.RemoteWriteConfig{
+			URL:            srv.URL,
+			Headers:        map[string]string{"X-Scope-OrgID": "edge"},
+			ExternalLabels: map[string]string{"cluster": "edge-1", "instance": "ignored"},
+			IntervalSec:    30,
+			TimeoutSec:     5,
+			WALDir:         GinkgoT().TempDir(),
+		}, reg)
+		Expect(err).NotTo(HaveOccurred())
+		writer.after = func(time.Duration) <-chan time.Time {
+			c := make(chan time.Time, 1)
+			c <- time.Now()
+			return c
+		}
+	})
+
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("pushes the gathered metrics with the external labels", func() {
+		Expect(writer.Push(context.Background())).To(Succeed())
+		Expect(ep.requests).To(HaveLen(1))
+		Expect(ep.headers[0].Get("Content-Encoding")).To(Equal("snappy"))
+		Expect(ep.headers[0].Get("X-Scope-OrgID")).To(Equal("edge"))
+
+		series := map[string]prompb.TimeSeries{}
+		for _, ts := range ep.requests[0].Timeseries {
+			labels := labelMap(ts.Labels)
+			series[labels["__name__"]+labels["le"]] = ts
+		}
+		counterSeries := series["kepler_node_package_joules_total"]
+		Expect(labelMap(counterSeries.Labels)).To(Equal(map[string]string{
+			"__name__": "kepler_node_package_joules_total",
+			"cluster":  "edge-1",
+			// the metric labels take precedence over the external labels
+			"instance": "node1",
+		}))
+		Expect(counterSeries.Samples).To(HaveLen(1))
+		Expect(counterSeries.Samples[0].Value).To(Equal(42.0))
+		Expect(series).To(HaveKey("kepler_test_seconds_bucket1"))
+		Expect(series).To(HaveKey("kepler_test_seconds_bucket+Inf"))
+		Expect(series).To(HaveKey("kepler_test_seconds_count"))
+	})
+
+	It("buffers the requests during an outage and sends them in order", func() {
+		ep.setStatus(http.StatusServiceUnavailable)
+		Expect(writer.Push(context.Background())).NotTo(Succeed())
+		counter.WithLabelValues("node1").Add(8)
+		Expect(writer.Push(context.Background())).NotTo(Succeed())
+		segments, err := writer.wal.segments()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(HaveLen(2))
+
+		ep.setStatus(0)
+		Expect(writer.Push(context.Background())).To(Succeed())
+		Expect(ep.requests).To(HaveLen(3))
+		values := []float64{}
+		for _, req := range ep.requests {
+			for _, ts := range req.Timeseries {
+				if labelMap(ts.Labels)["__name__"] == "kepler_node_package_joules_total" {
+					values = append(values, ts.Samples[0].Value)
+				}
+			}
+		}
+		Expect(values).To(Equal([]float64{42, 50, 50}))
+		segments, err = writer.wal.segments()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(BeEmpty())
+	})
+
+	It("stops waiting to retry when the push is cancelled", func() {
+		ep.setStatus(http.StatusServiceUnavailable)
+		writer.after = func(time.Duration) <-chan time.Time { return nil }
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- writer.Push(ctx) }()
+		cancel()
+		var err error
+		Eventually(done).Should(Receive(&err))
+		Expect(err).To(MatchError(ContainSubstring(context.Canceled.Error())))
+		segments, err := writer.wal.segments()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(HaveLen(1))
+	})
+
+	It("drops requests rejected by the endpoint", func() {
+		ep.setStatus(http.StatusBadRequest)
+		Expect(writer.Push(context.Background())).To(Succeed())
+		segments, err := writer.wal.segments()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(BeEmpty())
+	})
+
+	It("bounds the size of the WAL", func() {
+		writer.wal.maxSize = 1
+		ep.setStatus(http.StatusServiceUnavailable)
+		for i := 0; i < 3; i++ {
+			Expect(writer.Push(context.Background())).NotTo(Succeed())
+		}
+		segments, err := writer.wal.segments()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(segments).To(HaveLen(1))
+	})
+})
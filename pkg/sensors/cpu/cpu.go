@@ -0,0 +1,117 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform/source"
+	"k8s.io/klog/v2"
+)
+
+// sysfsCPUPath is the sysfs directory of the CPUs, it is overridden in tests
+var sysfsCPUPath = "/sys/devices/system/cpu"
+
+var (
+	baseFrequency     uint64
+	baseFrequencyOnce sync.Once
+)
+
+// BaseFrequency returns the base frequency in MHz of the CPUs, which MPERF counts at, or 0 if it is unknown. It is
+// read from the base_frequency of intel_pstate, otherwise from the nominal frequency of ACPI CPPC. The maximum
+// frequency of cpufreq is not used since it is the boost frequency with most drivers.
+func BaseFrequency() uint64 {
+	baseFrequencyOnce.Do(func() {
+		if freq, err := readUint(filepath.Join(sysfsCPUPath, "cpu0", "cpufreq", "base_frequency")); err == nil && freq > 0 {
+			baseFrequency = freq / 1000 // convert kHz to MHz
+			return
+		}
+		if freq, err := readUint(filepath.Join(sysfsCPUPath, "cpu0", "acpi_cppc", "nominal_freq")); err == nil && freq > 0 {
+			baseFrequency = freq // already in MHz
+			return
+		}
+		klog.V(1).Infoln("could not read the base frequency of the CPUs, the effective frequency is not computed")
+	})
+	return baseFrequency
+}
+
+// EffectiveFrequency returns the average frequency in MHz the CPUs ran at while they counted the APERF and MPERF
+// cycles, or 0 if MPERF did not count or the base frequency is unknown
+func EffectiveFrequency(aperf, mperf uint64) uint64 {
+	if mperf == 0 {
+		return 0
+	}
+	return uint64(float64(BaseFrequency()) * float64(aperf) / float64(mperf))
+}
+
+// ScalingFrequency returns the average frequency in MHz cpufreq set the CPUs to, or 0 if cpufreq is not available.
+// It is the frequency requested by the governor, which the CPUs may not run at.
+func ScalingFrequency() uint64 {
+	if _, err := os.Stat(filepath.Join(sysfsCPUPath, "cpufreq")); err != nil {
+		return 0
+	}
+	frequencies := (&source.ACPI{}).GetCPUCoreFrequency()
+	var sum, n uint64
+	for _, freq := range frequencies {
+		if freq > 0 {
+			sum += freq
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / n / 1000 // convert kHz to MHz
+}
+
+// IdleStateTimes returns the time in µs the CPUs spent in each cpuidle state since boot, summed over the CPUs and
+// keyed by the name of the state in lowercase
+func IdleStateTimes() (map[string]uint64, error) {
+	states, err := filepath.Glob(filepath.Join(sysfsCPUPath, "cpu[0-9]*", "cpuidle", "state[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("no cpuidle state in %s", sysfsCPUPath)
+	}
+	times := map[string]uint64{}
+	for _, state := range states {
+		name, err := os.ReadFile(filepath.Join(state, "name"))
+		if err != nil {
+			return nil, err
+		}
+		usec, err := readUint(filepath.Join(state, "time"))
+		if err != nil {
+			return nil, err
+		}
+		times[strings.ToLower(strings.TrimSpace(string(name)))] += usec
+	}
+	return times, nil
+}
+
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func writeSysfs(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func useSysfs(t *testing.T) string {
+	t.Helper()
+	origPath := sysfsCPUPath
+	sysfsCPUPath = t.TempDir()
+	baseFrequency, baseFrequencyOnce = 0, sync.Once{}
+	t.Cleanup(func() {
+		sysfsCPUPath = origPath
+		baseFrequency, baseFrequencyOnce = 0, sync.Once{}
+	})
+	return sysfsCPUPath
+}
+
+func TestIdleStateTimes(t *testing.T) {
+	path := useSysfs(t)
+	for _, cpu := range []string{"cpu0", "cpu1"} {
+		writeSysfs(t, filepath.Join(path, cpu, "cpuidle", "state0", "name"), "POLL")
+		writeSysfs(t, filepath.Join(path, cpu, "cpuidle", "state0", "time"), "10")
+		writeSysfs(t, filepath.Join(path, cpu, "cpuidle", "state1", "name"), "C6")
+		writeSysfs(t, filepath.Join(path, cpu, "cpuidle", "state1", "time"), "1000")
+	}
+	// not a CPU
+	writeSysfs(t, filepath.Join(path, "cpuidle", "current_driver"), "intel_idle")
+
+	times, err := IdleStateTimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 2 || times["poll"] != 20 || times["c6"] != 2000 {
+		t.Errorf("unexpected idle state times %v", times)
+	}
+}
+
+func TestIdleStateTimesWithoutCPUIdle(t *testing.T) {
+	useSysfs(t)
+	if _, err := IdleStateTimes(); err == nil {
+		t.Error("expected an error without cpuidle states")
+	}
+}
+
+func TestEffectiveFrequency(t *testing.T) {
+	path := useSysfs(t)
+	writeSysfs(t, filepath.Join(path, "cpu0", "cpufreq", "cpuinfo_max_freq"), "3500000")
+	writeSysfs(t, filepath.Join(path, "cpu0", "cpufreq", "base_frequency"), "2000000")
+
+	if freq := EffectiveFrequency(150, 100); freq != 3000 {
+		t.Errorf("expected 3000 MHz, got %d", freq)
+	}
+	if freq := EffectiveFrequency(150, 0); freq != 0 {
+		t.Errorf("expected no frequency without MPERF, got %d", freq)
+	}
+}
+
+func TestBaseFrequency(t *testing.T) {
+	path := useSysfs(t)
+	writeSysfs(t, filepath.Join(path, "cpu0", "acpi_cppc", "nominal_freq"), "2450")
+	if freq := BaseFrequency(); freq != 2450 {
+		t.Errorf("expected the nominal frequency 2450 MHz, got %d", freq)
+	}
+}
+
+func TestBaseFrequencyWithoutReference(t *testing.T) {
+	path := useSysfs(t)
+	// the maximum frequency is the boost frequency, it does not tell the frequency MPERF counts at
+	writeSysfs(t, filepath.Join(path, "cpu0", "cpufreq", "cpuinfo_max_freq"), "3500000")
+	if freq := BaseFrequency(); freq != 0 {
+		t.Errorf("expected an unknown base frequency, got %d", freq)
+	}
+	if freq := EffectiveFrequency(150, 100); freq != 0 {
+		t.Errorf("expected no effective frequency, got %d", freq)
+	}
+}
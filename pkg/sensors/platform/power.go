@@ -21,6 +21,7 @@ import (
 	"runtime"
 
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/health"
 	"github.com/sustainable-computing-io/kepler/pkg/sensors/platform/source"
 	"k8s.io/klog/v2"
 )
@@ -72,6 +73,7 @@ func InitPowerImpl() {
 		powerImpl = &source.PowerHMC{}
 	} else if redfish := source.NewRedfishClient(); redfish != nil && redfish.IsSystemCollectionSupported() {
 		powerImpl = redfish
+		health.GetRegistry().Register("redfish", redfish.HealthCheck)
 	} else if acpi := source.NewACPIPowerMeter(config.GetMockACPIPowerPath()); acpi != nil && acpi.CollectEnergy {
 		powerImpl = acpi
 	}
@@ -122,6 +122,8 @@ func (a *ACPI) GetCPUCoreFrequency() map[int32]uint64 {
 			path := fmt.Sprintf(freqPath, i)
 			data, err := os.ReadFile(path)
 			if err != nil {
+				// the policies may not be numbered contiguously
+				ch <- []uint64{i, 0}
 				return
 			}
 			if freq, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil {
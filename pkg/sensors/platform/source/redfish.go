@@ -157,8 +157,11 @@ type RedFishClient struct {
 	accessInfo    RedfishAccessInfo
 	systems       []*RedfishSystemPowerResult
 	ticker        *time.Ticker
+	stop          chan struct{}
 	probeInterval time.Duration
 	mutex         sync.Mutex
+	// lastErr is the error of the last power query, nil if it succeeded
+	lastErr error
 }
 
 func NewRedfishClient() *RedFishClient {
@@ -250,10 +253,15 @@ func (rf *RedFishClient) IsSystemCollectionSupported() bool {
 	// set a timer to check the power info every probeInterval seconds
 	if rf.ticker == nil {
 		rf.ticker = time.NewTicker(rf.probeInterval)
+		rf.stop = make(chan struct{})
 	}
-	go func() {
+	go func(ticker *time.Ticker, stop <-chan struct{}) {
 		for {
-			<-rf.ticker.C
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
 			for _, system := range rf.systems {
 				power, err := getRedfishPower(rf.accessInfo, system.chassis)
 				if err == nil && len(power.PowerControl) > 0 {
@@ -261,13 +269,20 @@ func (rf *RedFishClient) IsSystemCollectionSupported() bool {
 					rf.mutex.Lock()
 					klog.V(5).Infof("power info: %+v\n", power)
 					system.consumedWatts = power.PowerControl[0].PowerConsumedWatts
+					rf.lastErr = nil
 					rf.mutex.Unlock()
 				} else {
 					klog.V(5).Infof("failed to get power info: %v\n", err)
+					if err == nil {
+						err = fmt.Errorf("no power control reported for chassis %s", system.chassis)
+					}
+					rf.mutex.Lock()
+					rf.lastErr = err
+					rf.mutex.Unlock()
 				}
 			}
 		}
-	}()
+	}(rf.ticker, rf.stop)
 	return len(rf.systems) > 0
 }
 
@@ -290,9 +305,23 @@ func (rf *RedFishClient) GetAbsEnergyFromPlatform() (map[string]float64, error)
 	return nil, nil
 }
 
-// StopPower stops the power collection timer
+// HealthCheck returns the error of the last power query to the BMC
+func (rf *RedFishClient) HealthCheck() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	if rf.lastErr != nil {
+		return fmt.Errorf("failed to query the BMC: %w", rf.lastErr)
+	}
+	return nil
+}
+
+// StopPower stops the power collection timer and its goroutine
 func (rf *RedFishClient) StopPower() {
 	if rf != nil && rf.ticker != nil {
 		rf.ticker.Stop()
+		if rf.stop != nil {
+			close(rf.stop)
+			rf.stop = nil
+		}
 	}
 }
@@ -65,6 +65,9 @@ const (
 	KernelProcessNamespace string = "kernel"
 	SystemProcessName      string = "system_processes"
 	SystemProcessNamespace string = "system"
+	ExitedProcessName      string = "exited_processes"
+	BlockIOProcessName     string = "block_io"
+	CgroupProcessName      string = "cgroup"
 	EmptyString            string = ""
 	GenericSocketID        string = "socket0"
 	GenericGPUID           string = "gpu"
@@ -96,3 +99,9 @@ func IsFileExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
 }
+
+// SocketID returns the id the resource utilization of a process on the given socket is stored with,
+// the one of the first socket is GenericSocketID
+func SocketID(socket int) string {
+	return fmt.Sprintf("socket%d", socket)
+}
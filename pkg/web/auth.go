@@ -0,0 +1,101 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is the bcrypt hash the password of an unknown user is compared against, so that the unknown users take
+// as long to reject as the wrong passwords and cannot be told apart by timing.
+var dummyHash = []byte("$2a$10$icedljbKwDqU37TrpqssX.DB3.N7xCPrc882Qr7xqEPj/oAkM5ING")
+
+func validateHash(hash string) error {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err
+}
+
+// basicAuth checks the credentials of every request against the bcrypt hashes of the config.
+// Comparing bcrypt hashes is slow by design, so successful logins are cached to keep scrapes cheap.
+type basicAuth struct {
+	users map[string]string
+	next  http.Handler
+	// public are the paths served without credentials
+	public map[string]bool
+
+	mx    sync.Mutex
+	valid map[[sha256.Size]byte]bool
+}
+
+func (a *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.public[r.URL.Path] {
+		a.next.ServeHTTP(w, r)
+		return
+	}
+	user, pass, ok := r.BasicAuth()
+	if ok && a.authenticate(user, pass) {
+		a.next.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", "Basic")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+func (a *basicAuth) authenticate(user, pass string) bool {
+	hash, ok := a.users[user]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(pass))
+		return false
+	}
+	key := sha256.Sum256([]byte(user + ":" + hash + ":" + pass))
+	a.mx.Lock()
+	cached := a.valid[key]
+	a.mx.Unlock()
+	if cached {
+		return true
+	}
+	// the comparison is not locked, so that the wrong passwords do not delay the other requests
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+	a.mx.Lock()
+	a.valid[key] = true
+	a.mx.Unlock()
+	return true
+}
+
+// Handler wraps next with the basic authentication of the config, if any users are configured.
+// The public paths, such as the health probes whose clients do not send credentials, are served without authentication.
+func (c *Config) Handler(next http.Handler, public ...string) http.Handler {
+	if len(c.BasicAuthUsers) == 0 {
+		return next
+	}
+	a := &basicAuth{
+		users:  c.BasicAuthUsers,
+		next:   next,
+		public: map[string]bool{},
+		valid:  map[[sha256.Size]byte]bool{},
+	}
+	for _, path := range public {
+		a.public[path] = true
+	}
+	return a
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package web implements the Prometheus exporter web configuration file
+// (--web.config.file): TLS, mutual TLS and basic authentication for the exporter endpoints.
+package web
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TLSConfig is the tls_server_config section of the web config file.
+type TLSConfig struct {
+	CertFile         string        `yaml:"cert_file"`
+	KeyFile          string        `yaml:"key_file"`
+	ClientAuth       string        `yaml:"client_auth_type"`
+	ClientCAFile     string        `yaml:"client_ca_file"`
+	MinVersion       TLSVersion    `yaml:"min_version"`
+	MaxVersion       TLSVersion    `yaml:"max_version"`
+	CipherSuites     []CipherSuite `yaml:"cipher_suites"`
+	CurvePreferences []Curve       `yaml:"curve_preferences"`
+}
+
+// Config is the web config file.
+type Config struct {
+	TLSConfig      TLSConfig         `yaml:"tls_server_config"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+}
+
+// TLSVersion is a TLS version given by its name, e.g. TLS12.
+type TLSVersion uint16
+
+var tlsVersions = map[string]TLSVersion{
+	"TLS13": tls.VersionTLS13,
+	"TLS12": tls.VersionTLS12,
+	"TLS11": tls.VersionTLS11,
+	"TLS10": tls.VersionTLS10,
+}
+
+func (v *TLSVersion) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	version, ok := tlsVersions[s]
+	if !ok {
+		return fmt.Errorf("line %d: unknown TLS version %q", node.Line, s)
+	}
+	*v = version
+	return nil
+}
+
+// CipherSuite is a TLS cipher suite given by its Go name, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+type CipherSuite uint16
+
+func (c *CipherSuite) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == s {
+			*c = CipherSuite(suite.ID)
+			return nil
+		}
+	}
+	return fmt.Errorf("line %d: unknown or insecure cipher suite %q", node.Line, s)
+}
+
+// Curve is an elliptic curve given by its name, e.g. X25519.
+type Curve tls.CurveID
+
+var curves = map[string]Curve{
+	"CurveP256": Curve(tls.CurveP256),
+	"CurveP384": Curve(tls.CurveP384),
+	"CurveP521": Curve(tls.CurveP521),
+	"X25519":    Curve(tls.X25519),
+}
+
+func (c *Curve) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	curve, ok := curves[s]
+	if !ok {
+		return fmt.Errorf("line %d: unknown curve %q", node.Line, s)
+	}
+	*c = curve
+	return nil
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// LoadConfig reads and validates the web config file. Relative file paths in the config
+// are resolved against the directory of the config file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web config file %s: %w", path, err)
+	}
+	c, err := parseConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse web config file %s: %w", path, err)
+	}
+	c.setDirectory(filepath.Dir(path))
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid web config file %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func parseConfig(r io.Reader) (*Config, error) {
+	c := &Config{}
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) setDirectory(dir string) {
+	for _, f := range []*string{&c.TLSConfig.CertFile, &c.TLSConfig.KeyFile, &c.TLSConfig.ClientCAFile} {
+		if *f != "" && !filepath.IsAbs(*f) {
+			*f = filepath.Join(dir, *f)
+		}
+	}
+}
+
+func (c *Config) validate() error {
+	t := &c.TLSConfig
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if _, ok := clientAuthTypes[t.ClientAuth]; !ok {
+		return fmt.Errorf("unknown client_auth_type %q", t.ClientAuth)
+	}
+	if !c.TLSEnabled() && (t.ClientAuth != "" || t.ClientCAFile != "") {
+		return fmt.Errorf("client authentication requires cert_file and key_file")
+	}
+	if t.ClientCAFile != "" && t.ClientAuth == "" {
+		// same default as the Prometheus exporter toolkit
+		t.ClientAuth = "RequireAndVerifyClientCert"
+	}
+	if t.ClientCAFile == "" && (t.ClientAuth == "VerifyClientCertIfGiven" || t.ClientAuth == "RequireAndVerifyClientCert") {
+		return fmt.Errorf("client_auth_type %s requires client_ca_file", t.ClientAuth)
+	}
+	if t.MinVersion != 0 && t.MaxVersion != 0 && t.MinVersion > t.MaxVersion {
+		return fmt.Errorf("min_version must not be greater than max_version")
+	}
+	for user, hash := range c.BasicAuthUsers {
+		if err := validateHash(hash); err != nil {
+			return fmt.Errorf("invalid password hash for basic auth user %q: %w", user, err)
+		}
+	}
+	if c.TLSEnabled() {
+		// fail at startup rather than on the first handshake
+		if _, err := c.NewTLSConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TLSEnabled returns true if the exporter should serve TLS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSConfig.CertFile != "" && c.TLSConfig.KeyFile != ""
+}
+
+// NewTLSConfig builds the server TLS configuration. The server certificate is re-read
+// whenever the certificate or key files change, so rotated certificates are used without a restart.
+func (c *Config) NewTLSConfig() (*tls.Config, error) {
+	t := &c.TLSConfig
+	reloader, err := newCertReloader(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		ClientAuth:     clientAuthTypes[t.ClientAuth],
+		GetCertificate: reloader.getCertificate,
+	}
+	if t.MinVersion != 0 {
+		cfg.MinVersion = uint16(t.MinVersion)
+	}
+	if t.MaxVersion != 0 {
+		cfg.MaxVersion = uint16(t.MaxVersion)
+	}
+	for _, suite := range t.CipherSuites {
+		cfg.CipherSuites = append(cfg.CipherSuites, uint16(suite))
+	}
+	for _, curve := range t.CurvePreferences {
+		cfg.CurvePreferences = append(cfg.CurvePreferences, tls.CurveID(curve))
+	}
+	if t.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client_ca_file %s", t.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	}
+	return cfg, nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCert writes a self-signed certificate and its key to dir and returns their paths.
+func writeCert(dir, name string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)).To(Succeed())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)).To(Succeed())
+	return certFile, keyFile
+}
+
+func writeConfig(dir, content string) string {
+	path := filepath.Join(dir, "web.yaml")
+	Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	return path
+}
+
+var _ = Describe("Test web config", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeCert(dir, "server")
+		writeCert(dir, "ca")
+	})
+
+	It("parses the TLS settings with paths relative to the config file", func() {
+		c, err := LoadConfig(writeConfig(dir, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  client_ca_file: ca.crt
+  min_version: TLS12
+  max_version: TLS13
+  cipher_suites:
+    - TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+  curve_preferences:
+    - X25519
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.TLSEnabled()).To(BeTrue())
+		Expect(c.TLSConfig.CertFile).To(Equal(filepath.Join(dir, "server.crt")))
+
+		cfg, err := c.NewTLSConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+		Expect(cfg.MaxVersion).To(Equal(uint16(tls.VersionTLS13)))
+		Expect(cfg.CipherSuites).To(Equal([]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}))
+		Expect(cfg.CurvePreferences).To(Equal([]tls.CurveID{tls.X25519}))
+		// a client CA without an explicit mode requires verified client certificates
+		Expect(cfg.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+		Expect(cfg.ClientCAs).NotTo(BeNil())
+	})
+
+	It("rejects invalid files", func() {
+		for _, content := range []string{
+			"tls_server_config:\n  cert_file: server.crt\n  certfile: server.key\n",
+			"tls_server_config:\n  cert_file: server.crt\n",
+			"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  min_version: SSL3\n",
+			"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  min_version: TLS13\n  max_version: TLS12\n",
+			"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  cipher_suites: [TLS_RSA_WITH_RC4_128_SHA]\n",
+			"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_auth_type: RequireAndVerifyClientCert\n",
+			"tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_auth_type: Always\n",
+			"tls_server_config:\n  cert_file: missing.crt\n  key_file: server.key\n",
+			"tls_server_config:\n  client_ca_file: ca.crt\n",
+			"basic_auth_users:\n  admin: plaintext\n",
+		} {
+			_, err := LoadConfig(writeConfig(dir, content))
+			Expect(err).To(HaveOccurred(), content)
+		}
+		_, err := LoadConfig(filepath.Join(dir, "missing.yaml"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reloads the certificate when it changes on disk", func() {
+		c, err := LoadConfig(writeConfig(dir, "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n"))
+		Expect(err).NotTo(HaveOccurred())
+		cfg, err := c.NewTLSConfig()
+		Expect(err).NotTo(HaveOccurred())
+		before, err := cfg.GetCertificate(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		certFile, keyFile := writeCert(dir, "server")
+		future := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(certFile, future, future)).To(Succeed())
+		Expect(os.Chtimes(keyFile, future, future)).To(Succeed())
+		after, err := cfg.GetCertificate(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after.Certificate[0]).NotTo(Equal(before.Certificate[0]))
+
+		// a broken file keeps the current certificate
+		Expect(os.WriteFile(keyFile, []byte("broken"), 0o600)).To(Succeed())
+		Expect(os.Chtimes(keyFile, future.Add(time.Minute), future.Add(time.Minute))).To(Succeed())
+		current, err := cfg.GetCertificate(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).To(Equal(after))
+	})
+
+	It("requires basic auth credentials", func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		Expect(err).NotTo(HaveOccurred())
+		c, err := LoadConfig(writeConfig(dir, "basic_auth_users:\n  prometheus: "+string(hash)+"\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.TLSEnabled()).To(BeFalse())
+		handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "/healthz")
+		// an unknown user is compared against a valid hash, like a wrong password
+		Expect(validateHash(string(dummyHash))).To(Succeed())
+
+		for _, tc := range []struct {
+			user, pass string
+			code       int
+		}{
+			{"", "", http.StatusUnauthorized},
+			{"prometheus", "wrong", http.StatusUnauthorized},
+			{"admin", "secret", http.StatusUnauthorized},
+			{"prometheus", "secret", http.StatusOK},
+			{"prometheus", "secret", http.StatusOK},
+		} {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tc.user != "" {
+				req.SetBasicAuth(tc.user, tc.pass)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(tc.code), tc.user+":"+tc.pass)
+		}
+
+		// the public paths are served without credentials
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz/", nil))
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+	})
+})